@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"authservice/src/config"
+	"authservice/src/services"
+	"fmt"
+	"strings"
+)
+
+// checkConfig runs once the configuration has loaded, so the peppers and
+// audit keys have already been read and validated. It goes on to check what
+// loading does not.
+func checkConfig(serviceCfg *config.ServiceConfig, args []string) int {
+	problems := 0
+	report := func(ok bool, format string, a ...interface{}) {
+		status := "ok  "
+		if !ok {
+			status = "FAIL"
+			problems++
+		}
+		fmt.Printf("[%s] %s\n", status, fmt.Sprintf(format, a...))
+	}
+
+	report(serviceCfg.Port > 0, "service port %d", serviceCfg.Port)
+	report(len(serviceCfg.ClientSecret) >= 32, "token signing secret is at least 32 characters")
+
+	sqlDB, err := serviceCfg.Db.DB()
+	if err == nil {
+		err = sqlDB.Ping()
+	}
+	report(err == nil, "database connection %s", errorText(err))
+
+	if err == nil {
+		statuses, err := config.InitDatabaseMigration(serviceCfg.Db).Status()
+		pending, modified := 0, 0
+		for _, status := range statuses {
+			if !status.Applied {
+				pending++
+			}
+			if status.Modified {
+				modified++
+			}
+		}
+		report(err == nil && modified == 0, "migrations: %d pending, %d modified since applied %s", pending, modified, errorText(err))
+	}
+
+	currentPepper := serviceCfg.Peppers.CurrentId()
+	if len(currentPepper) == 0 {
+		fmt.Println("[warn] no pepper configured, passwords are hashed without one")
+	} else {
+		report(true, "current pepper %q loaded", currentPepper)
+	}
+
+	if serviceCfg.AuditSigningKey == nil {
+		fmt.Println("[warn] no audit checkpoint key configured, checkpoints are disabled")
+	} else {
+		report(true, "audit checkpoint key loaded, %d keys to verify with", len(serviceCfg.AuditVerifyKeys))
+	}
+
+	if serviceCfg.ScimToken == nil {
+		fmt.Println("[info] no SCIM token configured, SCIM provisioning is disabled")
+	} else {
+		report(true, "SCIM token loaded, SCIM served at %s", serviceCfg.ScimBaseUrl)
+	}
+
+	report(true, "authenticators: %s", strings.Join(serviceCfg.Authenticators, ", "))
+	if serviceCfg.Ldap != nil {
+		err := services.InitLdapAuthenticator(serviceCfg).CheckConnection()
+		report(err == nil, "LDAP connection to %s %s", serviceCfg.Ldap.Url, errorText(err))
+	}
+
+	if serviceCfg.Federation != nil {
+		for _, provider := range serviceCfg.Federation.Providers {
+			report(true, "identity provider %s (%s), callback %s/auth/%s/callback",
+				provider.Name, provider.Type, serviceCfg.Federation.CallbackBaseUrl, provider.Name)
+			if provider.Type == config.FederatedProviderSaml {
+				fmt.Printf("[info] SAML entity id %s, metadata at %s/auth/%s/metadata\n",
+					provider.EntityId, serviceCfg.Federation.CallbackBaseUrl, provider.Name)
+			}
+		}
+	}
+
+	if serviceCfg.Smtp == nil {
+		fmt.Println("[info] no SMTP server configured, email is disabled")
+	} else {
+		report(true, "SMTP server %s:%d, sending from %s", serviceCfg.Smtp.Host, serviceCfg.Smtp.Port, serviceCfg.Smtp.From)
+	}
+
+	if serviceCfg.MagicLink != nil {
+		report(true, "magic links open %s and expire after %s", serviceCfg.MagicLink.LinkUrl, serviceCfg.MagicLink.Ttl)
+	}
+
+	if serviceCfg.ApiKeyMaxLifetime > 0 {
+		report(true, "API keys expire after at most %d days", int(serviceCfg.ApiKeyMaxLifetime.Hours()/24))
+	} else {
+		fmt.Println("[info] API keys can be issued without an expiry")
+	}
+
+	report(serviceCfg.WebhookMaxAttempts > 0, "webhook max attempts %d", serviceCfg.WebhookMaxAttempts)
+
+	if problems > 0 {
+		fmt.Printf("%d problems found\n", problems)
+		return 1
+	}
+
+	fmt.Println("configuration is valid")
+	return 0
+}
+
+func errorText(err error) string {
+	if err != nil {
+		return fmt.Sprintf("(%v)", err)
+	}
+
+	return ""
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"authservice/src/config"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// migrate runs migrate up, migrate down [steps] or migrate status.
+func migrate(serviceCfg *config.ServiceConfig, args []string) int {
+	dbMigration := config.InitDatabaseMigration(serviceCfg.Db)
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := dbMigration.Up()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error applying migrations: %v\n", err)
+			return 1
+		}
+		fmt.Printf("applied %d migrations\n", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "the number of migrations to roll back must be a positive number")
+				return 2
+			}
+			steps = n
+		}
+
+		rolledBack, err := dbMigration.Down(steps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error rolling back migrations: %v\n", err)
+			return 1
+		}
+		fmt.Printf("rolled back %d migrations\n", rolledBack)
+	case "status":
+		statuses, err := dbMigration.Status()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading migration status: %v\n", err)
+			return 1
+		}
+
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			if status.Modified {
+				state += " (modified since applied)"
+			}
+			fmt.Printf("%04d %-30s %s\n", status.Version, status.Name, state)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "usage: authservice migrate [up | down [steps] | status]")
+		return 2
+	}
+
+	return 0
+}
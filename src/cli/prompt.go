@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// readPassword prompts without echo on a terminal and otherwise reads the
+// first line of stdin, so passwords can be piped in from a secret store.
+func readPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, prompt)
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return "", fmt.Errorf("no password supplied on stdin")
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
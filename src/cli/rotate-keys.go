@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"authservice/src/config"
+	"authservice/src/services"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// rotateKeys generates replacement key material. It never edits the
+// configuration itself; it prints the steps to complete the rotation.
+func rotateKeys(serviceCfg *config.ServiceConfig, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: authservice rotate-keys <pepper | audit | client-secret> [-out file]")
+		return 2
+	}
+
+	kind := args[0]
+	flags := newFlagSet("rotate-keys " + kind)
+	out := flags.String("out", "", "write the new secret to this file instead of printing it")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	switch kind {
+	case "pepper":
+		return rotatePepper(serviceCfg, *out)
+	case "audit":
+		return rotateAuditKey(serviceCfg, *out)
+	case "client-secret":
+		return rotateClientSecret(*out)
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown key %q, expected pepper, audit or client-secret\n", kind)
+	return 2
+}
+
+func rotatePepper(serviceCfg *config.ServiceConfig, out string) int {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		fmt.Fprintf(os.Stderr, "error generating pepper: %v\n", err)
+		return 1
+	}
+
+	if err := writeSecret(out, base64.StdEncoding.EncodeToString(secret)); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing pepper: %v\n", err)
+		return 1
+	}
+
+	counts, err := services.InitUserService(serviceCfg).CountUsersByPepper()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error counting users by pepper: %v\n", err)
+		return 1
+	}
+
+	fmt.Println()
+	fmt.Println("To rotate, add the secret as a new entry under pepper.keys and set")
+	fmt.Println("pepper.current_id to its id. Keep the old keys until no users are left on them;")
+	fmt.Println("each user moves to the current pepper the next time they log in.")
+	fmt.Println()
+	fmt.Printf("current pepper id: %q\n", serviceCfg.Peppers.CurrentId())
+
+	ids := make([]string, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		label := id
+		if len(label) == 0 {
+			label = "(none)"
+		}
+		fmt.Printf("  %-12s %d users\n", label, counts[id])
+	}
+
+	return 0
+}
+
+func rotateAuditKey(serviceCfg *config.ServiceConfig, out string) int {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		fmt.Fprintf(os.Stderr, "error generating audit key: %v\n", err)
+		return 1
+	}
+
+	if err := writeSecret(out, base64.StdEncoding.EncodeToString(seed)); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing audit key: %v\n", err)
+		return 1
+	}
+
+	publicKey := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+
+	fmt.Println()
+	fmt.Println("To rotate, point audit.checkpoint_key at the new seed.")
+	fmt.Printf("new public key: %s\n", base64.StdEncoding.EncodeToString(publicKey))
+
+	if serviceCfg.AuditSigningKey != nil {
+		current := serviceCfg.AuditSigningKey.Public().(ed25519.PublicKey)
+		fmt.Println("Add the current public key to audit.previous_public_keys so existing")
+		fmt.Println("checkpoints still verify:")
+		fmt.Printf("  %s\n", base64.StdEncoding.EncodeToString(current))
+	}
+
+	return 0
+}
+
+// rotateClientSecret generates a new client secret. Unlike the pepper and
+// the audit key, the secret has no list of previous keys still accepted, so
+// everything it signed stops verifying once it is replaced.
+func rotateClientSecret(out string) int {
+	secret := make([]byte, 48)
+	if _, err := rand.Read(secret); err != nil {
+		fmt.Fprintf(os.Stderr, "error generating client secret: %v\n", err)
+		return 1
+	}
+
+	if err := writeSecret(out, base64.RawURLEncoding.EncodeToString(secret)); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing client secret: %v\n", err)
+		return 1
+	}
+
+	fmt.Println()
+	fmt.Println("The client secret cannot be rotated gradually. To replace it, set")
+	fmt.Println("auth_service.client_secret to the new secret on every instance at once.")
+	fmt.Println("From then on:")
+	fmt.Println("  - issued tokens are refused, so every user has to sign in again")
+	fmt.Println("  - magic links already sent no longer work")
+	fmt.Println("  - audit pseudonyms no longer match the ones recorded before")
+
+	return 0
+}
+
+func writeSecret(out, secret string) error {
+	if len(out) == 0 {
+		fmt.Printf("new secret: %s\n", secret)
+		return nil
+	}
+
+	if err := os.WriteFile(out, []byte(secret+"\n"), 0600); err != nil {
+		return err
+	}
+
+	fmt.Printf("new secret written to %s\n", out)
+	return nil
+}
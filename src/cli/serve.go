@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"authservice/src/config"
+	"authservice/src/routes"
+	"authservice/src/services"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+func serve(serviceCfg *config.ServiceConfig, args []string) int {
+	flags := newFlagSet("serve")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	dbMigration := config.InitDatabaseMigration(serviceCfg.Db)
+	if _, err := dbMigration.Up(); err != nil {
+		log.Printf("error performing migration: %v", err)
+		return 1
+	}
+
+	// background jobs
+	services.InitUserPurgeJob(serviceCfg).Start(context.Background())
+	services.InitAuditCheckpointJob(serviceCfg).Start(context.Background())
+	services.InitWebhookDispatcherJob(serviceCfg).Start(context.Background())
+
+	// register routes
+	routes.InitClaimRoutes(serviceCfg).Register()
+	routes.InitUserRoutes(serviceCfg).Register()
+	routes.InitUserAdminRoutes(serviceCfg).Register()
+	routes.InitUserImportRoutes(serviceCfg).Register()
+	routes.InitAuditRoutes(serviceCfg).Register()
+	routes.InitWebhookRoutes(serviceCfg).Register()
+	routes.InitEventRoutes(serviceCfg).Register()
+	routes.InitServiceAccountRoutes(serviceCfg).Register()
+	routes.InitOrganizationRoutes(serviceCfg).Register()
+	routes.InitGroupRoutes(serviceCfg).Register()
+	routes.InitPermissionRoutes(serviceCfg).Register()
+	routes.InitDebugRoutes(serviceCfg).Register()
+
+	if serviceCfg.ScimToken != nil {
+		routes.InitScimRoutes(serviceCfg).Register()
+	} else {
+		log.Printf("SCIM provisioning is disabled as no scim.token is configured")
+	}
+
+	if serviceCfg.Federation != nil {
+		routes.InitFederationRoutes(serviceCfg).Register()
+	}
+
+	if serviceCfg.MagicLink != nil {
+		routes.InitMagicLinkRoutes(serviceCfg).Register()
+	}
+
+	log.Printf("starting service on port: %d\n", serviceCfg.Port)
+
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", serviceCfg.Port), serviceCfg.Mux); err != nil {
+		log.Printf("error starting http server: %v", err)
+		return 1
+	}
+
+	return 0
+}
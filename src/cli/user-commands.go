@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/services"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+func createAdmin(serviceCfg *config.ServiceConfig, args []string) int {
+	flags := newFlagSet("create-admin")
+	username := flags.String("username", "", "username of the new administrator")
+	email := flags.String("email", "", "email address of the new administrator")
+	firstName := flags.String("first-name", "", "first name")
+	surname := flags.String("surname", "", "surname")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if len(*username) == 0 || len(*email) == 0 {
+		fmt.Fprintln(os.Stderr, "-username and -email must be supplied")
+		return 2
+	}
+
+	password, err := readPassword("password: ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	user, err := services.InitUserService(serviceCfg).AddUser(operatorContext("create-admin"), domain.User{
+		Username:     *username,
+		Password:     password,
+		EmailAddress: *email,
+		FirstName:    *firstName,
+		Surname:      *surname,
+	}, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating administrator: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("created administrator %s with user id %d\n", user.Username, user.ID)
+	return 0
+}
+
+func resetPassword(serviceCfg *config.ServiceConfig, args []string) int {
+	flags := newFlagSet("reset-password")
+	username := flags.String("username", "", "user whose password is reset")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if len(*username) == 0 {
+		fmt.Fprintln(os.Stderr, "-username must be supplied")
+		return 2
+	}
+
+	password, err := readPassword("new password: ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	userService := services.InitUserService(serviceCfg)
+	if err := userService.ResetPassword(operatorContext("reset-password"), *username, password, operatorName()); err != nil {
+		fmt.Fprintf(os.Stderr, "error resetting password: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("password reset for %s, existing sessions have been signed out\n", *username)
+	return 0
+}
+
+func grantClaim(serviceCfg *config.ServiceConfig, args []string) int {
+	flags := newFlagSet("grant-claim")
+	username := flags.String("username", "", "user to grant the claim to")
+	claim := flags.String("claim", "", "claim to grant")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if len(*username) == 0 || len(*claim) == 0 {
+		fmt.Fprintln(os.Stderr, "-username and -claim must be supplied")
+		return 2
+	}
+
+	ctx := operatorContext("grant-claim")
+
+	user, err := services.InitUserService(serviceCfg).GetByUsername(ctx, *username)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error finding user %s: %v\n", *username, err)
+		return 1
+	}
+
+	userClaimService := services.InitUserClaimService(serviceCfg)
+	if err := userClaimService.GrantClaim(ctx, user.UserId, *claim); err != nil {
+		fmt.Fprintf(os.Stderr, "error granting claim: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("granted %s to %s\n", *claim, user.Username)
+	return 0
+}
+
+func listUsers(serviceCfg *config.ServiceConfig, args []string) int {
+	flags := newFlagSet("list-users")
+	query := dtos.UserListQueryDto{}
+	flags.StringVar(&query.Search, "q", "", "search usernames, email addresses and names")
+	flags.StringVar(&query.Claim, "claim", "", "only users holding this claim")
+	flags.StringVar(&query.Status, "status", "", "only users with this account status")
+	flags.BoolVar(&query.Deleted, "deleted", false, "list soft-deleted users instead")
+	flags.IntVar(&query.Limit, "limit", 50, "maximum number of users to list")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	userService := services.InitUserService(serviceCfg)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tEMAIL\tSTATUS\tVERIFIED\tCREATED")
+
+	remaining := query.Limit
+	for remaining > 0 {
+		query.Limit = remaining
+		page, err := userService.ListUsers(operatorContext("list-users"), query)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error listing users: %v\n", err)
+			return 1
+		}
+
+		for _, user := range page.Users {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%t\t%s\n",
+				user.UserId, user.Username, user.EmailAddress, user.Status, user.EmailVerified,
+				user.CreatedAt.Format("2006-01-02 15:04"))
+		}
+
+		remaining -= len(page.Users)
+		if len(page.NextCursor) == 0 {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	w.Flush()
+	return 0
+}
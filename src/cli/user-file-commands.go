@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"authservice/src/config"
+	"authservice/src/services"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// maxPrintedImportErrors keeps the report readable for a badly broken file;
+// the totals still count every failed row.
+const maxPrintedImportErrors = 100
+
+func importUsers(serviceCfg *config.ServiceConfig, args []string) int {
+	flags := newFlagSet("import-users")
+	file := flags.String("file", "", "CSV or JSON Lines file to import, - for stdin")
+	format := flags.String("format", "", "csv or jsonl, taken from the file extension when not given")
+	dryRun := flags.Bool("dry-run", false, "validate every row and report the outcome without saving anything")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if len(*file) == 0 {
+		fmt.Fprintln(os.Stderr, "-file must be supplied")
+		return 2
+	}
+
+	if len(*format) == 0 {
+		*format = filepath.Ext(*file)
+	}
+
+	fileFormat, err := services.ParseUserFileFormat(*format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var in io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	importService := services.InitUserImportService(serviceCfg)
+	result, err := importService.ImportUsers(operatorContext("import-users"), in, fileFormat, *dryRun, operatorName())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error importing users: %v\n", err)
+		return 1
+	}
+
+	for i, rowErr := range result.Errors {
+		if i == maxPrintedImportErrors {
+			fmt.Fprintf(os.Stderr, "... and %d more\n", len(result.Errors)-i)
+			break
+		}
+		fmt.Fprintf(os.Stderr, "row %d (%s): %s\n", rowErr.Row, rowErr.Username, rowErr.Error)
+	}
+
+	prefix := ""
+	if result.DryRun {
+		prefix = "dry run, nothing saved: "
+	}
+	fmt.Printf("%s%d rows, %d created, %d updated, %d unchanged, %d failed\n",
+		prefix, result.Rows, result.Created, result.Updated, result.Unchanged, result.Failed)
+
+	if result.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func exportUsers(serviceCfg *config.ServiceConfig, args []string) int {
+	flags := newFlagSet("export-users")
+	format := flags.String("format", "", "csv or jsonl, taken from the -out extension when not given")
+	outFile := flags.String("out", "", "file to write, standard output when not given")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if len(*format) == 0 {
+		*format = services.UserFileFormatJSONL
+		if len(*outFile) > 0 {
+			*format = filepath.Ext(*outFile)
+		}
+	}
+
+	fileFormat, err := services.ParseUserFileFormat(*format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var out io.Writer = os.Stdout
+	if len(*outFile) > 0 {
+		f, err := os.OpenFile(*outFile, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	importService := services.InitUserImportService(serviceCfg)
+	count, err := importService.ExportUsers(operatorContext("export-users"), out, fileFormat, operatorName())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error exporting users: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "exported %d users\n", count)
+	return 0
+}
@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"authservice/src/config"
+	"authservice/src/services"
+	"fmt"
+	"os"
+)
+
+// verifyAudit walks the audit log and reports the first broken link,
+// returning a non-zero exit code if the chain is not intact.
+func verifyAudit(serviceCfg *config.ServiceConfig, args []string) int {
+	result, err := services.InitAuditService(serviceCfg).VerifyChain()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error verifying audit log: %v\n", err)
+		return 2
+	}
+
+	fmt.Printf("checked %d events and %d checkpoints\n", result.EventsChecked, result.CheckpointsChecked)
+
+	if !result.Valid {
+		fmt.Printf("audit log is BROKEN: %s\n", result.Problem)
+		return 1
+	}
+
+	fmt.Println("audit log is intact")
+	return 0
+}
@@ -2,39 +2,413 @@ package config
 
 import (
 	"authservice/src/domain"
+	"authservice/src/migrations"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+const (
+	// held for the whole run so instances starting together take turns
+	migrationLockKey = 734000
+
+	// the baseline creates the append-only audit log, which rolling it back
+	// would destroy
+	baselineVersion = 1
+
+	createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		checksum text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`
+)
+
+var ErrBaselineRollback = errors.New("the baseline migration holds the audit log and cannot be rolled back")
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	Modified  bool
+}
+
+type migration struct {
+	version  int
+	name     string
+	up       string
+	down     string
+	checksum string
+	// upChecksum covers the up file alone, as checksums were first recorded
+	upChecksum string
+}
+
+type appliedMigration struct {
+	version   int
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
 type DatabaseMigration struct {
-	db *gorm.DB
+	db    *gorm.DB
+	files fs.FS
 }
 
 func InitDatabaseMigration(db *gorm.DB) *DatabaseMigration {
 	return &DatabaseMigration{
-		db: db,
+		db:    db,
+		files: migrations.Files,
+	}
+}
+
+// Up applies every pending migration in version order, each in its own
+// transaction. It refuses to run if an applied migration has been edited.
+func (m *DatabaseMigration) Up() (int, error) {
+	count := 0
+
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		available, applied, err := m.load(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if err := m.checkUnmodified(ctx, conn, available, applied); err != nil {
+			return err
+		}
+
+		for _, version := range sortedVersions(available) {
+			if _, ok := applied[version]; ok {
+				continue
+			}
+
+			mig := available[version]
+			err := m.apply(ctx, conn, mig.up,
+				"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+				mig.version, mig.name, mig.checksum)
+			if err != nil {
+				return fmt.Errorf("applying migration %d_%s: %v", mig.version, mig.name, err)
+			}
+			count++
+		}
+
+		return m.backfillAuditChain()
+	})
+
+	return count, err
+}
+
+// Down rolls back the given number of most recently applied migrations. It
+// rolls back nothing if that would take in the baseline.
+func (m *DatabaseMigration) Down(steps int) (int, error) {
+	count := 0
+
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		available, applied, err := m.load(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if err := m.checkUnmodified(ctx, conn, available, applied); err != nil {
+			return err
+		}
+
+		versions := sortedVersions(applied)
+		if len(versions) > 0 && versions[0] <= baselineVersion && steps >= len(versions) {
+			return ErrBaselineRollback
+		}
+
+		for i := len(versions) - 1; i >= 0 && count < steps; i-- {
+			mig, ok := available[versions[i]]
+			if !ok {
+				return fmt.Errorf("migration %d is not known to this build and cannot be rolled back", versions[i])
+			}
+
+			err := m.apply(ctx, conn, mig.down, "DELETE FROM schema_migrations WHERE version = $1", mig.version)
+			if err != nil {
+				return fmt.Errorf("rolling back migration %d_%s: %v", mig.version, mig.name, err)
+			}
+			count++
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// Status lists every known migration along with any applied migration this
+// build does not know about.
+func (m *DatabaseMigration) Status() ([]MigrationStatus, error) {
+	statuses := []MigrationStatus{}
+
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		available, applied, err := m.load(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		versions := sortedVersions(available)
+		for version := range applied {
+			if _, ok := available[version]; !ok {
+				versions = append(versions, version)
+			}
+		}
+		sort.Ints(versions)
+
+		for _, version := range versions {
+			status := MigrationStatus{Version: version}
+
+			mig, known := available[version]
+			if known {
+				status.Name = mig.name
+			}
+
+			if a, ok := applied[version]; ok {
+				appliedAt := a.appliedAt
+				status.Name = a.name
+				status.Applied = true
+				status.AppliedAt = &appliedAt
+				status.Modified = known && a.checksum != mig.checksum && a.checksum != mig.upChecksum
+			}
+
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// checkUnmodified refuses applied migrations whose files have been edited.
+// Checksums recorded before they covered the down file too are brought up to
+// date when the up file still matches.
+func (m *DatabaseMigration) checkUnmodified(ctx context.Context, conn *sql.Conn, available map[int]migration, applied map[int]appliedMigration) error {
+	for _, a := range applied {
+		mig, ok := available[a.version]
+		if !ok || mig.checksum == a.checksum {
+			continue
+		}
+
+		if mig.upChecksum != a.checksum {
+			return fmt.Errorf("migration %d_%s has been modified since it was applied", a.version, a.name)
+		}
+
+		_, err := conn.ExecContext(ctx, "UPDATE schema_migrations SET checksum = $1 WHERE version = $2", mig.checksum, a.version)
+		if err != nil {
+			return err
+		}
 	}
+
+	return nil
 }
 
-func (m *DatabaseMigration) DoMigration() error {
-	if err := m.db.AutoMigrate(&domain.User{}); err != nil {
+func (m *DatabaseMigration) withLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+
+	sqlDB, err := m.db.DB()
+	if err != nil {
 		return err
 	}
 
-	if err := m.db.AutoMigrate(&domain.Claim{}); err != nil {
+	// session level advisory locks belong to a connection, so everything runs
+	// on the one connection
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
 		return err
 	}
+	defer conn.Close()
 
-	m.db.FirstOrCreate(&domain.Claim{
-		Claim: "Administrator",
-	}, 1)
-	m.db.FirstOrCreate(&domain.Claim{
-		Claim: "User",
-	}, 2)
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey)
 
-	if err := m.db.AutoMigrate(&domain.UserClaim{}); err != nil {
+	if _, err := conn.ExecContext(ctx, createSchemaMigrations); err != nil {
 		return err
 	}
 
-	return nil
+	return fn(ctx, conn)
+}
+
+func (m *DatabaseMigration) apply(ctx context.Context, conn *sql.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *DatabaseMigration) load(ctx context.Context, conn *sql.Conn) (map[int]migration, map[int]appliedMigration, error) {
+	available, err := m.readFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.Scan(&a.version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, nil, err
+		}
+		applied[a.version] = a
+	}
+
+	return available, applied, rows.Err()
+}
+
+// readFiles pairs up the <version>_<name>.up.sql and .down.sql files.
+func (m *DatabaseMigration) readFiles() (map[int]migration, error) {
+	entries, err := fs.ReadDir(m.files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	available := map[int]migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		direction := ""
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		versionPart, name, ok := strings.Cut(strings.TrimSuffix(fileName, "."+direction+".sql"), "_")
+		version, err := strconv.Atoi(versionPart)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration file %s is not named <version>_<name>.%s.sql", fileName, direction)
+		}
+
+		data, err := fs.ReadFile(m.files, fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		mig := available[version]
+		if len(mig.name) > 0 && mig.name != name {
+			return nil, fmt.Errorf("migration %d has files with different names", version)
+		}
+		mig.version = version
+		mig.name = name
+
+		if direction == "up" {
+			mig.up = string(data)
+		} else {
+			mig.down = string(data)
+		}
+
+		available[version] = mig
+	}
+
+	for version, mig := range available {
+		if len(mig.up) == 0 || len(mig.down) == 0 {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", version, mig.name)
+		}
+
+		upSum := sha256.Sum256([]byte(mig.up))
+		mig.checksum = migrationChecksum(mig.up, mig.down)
+		mig.upChecksum = hex.EncodeToString(upSum[:])
+		available[version] = mig
+	}
+
+	return available, nil
+}
+
+// migrationChecksum hashes both files, each preceded by its length so moving
+// text from one file to the other changes the checksum.
+func migrationChecksum(up, down string) string {
+	h := sha256.New()
+	for _, file := range []string{up, down} {
+		fmt.Fprintf(h, "%d:", len(file))
+		h.Write([]byte(file))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func sortedVersions[T any](migrations map[int]T) []int {
+	versions := make([]int, 0, len(migrations))
+	for version := range migrations {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+
+	return versions
+}
+
+// backfillAuditChain hashes events recorded before the audit log was chained.
+// Those events always precede the chained ones, so they are linked in id
+// order with the append-only trigger briefly disabled. The hashes are
+// computed in Go, so this runs after the SQL migrations rather than as one.
+func (m *DatabaseMigration) backfillAuditChain() error {
+	var unchained int64
+	if err := m.db.Model(&domain.AuditEvent{}).Where("hash IS NULL OR hash = ''").Count(&unchained).Error; err != nil {
+		return err
+	}
+
+	if unchained == 0 {
+		return nil
+	}
+
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE audit_events DISABLE TRIGGER audit_events_append_only").Error; err != nil {
+			return err
+		}
+
+		var events []domain.AuditEvent
+		if err := tx.Where("hash IS NULL OR hash = ''").Order("id").Find(&events).Error; err != nil {
+			return err
+		}
+
+		prevHash := ""
+		for _, event := range events {
+			event.PrevHash = prevHash
+			event.Hash = event.ComputeHash()
+
+			err := tx.Model(&domain.AuditEvent{}).
+				Where("id = ?", event.ID).
+				Updates(map[string]interface{}{"prev_hash": event.PrevHash, "hash": event.Hash}).
+				Error
+			if err != nil {
+				return err
+			}
+
+			prevHash = event.Hash
+		}
+
+		return tx.Exec("ALTER TABLE audit_events ENABLE TRIGGER audit_events_append_only").Error
+	})
 }
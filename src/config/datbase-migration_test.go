@@ -0,0 +1,98 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadMigrationFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr bool
+	}{
+		{
+			name: "paired files",
+			files: fstest.MapFS{
+				"0001_baseline.up.sql":   {Data: []byte("CREATE TABLE a ();")},
+				"0001_baseline.down.sql": {Data: []byte("SELECT 1;")},
+				"0002_second.up.sql":     {Data: []byte("CREATE TABLE b ();")},
+				"0002_second.down.sql":   {Data: []byte("DROP TABLE b;")},
+				"migrations.go":          {Data: []byte("package migrations")},
+			},
+		},
+		{
+			name: "missing down file",
+			files: fstest.MapFS{
+				"0001_baseline.up.sql": {Data: []byte("CREATE TABLE a ();")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "mismatched names",
+			files: fstest.MapFS{
+				"0001_baseline.up.sql": {Data: []byte("CREATE TABLE a ();")},
+				"0001_other.down.sql":  {Data: []byte("SELECT 1;")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unnumbered file",
+			files: fstest.MapFS{
+				"baseline.up.sql": {Data: []byte("CREATE TABLE a ();")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			available, err := (&DatabaseMigration{files: tt.files}).readFiles()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(available) != 2 {
+				t.Fatalf("readFiles() found %d migrations, want 2", len(available))
+			}
+
+			mig := available[2]
+			if mig.name != "second" || mig.up != "CREATE TABLE b ();" || mig.down != "DROP TABLE b;" {
+				t.Errorf("migration 2 = %+v", mig)
+			}
+
+			upSum := sha256.Sum256([]byte(mig.up))
+			if mig.upChecksum != hex.EncodeToString(upSum[:]) {
+				t.Errorf("upChecksum = %s, want the checksum of the up file", mig.upChecksum)
+			}
+			if mig.checksum != migrationChecksum(mig.up, mig.down) {
+				t.Errorf("checksum = %s, want the checksum of both files", mig.checksum)
+			}
+		})
+	}
+}
+
+func TestMigrationChecksumCoversDownFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		up, down string
+	}{
+		{name: "down file edited", up: "CREATE TABLE a ();", down: "DROP TABLE a; DROP TABLE audit_events;"},
+		{name: "text moved between files", up: "CREATE TABLE a ();DROP", down: " TABLE a;"},
+		{name: "files swapped", up: "DROP TABLE a;", down: "CREATE TABLE a ();"},
+	}
+
+	original := migrationChecksum("CREATE TABLE a ();", "DROP TABLE a;")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if migrationChecksum(tt.up, tt.down) == original {
+				t.Errorf("migrationChecksum(%q, %q) matches the original files", tt.up, tt.down)
+			}
+		})
+	}
+}
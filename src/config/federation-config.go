@@ -0,0 +1,319 @@
+package config
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	FederatedProviderOidc   = "oidc"
+	FederatedProviderGithub = "github"
+	FederatedProviderSaml   = "saml"
+
+	// the attribute names Entra ID and AD FS send, which most other SAML
+	// identity providers can be set up to use too
+	samlEmailAttribute     = "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress"
+	samlFirstNameAttribute = "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname"
+	samlSurnameAttribute   = "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname"
+)
+
+// FederationConfig lists the external identity providers users can sign in
+// with. CallbackBaseUrl is the public address of this service, which each
+// provider redirects back to at /auth/<name>/callback. SAML providers need the
+// certificate and key this service signs its requests with and that
+// assertions are encrypted for.
+type FederationConfig struct {
+	CallbackBaseUrl string
+	RedirectUrl     string
+	LoginTimeout    time.Duration
+	Providers       []FederatedProviderConfig
+	SamlCertificate *x509.Certificate
+	SamlKey         *rsa.PrivateKey
+}
+
+type FederatedProviderConfig struct {
+	Name         string
+	DisplayName  string
+	Type         string
+	Issuer       string
+	BaseUrl      string
+	ApiUrl       string
+	ClientId     string
+	ClientSecret []byte
+	Scopes       []string
+
+	// SAML providers are described by their metadata, read from MetadataUrl
+	// on first use or from IdpMetadata, and know this service by EntityId
+	MetadataUrl  string
+	IdpMetadata  []byte
+	EntityId     string
+	NameIdFormat string
+	Attributes   FederatedAttributes
+
+	// TrustEmail treats the provider's email addresses as verified when it
+	// does not say, which is only safe for a provider that verifies them all
+	TrustEmail     bool
+	Provision      bool
+	AllowedDomains []string
+	ClaimRules     []FederatedClaimRule
+}
+
+// FederatedClaimRule grants Claim to users whose Attribute, a dotted path
+// into the provider's claims, equals Value or is a list containing it.
+type FederatedClaimRule struct {
+	Attribute string `mapstructure:"attribute"`
+	Value     string `mapstructure:"value"`
+	Claim     string `mapstructure:"claim"`
+}
+
+// FederatedAttributes names the SAML attributes holding the user's details.
+// Subject defaults to the assertion's NameID.
+type FederatedAttributes struct {
+	Subject      string `mapstructure:"subject"`
+	EmailAddress string `mapstructure:"email"`
+	FirstName    string `mapstructure:"first_name"`
+	Surname      string `mapstructure:"surname"`
+}
+
+type federatedProviderEntry struct {
+	Name           string               `mapstructure:"name"`
+	DisplayName    string               `mapstructure:"display_name"`
+	Type           string               `mapstructure:"type"`
+	Issuer         string               `mapstructure:"issuer"`
+	BaseUrl        string               `mapstructure:"base_url"`
+	ApiUrl         string               `mapstructure:"api_url"`
+	ClientId       string               `mapstructure:"client_id"`
+	ClientSecret   secretEntry          `mapstructure:"client_secret"`
+	Scopes         []string             `mapstructure:"scopes"`
+	MetadataUrl    string               `mapstructure:"metadata_url"`
+	MetadataFile   string               `mapstructure:"metadata_file"`
+	EntityId       string               `mapstructure:"entity_id"`
+	NameIdFormat   string               `mapstructure:"name_id_format"`
+	Attributes     FederatedAttributes  `mapstructure:"attributes"`
+	TrustEmail     bool                 `mapstructure:"trust_email"`
+	Provision      *bool                `mapstructure:"provision"`
+	AllowedDomains []string             `mapstructure:"allowed_domains"`
+	ClaimRules     []FederatedClaimRule `mapstructure:"claim_rules"`
+}
+
+type secretEntry struct {
+	File string `mapstructure:"file"`
+	Env  string `mapstructure:"env"`
+}
+
+var federatedProviderName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// buildFederationConfig loads the identity providers, returning nil when none
+// are configured.
+func buildFederationConfig() (*FederationConfig, error) {
+	var entries []federatedProviderEntry
+	if err := viper.UnmarshalKey("federation.providers", &entries); err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	federationCfg := &FederationConfig{
+		CallbackBaseUrl: strings.TrimSuffix(viper.GetString("federation.callback_base_url"), "/"),
+		RedirectUrl:     viper.GetString("federation.redirect_url"),
+		LoginTimeout:    time.Duration(viper.GetInt("federation.login_timeout_minutes")) * time.Minute,
+	}
+
+	if u, err := url.Parse(federationCfg.CallbackBaseUrl); err != nil || !u.IsAbs() {
+		return nil, errors.New("federation.callback_base_url must be the absolute url of this service")
+	}
+
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		provider, err := buildFederatedProvider(entry, federationCfg.CallbackBaseUrl)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: %v", entry.Name, err)
+		}
+
+		if seen[provider.Name] {
+			return nil, fmt.Errorf("provider %s is listed more than once", provider.Name)
+		}
+		seen[provider.Name] = true
+
+		federationCfg.Providers = append(federationCfg.Providers, provider)
+
+		if provider.Type == FederatedProviderSaml && federationCfg.SamlKey == nil {
+			federationCfg.SamlCertificate, federationCfg.SamlKey, err = buildSamlKeyPair()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return federationCfg, nil
+}
+
+// buildSamlKeyPair reads the PEM encoded certificate and RSA private key of
+// this service's SAML service providers.
+func buildSamlKeyPair() (*x509.Certificate, *rsa.PrivateKey, error) {
+	certPem, err := readSecret(viper.GetString("federation.saml.certificate.file"), viper.GetString("federation.saml.certificate.env"))
+	if err != nil || len(certPem) == 0 {
+		return nil, nil, fmt.Errorf("error reading federation.saml.certificate: %v", err)
+	}
+
+	keyPem, err := readSecret(viper.GetString("federation.saml.private_key.file"), viper.GetString("federation.saml.private_key.env"))
+	if err != nil || len(keyPem) == 0 {
+		return nil, nil, fmt.Errorf("error reading federation.saml.private_key: %v", err)
+	}
+
+	certBlock, _ := pem.Decode(certPem)
+	if certBlock == nil {
+		return nil, nil, errors.New("federation.saml.certificate is not PEM encoded")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid federation.saml.certificate: %v", err)
+	}
+
+	keyBlock, _ := pem.Decode(keyPem)
+	if keyBlock == nil {
+		return nil, nil, errors.New("federation.saml.private_key is not PEM encoded")
+	}
+
+	var key interface{}
+	if key, err = x509.ParsePKCS8PrivateKey(keyBlock.Bytes); err != nil {
+		key, err = x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid federation.saml.private_key: %v", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("federation.saml.private_key must be an RSA key")
+	}
+
+	if publicKey, ok := cert.PublicKey.(*rsa.PublicKey); !ok || !publicKey.Equal(&rsaKey.PublicKey) {
+		return nil, nil, errors.New("federation.saml.certificate is not for federation.saml.private_key")
+	}
+
+	return cert, rsaKey, nil
+}
+
+func buildFederatedProvider(entry federatedProviderEntry, callbackBaseUrl string) (FederatedProviderConfig, error) {
+	if !federatedProviderName.MatchString(entry.Name) {
+		return FederatedProviderConfig{}, errors.New("name must be lower case letters, digits and hyphens")
+	}
+
+	if len(entry.ClientId) == 0 && entry.Type != FederatedProviderSaml {
+		return FederatedProviderConfig{}, errors.New("client_id must be set")
+	}
+
+	secret, err := readSecret(entry.ClientSecret.File, entry.ClientSecret.Env)
+	if err != nil {
+		return FederatedProviderConfig{}, fmt.Errorf("error reading the client secret: %v", err)
+	}
+
+	provider := FederatedProviderConfig{
+		Name:           entry.Name,
+		DisplayName:    entry.DisplayName,
+		Type:           entry.Type,
+		Issuer:         entry.Issuer,
+		BaseUrl:        strings.TrimSuffix(entry.BaseUrl, "/"),
+		ApiUrl:         strings.TrimSuffix(entry.ApiUrl, "/"),
+		ClientId:       entry.ClientId,
+		ClientSecret:   secret,
+		Scopes:         entry.Scopes,
+		MetadataUrl:    entry.MetadataUrl,
+		EntityId:       entry.EntityId,
+		NameIdFormat:   entry.NameIdFormat,
+		Attributes:     entry.Attributes,
+		TrustEmail:     entry.TrustEmail,
+		Provision:      entry.Provision == nil || *entry.Provision,
+		AllowedDomains: entry.AllowedDomains,
+		ClaimRules:     entry.ClaimRules,
+	}
+
+	if len(provider.DisplayName) == 0 {
+		provider.DisplayName = provider.Name
+	}
+
+	switch provider.Type {
+	case FederatedProviderOidc:
+		if len(provider.Issuer) == 0 {
+			return provider, errors.New("issuer must be set")
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "email", "profile"}
+		}
+	case FederatedProviderGithub:
+		if len(provider.BaseUrl) == 0 {
+			provider.BaseUrl = "https://github.com"
+		}
+		if len(provider.ApiUrl) == 0 {
+			provider.ApiUrl = "https://api.github.com"
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"read:user", "user:email"}
+		}
+	case FederatedProviderSaml:
+		if err := buildSamlProvider(&provider, entry, callbackBaseUrl); err != nil {
+			return provider, err
+		}
+	default:
+		return provider, fmt.Errorf("type must be %s, %s or %s", FederatedProviderOidc, FederatedProviderGithub, FederatedProviderSaml)
+	}
+
+	for _, rule := range provider.ClaimRules {
+		if len(rule.Attribute) == 0 || len(rule.Claim) == 0 {
+			return provider, errors.New("every claim rule needs an attribute and a claim")
+		}
+	}
+
+	return provider, nil
+}
+
+func buildSamlProvider(provider *FederatedProviderConfig, entry federatedProviderEntry, callbackBaseUrl string) error {
+	switch {
+	case len(entry.MetadataFile) > 0:
+		metadata, err := os.ReadFile(entry.MetadataFile)
+		if err != nil {
+			return fmt.Errorf("error reading metadata_file: %v", err)
+		}
+		provider.IdpMetadata = metadata
+	case len(provider.MetadataUrl) == 0:
+		return errors.New("metadata_url or metadata_file must be set")
+	}
+
+	if len(provider.EntityId) == 0 {
+		provider.EntityId = fmt.Sprintf("%s/auth/%s/metadata", callbackBaseUrl, provider.Name)
+	}
+
+	switch provider.NameIdFormat {
+	case "":
+		provider.NameIdFormat = "unspecified"
+	case "unspecified", "persistent", "email", "transient":
+	default:
+		return errors.New("name_id_format must be unspecified, persistent, email or transient")
+	}
+
+	if len(provider.Attributes.EmailAddress) == 0 {
+		provider.Attributes.EmailAddress = samlEmailAttribute
+	}
+	if len(provider.Attributes.FirstName) == 0 {
+		provider.Attributes.FirstName = samlFirstNameAttribute
+	}
+	if len(provider.Attributes.Surname) == 0 {
+		provider.Attributes.Surname = samlSurnameAttribute
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// LdapConfig describes the directory users can sign in against. Users are
+// found by searching BaseDn with UserFilter, in which %s is replaced by the
+// escaped username, using the service account in BindDn.
+type LdapConfig struct {
+	Url                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+
+	BindDn       string
+	BindPassword []byte
+
+	BaseDn     string
+	UserFilter string
+
+	// group membership comes from the MemberOf attribute unless a group
+	// search is configured, in which case %s is replaced by the user's DN
+	GroupBaseDn string
+	GroupFilter string
+
+	UsernameAttribute  string
+	EmailAttribute     string
+	FirstNameAttribute string
+	SurnameAttribute   string
+	MemberOfAttribute  string
+
+	GroupClaims []LdapGroupClaim
+}
+
+// LdapGroupClaim grants Claim to members of the group with the DN Group.
+type LdapGroupClaim struct {
+	Group string `mapstructure:"group"`
+	Claim string `mapstructure:"claim"`
+}
+
+const (
+	AuthenticatorLocal = "local"
+	AuthenticatorLdap  = "ldap"
+)
+
+func setLdapDefaults() {
+	viper.SetDefault("ldap.timeout_seconds", 10)
+	viper.SetDefault("ldap.user_filter", "(&(objectClass=user)(sAMAccountName=%s))")
+	viper.SetDefault("ldap.attributes.username", "sAMAccountName")
+	viper.SetDefault("ldap.attributes.email", "mail")
+	viper.SetDefault("ldap.attributes.first_name", "givenName")
+	viper.SetDefault("ldap.attributes.surname", "sn")
+	viper.SetDefault("ldap.attributes.member_of", "memberOf")
+}
+
+// buildLdapConfig loads the directory settings, returning nil when no
+// ldap.url is configured.
+func buildLdapConfig() (*LdapConfig, error) {
+	url := viper.GetString("ldap.url")
+	if len(url) == 0 {
+		return nil, nil
+	}
+
+	ldapCfg := &LdapConfig{
+		Url:                url,
+		StartTLS:           viper.GetBool("ldap.start_tls"),
+		InsecureSkipVerify: viper.GetBool("ldap.insecure_skip_verify"),
+		Timeout:            time.Duration(viper.GetInt("ldap.timeout_seconds")) * time.Second,
+		BindDn:             viper.GetString("ldap.bind_dn"),
+		BaseDn:             viper.GetString("ldap.base_dn"),
+		UserFilter:         viper.GetString("ldap.user_filter"),
+		GroupBaseDn:        viper.GetString("ldap.group_base_dn"),
+		GroupFilter:        viper.GetString("ldap.group_filter"),
+		UsernameAttribute:  viper.GetString("ldap.attributes.username"),
+		EmailAttribute:     viper.GetString("ldap.attributes.email"),
+		FirstNameAttribute: viper.GetString("ldap.attributes.first_name"),
+		SurnameAttribute:   viper.GetString("ldap.attributes.surname"),
+		MemberOfAttribute:  viper.GetString("ldap.attributes.member_of"),
+	}
+
+	if len(ldapCfg.BaseDn) == 0 {
+		return nil, errors.New("ldap.base_dn must be set")
+	}
+
+	if strings.Count(ldapCfg.UserFilter, "%s") != 1 {
+		return nil, errors.New("ldap.user_filter must contain %s exactly once")
+	}
+
+	if len(ldapCfg.GroupFilter) > 0 && strings.Count(ldapCfg.GroupFilter, "%s") != 1 {
+		return nil, errors.New("ldap.group_filter must contain %s exactly once")
+	}
+
+	if len(ldapCfg.BindDn) > 0 {
+		password, err := readSecret(
+			viper.GetString("ldap.bind_password.file"),
+			viper.GetString("ldap.bind_password.env"),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the ldap bind password: %v", err)
+		}
+		ldapCfg.BindPassword = password
+	}
+
+	if err := viper.UnmarshalKey("ldap.group_claims", &ldapCfg.GroupClaims); err != nil {
+		return nil, err
+	}
+
+	for _, groupClaim := range ldapCfg.GroupClaims {
+		if len(groupClaim.Group) == 0 || len(groupClaim.Claim) == 0 {
+			return nil, errors.New("every ldap.group_claims entry needs a group and a claim")
+		}
+	}
+
+	return ldapCfg, nil
+}
+
+// buildAuthenticators returns the order in which login tries each source of
+// users. It defaults to the local database followed by the directory, when
+// one is configured.
+func buildAuthenticators(ldapCfg *LdapConfig) ([]string, error) {
+	authenticators := viper.GetStringSlice("authentication.authenticators")
+	if len(authenticators) == 0 {
+		authenticators = []string{AuthenticatorLocal}
+		if ldapCfg != nil {
+			authenticators = append(authenticators, AuthenticatorLdap)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, name := range authenticators {
+		switch {
+		case seen[name]:
+			return nil, fmt.Errorf("authenticator %s is listed more than once", name)
+		case name == AuthenticatorLdap && ldapCfg == nil:
+			return nil, errors.New("the ldap authenticator needs ldap.url to be set")
+		case name != AuthenticatorLocal && name != AuthenticatorLdap:
+			return nil, fmt.Errorf("unknown authenticator %s", name)
+		}
+		seen[name] = true
+	}
+
+	return authenticators, nil
+}
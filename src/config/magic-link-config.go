@@ -0,0 +1,54 @@
+package config
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// MagicLinkConfig enables signing in with a link emailed to the user. LinkUrl
+// is the page of the application the link opens, which is given the token
+// in its token query parameter to exchange for an access token.
+type MagicLinkConfig struct {
+	LinkUrl          string
+	Ttl              time.Duration
+	MaxPerHour       int
+	MaxRequestsPerIp int
+}
+
+func setMagicLinkDefaults() {
+	viper.SetDefault("magic_link.ttl_minutes", 15)
+	viper.SetDefault("magic_link.max_per_hour", 3)
+	viper.SetDefault("magic_link.max_requests_per_ip", 20)
+}
+
+// buildMagicLinkConfig returns nil when no magic_link.link_url is configured.
+func buildMagicLinkConfig(smtpCfg *SmtpConfig) (*MagicLinkConfig, error) {
+	linkUrl := viper.GetString("magic_link.link_url")
+	if len(linkUrl) == 0 {
+		return nil, nil
+	}
+
+	if u, err := url.Parse(linkUrl); err != nil || !u.IsAbs() {
+		return nil, errors.New("magic_link.link_url must be an absolute url")
+	}
+
+	if smtpCfg == nil {
+		return nil, errors.New("magic links are emailed, so smtp.host must be set")
+	}
+
+	magicLinkCfg := &MagicLinkConfig{
+		LinkUrl:          linkUrl,
+		Ttl:              time.Duration(viper.GetInt("magic_link.ttl_minutes")) * time.Minute,
+		MaxPerHour:       viper.GetInt("magic_link.max_per_hour"),
+		MaxRequestsPerIp: viper.GetInt("magic_link.max_requests_per_ip"),
+	}
+
+	if magicLinkCfg.Ttl <= 0 || magicLinkCfg.MaxPerHour <= 0 || magicLinkCfg.MaxRequestsPerIp <= 0 {
+		return nil, errors.New("magic_link.ttl_minutes, max_per_hour and max_requests_per_ip must be positive")
+	}
+
+	return magicLinkCfg, nil
+}
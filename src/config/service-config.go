@@ -1,10 +1,17 @@
 package config
 
 import (
+	"authservice/src/helpers"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path"
+	"runtime"
+	"strings"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -24,16 +31,76 @@ type ServiceConfig struct {
 	ClientId     string
 	ClientSecret string
 	Mux          *chi.Mux
+	ContentTypes *helpers.ContentTypes
+	HashExecutor *helpers.HashExecutor
+	Peppers      *helpers.PepperSet
+
+	UserRetention     time.Duration
+	UserPurgeInterval time.Duration
+
+	AuditSigningKey         ed25519.PrivateKey
+	AuditVerifyKeys         []ed25519.PublicKey
+	AuditCheckpointInterval time.Duration
+
+	WebhookDispatchInterval time.Duration
+	WebhookMaxAttempts      int
+	WebhookTimeout          time.Duration
+
+	ScimToken        []byte
+	ScimOrganization string
+	ScimBaseUrl      string
+
+	Authenticators []string
+	Ldap           *LdapConfig
+
+	Federation *FederationConfig
+
+	Smtp      *SmtpConfig
+	MagicLink *MagicLinkConfig
+
+	ApiKeyMaxLifetime time.Duration
+}
+
+type pepperKeyConfig struct {
+	Id   string `mapstructure:"id"`
+	File string `mapstructure:"file"`
+	Env  string `mapstructure:"env"`
 }
 
 func InitServiceConfig() *ServiceConfig {
+	serviceCfg, err := LoadServiceConfig()
+	if err != nil {
+		sentry.CaptureException(err)
+		log.Fatal(err)
+	}
+
+	return serviceCfg
+}
+
+// LoadServiceConfig is InitServiceConfig for callers that want to report a
+// broken configuration themselves rather than exit.
+func LoadServiceConfig() (*ServiceConfig, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
 
+	viper.SetDefault("hashing.max_concurrency", runtime.NumCPU())
+	viper.SetDefault("hashing.queue_timeout_ms", 2000)
+	viper.SetDefault("users.retention_days", 30)
+	viper.SetDefault("users.purge_interval_minutes", 60)
+	viper.SetDefault("audit.checkpoint_interval_minutes", 60)
+	viper.SetDefault("webhooks.dispatch_interval_seconds", 5)
+	viper.SetDefault("webhooks.max_attempts", 10)
+	viper.SetDefault("webhooks.timeout_seconds", 10)
+	viper.SetDefault("scim.base_url", "/scim/v2")
+	setLdapDefaults()
+	viper.SetDefault("federation.login_timeout_minutes", 10)
+	setSmtpDefaults()
+	setMagicLinkDefaults()
+	viper.SetDefault("api_keys.max_lifetime_days", 365)
+
 	if err := viper.ReadInConfig(); err != nil {
-		sentry.CaptureException(err)
-		log.Fatalf("error reading service configuration: %v", err)
+		return nil, fmt.Errorf("error reading service configuration: %v", err)
 	}
 
 	logFilePath := path.Join(
@@ -41,10 +108,10 @@ func InitServiceConfig() *ServiceConfig {
 		viper.GetString("service.log_file_name"),
 	)
 
-	logFile, err := os.Create(logFilePath)
+	// appended to rather than truncated, as operator commands share the file
+	logFile, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
-		sentry.CaptureException(err)
-		log.Fatalf("error creating log file: %v", err)
+		return nil, fmt.Errorf("error creating log file: %v", err)
 	}
 
 	db, err := buildDatbaseConnection(
@@ -56,18 +123,94 @@ func InitServiceConfig() *ServiceConfig {
 		viper.GetInt("database.port"))
 
 	if err != nil {
-		sentry.CaptureException(err)
-		log.Fatalf("error connecting to database server: %v", err)
+		return nil, fmt.Errorf("error connecting to database server: %v", err)
+	}
+
+	peppers, err := buildPepperSet()
+	if err != nil {
+		return nil, fmt.Errorf("error loading password peppers: %v", err)
+	}
+
+	auditSigningKey, auditVerifyKeys, err := buildAuditKeys()
+	if err != nil {
+		return nil, fmt.Errorf("error loading audit checkpoint keys: %v", err)
+	}
+
+	scimToken, err := buildScimToken()
+	if err != nil {
+		return nil, fmt.Errorf("error loading SCIM token: %v", err)
+	}
+
+	scimOrganization := strings.TrimSpace(viper.GetString("scim.organization"))
+	if len(scimToken) > 0 && len(scimOrganization) == 0 {
+		return nil, errors.New("scim.organization must name the organization the SCIM token provisions")
+	}
+
+	ldapCfg, err := buildLdapConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading LDAP configuration: %v", err)
+	}
+
+	authenticators, err := buildAuthenticators(ldapCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error loading authenticators: %v", err)
+	}
+
+	federationCfg, err := buildFederationConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading identity providers: %v", err)
+	}
+
+	smtpCfg, err := buildSmtpConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading SMTP configuration: %v", err)
+	}
+
+	magicLinkCfg, err := buildMagicLinkConfig(smtpCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error loading magic link configuration: %v", err)
 	}
 
+	mux, contentTypes := initServiceMux()
+
 	return &ServiceConfig{
 		Port:         viper.GetInt("service.port"),
 		Logger:       buildLogger(logFile),
 		Db:           db,
 		ClientId:     viper.GetString("auth_service.client_id"),
 		ClientSecret: viper.GetString("auth_service.client_secret"),
-		Mux:          initServiceMux(),
-	}
+		Mux:          mux,
+		ContentTypes: contentTypes,
+		HashExecutor: helpers.InitHashExecutor(
+			viper.GetInt("hashing.max_concurrency"),
+			time.Duration(viper.GetInt("hashing.queue_timeout_ms"))*time.Millisecond,
+		),
+		Peppers:           peppers,
+		UserRetention:     time.Duration(viper.GetInt("users.retention_days")) * 24 * time.Hour,
+		UserPurgeInterval: time.Duration(viper.GetInt("users.purge_interval_minutes")) * time.Minute,
+
+		AuditSigningKey:         auditSigningKey,
+		AuditVerifyKeys:         auditVerifyKeys,
+		AuditCheckpointInterval: time.Duration(viper.GetInt("audit.checkpoint_interval_minutes")) * time.Minute,
+
+		WebhookDispatchInterval: time.Duration(viper.GetInt("webhooks.dispatch_interval_seconds")) * time.Second,
+		WebhookMaxAttempts:      viper.GetInt("webhooks.max_attempts"),
+		WebhookTimeout:          time.Duration(viper.GetInt("webhooks.timeout_seconds")) * time.Second,
+
+		ScimToken:        scimToken,
+		ScimOrganization: scimOrganization,
+		ScimBaseUrl:      strings.TrimSuffix(viper.GetString("scim.base_url"), "/"),
+
+		Authenticators: authenticators,
+		Ldap:           ldapCfg,
+
+		Federation: federationCfg,
+
+		Smtp:      smtpCfg,
+		MagicLink: magicLinkCfg,
+
+		ApiKeyMaxLifetime: time.Duration(viper.GetInt("api_keys.max_lifetime_days")) * 24 * time.Hour,
+	}, nil
 }
 
 func buildLogger(f *os.File) *zap.SugaredLogger {
@@ -88,6 +231,102 @@ func buildLogger(f *os.File) *zap.SugaredLogger {
 	return logger.Sugar()
 }
 
+func buildPepperSet() (*helpers.PepperSet, error) {
+	var keys []pepperKeyConfig
+	if err := viper.UnmarshalKey("pepper.keys", &keys); err != nil {
+		return nil, err
+	}
+
+	peppers := map[string][]byte{}
+	for _, key := range keys {
+		secret, err := readSecret(key.File, key.Env)
+		if err != nil {
+			return nil, fmt.Errorf("error reading pepper %s: %v", key.Id, err)
+		}
+		peppers[key.Id] = secret
+	}
+
+	return helpers.InitPepperSet(viper.GetString("pepper.current_id"), peppers)
+}
+
+// buildAuditKeys loads the checkpoint signing key, a base64 encoded ed25519
+// seed, and the public keys checkpoints are verified against. Previous public
+// keys can be listed so checkpoints signed before a key rotation still verify.
+func buildAuditKeys() (ed25519.PrivateKey, []ed25519.PublicKey, error) {
+	var signingKey ed25519.PrivateKey
+	verifyKeys := []ed25519.PublicKey{}
+
+	file := viper.GetString("audit.checkpoint_key.file")
+	env := viper.GetString("audit.checkpoint_key.env")
+	if len(file) > 0 || len(env) > 0 {
+		secret, err := readSecret(file, env)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		seed, err := base64.StdEncoding.DecodeString(string(secret))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, nil, fmt.Errorf("the checkpoint key must be a base64 encoded %d byte seed", ed25519.SeedSize)
+		}
+
+		signingKey = ed25519.NewKeyFromSeed(seed)
+		verifyKeys = append(verifyKeys, signingKey.Public().(ed25519.PublicKey))
+	}
+
+	for _, encoded := range viper.GetStringSlice("audit.previous_public_keys") {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, nil, fmt.Errorf("invalid previous audit public key %s", encoded)
+		}
+		verifyKeys = append(verifyKeys, ed25519.PublicKey(key))
+	}
+
+	return signingKey, verifyKeys, nil
+}
+
+// buildScimToken loads the bearer token SCIM clients authenticate with. SCIM
+// is disabled when no token is configured.
+func buildScimToken() ([]byte, error) {
+	file := viper.GetString("scim.token.file")
+	env := viper.GetString("scim.token.env")
+	if len(file) == 0 && len(env) == 0 {
+		return nil, nil
+	}
+
+	token, err := readSecret(file, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(token) < 32 {
+		return nil, errors.New("the SCIM token must be at least 32 characters")
+	}
+
+	return token, nil
+}
+
+// readSecret prefers the environment variable and falls back to the file.
+func readSecret(file, env string) ([]byte, error) {
+	if len(env) > 0 {
+		if value, ok := os.LookupEnv(env); ok && len(strings.TrimSpace(value)) > 0 {
+			return []byte(strings.TrimSpace(value)), nil
+		}
+	}
+
+	if len(file) > 0 {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if secret := bytes.TrimSpace(data); len(secret) > 0 {
+			return secret, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no secret found in environment variable %q or file %q", env, file)
+}
+
 func buildDatbaseConnection(env, host, username, password, dbName string, port int) (*gorm.DB, error) {
 
 	if env == "dev" {
@@ -1,13 +1,17 @@
 package config
 
 import (
+	"authservice/src/helpers"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httplog"
 )
 
-func initServiceMux() *chi.Mux {
+// initServiceMux also returns the content type policy, so routes can accept
+// bodies of other types than the defaults.
+func initServiceMux() (*chi.Mux, *helpers.ContentTypes) {
 	requestLogger := httplog.NewLogger("authentication-service", httplog.Options{
 		JSON:     true,
 		Concise:  true,
@@ -24,13 +28,16 @@ func initServiceMux() *chi.Mux {
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 
+	mux.Use(middleware.RequestID)
+	mux.Use(helpers.RequestMetadataMiddleware)
 	mux.Use(httplog.RequestLogger(requestLogger))
 	mux.Use(middleware.Compress(5, "application/json"))
-	mux.Use(middleware.AllowContentType("application/json", "text/xml"))
+	contentTypes := helpers.InitContentTypes(mux, "application/json", "text/xml", "application/x-ndjson", "application/scim+json")
+	mux.Use(contentTypes.Handler)
 	mux.Use(middleware.NoCache)
 	mux.Use(middleware.StripSlashes)
 	mux.Use(middleware.Logger)
 	mux.Use(middleware.Recoverer)
 
-	return mux
+	return mux, contentTypes
 }
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// SmtpConfig is the mail server email is sent through. With ImplicitTLS the
+// connection is TLS from the start, as on port 465; otherwise STARTTLS is
+// used whenever the server offers it.
+type SmtpConfig struct {
+	Host        string
+	Port        int
+	Username    string
+	Password    []byte
+	From        string
+	ImplicitTLS bool
+	Timeout     time.Duration
+}
+
+func setSmtpDefaults() {
+	viper.SetDefault("smtp.port", 587)
+	viper.SetDefault("smtp.timeout_seconds", 10)
+}
+
+// buildSmtpConfig returns nil when no smtp.host is configured.
+func buildSmtpConfig() (*SmtpConfig, error) {
+	if len(viper.GetString("smtp.host")) == 0 {
+		return nil, nil
+	}
+
+	smtpCfg := &SmtpConfig{
+		Host:        viper.GetString("smtp.host"),
+		Port:        viper.GetInt("smtp.port"),
+		Username:    viper.GetString("smtp.username"),
+		From:        viper.GetString("smtp.from"),
+		ImplicitTLS: viper.GetBool("smtp.implicit_tls"),
+		Timeout:     time.Duration(viper.GetInt("smtp.timeout_seconds")) * time.Second,
+	}
+
+	if _, err := mail.ParseAddress(smtpCfg.From); err != nil {
+		return nil, errors.New("smtp.from must be an email address, such as \"Example <no-reply@example.com>\"")
+	}
+
+	if len(smtpCfg.Username) > 0 {
+		password, err := readSecret(viper.GetString("smtp.password.file"), viper.GetString("smtp.password.env"))
+		if err != nil {
+			return nil, fmt.Errorf("error reading smtp.password: %v", err)
+		}
+		smtpCfg.Password = password
+	}
+
+	return smtpCfg, nil
+}
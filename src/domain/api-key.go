@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+// ApiKeyPrefix starts every API key, so they can be told apart from access
+// tokens and spotted by secret scanners.
+const ApiKeyPrefix = "ak_"
+
+// ApiKey is a long lived credential for scripts and jobs, acting as its user
+// with at most the claims named in Scopes. Only a hash of the key is kept,
+// along with its first characters so its owner can recognise it.
+type ApiKey struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UserId     uint `gorm:"index"`
+	Name       string
+	Prefix     string
+	KeyHash    string   `gorm:"uniqueIndex" json:"-"`
+	Scopes     []string `gorm:"serializer:json"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	LastUsedIp string
+	RevokedAt  *time.Time
+}
+
+func (k ApiKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
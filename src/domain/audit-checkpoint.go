@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// AuditCheckpoint is a signed statement of the audit chain head at a point in
+// time, letting auditors detect a chain that has been rewritten wholesale.
+type AuditCheckpoint struct {
+	ID            uint      `gorm:"primarykey"`
+	CreatedAt     time.Time `gorm:"index"`
+	LastEventId   uint
+	LastEventHash string
+	KeyId         string
+	Signature     string
+}
+
+func (c AuditCheckpoint) SigningPayload() []byte {
+	return []byte(fmt.Sprintf("%d:%s:%s",
+		c.LastEventId,
+		c.LastEventHash,
+		c.CreatedAt.UTC().Format(time.RFC3339Nano)))
+}
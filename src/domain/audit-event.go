@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditUserRegistered          = "user.registered"
+	AuditUserLoginSucceeded      = "user.login_succeeded"
+	AuditUserLoginFailed         = "user.login_failed"
+	AuditUserPasswordChanged     = "user.password_changed"
+	AuditUserDetailsUpdated      = "user.details_updated"
+	AuditUserDeleted             = "user.deleted"
+	AuditUserSuspended           = "user.suspended"
+	AuditUserReactivated         = "user.reactivated"
+	AuditUserRestored            = "user.restored"
+	AuditUserExported            = "user.exported"
+	AuditUserErased              = "user.erased"
+	AuditUserSessionRevoked      = "user.session_revoked"
+	AuditUserEmailVerified       = "user.email_verified"
+	AuditUserIdentityLinked      = "user.identity_linked"
+	AuditUserIdentityUnlinked    = "user.identity_unlinked"
+	AuditUserMagicLinkSent       = "user.magic_link_sent"
+	AuditUserOrganizationChanged = "user.organization_changed"
+	AuditUsersImported           = "users.imported"
+	AuditUsersExported           = "users.exported"
+	AuditClaimGranted            = "claim.granted"
+	AuditClaimRevoked            = "claim.revoked"
+	AuditClaimCreated            = "claim.created"
+	AuditClaimUpdated            = "claim.updated"
+	AuditClaimDeleted            = "claim.deleted"
+	AuditClaimPermissionGranted  = "claim.permission_granted"
+	AuditClaimPermissionRevoked  = "claim.permission_revoked"
+	AuditPermissionCreated       = "permission.created"
+	AuditPermissionDeleted       = "permission.deleted"
+	AuditApiKeyCreated           = "api_key.created"
+	AuditApiKeyRevoked           = "api_key.revoked"
+	AuditGroupCreated            = "group.created"
+	AuditGroupDeleted            = "group.deleted"
+	AuditGroupMemberAdded        = "group.member_added"
+	AuditGroupMemberRemoved      = "group.member_removed"
+	AuditGroupClaimGranted       = "group.claim_granted"
+	AuditGroupClaimRevoked       = "group.claim_revoked"
+	AuditGroupSubgroupAdded      = "group.subgroup_added"
+	AuditGroupSubgroupRemoved    = "group.subgroup_removed"
+	AuditOrganizationCreated     = "organization.created"
+	AuditWebhookCreated          = "webhook.created"
+	AuditWebhookDeleted          = "webhook.deleted"
+
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEvent rows are append-only, the table rejects updates and deletes.
+// Users are referenced by id only so erasing a user leaves no personal data
+// behind in the audit trail; IP addresses are truncated to their network and
+// usernames, email addresses and external subjects appear only as keyed
+// pseudonyms. Each row carries the hash of the row before it,
+// so removing or altering a row breaks the chain from that point on.
+type AuditEvent struct {
+	ID           uint      `gorm:"primarykey"`
+	CreatedAt    time.Time `gorm:"index"`
+	EventType    string    `gorm:"index"`
+	Outcome      string
+	ActorUserId  *uint `gorm:"index"`
+	TargetUserId *uint `gorm:"index"`
+	Target       string
+	IPAddress    string
+	UserAgent    string
+	RequestId    string `gorm:"index"`
+	Details      string
+	PrevHash     string
+	Hash         string `gorm:"index"`
+}
+
+type auditEventHashInput struct {
+	PrevHash     string
+	CreatedAt    string
+	EventType    string
+	Outcome      string
+	ActorUserId  *uint
+	TargetUserId *uint
+	Target       string
+	IPAddress    string
+	UserAgent    string
+	RequestId    string
+	Details      string
+}
+
+// ComputeHash hashes every recorded field together with PrevHash. The id is
+// left out as it is only known once the row has been inserted.
+func (e AuditEvent) ComputeHash() string {
+	input, _ := json.Marshal(auditEventHashInput{
+		PrevHash:     e.PrevHash,
+		CreatedAt:    e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		EventType:    e.EventType,
+		Outcome:      e.Outcome,
+		ActorUserId:  e.ActorUserId,
+		TargetUserId: e.TargetUserId,
+		Target:       e.Target,
+		IPAddress:    e.IPAddress,
+		UserAgent:    e.UserAgent,
+		RequestId:    e.RequestId,
+		Details:      e.Details,
+	})
+
+	sum := sha256.Sum256(input)
+	return hex.EncodeToString(sum[:])
+}
@@ -2,7 +2,16 @@ package domain
 
 import "gorm.io/gorm"
 
+const (
+	AdministratorClaim = "Administrator"
+	UserClaimName      = "User"
+)
+
+// Claim is a role. Roles are granted to users and groups, and bundle the
+// permissions tokens carry. Administrator and User are seeded, Administrator
+// with every permission the service checks.
 type Claim struct {
 	gorm.Model
-	Claim string `gorm:"unique"`
+	Claim      string `gorm:"unique"`
+	ExternalId string `gorm:"index" json:"-"`
 }
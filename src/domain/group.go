@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Group holds claims its members inherit. A group can be made a subgroup of
+// others, whose claims its members inherit too. Groups belong to the same
+// organization as their members, or to none for the platform's users.
+type Group struct {
+	gorm.Model
+	Name           string
+	Description    string
+	OrganizationId *uint `gorm:"index"`
+}
+
+type GroupMember struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	GroupId   uint `gorm:"uniqueIndex:idx_group_members_group_user"`
+	UserId    uint `gorm:"uniqueIndex:idx_group_members_group_user;index"`
+}
+
+type GroupClaim struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	GroupId   uint `gorm:"uniqueIndex:idx_group_claims_group_claim"`
+	ClaimId   uint `gorm:"uniqueIndex:idx_group_claims_group_claim;index"`
+}
+
+// GroupSubgroup makes the members of SubgroupId members of GroupId.
+type GroupSubgroup struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	GroupId    uint `gorm:"uniqueIndex:idx_group_subgroups_group_subgroup"`
+	SubgroupId uint `gorm:"uniqueIndex:idx_group_subgroups_group_subgroup;index"`
+}
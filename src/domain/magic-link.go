@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// MagicLink is a single use link emailed to a user to sign in with. Only
+// keyed hashes are kept of the token in the link and of the secret held by
+// the browser that asked for it, which must be the one to use it.
+type MagicLink struct {
+	ID           uint      `gorm:"primarykey"`
+	CreatedAt    time.Time `gorm:"index"`
+	UserId       uint      `gorm:"index"`
+	TokenHash    string    `gorm:"uniqueIndex"`
+	BindingHash  string
+	EmailAddress string
+	IPAddress    string
+	ExpiresAt    time.Time
+	ConsumedAt   *time.Time
+}
@@ -0,0 +1,12 @@
+package domain
+
+import "gorm.io/gorm"
+
+// Organization is a customer, or tenant, served by the deployment. Users
+// belong to at most one; those in none are the platform's own, and platform
+// administrators are the only ones who can see across organizations.
+type Organization struct {
+	gorm.Model
+	Slug string `gorm:"uniqueIndex:idx_organizations_slug_active,where:deleted_at IS NULL"`
+	Name string
+}
@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventUserRegistered    = "user.registered"
+	EventUserEmailVerified = "user.email_verified"
+	EventUserEmailChanged  = "user.email_changed"
+	EventUserDeleted       = "user.deleted"
+	EventUserErased        = "user.erased"
+	EventUserUpdated       = "user.updated"
+	EventUserStatusChanged = "user.status_changed"
+	EventUserRestored      = "user.restored"
+	EventUserPurged        = "user.purged"
+	EventClaimGranted      = "claim.granted"
+	EventClaimRevoked      = "claim.revoked"
+	EventClaimCreated      = "claim.created"
+	EventClaimUpdated      = "claim.updated"
+	EventClaimDeleted      = "claim.deleted"
+)
+
+// WebhookEventTypes are the events webhook subscriptions can ask for.
+var WebhookEventTypes = []string{
+	EventUserRegistered,
+	EventUserEmailVerified,
+	EventUserEmailChanged,
+	EventUserDeleted,
+	EventUserErased,
+}
+
+// OutboxEvent is written in the same transaction as the change it describes,
+// so an event exists if and only if the change was committed. Ids are
+// assigned in commit order, letting consumers of the event feed resume from
+// the last id they saw. DispatchedAt records when webhook deliveries were
+// queued for the event.
+type OutboxEvent struct {
+	ID           uint       `gorm:"primarykey"`
+	CreatedAt    time.Time  `gorm:"index"`
+	EventType    string     `gorm:"index"`
+	UserId       *uint      `gorm:"index"`
+	Payload      string     `gorm:"type:jsonb"`
+	DispatchedAt *time.Time `gorm:"index"`
+}
+
+// NewOutboxEvent adds the user id, when there is one, to the payload so
+// consumers always know which user an event concerns.
+func NewOutboxEvent(eventType string, userId *uint, payload map[string]interface{}) (OutboxEvent, error) {
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+
+	if userId != nil {
+		payload["user_id"] = *userId
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return OutboxEvent{}, err
+	}
+
+	return OutboxEvent{
+		EventType: eventType,
+		UserId:    userId,
+		Payload:   string(data),
+	}, nil
+}
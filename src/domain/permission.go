@@ -0,0 +1,70 @@
+package domain
+
+import "time"
+
+// The permissions the service itself checks. Each is seeded and granted to
+// the Administrator role, and cannot be taken from it.
+const (
+	PermissionUsersRead            = "users:read"
+	PermissionUsersWrite           = "users:write"
+	PermissionUsersErase           = "users:erase"
+	PermissionClaimsRead           = "claims:read"
+	PermissionClaimsWrite          = "claims:write"
+	PermissionGroupsRead           = "groups:read"
+	PermissionGroupsWrite          = "groups:write"
+	PermissionOrganizationsRead    = "organizations:read"
+	PermissionOrganizationsWrite   = "organizations:write"
+	PermissionServiceAccountsRead  = "service_accounts:read"
+	PermissionServiceAccountsWrite = "service_accounts:write"
+	PermissionWebhooksRead         = "webhooks:read"
+	PermissionWebhooksWrite        = "webhooks:write"
+	PermissionAuditRead            = "audit:read"
+	PermissionEventsRead           = "events:read"
+	PermissionMetricsRead          = "metrics:read"
+)
+
+var BuiltInPermissions = []string{
+	PermissionUsersRead,
+	PermissionUsersWrite,
+	PermissionUsersErase,
+	PermissionClaimsRead,
+	PermissionClaimsWrite,
+	PermissionGroupsRead,
+	PermissionGroupsWrite,
+	PermissionOrganizationsRead,
+	PermissionOrganizationsWrite,
+	PermissionServiceAccountsRead,
+	PermissionServiceAccountsWrite,
+	PermissionWebhooksRead,
+	PermissionWebhooksWrite,
+	PermissionAuditRead,
+	PermissionEventsRead,
+	PermissionMetricsRead,
+}
+
+// Permission is an action on a kind of resource, named resource:action.
+// Besides the service's own, permissions can be added for the applications
+// relying on its tokens to check.
+type Permission struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	Name        string `gorm:"uniqueIndex"`
+	Description string
+}
+
+// RolePermission bundles a permission into a role, which is a claim.
+type RolePermission struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	ClaimId      uint `gorm:"uniqueIndex:idx_role_permissions_claim_permission"`
+	PermissionId uint `gorm:"uniqueIndex:idx_role_permissions_claim_permission;index"`
+}
+
+func IsBuiltInPermission(name string) bool {
+	for _, permission := range BuiltInPermissions {
+		if permission == name {
+			return true
+		}
+	}
+	return false
+}
@@ -2,8 +2,12 @@ package domain
 
 import "gorm.io/gorm"
 
+// UserClaim grants a claim within the organization of the user it is granted
+// to, so an organization's administrators administer only that organization.
+// Claims of users in no organization apply to the platform.
 type UserClaim struct {
 	gorm.Model
-	UserId  uint
-	ClaimId uint
+	UserId         uint  `gorm:"uniqueIndex:idx_user_claims_user_claim"`
+	ClaimId        uint  `gorm:"uniqueIndex:idx_user_claims_user_claim"`
+	OrganizationId *uint `gorm:"index"`
 }
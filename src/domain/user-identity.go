@@ -0,0 +1,31 @@
+package domain
+
+import "time"
+
+// UserIdentity links a user to their account at an external identity
+// provider. Subject is the provider's own, stable, id for that account, and a
+// user can be linked to one account per provider.
+type UserIdentity struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	UserId       uint   `gorm:"uniqueIndex:idx_user_identities_user_provider"`
+	Provider     string `gorm:"uniqueIndex:idx_user_identities_provider_subject;uniqueIndex:idx_user_identities_user_provider"`
+	Subject      string `gorm:"uniqueIndex:idx_user_identities_provider_subject"`
+	EmailAddress string
+	LastLoginAt  *time.Time
+}
+
+// FederatedLogin is a login in progress at an identity provider, kept from
+// the redirect to the provider until its callback and looked up by the state
+// parameter passed through it. LinkUserId is set when a signed in user is
+// linking the account to themselves rather than signing in with it.
+type FederatedLogin struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	State        string `gorm:"uniqueIndex"`
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time `gorm:"index"`
+	LinkUserId   *uint
+}
@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+const (
+	AuthMethodPassword  = "password"
+	AuthMethodFederated = "federated"
+	AuthMethodMagicLink = "magic_link"
+)
+
+// UserSession is created on every successful login, so the table doubles as
+// the user's login history. SessionId is carried in the token's sid claim.
+type UserSession struct {
+	ID         uint      `gorm:"primarykey" json:"-"`
+	CreatedAt  time.Time `gorm:"index"`
+	SessionId  string    `gorm:"uniqueIndex"`
+	UserId     uint      `gorm:"index" json:"-"`
+	AuthMethod string
+	IPAddress  string
+	UserAgent  string
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+}
+
+func (s UserSession) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
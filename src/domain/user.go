@@ -1,12 +1,44 @@
 package domain
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AccountStatusActive              = "active"
+	AccountStatusSuspended           = "suspended"
+	AccountStatusLocked              = "locked"
+	AccountStatusPendingVerification = "pending_verification"
+	AccountStatusErased              = "erased"
+
+	// AuthSource is where a user's password is checked. Directory and
+	// federated users are provisioned on their first login and have no local
+	// password. Service accounts have no password at all and only sign in
+	// with API keys.
+	AuthSourceLocal          = "local"
+	AuthSourceLdap           = "ldap"
+	AuthSourceFederated      = "federated"
+	AuthSourceServiceAccount = "service_account"
+)
 
 type User struct {
 	gorm.Model
-	Username     string `gorm:"unique"`
-	Password     string
-	EmailAddress string `gorm:"uniqueIndex"`
-	FirstName    string
-	Surname      string
+	Username        string `gorm:"uniqueIndex:idx_users_username_active,where:deleted_at IS NULL"`
+	Password        string
+	PepperId        string `json:"-"`
+	EmailAddress    string `gorm:"uniqueIndex:idx_users_email_address_active,where:deleted_at IS NULL"`
+	FirstName       string
+	Surname         string
+	EmailVerified   bool
+	Status          string `gorm:"index;default:active"`
+	StatusReason    string
+	StatusChangedBy string
+	StatusChangedAt *time.Time
+	TokensRevokedAt *time.Time `json:"-"`
+	ErasedAt        *time.Time
+	ExternalId      string `gorm:"index"`
+	AuthSource      string `gorm:"default:local"`
+	OrganizationId  *uint  `gorm:"index"`
 }
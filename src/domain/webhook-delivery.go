@@ -0,0 +1,27 @@
+package domain
+
+import "time"
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookDelivery tracks sending one outbox event to one subscription and
+// doubles as the delivery log.
+type WebhookDelivery struct {
+	ID             uint `gorm:"primarykey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	SubscriptionId uint `gorm:"uniqueIndex:idx_webhook_deliveries_subscription_event"`
+	OutboxEventId  uint `gorm:"uniqueIndex:idx_webhook_deliveries_subscription_event"`
+	EventType      string
+	Status         string `gorm:"index;default:pending"`
+	Attempts       int
+	NextAttemptAt  time.Time `gorm:"index"`
+	LastAttemptAt  *time.Time
+	ResponseStatus int
+	LastError      string
+	DeliveredAt    *time.Time
+}
@@ -0,0 +1,20 @@
+package domain
+
+import "gorm.io/gorm"
+
+type WebhookSubscription struct {
+	gorm.Model
+	Url        string
+	Secret     string   `json:"-"`
+	EventTypes []string `gorm:"serializer:json"`
+}
+
+func (s WebhookSubscription) IsSubscribedTo(eventType string) bool {
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,29 @@
+package dtos
+
+import "time"
+
+// ApiKeyCreateDto names the claims the key may use as its Scopes. Without an
+// ExpiresAt the key lasts as long as keys are allowed to.
+type ApiKeyCreateDto struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+// ApiKeyDto only carries the key in the response to creating it.
+type ApiKeyDto struct {
+	ApiKeyId   uint
+	Name       string
+	Prefix     string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	LastUsedIp string
+	Key        string `json:",omitempty"`
+}
+
+type ServiceAccountCreateDto struct {
+	Username     string
+	EmailAddress string
+}
@@ -0,0 +1,8 @@
+package dtos
+
+import "authservice/src/domain"
+
+type AuditEventListResponseDto struct {
+	Events     []domain.AuditEvent
+	NextCursor string
+}
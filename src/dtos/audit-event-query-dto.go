@@ -0,0 +1,15 @@
+package dtos
+
+import "time"
+
+type AuditEventQueryDto struct {
+	EventType    string
+	Outcome      string
+	ActorUserId  *uint
+	TargetUserId *uint
+	RequestId    string
+	From         *time.Time
+	To           *time.Time
+	BeforeId     uint
+	Limit        int
+}
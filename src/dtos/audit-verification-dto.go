@@ -0,0 +1,10 @@
+package dtos
+
+type AuditVerificationDto struct {
+	Valid              bool
+	EventsChecked      int
+	CheckpointsChecked int
+	BrokenEventId      uint
+	BrokenCheckpointId uint
+	Problem            string
+}
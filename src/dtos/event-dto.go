@@ -0,0 +1,15 @@
+package dtos
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventDto is the shape of a domain event in the event feed, the event stream
+// and webhook deliveries alike.
+type EventDto struct {
+	Id        uint            `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
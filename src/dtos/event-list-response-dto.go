@@ -0,0 +1,6 @@
+package dtos
+
+type EventListResponseDto struct {
+	Events     []EventDto `json:"events"`
+	NextCursor string     `json:"next_cursor"`
+}
@@ -0,0 +1,11 @@
+package dtos
+
+type FederatedProviderDto struct {
+	Name        string
+	DisplayName string
+	LoginUrl    string
+}
+
+type FederatedLinkDto struct {
+	AuthUrl string
+}
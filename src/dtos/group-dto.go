@@ -0,0 +1,33 @@
+package dtos
+
+import "time"
+
+type GroupCreateDto struct {
+	Name        string
+	Description string
+}
+
+type GroupDto struct {
+	GroupId        uint
+	Name           string
+	Description    string
+	OrganizationId *uint
+	CreatedAt      time.Time
+}
+
+// GroupDetailDto lists the claims granted to the group itself, its direct
+// members and its direct subgroups.
+type GroupDetailDto struct {
+	GroupDto
+	Claims    []string
+	Members   []UserDto
+	Subgroups []GroupDto
+}
+
+type GroupMemberDto struct {
+	UserId uint
+}
+
+type GroupSubgroupDto struct {
+	GroupId uint
+}
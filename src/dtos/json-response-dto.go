@@ -2,6 +2,7 @@ package dtos
 
 type JsonResponseDto struct {
 	Error   bool   `json:"error"`
+	Code    string `json:"code,omitempty"`
 	Message string `json:"message"`
 	Data    any    `json:"data,omitempty"`
 }
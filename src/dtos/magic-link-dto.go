@@ -0,0 +1,9 @@
+package dtos
+
+type MagicLinkRequestDto struct {
+	EmailAddress string
+}
+
+type MagicLinkConsumeDto struct {
+	Token string
+}
@@ -0,0 +1,21 @@
+package dtos
+
+import "time"
+
+type OrganizationCreateDto struct {
+	Slug string
+	Name string
+}
+
+type OrganizationDto struct {
+	OrganizationId uint
+	Slug           string
+	Name           string
+	CreatedAt      time.Time
+}
+
+// UserOrganizationDto moves a user into the organization, or out of any when
+// OrganizationId is null.
+type UserOrganizationDto struct {
+	OrganizationId *uint
+}
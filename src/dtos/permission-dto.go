@@ -0,0 +1,19 @@
+package dtos
+
+import "time"
+
+type PermissionCreateDto struct {
+	Name        string
+	Description string
+}
+
+type PermissionDto struct {
+	Name        string
+	Description string
+	BuiltIn     bool
+	CreatedAt   time.Time
+}
+
+type RolePermissionDto struct {
+	Permission string
+}
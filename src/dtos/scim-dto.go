@@ -0,0 +1,107 @@
+package dtos
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ScimUserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimGroupSchema        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ScimListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimPatchOpSchema      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ScimErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	ScimServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ScimResourceTypeSchema          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// The SCIM dtos follow the attribute names of RFC 7643 rather than the rest of
+// the API, as SCIM clients expect them.
+
+type ScimUserDto struct {
+	Schemas     []string           `json:"schemas"`
+	Id          string             `json:"id,omitempty"`
+	ExternalId  string             `json:"externalId,omitempty"`
+	UserName    string             `json:"userName"`
+	Name        *ScimNameDto       `json:"name,omitempty"`
+	DisplayName string             `json:"displayName,omitempty"`
+	Emails      []ScimEmailDto     `json:"emails,omitempty"`
+	Active      *bool              `json:"active,omitempty"`
+	Password    string             `json:"password,omitempty"`
+	Groups      []ScimReferenceDto `json:"groups,omitempty"`
+	Meta        *ScimMetaDto       `json:"meta,omitempty"`
+}
+
+type ScimNameDto struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type ScimEmailDto struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// ScimReferenceDto is a group of a user or a member of a group.
+type ScimReferenceDto struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type ScimGroupDto struct {
+	Schemas     []string           `json:"schemas"`
+	Id          string             `json:"id,omitempty"`
+	ExternalId  string             `json:"externalId,omitempty"`
+	DisplayName string             `json:"displayName"`
+	Members     []ScimReferenceDto `json:"members,omitempty"`
+	Meta        *ScimMetaDto       `json:"meta,omitempty"`
+}
+
+type ScimMetaDto struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location"`
+	Version      string     `json:"version,omitempty"`
+}
+
+type ScimListResponseDto struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// ScimListQueryDto holds the query parameters of a list request. StartIndex
+// is one based, as in SCIM, and Count is nil when not given.
+type ScimListQueryDto struct {
+	Filter             string
+	StartIndex         int
+	Count              *int
+	SortBy             string
+	SortDescending     bool
+	ExcludedAttributes []string
+}
+
+type ScimPatchDto struct {
+	Schemas    []string                `json:"schemas"`
+	Operations []ScimPatchOperationDto `json:"Operations"`
+}
+
+type ScimPatchOperationDto struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type ScimErrorDto struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
@@ -0,0 +1,5 @@
+package dtos
+
+type UserClaimDto struct {
+	Claim string
+}
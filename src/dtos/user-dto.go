@@ -1,9 +1,18 @@
 package dtos
 
+import "time"
+
 type UserDto struct {
-	UserId       uint
-	Username     string
-	EmailAddress string
-	FirstName    string
-	Surname      string
+	UserId         uint
+	Username       string
+	EmailAddress   string
+	FirstName      string
+	Surname        string
+	EmailVerified  bool
+	Status         string
+	StatusReason   string
+	AuthSource     string
+	OrganizationId *uint
+	CreatedAt      time.Time
+	DeletedAt      *time.Time
 }
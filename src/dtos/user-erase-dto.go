@@ -0,0 +1,5 @@
+package dtos
+
+type UserEraseDto struct {
+	Password string
+}
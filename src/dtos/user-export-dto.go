@@ -0,0 +1,31 @@
+package dtos
+
+import (
+	"authservice/src/domain"
+	"time"
+)
+
+type UserExportDto struct {
+	ExportedAt   time.Time
+	Profile      UserExportProfileDto
+	Claims       []string
+	LoginHistory []UserSessionDto
+	AuditEvents  []domain.AuditEvent
+}
+
+type UserExportProfileDto struct {
+	UserId          uint
+	Username        string
+	EmailAddress    string
+	FirstName       string
+	Surname         string
+	EmailVerified   bool
+	Status          string
+	StatusReason    string
+	StatusChangedBy string
+	StatusChangedAt *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	DeletedAt       *time.Time
+	ErasedAt        *time.Time
+}
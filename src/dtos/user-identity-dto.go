@@ -0,0 +1,12 @@
+package dtos
+
+import "time"
+
+type UserIdentityDto struct {
+	Id           uint
+	Provider     string
+	DisplayName  string
+	EmailAddress string
+	CreatedAt    time.Time
+	LastLoginAt  *time.Time
+}
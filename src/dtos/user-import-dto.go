@@ -0,0 +1,37 @@
+package dtos
+
+// UserImportRowDto is one user in an import or export file. JSON Lines files
+// use the json names below and CSV files use them as column headings, with
+// claims separated by semicolons.
+type UserImportRowDto struct {
+	Username      string   `json:"username"`
+	EmailAddress  string   `json:"email_address"`
+	FirstName     string   `json:"first_name,omitempty"`
+	Surname       string   `json:"surname,omitempty"`
+	Password      string   `json:"password,omitempty"`
+	PasswordHash  string   `json:"password_hash,omitempty"`
+	Claims        []string `json:"claims,omitempty"`
+	EmailVerified *bool    `json:"email_verified,omitempty"`
+	Status        string   `json:"status,omitempty"`
+}
+
+type UserImportResultDto struct {
+	DryRun    bool
+	Rows      int
+	Created   int
+	Updated   int
+	Unchanged int
+	Failed    int
+	Errors    []UserImportErrorDto
+}
+
+func (r *UserImportResultDto) AddError(row int, username string, err error) {
+	r.Failed++
+	r.Errors = append(r.Errors, UserImportErrorDto{Row: row, Username: username, Error: err.Error()})
+}
+
+type UserImportErrorDto struct {
+	Row      int
+	Username string
+	Error    string
+}
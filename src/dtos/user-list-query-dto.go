@@ -0,0 +1,25 @@
+package dtos
+
+import "time"
+
+type UserListQueryDto struct {
+	Search        string
+	Claim         string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	EmailVerified *bool
+	Locked        *bool
+	Status        string
+	AuthSource    string
+	Deleted       bool
+	SortBy        string
+	SortDesc      bool
+	Cursor        string
+	Limit         int
+}
+
+type UserListCursorDto struct {
+	SortBy    string `json:"s"`
+	SortValue string `json:"v"`
+	UserId    uint   `json:"id"`
+}
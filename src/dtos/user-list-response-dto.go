@@ -0,0 +1,6 @@
+package dtos
+
+type UserListResponseDto struct {
+	Users      []UserDto
+	NextCursor string
+}
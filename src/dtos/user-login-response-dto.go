@@ -1,6 +1,7 @@
 package dtos
 
 type UserLoginResponseDto struct {
+	UserId       uint
 	Username     string
 	EmailAddress string
 	UserClaims   []string
@@ -0,0 +1,11 @@
+package dtos
+
+// UserRegistrationDto is all a caller may choose about a new account; its
+// status, verification and origin are for the service to set.
+type UserRegistrationDto struct {
+	Username     string
+	EmailAddress string
+	Password     string
+	FirstName    string
+	Surname      string
+}
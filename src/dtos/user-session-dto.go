@@ -0,0 +1,15 @@
+package dtos
+
+import "time"
+
+type UserSessionDto struct {
+	SessionId  string
+	AuthMethod string
+	IPAddress  string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+	Current    bool
+}
@@ -0,0 +1,5 @@
+package dtos
+
+type UserStatusChangeDto struct {
+	Reason string
+}
@@ -0,0 +1,8 @@
+package dtos
+
+import "authservice/src/domain"
+
+type WebhookDeliveryListResponseDto struct {
+	Deliveries []domain.WebhookDelivery
+	NextCursor string
+}
@@ -0,0 +1,19 @@
+package dtos
+
+import "time"
+
+type WebhookSubscriptionCreateDto struct {
+	Url        string
+	Secret     string
+	EventTypes []string
+}
+
+// WebhookSubscriptionDto only carries the secret in the response to creating
+// the subscription.
+type WebhookSubscriptionDto struct {
+	WebhookId  uint
+	Url        string
+	EventTypes []string
+	CreatedAt  time.Time
+	Secret     string `json:",omitempty"`
+}
@@ -0,0 +1,72 @@
+package helpers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ContentTypes accepts request bodies of the default content types on every
+// route, and of any other type only on the routes that asked for it. It runs
+// before routing, so it looks the route up itself.
+type ContentTypes struct {
+	mux      *chi.Mux
+	defaults map[string]bool
+	routes   map[string]map[string]bool
+}
+
+func InitContentTypes(mux *chi.Mux, defaults ...string) *ContentTypes {
+	return &ContentTypes{
+		mux:      mux,
+		defaults: contentTypeSet(defaults),
+		routes:   make(map[string]map[string]bool),
+	}
+}
+
+// Allow accepts the content types on one route, named by its method and
+// pattern as registered. Routes call it from Register, before serving starts.
+func (c *ContentTypes) Allow(method, pattern string, contentTypes ...string) {
+	key := method + " " + pattern
+	if c.routes[key] == nil {
+		c.routes[key] = make(map[string]bool)
+	}
+	for contentType := range contentTypeSet(contentTypes) {
+		c.routes[key][contentType] = true
+	}
+}
+
+func (c *ContentTypes) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		contentType := strings.ToLower(strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0]))
+		if c.defaults[contentType] || c.allowedOnRoute(r, contentType) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+	})
+}
+
+func (c *ContentTypes) allowedOnRoute(r *http.Request, contentType string) bool {
+	rctx := chi.NewRouteContext()
+	if !c.mux.Match(rctx, r.Method, r.URL.Path) {
+		return false
+	}
+
+	return c.routes[r.Method+" "+rctx.RoutePattern()][contentType]
+}
+
+func contentTypeSet(contentTypes []string) map[string]bool {
+	set := make(map[string]bool, len(contentTypes))
+	for _, contentType := range contentTypes {
+		set[strings.ToLower(strings.TrimSpace(contentType))] = true
+	}
+
+	return set
+}
@@ -0,0 +1,55 @@
+package helpers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestContentTypes(t *testing.T) {
+	mux := chi.NewMux()
+	contentTypes := InitContentTypes(mux, "application/json")
+	mux.Use(contentTypes.Handler)
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	mux.Post("/users/import", ok)
+	mux.Post("/users/{id}", ok)
+	mux.Post("/auth/{provider}/callback", ok)
+	contentTypes.Allow(http.MethodPost, "/users/import", "text/csv")
+	contentTypes.Allow(http.MethodPost, "/auth/{provider}/callback", "application/x-www-form-urlencoded")
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{name: "default type anywhere", path: "/users/7", contentType: "application/json", body: "{}", want: http.StatusOK},
+		{name: "default type with parameters", path: "/users/7", contentType: "application/json; charset=utf-8", body: "{}", want: http.StatusOK},
+		{name: "csv on import", path: "/users/import", contentType: "text/csv", body: "username", want: http.StatusOK},
+		{name: "csv upper case on import", path: "/users/import", contentType: "Text/CSV", body: "username", want: http.StatusOK},
+		{name: "csv elsewhere", path: "/users/7", contentType: "text/csv", body: "username", want: http.StatusUnsupportedMediaType},
+		{name: "form on callback pattern", path: "/auth/okta/callback", contentType: "application/x-www-form-urlencoded", body: "a=b", want: http.StatusOK},
+		{name: "form on import", path: "/users/import", contentType: "application/x-www-form-urlencoded", body: "a=b", want: http.StatusUnsupportedMediaType},
+		{name: "unknown route", path: "/nowhere", contentType: "text/csv", body: "username", want: http.StatusUnsupportedMediaType},
+		{name: "empty body", path: "/users/7", contentType: "text/plain", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
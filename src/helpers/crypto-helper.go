@@ -3,23 +3,78 @@ package helpers
 import "golang.org/x/crypto/bcrypt"
 
 type CryptoHelper struct {
+	executor *HashExecutor
+	peppers  *PepperSet
 }
 
-func InitCryptoHelper() *CryptoHelper {
-	return &CryptoHelper{}
+func InitCryptoHelper(executor *HashExecutor, peppers *PepperSet) *CryptoHelper {
+	return &CryptoHelper{
+		executor: executor,
+		peppers:  peppers,
+	}
 }
 
 func (h *CryptoHelper) Encrypt(s string) (string, error) {
-	hashedString, err := bcrypt.GenerateFromPassword([]byte(s), bcrypt.DefaultCost)
+	var hashedString []byte
+
+	err := h.executor.Do(func() error {
+		var err error
+		hashedString, err = bcrypt.GenerateFromPassword([]byte(s), bcrypt.DefaultCost)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
+
 	return string(hashedString), nil
 }
 
-func (h *CryptoHelper) IsHashMatched(hash, s string) bool {
-	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(s)); err != nil {
-		return false
+func (h *CryptoHelper) IsHashMatched(hash, s string) (bool, error) {
+	matched := false
+
+	err := h.executor.Do(func() error {
+		matched = bcrypt.CompareHashAndPassword([]byte(hash), []byte(s)) == nil
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return matched, nil
+}
+
+func (h *CryptoHelper) HashPassword(password string) (string, string, error) {
+	pepperId := h.peppers.CurrentId()
+
+	peppered, err := h.peppers.Apply(pepperId, password)
+	if err != nil {
+		return "", "", err
+	}
+
+	hash, err := h.Encrypt(peppered)
+	if err != nil {
+		return "", "", err
+	}
+
+	return hash, pepperId, nil
+}
+
+func (h *CryptoHelper) IsPasswordMatched(hash, pepperId, password string) (bool, error) {
+	peppered, err := h.peppers.Apply(pepperId, password)
+	if err != nil {
+		return false, err
 	}
-	return true
+
+	return h.IsHashMatched(hash, peppered)
+}
+
+// IsBcryptHash reports whether hash is a well formed bcrypt hash, such as one
+// imported from another system.
+func IsBcryptHash(hash string) bool {
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
+
+func (h *CryptoHelper) NeedsRehash(pepperId string) bool {
+	return pepperId != h.peppers.CurrentId()
 }
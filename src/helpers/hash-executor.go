@@ -0,0 +1,87 @@
+package helpers
+
+import (
+	"errors"
+	"expvar"
+	"time"
+)
+
+var ErrHashQueueTimeout = errors.New("the service is busy, please try again shortly")
+
+var (
+	hashQueueDepth    = expvar.NewInt("hash_queue_depth")
+	hashInFlight      = expvar.NewInt("hash_in_flight")
+	hashRejectedCount = expvar.NewInt("hash_rejected_total")
+	hashCount         = expvar.NewInt("hash_total")
+	hashLatencyTotal  = expvar.NewFloat("hash_latency_ms_total")
+	hashLatencyBucket = expvar.NewMap("hash_latency_ms_bucket")
+)
+
+var hashLatencyBuckets = []struct {
+	name  string
+	limit time.Duration
+}{
+	{"le_50", 50 * time.Millisecond},
+	{"le_100", 100 * time.Millisecond},
+	{"le_250", 250 * time.Millisecond},
+	{"le_500", 500 * time.Millisecond},
+	{"le_1000", time.Second},
+}
+
+type HashExecutor struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+func InitHashExecutor(maxConcurrency int, queueTimeout time.Duration) *HashExecutor {
+	if maxConcurrency <= 0 {
+		maxConcurrency = 1
+	}
+
+	return &HashExecutor{
+		slots:        make(chan struct{}, maxConcurrency),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Do runs fn once a hashing slot is free, giving up with ErrHashQueueTimeout
+// if none becomes available within the queue timeout.
+func (e *HashExecutor) Do(fn func() error) error {
+	hashQueueDepth.Add(1)
+	timer := time.NewTimer(e.queueTimeout)
+
+	select {
+	case e.slots <- struct{}{}:
+		timer.Stop()
+		hashQueueDepth.Add(-1)
+	case <-timer.C:
+		hashQueueDepth.Add(-1)
+		hashRejectedCount.Add(1)
+		return ErrHashQueueTimeout
+	}
+
+	hashInFlight.Add(1)
+	defer func() {
+		hashInFlight.Add(-1)
+		<-e.slots
+	}()
+
+	start := time.Now()
+	err := fn()
+	recordHashLatency(time.Since(start))
+
+	return err
+}
+
+func recordHashLatency(elapsed time.Duration) {
+	hashCount.Add(1)
+	hashLatencyTotal.Add(float64(elapsed) / float64(time.Millisecond))
+
+	for _, bucket := range hashLatencyBuckets {
+		if elapsed <= bucket.limit {
+			hashLatencyBucket.Add(bucket.name, 1)
+			return
+		}
+	}
+	hashLatencyBucket.Add("gt_1000", 1)
+}
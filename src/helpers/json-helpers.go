@@ -63,6 +63,12 @@ func (h *JsonHelpers) WriteJSON(w http.ResponseWriter, status int, data any, hea
 }
 
 func (h *JsonHelpers) ErrorJSON(w http.ResponseWriter, err error, status int, errSource string) error {
+	return h.ErrorCodeJSON(w, err, status, "", errSource)
+}
+
+// ErrorCodeJSON adds a machine readable code so clients can tell apart
+// errors that share a status code.
+func (h *JsonHelpers) ErrorCodeJSON(w http.ResponseWriter, err error, status int, code, errSource string) error {
 	statusCode := http.StatusBadRequest
 
 	if status > 0 {
@@ -71,6 +77,7 @@ func (h *JsonHelpers) ErrorJSON(w http.ResponseWriter, err error, status int, er
 
 	var payload dtos.JsonResponseDto
 	payload.Error = true
+	payload.Code = code
 	payload.Message = err.Error()
 
 	h.logger.Errorf("error in %s: Err: %v", errSource, err)
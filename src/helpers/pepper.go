@@ -0,0 +1,49 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+type PepperSet struct {
+	currentId string
+	peppers   map[string][]byte
+}
+
+func InitPepperSet(currentId string, peppers map[string][]byte) (*PepperSet, error) {
+	if len(currentId) > 0 {
+		if _, ok := peppers[currentId]; !ok {
+			return nil, fmt.Errorf("no secret has been configured for the current pepper %s", currentId)
+		}
+	}
+
+	return &PepperSet{
+		currentId: currentId,
+		peppers:   peppers,
+	}, nil
+}
+
+func (p *PepperSet) CurrentId() string {
+	return p.currentId
+}
+
+// Apply returns the password keyed with the given pepper. An empty pepperId
+// means the hash pre-dates peppering and the password is returned unchanged.
+func (p *PepperSet) Apply(pepperId, password string) (string, error) {
+	if len(pepperId) == 0 {
+		return password, nil
+	}
+
+	secret, ok := p.peppers[pepperId]
+	if !ok {
+		return "", fmt.Errorf("unknown pepper %s", pepperId)
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(password))
+
+	// base64 keeps the result inside bcrypt's 72 byte input limit
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
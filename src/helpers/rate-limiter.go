@@ -0,0 +1,69 @@
+package helpers
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter allows each key, such as a client's IP address, a number of
+// events per window, counted in fixed windows. Counts are kept in memory, so
+// each instance of the service limits on its own.
+type RateLimiter struct {
+	limit     int
+	window    time.Duration
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func InitRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:     limit,
+		window:    window,
+		windows:   map[string]*rateWindow{},
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow counts an event for the key, returning false along with how long
+// until the key is allowed again once it is over the limit.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+
+	if w.count >= l.limit {
+		return false, w.start.Add(l.window).Sub(now)
+	}
+
+	w.count++
+	return true, 0
+}
+
+// sweep forgets windows that have ended, at most once per window.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+
+	l.lastSweep = now
+}
@@ -0,0 +1,46 @@
+package helpers
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type requestMetadataCtxKey struct{}
+
+type RequestMetadata struct {
+	IPAddress string
+	UserAgent string
+	RequestId string
+}
+
+// RequestMetadataMiddleware must run after chi's RequestID middleware.
+func RequestMetadataMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		metadata := RequestMetadata{
+			IPAddress: ip,
+			UserAgent: r.UserAgent(),
+			RequestId: middleware.GetReqID(r.Context()),
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithRequestMetadata(r.Context(), metadata)))
+	})
+}
+
+// WithRequestMetadata lets callers outside an HTTP request, such as the
+// operator commands, say where a change came from.
+func WithRequestMetadata(ctx context.Context, metadata RequestMetadata) context.Context {
+	return context.WithValue(ctx, requestMetadataCtxKey{}, metadata)
+}
+
+func RequestMetadataFromContext(ctx context.Context) RequestMetadata {
+	metadata, _ := ctx.Value(requestMetadataCtxKey{}).(RequestMetadata)
+	return metadata
+}
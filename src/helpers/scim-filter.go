@@ -0,0 +1,342 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ScimFilter is a parsed SCIM filter expression (RFC 7644 section 3.4.2.2),
+// one of ScimCompareFilter, ScimLogicalFilter or ScimNotFilter.
+type ScimFilter interface {
+	scimFilter()
+}
+
+// ScimCompareFilter compares an attribute with a value. Attribute paths are
+// lower cased with any core schema URN removed, and sub-attributes of a value
+// path such as emails[value eq "x"] are joined to it as emails.value. Value
+// is a string, float64, bool or nil, and is nil for the pr operator.
+type ScimCompareFilter struct {
+	Attribute string
+	Operator  string
+	Value     interface{}
+}
+
+type ScimLogicalFilter struct {
+	Operator string
+	Left     ScimFilter
+	Right    ScimFilter
+}
+
+type ScimNotFilter struct {
+	Filter ScimFilter
+}
+
+func (ScimCompareFilter) scimFilter() {}
+func (ScimLogicalFilter) scimFilter() {}
+func (ScimNotFilter) scimFilter()     {}
+
+var ErrInvalidScimFilter = errors.New("invalid filter")
+
+var scimCompareOperators = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+var scimSchemaPrefixes = []string{
+	"urn:ietf:params:scim:schemas:core:2.0:user:",
+	"urn:ietf:params:scim:schemas:core:2.0:group:",
+}
+
+// ParseScimFilter parses a filter such as
+//
+//	userName eq "bjensen" and (emails co "@example.com" or not (active eq false))
+//
+// Operators and attribute names are case insensitive.
+func ParseScimFilter(filter string) (ScimFilter, error) {
+	tokens, err := tokenizeScimFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &scimFilterParser{tokens: tokens}
+	expr, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.done() {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidScimFilter, p.peek().text)
+	}
+
+	return expr, nil
+}
+
+// NormalizeScimPath lower cases an attribute path and removes any core schema
+// URN from the front of it.
+func NormalizeScimPath(path string) string {
+	path = strings.ToLower(strings.TrimSpace(path))
+	for _, prefix := range scimSchemaPrefixes {
+		path = strings.TrimPrefix(path, prefix)
+	}
+
+	return path
+}
+
+const (
+	scimTokenWord = iota
+	scimTokenString
+	scimTokenPunct
+)
+
+type scimToken struct {
+	kind int
+	text string
+}
+
+func tokenizeScimFilter(filter string) ([]scimToken, error) {
+	tokens := []scimToken{}
+	runes := []rune(filter)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == '[' || r == ']':
+			tokens = append(tokens, scimToken{kind: scimTokenPunct, text: string(r)})
+			i++
+		case r == '"':
+			// strings are JSON strings, so decode them as such
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidScimFilter)
+			}
+
+			var value string
+			if err := json.Unmarshal([]byte(string(runes[i:j+1])), &value); err != nil {
+				return nil, fmt.Errorf("%w: invalid string %s", ErrInvalidScimFilter, string(runes[i:j+1]))
+			}
+			tokens = append(tokens, scimToken{kind: scimTokenString, text: value})
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(`()[]"`, runes[j]) {
+				j++
+			}
+			tokens = append(tokens, scimToken{kind: scimTokenWord, text: string(runes[i:j])})
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
+
+type scimFilterParser struct {
+	tokens []scimToken
+	pos    int
+}
+
+func (p *scimFilterParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *scimFilterParser) peek() scimToken {
+	if p.done() {
+		return scimToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *scimFilterParser) next() scimToken {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *scimFilterParser) isKeyword(keyword string) bool {
+	token := p.peek()
+	return token.kind == scimTokenWord && strings.EqualFold(token.text, keyword)
+}
+
+func (p *scimFilterParser) isPunct(punct string) bool {
+	token := p.peek()
+	return token.kind == scimTokenPunct && token.text == punct
+}
+
+func (p *scimFilterParser) expectPunct(punct string) error {
+	if !p.isPunct(punct) {
+		return fmt.Errorf("%w: expected %q", ErrInvalidScimFilter, punct)
+	}
+	p.pos++
+	return nil
+}
+
+// The parse functions carry the attribute of the enclosing value path, if
+// any, so sub-attributes inside [] are joined to it.
+
+func (p *scimFilterParser) parseOr(parent string) (ScimFilter, error) {
+	left, err := p.parseAnd(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd(parent)
+		if err != nil {
+			return nil, err
+		}
+		left = ScimLogicalFilter{Operator: "or", Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd(parent string) (ScimFilter, error) {
+	left, err := p.parseUnary(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("and") {
+		p.pos++
+		right, err := p.parseUnary(parent)
+		if err != nil {
+			return nil, err
+		}
+		left = ScimLogicalFilter{Operator: "and", Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *scimFilterParser) parseUnary(parent string) (ScimFilter, error) {
+	if p.isKeyword("not") {
+		p.pos++
+		if !p.isPunct("(") {
+			return nil, fmt.Errorf("%w: not must be followed by a parenthesised expression", ErrInvalidScimFilter)
+		}
+
+		expr, err := p.parseUnary(parent)
+		if err != nil {
+			return nil, err
+		}
+		return ScimNotFilter{Filter: expr}, nil
+	}
+
+	if p.isPunct("(") {
+		p.pos++
+		expr, err := p.parseOr(parent)
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expectPunct(")")
+	}
+
+	return p.parseComparison(parent)
+}
+
+func (p *scimFilterParser) parseComparison(parent string) (ScimFilter, error) {
+	token := p.next()
+	if token.kind != scimTokenWord {
+		return nil, fmt.Errorf("%w: expected an attribute", ErrInvalidScimFilter)
+	}
+
+	attribute := NormalizeScimPath(token.text)
+	if len(parent) > 0 {
+		attribute = parent + "." + attribute
+	}
+
+	if p.isPunct("[") {
+		if len(parent) > 0 {
+			return nil, fmt.Errorf("%w: value paths cannot be nested", ErrInvalidScimFilter)
+		}
+
+		p.pos++
+		expr, err := p.parseOr(attribute)
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expectPunct("]")
+	}
+
+	operator := strings.ToLower(p.next().text)
+	if operator == "pr" {
+		return ScimCompareFilter{Attribute: attribute, Operator: operator}, nil
+	}
+
+	if !scimCompareOperators[operator] {
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidScimFilter, operator)
+	}
+
+	if p.done() {
+		return nil, fmt.Errorf("%w: expected a value after %s", ErrInvalidScimFilter, operator)
+	}
+
+	valueToken := p.next()
+	var value interface{}
+
+	switch {
+	case valueToken.kind == scimTokenString:
+		value = valueToken.text
+	case valueToken.kind == scimTokenWord:
+		if err := json.Unmarshal([]byte(strings.ToLower(valueToken.text)), &value); err != nil {
+			return nil, fmt.Errorf("%w: invalid value %q", ErrInvalidScimFilter, valueToken.text)
+		}
+		if _, ok := value.(string); ok {
+			return nil, fmt.Errorf("%w: invalid value %q", ErrInvalidScimFilter, valueToken.text)
+		}
+	default:
+		return nil, fmt.Errorf("%w: expected a value after %s", ErrInvalidScimFilter, operator)
+	}
+
+	return ScimCompareFilter{Attribute: attribute, Operator: operator, Value: value}, nil
+}
+
+// ScimPath is the target of a PATCH operation, such as name.givenName,
+// members[value eq "2"] or emails[type eq "work"].value.
+type ScimPath struct {
+	Attribute    string
+	Filter       ScimFilter
+	SubAttribute string
+}
+
+func ParseScimPath(path string) (ScimPath, error) {
+	path = strings.TrimSpace(path)
+
+	open := strings.Index(path, "[")
+	if open < 0 {
+		return ScimPath{Attribute: NormalizeScimPath(path)}, nil
+	}
+
+	close := strings.LastIndex(path, "]")
+	if close < open {
+		return ScimPath{}, fmt.Errorf("%w: unterminated value path %q", ErrInvalidScimFilter, path)
+	}
+
+	// parsed as a value path filter so its attributes are joined to the path
+	filter, err := ParseScimFilter(path[:close+1])
+	if err != nil {
+		return ScimPath{}, err
+	}
+
+	scimPath := ScimPath{Attribute: NormalizeScimPath(path[:open]), Filter: filter}
+
+	if rest := path[close+1:]; len(rest) > 0 {
+		if !strings.HasPrefix(rest, ".") || len(rest) == 1 {
+			return ScimPath{}, fmt.Errorf("%w: invalid path %q", ErrInvalidScimFilter, path)
+		}
+		scimPath.SubAttribute = strings.ToLower(rest[1:])
+	}
+
+	return scimPath, nil
+}
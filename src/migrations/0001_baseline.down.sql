@@ -0,0 +1,3 @@
+-- The baseline is never rolled back: it holds the append-only audit log,
+-- which must outlive any rollback. See DatabaseMigration.Down.
+SELECT 1;
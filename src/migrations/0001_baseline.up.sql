@@ -0,0 +1,192 @@
+-- Baseline schema. Every statement is idempotent so databases created by the
+-- old AutoMigrate based start up are brought to the same state as new ones.
+
+-- users
+ALTER TABLE IF EXISTS users DROP CONSTRAINT IF EXISTS uni_users_username;
+ALTER TABLE IF EXISTS users DROP CONSTRAINT IF EXISTS users_username_key;
+DROP INDEX IF EXISTS idx_users_email_address;
+
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    username text,
+    password text,
+    email_address text,
+    first_name text,
+    surname text
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pepper_id text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified boolean;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status text DEFAULT 'active';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_reason text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_changed_by text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_changed_at timestamptz;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_revoked_at timestamptz;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS erased_at timestamptz;
+
+-- the boolean locked column was folded into status
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'locked') THEN
+        UPDATE users SET status = 'locked' WHERE locked = true;
+        ALTER TABLE users DROP COLUMN locked;
+    END IF;
+END
+$$;
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_users_status ON users (status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_active ON users (username) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_address_active ON users (email_address) WHERE deleted_at IS NULL;
+
+-- claims
+CREATE TABLE IF NOT EXISTS claims (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    claim text CONSTRAINT uni_claims_claim UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS idx_claims_deleted_at ON claims (deleted_at);
+
+INSERT INTO claims (created_at, updated_at, claim)
+VALUES (now(), now(), 'Administrator'), (now(), now(), 'User')
+ON CONFLICT DO NOTHING;
+
+-- user_claims, clearing out revoked and duplicate grants before the unique
+-- index is created
+CREATE TABLE IF NOT EXISTS user_claims (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id bigint,
+    claim_id bigint
+);
+
+DELETE FROM user_claims WHERE deleted_at IS NOT NULL;
+DELETE FROM user_claims a USING user_claims b
+    WHERE a.id > b.id AND a.user_id = b.user_id AND a.claim_id = b.claim_id;
+
+CREATE INDEX IF NOT EXISTS idx_user_claims_deleted_at ON user_claims (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_claims_user_claim ON user_claims (user_id, claim_id);
+
+-- user_sessions
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    session_id text,
+    user_id bigint,
+    auth_method text,
+    ip_address text,
+    user_agent text,
+    last_seen_at timestamptz,
+    expires_at timestamptz,
+    revoked_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_created_at ON user_sessions (created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_sessions_session_id ON user_sessions (session_id);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions (user_id);
+
+-- outbox and webhooks
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    event_type text,
+    user_id bigint,
+    payload jsonb,
+    dispatched_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_created_at ON outbox_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_event_type ON outbox_events (event_type);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_user_id ON outbox_events (user_id);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_dispatched_at ON outbox_events (dispatched_at);
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    url text,
+    secret text,
+    event_types text
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_deleted_at ON webhook_subscriptions (deleted_at);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    subscription_id bigint,
+    outbox_event_id bigint,
+    event_type text,
+    status text DEFAULT 'pending',
+    attempts bigint,
+    next_attempt_at timestamptz,
+    last_attempt_at timestamptz,
+    response_status bigint,
+    last_error text,
+    delivered_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription_event ON webhook_deliveries (subscription_id, outbox_event_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries (status);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_next_attempt_at ON webhook_deliveries (next_attempt_at);
+
+-- audit log
+CREATE TABLE IF NOT EXISTS audit_events (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    event_type text,
+    outcome text,
+    actor_user_id bigint,
+    target_user_id bigint,
+    target text,
+    ip_address text,
+    user_agent text,
+    request_id text,
+    details text
+);
+
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS prev_hash text;
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS hash text;
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_event_type ON audit_events (event_type);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_user_id ON audit_events (actor_user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target_user_id ON audit_events (target_user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_request_id ON audit_events (request_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_hash ON audit_events (hash);
+
+CREATE TABLE IF NOT EXISTS audit_checkpoints (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    last_event_id bigint,
+    last_event_hash text,
+    key_id text,
+    signature text
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_checkpoints_created_at ON audit_checkpoints (created_at);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+DROP TRIGGER IF EXISTS audit_checkpoints_append_only ON audit_checkpoints;
+CREATE TRIGGER audit_checkpoints_append_only BEFORE UPDATE OR DELETE ON audit_checkpoints
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_claims_external_id;
+DROP INDEX IF EXISTS idx_users_external_id;
+
+ALTER TABLE claims DROP COLUMN IF EXISTS external_id;
+ALTER TABLE users DROP COLUMN IF EXISTS external_id;
@@ -0,0 +1,6 @@
+-- externalId of SCIM users and groups, set by the provisioning client
+ALTER TABLE users ADD COLUMN IF NOT EXISTS external_id text;
+ALTER TABLE claims ADD COLUMN IF NOT EXISTS external_id text;
+
+CREATE INDEX IF NOT EXISTS idx_users_external_id ON users (external_id);
+CREATE INDEX IF NOT EXISTS idx_claims_external_id ON claims (external_id);
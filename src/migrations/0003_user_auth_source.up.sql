@@ -0,0 +1,2 @@
+-- where each user's password is checked, local or a directory such as ldap
+ALTER TABLE users ADD COLUMN IF NOT EXISTS auth_source text NOT NULL DEFAULT 'local';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS federated_logins;
+DROP TABLE IF EXISTS user_identities;
@@ -0,0 +1,27 @@
+-- accounts at external identity providers linked to users
+CREATE TABLE IF NOT EXISTS user_identities (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    user_id bigint,
+    provider text,
+    subject text,
+    email_address text,
+    last_login_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_provider_subject ON user_identities (provider, subject);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_user_provider ON user_identities (user_id, provider);
+
+-- logins in progress at an identity provider, deleted once completed
+CREATE TABLE IF NOT EXISTS federated_logins (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    state text,
+    provider text,
+    nonce text,
+    code_verifier text,
+    expires_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_federated_logins_state ON federated_logins (state);
+CREATE INDEX IF NOT EXISTS idx_federated_logins_expires_at ON federated_logins (expires_at);
@@ -0,0 +1 @@
+ALTER TABLE federated_logins DROP COLUMN IF EXISTS link_user_id;
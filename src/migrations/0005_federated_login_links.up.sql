@@ -0,0 +1,2 @@
+-- the user linking an identity provider account, for logins that link one
+ALTER TABLE federated_logins ADD COLUMN IF NOT EXISTS link_user_id bigint;
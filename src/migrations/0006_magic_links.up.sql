@@ -0,0 +1,16 @@
+-- single use sign in links emailed to users, kept for a day for rate limiting
+CREATE TABLE IF NOT EXISTS magic_links (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    user_id bigint,
+    token_hash text,
+    binding_hash text,
+    email_address text,
+    ip_address text,
+    expires_at timestamptz,
+    consumed_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_magic_links_created_at ON magic_links (created_at);
+CREATE INDEX IF NOT EXISTS idx_magic_links_user_id ON magic_links (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_magic_links_token_hash ON magic_links (token_hash);
@@ -0,0 +1,17 @@
+-- long lived credentials for scripts and service accounts, stored hashed
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    user_id bigint,
+    name text,
+    prefix text,
+    key_hash text,
+    scopes text,
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    last_used_ip text,
+    revoked_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_key_hash ON api_keys (key_hash);
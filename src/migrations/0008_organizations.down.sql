@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_user_claims_organization_id;
+ALTER TABLE user_claims DROP COLUMN IF EXISTS organization_id;
+
+DROP INDEX IF EXISTS idx_users_organization_id;
+ALTER TABLE users DROP COLUMN IF EXISTS organization_id;
+
+DROP TABLE IF EXISTS organizations;
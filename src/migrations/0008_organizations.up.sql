@@ -0,0 +1,18 @@
+-- organizations, the tenants users and the claims they hold belong to
+CREATE TABLE IF NOT EXISTS organizations (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    slug text,
+    name text
+);
+
+CREATE INDEX IF NOT EXISTS idx_organizations_deleted_at ON organizations (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organizations_slug_active ON organizations (slug) WHERE deleted_at IS NULL;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS organization_id bigint;
+CREATE INDEX IF NOT EXISTS idx_users_organization_id ON users (organization_id);
+
+ALTER TABLE user_claims ADD COLUMN IF NOT EXISTS organization_id bigint;
+CREATE INDEX IF NOT EXISTS idx_user_claims_organization_id ON user_claims (organization_id);
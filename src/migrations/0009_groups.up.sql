@@ -0,0 +1,46 @@
+-- groups holding claims their members, and the members of their subgroups,
+-- inherit
+CREATE TABLE IF NOT EXISTS groups (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name text,
+    description text,
+    organization_id bigint
+);
+
+CREATE INDEX IF NOT EXISTS idx_groups_deleted_at ON groups (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_groups_organization_id ON groups (organization_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_groups_organization_name_active
+    ON groups (COALESCE(organization_id, 0), lower(name)) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS group_members (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    group_id bigint,
+    user_id bigint
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_members_group_user ON group_members (group_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_group_members_user_id ON group_members (user_id);
+
+CREATE TABLE IF NOT EXISTS group_claims (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    group_id bigint,
+    claim_id bigint
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_claims_group_claim ON group_claims (group_id, claim_id);
+CREATE INDEX IF NOT EXISTS idx_group_claims_claim_id ON group_claims (claim_id);
+
+CREATE TABLE IF NOT EXISTS group_subgroups (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    group_id bigint,
+    subgroup_id bigint
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_subgroups_group_subgroup ON group_subgroups (group_id, subgroup_id);
+CREATE INDEX IF NOT EXISTS idx_group_subgroups_subgroup_id ON group_subgroups (subgroup_id);
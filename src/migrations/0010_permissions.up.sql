@@ -0,0 +1,44 @@
+-- permissions, and the roles, which are claims, that bundle them
+CREATE TABLE IF NOT EXISTS permissions (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    name text,
+    description text
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_permissions_name ON permissions (name);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    claim_id bigint,
+    permission_id bigint
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_role_permissions_claim_permission ON role_permissions (claim_id, permission_id);
+CREATE INDEX IF NOT EXISTS idx_role_permissions_permission_id ON role_permissions (permission_id);
+
+INSERT INTO permissions (created_at, name, description)
+VALUES
+    (now(), 'users:read', 'list and view users and export their data'),
+    (now(), 'users:write', 'add, import, suspend, reactivate, restore and verify users'),
+    (now(), 'users:erase', 'erase the personal data of users'),
+    (now(), 'claims:read', 'view roles, their permissions and who holds them'),
+    (now(), 'claims:write', 'define roles and permissions and grant roles to users'),
+    (now(), 'groups:read', 'view groups'),
+    (now(), 'groups:write', 'manage groups, their members and roles'),
+    (now(), 'organizations:read', 'view organizations'),
+    (now(), 'organizations:write', 'create organizations and move users between them'),
+    (now(), 'service_accounts:read', 'view service account API keys'),
+    (now(), 'service_accounts:write', 'create service accounts and manage their API keys'),
+    (now(), 'webhooks:read', 'view webhook subscriptions and deliveries'),
+    (now(), 'webhooks:write', 'manage webhook subscriptions'),
+    (now(), 'audit:read', 'query the audit log'),
+    (now(), 'events:read', 'read the event feed')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (created_at, claim_id, permission_id)
+SELECT now(), claims.id, permissions.id
+FROM claims CROSS JOIN permissions
+WHERE claims.claim = 'Administrator' AND claims.deleted_at IS NULL
+ON CONFLICT (claim_id, permission_id) DO NOTHING;
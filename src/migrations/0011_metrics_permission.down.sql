@@ -0,0 +1,4 @@
+DELETE FROM role_permissions
+WHERE permission_id IN (SELECT id FROM permissions WHERE name = 'metrics:read');
+
+DELETE FROM permissions WHERE name = 'metrics:read';
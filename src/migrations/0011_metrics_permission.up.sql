@@ -0,0 +1,10 @@
+-- the permission to read the service's metrics at /debug/vars
+INSERT INTO permissions (created_at, name, description)
+VALUES (now(), 'metrics:read', 'read the service metrics')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (created_at, claim_id, permission_id)
+SELECT now(), claims.id, permissions.id
+FROM claims CROSS JOIN permissions
+WHERE claims.claim = 'Administrator' AND claims.deleted_at IS NULL AND permissions.name = 'metrics:read'
+ON CONFLICT (claim_id, permission_id) DO NOTHING;
@@ -0,0 +1,9 @@
+// Package migrations embeds the versioned SQL migrations. Each version has a
+// <version>_<name>.up.sql file and a matching .down.sql file; applied files
+// must never be edited, add a new version instead.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var Files embed.FS
@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// apiKeyUseInterval is how often a key's last use is written, so busy keys do
+// not cost a write on every request.
+const apiKeyUseInterval = time.Minute
+
+type ApiKeyRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func InitApiKeyRepository(serviceCfg *config.ServiceConfig) *ApiKeyRepository {
+	return &ApiKeyRepository{
+		db:     serviceCfg.Db,
+		logger: serviceCfg.Logger,
+	}
+}
+
+func (r *ApiKeyRepository) Add(key domain.ApiKey) (domain.ApiKey, error) {
+	if err := r.db.Create(&key).Error; err != nil {
+		r.logger.Errorf("error adding API key for user id %d with error %v", key.UserId, err)
+		return key, err
+	}
+
+	return key, nil
+}
+
+func (r *ApiKeyRepository) GetByHash(keyHash string) (domain.ApiKey, error) {
+	var key domain.ApiKey
+
+	if err := r.db.First(&key, "key_hash = ?", keyHash).Error; err != nil {
+		return domain.ApiKey{}, err
+	}
+
+	return key, nil
+}
+
+// GetByUserId returns the user's keys that have not been revoked, newest
+// first.
+func (r *ApiKeyRepository) GetByUserId(userId uint) ([]domain.ApiKey, error) {
+	var keys []domain.ApiKey
+
+	err := r.db.
+		Where("user_id = ? AND revoked_at IS NULL", userId).
+		Order("created_at DESC").
+		Find(&keys).
+		Error
+	if err != nil {
+		r.logger.Errorf("error getting API keys for user id %d with error %v", userId, err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Revoke revokes the key if it belongs to the user, returning the number of
+// keys revoked.
+func (r *ApiKeyRepository) Revoke(userId, keyId uint) (int64, error) {
+	result := r.db.Model(&domain.ApiKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyId, userId).
+		Update("revoked_at", time.Now())
+
+	if result.Error != nil {
+		r.logger.Errorf("error revoking API key %d of user id %d with error %v", keyId, userId, result.Error)
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
+
+// RecordUse stores when and where the key was last used, at most once per
+// apiKeyUseInterval.
+func (r *ApiKeyRepository) RecordUse(keyId uint, ipAddress string) error {
+	now := time.Now()
+
+	err := r.db.Model(&domain.ApiKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", keyId, now.Add(-apiKeyUseInterval)).
+		Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": ipAddress,
+		}).
+		Error
+
+	if err != nil {
+		r.logger.Errorf("error recording use of API key %d with error %v", keyId, err)
+		return err
+	}
+
+	return nil
+}
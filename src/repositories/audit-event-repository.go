@@ -0,0 +1,186 @@
+package repositories
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	auditChainLockKey = 734001
+)
+
+type AuditEventRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func InitAuditEventRepository(serviceCfg *config.ServiceConfig) *AuditEventRepository {
+	return &AuditEventRepository{
+		db:     serviceCfg.Db,
+		logger: serviceCfg.Logger,
+	}
+}
+
+// Add links the event onto the end of the hash chain. An advisory lock
+// serialises writers so two events can never claim the same predecessor.
+func (r *AuditEventRepository) Add(event domain.AuditEvent) (domain.AuditEvent, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLockKey).Error; err != nil {
+			return err
+		}
+
+		var last domain.AuditEvent
+		if err := tx.Order("id DESC").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+
+		event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		event.PrevHash = last.Hash
+		event.Hash = event.ComputeHash()
+
+		return tx.Create(&event).Error
+	})
+
+	if err != nil {
+		r.logger.Errorf("error recording audit event %s with error %v", event.EventType, err)
+		return event, err
+	}
+
+	return event, nil
+}
+
+func (r *AuditEventRepository) GetLatest() (domain.AuditEvent, error) {
+	var event domain.AuditEvent
+
+	if err := r.db.Order("id DESC").First(&event).Error; err != nil {
+		return domain.AuditEvent{}, err
+	}
+
+	return event, nil
+}
+
+func (r *AuditEventRepository) GetById(id uint) (domain.AuditEvent, error) {
+	var event domain.AuditEvent
+
+	if err := r.db.First(&event, id).Error; err != nil {
+		return domain.AuditEvent{}, err
+	}
+
+	return event, nil
+}
+
+// GetBatchAfter returns up to limit events with an id above afterId in chain
+// order.
+func (r *AuditEventRepository) GetBatchAfter(afterId uint, limit int) ([]domain.AuditEvent, error) {
+	var events []domain.AuditEvent
+
+	if err := r.db.Where("id > ?", afterId).Order("id").Limit(limit).Find(&events).Error; err != nil {
+		r.logger.Errorf("error reading audit events after id %d with error %v", afterId, err)
+		return []domain.AuditEvent{}, err
+	}
+
+	return events, nil
+}
+
+func (r *AuditEventRepository) AddCheckpoint(checkpoint domain.AuditCheckpoint) (domain.AuditCheckpoint, error) {
+	if err := r.db.Create(&checkpoint).Error; err != nil {
+		r.logger.Errorf("error recording audit checkpoint with error %v", err)
+		return checkpoint, err
+	}
+
+	return checkpoint, nil
+}
+
+func (r *AuditEventRepository) GetLatestCheckpoint() (domain.AuditCheckpoint, error) {
+	var checkpoint domain.AuditCheckpoint
+
+	if err := r.db.Order("id DESC").First(&checkpoint).Error; err != nil {
+		return domain.AuditCheckpoint{}, err
+	}
+
+	return checkpoint, nil
+}
+
+func (r *AuditEventRepository) GetCheckpoints() ([]domain.AuditCheckpoint, error) {
+	var checkpoints []domain.AuditCheckpoint
+
+	if err := r.db.Order("id").Find(&checkpoints).Error; err != nil {
+		r.logger.Errorf("error reading audit checkpoints with error %v", err)
+		return []domain.AuditCheckpoint{}, err
+	}
+
+	return checkpoints, nil
+}
+
+// List returns events newest first. Within an organization only events by or
+// about its users are listed.
+func (r *AuditEventRepository) List(scope TenantScope, query dtos.AuditEventQueryDto) ([]domain.AuditEvent, error) {
+	var events []domain.AuditEvent
+
+	tx := r.db.Model(&domain.AuditEvent{})
+
+	if !scope.all {
+		members := r.db.Unscoped().Model(&domain.User{}).Select("id").Scopes(scope.where("users"))
+		tx = tx.Where("(target_user_id IN (?) OR actor_user_id IN (?))", members, members)
+	}
+
+	if len(query.EventType) > 0 {
+		tx = tx.Where("event_type = ?", query.EventType)
+	}
+
+	if len(query.Outcome) > 0 {
+		tx = tx.Where("outcome = ?", query.Outcome)
+	}
+
+	if query.ActorUserId != nil {
+		tx = tx.Where("actor_user_id = ?", *query.ActorUserId)
+	}
+
+	if query.TargetUserId != nil {
+		tx = tx.Where("target_user_id = ?", *query.TargetUserId)
+	}
+
+	if len(query.RequestId) > 0 {
+		tx = tx.Where("request_id = ?", query.RequestId)
+	}
+
+	if query.From != nil {
+		tx = tx.Where("created_at >= ?", *query.From)
+	}
+
+	if query.To != nil {
+		tx = tx.Where("created_at < ?", *query.To)
+	}
+
+	if query.BeforeId > 0 {
+		tx = tx.Where("id < ?", query.BeforeId)
+	}
+
+	if err := tx.Order("id DESC").Limit(query.Limit).Find(&events).Error; err != nil {
+		r.logger.Errorf("error listing audit events with error %v", err)
+		return []domain.AuditEvent{}, err
+	}
+
+	return events, nil
+}
+
+func (r *AuditEventRepository) GetByUserId(userId uint) ([]domain.AuditEvent, error) {
+	var events []domain.AuditEvent
+
+	err := r.db.
+		Where("actor_user_id = ? OR target_user_id = ?", userId, userId).
+		Order("id").
+		Find(&events).
+		Error
+	if err != nil {
+		r.logger.Errorf("error getting audit events for user id %d with error %v", userId, err)
+		return []domain.AuditEvent{}, err
+	}
+
+	return events, nil
+}
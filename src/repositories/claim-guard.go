@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// serialises changes to who holds a claim, directly or through group
+	// nesting and membership, so two changes made side by side cannot
+	// together form a cycle or leave no one holding a guarded claim
+	claimHoldersLockKey = 734003
+)
+
+var (
+	// ErrClaimUnheld is returned when a change would leave no user holding
+	// a guarded claim that was held before it.
+	ErrClaimUnheld = errors.New("no user would be left holding the claim")
+)
+
+// ClaimGuard names a claim at least one user in the scope must still hold
+// after a change that may take it away from users.
+type ClaimGuard struct {
+	Scope   TenantScope
+	ClaimId uint
+}
+
+// guardClaim makes the change in a transaction, rolling it back with
+// ErrClaimUnheld if it leaves nobody in the guard's scope holding the claim.
+func guardClaim(db *gorm.DB, guard ClaimGuard, change func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := lockClaimHolders(tx); err != nil {
+			return err
+		}
+
+		before, err := countClaimHolders(tx, guard.Scope, guard.ClaimId)
+		if err != nil {
+			return err
+		}
+
+		if err := change(tx); err != nil {
+			return err
+		}
+
+		after, err := countClaimHolders(tx, guard.Scope, guard.ClaimId)
+		if err != nil {
+			return err
+		}
+
+		if before > 0 && after == 0 {
+			return ErrClaimUnheld
+		}
+
+		return nil
+	})
+}
+
+func lockClaimHolders(tx *gorm.DB) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", claimHoldersLockKey).Error
+}
@@ -3,6 +3,7 @@ package repositories
 import (
 	"authservice/src/config"
 	"authservice/src/domain"
+	"errors"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -21,7 +22,15 @@ func InitClaimRepository(serviceCfg *config.ServiceConfig) *ClaimRepository {
 }
 
 func (r *ClaimRepository) Add(claim domain.Claim) (domain.Claim, error) {
-	if err := r.db.Create(&claim).Error; err != nil {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&claim).Error; err != nil {
+			return err
+		}
+
+		return addClaimOutboxEvent(tx, domain.EventClaimCreated, claim)
+	})
+
+	if err != nil {
 		r.logger.Errorf("error creating claim %+v with error %v", claim, err)
 		return claim, err
 	}
@@ -29,8 +38,18 @@ func (r *ClaimRepository) Add(claim domain.Claim) (domain.Claim, error) {
 	return claim, nil
 }
 
+// Update renames the claim. The external id is only ever set through SCIM, so
+// it is left alone.
 func (r *ClaimRepository) Update(claim domain.Claim) error {
-	if err := r.db.Save(&claim).Error; err != nil {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.Claim{}).Where("id = ?", claim.ID).Update("claim", claim.Claim).Error; err != nil {
+			return err
+		}
+
+		return addClaimOutboxEvent(tx, domain.EventClaimUpdated, claim)
+	})
+
+	if err != nil {
 		r.logger.Errorf("error updating claim %+v with error %v", claim, err)
 		return err
 	}
@@ -39,7 +58,15 @@ func (r *ClaimRepository) Update(claim domain.Claim) error {
 }
 
 func (r *ClaimRepository) Delete(claim domain.Claim) error {
-	if err := r.db.Delete(&claim).Error; err != nil {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&claim).Error; err != nil {
+			return err
+		}
+
+		return addClaimOutboxEvent(tx, domain.EventClaimDeleted, claim)
+	})
+
+	if err != nil {
 		r.logger.Errorf("error deleting claim %+v with error %v", claim, err)
 		return err
 	}
@@ -47,6 +74,26 @@ func (r *ClaimRepository) Delete(claim domain.Claim) error {
 	return nil
 }
 
+func addClaimOutboxEvent(tx *gorm.DB, eventType string, claim domain.Claim) error {
+	return addOutboxEvent(tx, eventType, nil, map[string]interface{}{
+		"claim_id": claim.ID,
+		"claim":    claim.Claim,
+	})
+}
+
+func (r *ClaimRepository) GetByName(name string) (domain.Claim, error) {
+	var claim domain.Claim
+
+	if err := r.db.First(&claim, "claim = ?", name).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			r.logger.Errorf("error getting claim %s with error %v", name, err)
+		}
+		return domain.Claim{}, err
+	}
+
+	return claim, nil
+}
+
 func (r *ClaimRepository) GetAll() ([]domain.Claim, error) {
 	var claims []domain.Claim
 
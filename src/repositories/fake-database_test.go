@@ -0,0 +1,130 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeResult is what the fake database answers a statement with: rows for
+// queries, the number of rows affected for everything else.
+type fakeResult struct {
+	columns      []string
+	rows         [][]driver.Value
+	rowsAffected int64
+}
+
+// fakeDatabase stands in for Postgres behind gorm, answering each statement
+// with the test's answer func and recording the statements it was sent,
+// including the BEGIN, COMMIT and ROLLBACK of transactions.
+type fakeDatabase struct {
+	answer     func(query string, args []driver.Value) (fakeResult, error)
+	statements []string
+}
+
+func newFakeDb(t *testing.T, answer func(query string, args []driver.Value) (fakeResult, error)) (*gorm.DB, *fakeDatabase) {
+	t.Helper()
+
+	fake := &fakeDatabase{answer: answer}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(fake)}), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("opening fake database: %v", err)
+	}
+
+	return db, fake
+}
+
+func (f *fakeDatabase) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{db: f}, nil
+}
+
+func (f *fakeDatabase) Driver() driver.Driver {
+	return nil
+}
+
+func (f *fakeDatabase) run(query string, args []driver.NamedValue) (fakeResult, error) {
+	f.statements = append(f.statements, query)
+
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+
+	return f.answer(query, values)
+}
+
+type fakeConn struct {
+	db *fakeDatabase
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.statements = append(c.db.statements, "BEGIN")
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.db.statements = append(c.db.statements, "COMMIT")
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.db.statements = append(c.db.statements, "ROLLBACK")
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(result.rowsAffected), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fakeRows{columns: result.columns, rows: result.rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FederatedLoginRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func InitFederatedLoginRepository(serviceCfg *config.ServiceConfig) *FederatedLoginRepository {
+	return &FederatedLoginRepository{
+		db:     serviceCfg.Db,
+		logger: serviceCfg.Logger,
+	}
+}
+
+// Add stores a new login, clearing out logins that were abandoned and have
+// since expired.
+func (r *FederatedLoginRepository) Add(login domain.FederatedLogin) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&domain.FederatedLogin{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&login).Error
+	})
+
+	if err != nil {
+		r.logger.Errorf("error storing %s login with error %v", login.Provider, err)
+		return err
+	}
+
+	return nil
+}
+
+// Consume deletes and returns the unexpired login with the state, so each
+// state can only be used once.
+func (r *FederatedLoginRepository) Consume(state string) (domain.FederatedLogin, error) {
+	var logins []domain.FederatedLogin
+
+	err := r.db.
+		Clauses(clause.Returning{}).
+		Where("state = ? AND expires_at > ?", state, time.Now()).
+		Delete(&logins).
+		Error
+	if err != nil {
+		r.logger.Errorf("error consuming login state with error %v", err)
+		return domain.FederatedLogin{}, err
+	}
+
+	if len(logins) == 0 {
+		return domain.FederatedLogin{}, gorm.ErrRecordNotFound
+	}
+
+	return logins[0], nil
+}
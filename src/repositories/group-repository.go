@@ -0,0 +1,243 @@
+package repositories
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"errors"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrGroupCycle is returned when a group would become a subgroup of
+	// itself, directly or through other groups.
+	ErrGroupCycle = errors.New("the group would become a subgroup of itself")
+)
+
+type GroupRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func InitGroupRepository(serviceCfg *config.ServiceConfig) *GroupRepository {
+	return &GroupRepository{
+		db:     serviceCfg.Db,
+		logger: serviceCfg.Logger,
+	}
+}
+
+func (r *GroupRepository) Add(group domain.Group) (domain.Group, error) {
+	if err := r.db.Create(&group).Error; err != nil {
+		r.logger.Errorf("error adding group %s with error %v", group.Name, err)
+		return group, err
+	}
+
+	return group, nil
+}
+
+func (r *GroupRepository) GetById(scope TenantScope, groupId uint) (domain.Group, error) {
+	var group domain.Group
+
+	if err := r.db.Scopes(scope.where("groups")).First(&group, groupId).Error; err != nil {
+		return domain.Group{}, err
+	}
+
+	return group, nil
+}
+
+// GetByName matches names regardless of case, as the unique index does.
+func (r *GroupRepository) GetByName(organizationId *uint, name string) (domain.Group, error) {
+	var group domain.Group
+
+	err := r.db.
+		Scopes(InTenant(organizationId).where("groups")).
+		Where("lower(name) = lower(?)", name).
+		First(&group).
+		Error
+	if err != nil {
+		return domain.Group{}, err
+	}
+
+	return group, nil
+}
+
+func (r *GroupRepository) List(scope TenantScope) ([]domain.Group, error) {
+	var groups []domain.Group
+
+	if err := r.db.Scopes(scope.where("groups")).Order("name").Find(&groups).Error; err != nil {
+		r.logger.Errorf("error listing groups with error %v", err)
+		return []domain.Group{}, err
+	}
+
+	return groups, nil
+}
+
+// Delete removes the group along with its memberships, claims and nesting,
+// so its members stop inheriting through it.
+func (r *GroupRepository) Delete(group domain.Group, guard ClaimGuard) error {
+	err := guardClaim(r.db, guard, func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&domain.GroupMember{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("group_id = ?", group.ID).Delete(&domain.GroupClaim{}).Error; err != nil {
+			return err
+		}
+
+		err := tx.Where("group_id = ? OR subgroup_id = ?", group.ID, group.ID).Delete(&domain.GroupSubgroup{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&group).Error
+	})
+
+	if err != nil && !errors.Is(err, ErrClaimUnheld) {
+		r.logger.Errorf("error deleting group %s with error %v", group.Name, err)
+	}
+
+	return err
+}
+
+func (r *GroupRepository) GetMembers(groupId uint) ([]domain.User, error) {
+	var users []domain.User
+
+	err := r.db.
+		Joins("inner join group_members on group_members.user_id = users.id").
+		Where("group_members.group_id = ?", groupId).
+		Order("users.username").
+		Find(&users).
+		Error
+	if err != nil {
+		r.logger.Errorf("error getting members of group %d with error %v", groupId, err)
+		return []domain.User{}, err
+	}
+
+	return users, nil
+}
+
+func (r *GroupRepository) GetClaims(groupId uint) ([]string, error) {
+	claims := []string{}
+
+	err := r.db.
+		Table("claims").
+		Joins("inner join group_claims on group_claims.claim_id = claims.id").
+		Where("group_claims.group_id = ? AND claims.deleted_at IS NULL", groupId).
+		Order("claims.claim").
+		Pluck("claims.claim", &claims).
+		Error
+	if err != nil {
+		r.logger.Errorf("error getting claims of group %d with error %v", groupId, err)
+		return []string{}, err
+	}
+
+	return claims, nil
+}
+
+func (r *GroupRepository) GetSubgroups(groupId uint) ([]domain.Group, error) {
+	var groups []domain.Group
+
+	err := r.db.
+		Joins("inner join group_subgroups on group_subgroups.subgroup_id = groups.id").
+		Where("group_subgroups.group_id = ?", groupId).
+		Order("groups.name").
+		Find(&groups).
+		Error
+	if err != nil {
+		r.logger.Errorf("error getting subgroups of group %d with error %v", groupId, err)
+		return []domain.Group{}, err
+	}
+
+	return groups, nil
+}
+
+// AddMember, AddClaim and AddSubgroup are idempotent, adding what is already
+// there is a no-op.
+func (r *GroupRepository) AddMember(groupId, userId uint) error {
+	member := domain.GroupMember{GroupId: groupId, UserId: userId}
+
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error; err != nil {
+		r.logger.Errorf("error adding user id %d to group %d with error %v", userId, groupId, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *GroupRepository) RemoveMember(groupId, userId uint, guard ClaimGuard) (int64, error) {
+	return r.remove(guard, &domain.GroupMember{}, "group_id = ? AND user_id = ?", groupId, userId)
+}
+
+func (r *GroupRepository) AddClaim(groupId, claimId uint) error {
+	groupClaim := domain.GroupClaim{GroupId: groupId, ClaimId: claimId}
+
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&groupClaim).Error; err != nil {
+		r.logger.Errorf("error adding claim %d to group %d with error %v", claimId, groupId, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *GroupRepository) RemoveClaim(groupId, claimId uint, guard ClaimGuard) (int64, error) {
+	return r.remove(guard, &domain.GroupClaim{}, "group_id = ? AND claim_id = ?", groupId, claimId)
+}
+
+// AddSubgroup returns ErrGroupCycle when the group is the subgroup or one of
+// its subgroups, at any depth.
+func (r *GroupRepository) AddSubgroup(groupId, subgroupId uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockClaimHolders(tx); err != nil {
+			return err
+		}
+
+		var cycles int64
+		err := tx.Raw(`WITH RECURSIVE descendants AS (
+				SELECT CAST(? AS bigint) AS group_id
+				UNION
+				SELECT group_subgroups.subgroup_id FROM group_subgroups
+				INNER JOIN descendants ON descendants.group_id = group_subgroups.group_id
+			)
+			SELECT count(*) FROM descendants WHERE group_id = ?`, subgroupId, groupId).
+			Scan(&cycles).
+			Error
+		if err != nil {
+			return err
+		}
+
+		if cycles > 0 {
+			return ErrGroupCycle
+		}
+
+		nesting := domain.GroupSubgroup{GroupId: groupId, SubgroupId: subgroupId}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&nesting).Error
+	})
+
+	if err != nil && !errors.Is(err, ErrGroupCycle) {
+		r.logger.Errorf("error adding subgroup %d to group %d with error %v", subgroupId, groupId, err)
+	}
+
+	return err
+}
+
+func (r *GroupRepository) RemoveSubgroup(groupId, subgroupId uint, guard ClaimGuard) (int64, error) {
+	return r.remove(guard, &domain.GroupSubgroup{}, "group_id = ? AND subgroup_id = ?", groupId, subgroupId)
+}
+
+func (r *GroupRepository) remove(guard ClaimGuard, model interface{}, query string, args ...interface{}) (int64, error) {
+	var removed int64
+
+	err := guardClaim(r.db, guard, func(tx *gorm.DB) error {
+		result := tx.Where(query, args...).Delete(model)
+		removed = result.RowsAffected
+		return result.Error
+	})
+
+	if err != nil && !errors.Is(err, ErrClaimUnheld) {
+		r.logger.Errorf("error removing from group with error %v", err)
+	}
+
+	return removed, err
+}
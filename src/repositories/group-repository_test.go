@@ -0,0 +1,166 @@
+package repositories
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// nestedGroups answers the cycle check of AddSubgroup from the subgroups of
+// each group, as the recursive query would.
+func nestedGroups(subgroups map[uint][]uint) func(string, []driver.Value) (fakeResult, error) {
+	return func(query string, args []driver.Value) (fakeResult, error) {
+		switch {
+		case strings.Contains(query, "WITH RECURSIVE descendants"):
+			from, group := uint(args[0].(int64)), uint(args[1].(int64))
+
+			var count int64
+			seen := map[uint]bool{}
+			queue := []uint{from}
+			for len(queue) > 0 {
+				next := queue[0]
+				queue = queue[1:]
+				if seen[next] {
+					continue
+				}
+				seen[next] = true
+				if next == group {
+					count++
+				}
+				queue = append(queue, subgroups[next]...)
+			}
+
+			return fakeResult{columns: []string{"count"}, rows: [][]driver.Value{{count}}}, nil
+		case strings.HasPrefix(query, "INSERT"):
+			return fakeResult{columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}}}, nil
+		default:
+			return fakeResult{}, nil
+		}
+	}
+}
+
+func TestGroupAddSubgroup(t *testing.T) {
+	// 1 has the subgroup 2, which has the subgroup 3
+	subgroups := map[uint][]uint{1: {2}, 2: {3}}
+
+	tests := []struct {
+		name       string
+		groupId    uint
+		subgroupId uint
+		wantErr    error
+	}{
+		{name: "unrelated group", groupId: 1, subgroupId: 4},
+		{name: "group that already contains it", groupId: 1, subgroupId: 3},
+		{name: "the group itself", groupId: 2, subgroupId: 2, wantErr: ErrGroupCycle},
+		{name: "direct parent", groupId: 2, subgroupId: 1, wantErr: ErrGroupCycle},
+		{name: "ancestor further up", groupId: 3, subgroupId: 1, wantErr: ErrGroupCycle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDb(t, nestedGroups(subgroups))
+			repo := &GroupRepository{db: db, logger: zap.NewNop().Sugar()}
+
+			err := repo.AddSubgroup(tt.groupId, tt.subgroupId)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AddSubgroup() error = %v, want %v", err, tt.wantErr)
+			}
+
+			want := []string{"BEGIN", "pg_advisory_xact_lock", "WITH RECURSIVE descendants", "INSERT", "COMMIT"}
+			if tt.wantErr != nil {
+				want = []string{"BEGIN", "pg_advisory_xact_lock", "WITH RECURSIVE descendants", "ROLLBACK"}
+			}
+			checkStatements(t, fake.statements, want)
+		})
+	}
+}
+
+func TestGroupRemoveGuarded(t *testing.T) {
+	organizationId := uint(5)
+
+	tests := []struct {
+		name        string
+		scope       TenantScope
+		holders     []int64
+		wantErr     error
+		wantHolders string
+	}{
+		{
+			name:        "other holders left",
+			scope:       InTenant(&organizationId),
+			holders:     []int64{2, 1},
+			wantHolders: "users.organization_id = $",
+		},
+		{
+			name:        "last holder in the organization",
+			scope:       InTenant(&organizationId),
+			holders:     []int64{1, 0},
+			wantErr:     ErrClaimUnheld,
+			wantHolders: "users.organization_id = $",
+		},
+		{
+			name:        "last holder outside any organization",
+			scope:       InTenant(nil),
+			holders:     []int64{1, 0},
+			wantErr:     ErrClaimUnheld,
+			wantHolders: "users.organization_id IS NULL",
+		},
+		{
+			name:        "claim nobody held",
+			scope:       InTenant(&organizationId),
+			holders:     []int64{0, 0},
+			wantHolders: "users.organization_id = $",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holders := tt.holders
+			db, fake := newFakeDb(t, func(query string, args []driver.Value) (fakeResult, error) {
+				if !strings.Contains(query, "claim_groups") {
+					return fakeResult{rowsAffected: 1}, nil
+				}
+
+				if !strings.Contains(query, tt.wantHolders) {
+					t.Errorf("holders counted with %q, want it limited by %q", query, tt.wantHolders)
+				}
+
+				count := holders[0]
+				holders = holders[1:]
+				return fakeResult{columns: []string{"count"}, rows: [][]driver.Value{{count}}}, nil
+			})
+			repo := &GroupRepository{db: db, logger: zap.NewNop().Sugar()}
+
+			removed, err := repo.RemoveMember(1, 2, ClaimGuard{Scope: tt.scope, ClaimId: 3})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RemoveMember() error = %v, want %v", err, tt.wantErr)
+			}
+			if removed != 1 {
+				t.Errorf("RemoveMember() removed %d, want 1", removed)
+			}
+
+			want := []string{"BEGIN", "pg_advisory_xact_lock", "claim_groups", "DELETE", "claim_groups", "COMMIT"}
+			if tt.wantErr != nil {
+				want[len(want)-1] = "ROLLBACK"
+			}
+			checkStatements(t, fake.statements, want)
+		})
+	}
+}
+
+// checkStatements checks each statement contains the wanted text, in order.
+func checkStatements(t *testing.T, statements, want []string) {
+	t.Helper()
+
+	matched := len(statements) == len(want)
+	for i := 0; matched && i < len(want); i++ {
+		matched = strings.Contains(statements[i], want[i])
+	}
+
+	if !matched {
+		t.Errorf("statements = %q, want them to contain %q", statements, want)
+	}
+}
@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// magicLinkRetention is how long links are kept after they are sent, long
+// enough to count them against the hourly limit.
+const magicLinkRetention = 24 * time.Hour
+
+type MagicLinkRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func InitMagicLinkRepository(serviceCfg *config.ServiceConfig) *MagicLinkRepository {
+	return &MagicLinkRepository{
+		db:     serviceCfg.Db,
+		logger: serviceCfg.Logger,
+	}
+}
+
+// Add stores a new link, clearing out links old enough to no longer count.
+func (r *MagicLinkRepository) Add(link domain.MagicLink) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("created_at < ?", time.Now().Add(-magicLinkRetention)).Delete(&domain.MagicLink{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&link).Error
+	})
+
+	if err != nil {
+		r.logger.Errorf("error storing magic link for user id %d with error %v", link.UserId, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *MagicLinkRepository) CountSince(userId uint, since time.Time) (int64, error) {
+	var count int64
+
+	err := r.db.Model(&domain.MagicLink{}).
+		Where("user_id = ? AND created_at >= ?", userId, since).
+		Count(&count).
+		Error
+	if err != nil {
+		r.logger.Errorf("error counting magic links for user id %d with error %v", userId, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetUsable returns the unexpired and unused link with the token hash.
+func (r *MagicLinkRepository) GetUsable(tokenHash string) (domain.MagicLink, error) {
+	var link domain.MagicLink
+
+	err := r.db.
+		Where("token_hash = ? AND consumed_at IS NULL AND expires_at > ?", tokenHash, time.Now()).
+		First(&link).
+		Error
+	if err != nil {
+		return domain.MagicLink{}, err
+	}
+
+	return link, nil
+}
+
+// Consume marks the link used, reporting false when another request used it
+// first.
+func (r *MagicLinkRepository) Consume(linkId uint) (bool, error) {
+	result := r.db.Model(&domain.MagicLink{}).
+		Where("id = ? AND consumed_at IS NULL", linkId).
+		Update("consumed_at", time.Now())
+
+	if result.Error != nil {
+		r.logger.Errorf("error consuming magic link %d with error %v", linkId, result.Error)
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+// newDryRunDb builds statements without running them, recording the SQL of
+// each so tests can check the conditions a repository relies on.
+func newDryRunDb(t *testing.T) (*gorm.DB, *[]string) {
+	t.Helper()
+
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatalf("opening dry run database: %v", err)
+	}
+
+	statements := []string{}
+	record := func(tx *gorm.DB) {
+		statements = append(statements, tx.Statement.SQL.String())
+	}
+	db.Callback().Query().After("gorm:query").Register("test:record", record)
+	db.Callback().Update().After("gorm:update").Register("test:record", record)
+
+	return db, &statements
+}
+
+func TestMagicLinkConsumeIsSingleUse(t *testing.T) {
+	db, statements := newDryRunDb(t)
+	repo := &MagicLinkRepository{db: db, logger: zap.NewNop().Sugar()}
+
+	// a dry run updates no rows, as when another request used the link first
+	consumed, err := repo.Consume(7)
+	if err != nil {
+		t.Fatalf("Consume() error = %v", err)
+	}
+	if consumed {
+		t.Error("Consume() = true for a link no row was updated for")
+	}
+
+	if len(*statements) != 1 {
+		t.Fatalf("Consume() ran %d statements, want 1", len(*statements))
+	}
+	for _, want := range []string{"UPDATE", "consumed_at", "consumed_at IS NULL"} {
+		if !strings.Contains((*statements)[0], want) {
+			t.Errorf("Consume() SQL %q does not contain %q", (*statements)[0], want)
+		}
+	}
+}
+
+func TestMagicLinkGetUsable(t *testing.T) {
+	db, statements := newDryRunDb(t)
+	repo := &MagicLinkRepository{db: db, logger: zap.NewNop().Sugar()}
+
+	repo.GetUsable("token-hash")
+
+	if len(*statements) != 1 {
+		t.Fatalf("GetUsable() ran %d statements, want 1", len(*statements))
+	}
+	if want := "token_hash = ? AND consumed_at IS NULL AND expires_at > ?"; !strings.Contains((*statements)[0], want) {
+		t.Errorf("GetUsable() SQL %q does not contain %q", (*statements)[0], want)
+	}
+}
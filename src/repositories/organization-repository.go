@@ -0,0 +1,130 @@
+package repositories
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type OrganizationRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func InitOrganizationRepository(serviceCfg *config.ServiceConfig) *OrganizationRepository {
+	return &OrganizationRepository{
+		db:     serviceCfg.Db,
+		logger: serviceCfg.Logger,
+	}
+}
+
+func (r *OrganizationRepository) Add(organization domain.Organization) (domain.Organization, error) {
+	if err := r.db.Create(&organization).Error; err != nil {
+		r.logger.Errorf("error adding organization %s with error %v", organization.Slug, err)
+		return organization, err
+	}
+
+	return organization, nil
+}
+
+func (r *OrganizationRepository) GetById(organizationId uint) (domain.Organization, error) {
+	var organization domain.Organization
+
+	if err := r.db.First(&organization, organizationId).Error; err != nil {
+		return domain.Organization{}, err
+	}
+
+	return organization, nil
+}
+
+func (r *OrganizationRepository) GetBySlug(slug string) (domain.Organization, error) {
+	var organization domain.Organization
+
+	if err := r.db.First(&organization, "slug = ?", slug).Error; err != nil {
+		return domain.Organization{}, err
+	}
+
+	return organization, nil
+}
+
+func (r *OrganizationRepository) GetAll() ([]domain.Organization, error) {
+	var organizations []domain.Organization
+
+	if err := r.db.Order("slug").Find(&organizations).Error; err != nil {
+		r.logger.Errorf("error getting organizations with error %v", err)
+		return nil, err
+	}
+
+	return organizations, nil
+}
+
+// SetMembership moves the user into the organization, or out of any with
+// nil, and revokes their tokens, which name the organization they were issued
+// in. The claims granted to them are revoked, but for the default claim,
+// which they hold in the organization they join.
+func (r *OrganizationRepository) SetMembership(userId uint, organizationId *uint, defaultClaimId uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&domain.User{}).
+			Where("id = ?", userId).
+			Updates(map[string]interface{}{
+				"organization_id":   organizationId,
+				"tokens_revoked_at": time.Now(),
+			}).
+			Error
+		if err != nil {
+			return err
+		}
+
+		var userClaims []domain.UserClaim
+		if err := tx.Where("user_id = ? AND claim_id <> ?", userId, defaultClaimId).Find(&userClaims).Error; err != nil {
+			return err
+		}
+
+		for _, userClaim := range userClaims {
+			if err := tx.Unscoped().Delete(&userClaim).Error; err != nil {
+				return err
+			}
+
+			if err := addUserClaimOutboxEvent(tx, domain.EventClaimRevoked, userClaim); err != nil {
+				return err
+			}
+		}
+
+		result := tx.Model(&domain.UserClaim{}).
+			Where("user_id = ? AND claim_id = ?", userId, defaultClaimId).
+			Update("organization_id", organizationId)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			userClaim := domain.UserClaim{UserId: userId, ClaimId: defaultClaimId, OrganizationId: organizationId}
+			if err := tx.Create(&userClaim).Error; err != nil {
+				return err
+			}
+
+			if err := addUserClaimOutboxEvent(tx, domain.EventClaimGranted, userClaim); err != nil {
+				return err
+			}
+		}
+
+		// groups belong to an organization, so the user leaves them all
+		if err := tx.Where("user_id = ?", userId).Delete(&domain.GroupMember{}).Error; err != nil {
+			return err
+		}
+
+		return addUserOutboxEvent(tx, domain.EventUserUpdated, userId, map[string]interface{}{
+			"organization_id": organizationId,
+		})
+	})
+
+	if err != nil {
+		r.logger.Errorf("error moving user id %d to organization %v with error %v", userId, organizationId, err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	outboxLockKey = 734002
+)
+
+type OutboxRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func InitOutboxRepository(serviceCfg *config.ServiceConfig) *OutboxRepository {
+	return &OutboxRepository{
+		db:     serviceCfg.Db,
+		logger: serviceCfg.Logger,
+	}
+}
+
+// addOutboxEvent must be given the transaction making the change so the
+// event is only ever committed along with it. The advisory lock is held until
+// that transaction ends, so events become visible in id order and a reader
+// resuming after an id can never miss one committed later with a lower id.
+// It should be the last write in the transaction to keep the lock short.
+func addOutboxEvent(tx *gorm.DB, eventType string, userId *uint, payload map[string]interface{}) error {
+	event, err := domain.NewOutboxEvent(eventType, userId, payload)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", outboxLockKey).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&event).Error
+}
+
+func addUserOutboxEvent(tx *gorm.DB, eventType string, userId uint, payload map[string]interface{}) error {
+	return addOutboxEvent(tx, eventType, &userId, payload)
+}
+
+// DispatchPending hands up to limit undispatched events to fn inside a
+// transaction, marking them dispatched if fn succeeds. Rows are locked with
+// SKIP LOCKED so several instances can dispatch side by side.
+func (r *OutboxRepository) DispatchPending(limit int, fn func(tx *gorm.DB, events []domain.OutboxEvent) error) (int, error) {
+	dispatched := 0
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var events []domain.OutboxEvent
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("dispatched_at IS NULL").
+			Order("id").
+			Limit(limit).
+			Find(&events).
+			Error
+		if err != nil {
+			return err
+		}
+
+		if len(events) == 0 {
+			return nil
+		}
+
+		if err := fn(tx, events); err != nil {
+			return err
+		}
+
+		ids := make([]uint, 0, len(events))
+		for _, event := range events {
+			ids = append(ids, event.ID)
+		}
+
+		dispatched = len(events)
+		return tx.Model(&domain.OutboxEvent{}).Where("id IN ?", ids).Update("dispatched_at", time.Now()).Error
+	})
+
+	if err != nil {
+		r.logger.Errorf("error dispatching outbox events with error %v", err)
+		return 0, err
+	}
+
+	return dispatched, nil
+}
+
+func (r *OutboxRepository) GetById(eventId uint) (domain.OutboxEvent, error) {
+	var event domain.OutboxEvent
+
+	if err := r.db.First(&event, eventId).Error; err != nil {
+		return domain.OutboxEvent{}, err
+	}
+
+	return event, nil
+}
+
+// GetAfter returns events with an id greater than afterId in id order,
+// optionally restricted to the given event types.
+func (r *OutboxRepository) GetAfter(afterId uint, eventTypes []string, limit int) ([]domain.OutboxEvent, error) {
+	var events []domain.OutboxEvent
+
+	tx := r.db.Where("id > ?", afterId)
+	if len(eventTypes) > 0 {
+		tx = tx.Where("event_type IN ?", eventTypes)
+	}
+
+	if err := tx.Order("id").Limit(limit).Find(&events).Error; err != nil {
+		r.logger.Errorf("error getting events after id %d with error %v", afterId, err)
+		return []domain.OutboxEvent{}, err
+	}
+
+	return events, nil
+}
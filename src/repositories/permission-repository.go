@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PermissionRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func InitPermissionRepository(serviceCfg *config.ServiceConfig) *PermissionRepository {
+	return &PermissionRepository{
+		db:     serviceCfg.Db,
+		logger: serviceCfg.Logger,
+	}
+}
+
+func (r *PermissionRepository) Add(permission domain.Permission) (domain.Permission, error) {
+	if err := r.db.Create(&permission).Error; err != nil {
+		r.logger.Errorf("error adding permission %s with error %v", permission.Name, err)
+		return permission, err
+	}
+
+	return permission, nil
+}
+
+func (r *PermissionRepository) GetAll() ([]domain.Permission, error) {
+	var permissions []domain.Permission
+
+	if err := r.db.Order("name").Find(&permissions).Error; err != nil {
+		r.logger.Errorf("error getting permissions with error %v", err)
+		return []domain.Permission{}, err
+	}
+
+	return permissions, nil
+}
+
+func (r *PermissionRepository) GetByName(name string) (domain.Permission, error) {
+	var permission domain.Permission
+
+	if err := r.db.First(&permission, "name = ?", name).Error; err != nil {
+		return domain.Permission{}, err
+	}
+
+	return permission, nil
+}
+
+// Delete removes the permission from every role bundling it.
+func (r *PermissionRepository) Delete(permission domain.Permission) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("permission_id = ?", permission.ID).Delete(&domain.RolePermission{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&permission).Error
+	})
+
+	if err != nil {
+		r.logger.Errorf("error deleting permission %s with error %v", permission.Name, err)
+		return err
+	}
+
+	return nil
+}
+
+// GetByClaimNames returns the permissions the roles bundle between them,
+// each once, ordered by name.
+func (r *PermissionRepository) GetByClaimNames(claimNames []string) ([]string, error) {
+	permissions := []string{}
+	if len(claimNames) == 0 {
+		return permissions, nil
+	}
+
+	err := r.db.
+		Model(&domain.Permission{}).
+		Distinct("permissions.name").
+		Joins("inner join role_permissions on role_permissions.permission_id = permissions.id").
+		Joins("inner join claims on claims.id = role_permissions.claim_id AND claims.deleted_at IS NULL").
+		Where("claims.claim IN ?", claimNames).
+		Order("permissions.name").
+		Pluck("permissions.name", &permissions).
+		Error
+	if err != nil {
+		r.logger.Errorf("error getting permissions for %d roles with error %v", len(claimNames), err)
+		return []string{}, err
+	}
+
+	return permissions, nil
+}
+
+// GrantToClaim is idempotent, bundling a permission the role already has is
+// a no-op.
+func (r *PermissionRepository) GrantToClaim(claimId, permissionId uint) error {
+	rolePermission := domain.RolePermission{ClaimId: claimId, PermissionId: permissionId}
+
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rolePermission).Error; err != nil {
+		r.logger.Errorf("error granting permission %d to claim %d with error %v", permissionId, claimId, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *PermissionRepository) RevokeFromClaim(claimId, permissionId uint) (int64, error) {
+	result := r.db.
+		Where("claim_id = ? AND permission_id = ?", claimId, permissionId).
+		Delete(&domain.RolePermission{})
+	if result.Error != nil {
+		r.logger.Errorf("error revoking permission %d from claim %d with error %v", permissionId, claimId, result.Error)
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
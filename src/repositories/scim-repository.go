@@ -0,0 +1,337 @@
+package repositories
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/helpers"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	scimText = iota
+	scimExactText
+	scimId
+	scimTime
+	scimActive
+	scimMember
+)
+
+// scimAttribute maps a filterable SCIM attribute onto SQL. Member attributes
+// are EXISTS subqueries taking the compared value as their only parameter.
+type scimAttribute struct {
+	column string
+	kind   int
+}
+
+var scimUserAttributes = map[string]scimAttribute{
+	"id":                {"users.id", scimId},
+	"username":          {"users.username", scimText},
+	"externalid":        {"users.external_id", scimExactText},
+	"name.givenname":    {"users.first_name", scimText},
+	"name.familyname":   {"users.surname", scimText},
+	"emails":            {"users.email_address", scimText},
+	"emails.value":      {"users.email_address", scimText},
+	"active":            {"users.status", scimActive},
+	"meta.created":      {"users.created_at", scimTime},
+	"meta.lastmodified": {"users.updated_at", scimTime},
+	"groups":            {userInClaimSQL, scimMember},
+	"groups.value":      {userInClaimSQL, scimMember},
+	"groups.display":    {userInNamedClaimSQL, scimMember},
+}
+
+var scimGroupAttributes = map[string]scimAttribute{
+	"id":                {"claims.id", scimId},
+	"displayname":       {"claims.claim", scimText},
+	"externalid":        {"claims.external_id", scimExactText},
+	"meta.created":      {"claims.created_at", scimTime},
+	"meta.lastmodified": {"claims.updated_at", scimTime},
+	"members":           {claimHasUserSQL, scimMember},
+	"members.value":     {claimHasUserSQL, scimMember},
+}
+
+const (
+	userInClaimSQL = `EXISTS (SELECT 1 FROM user_claims
+		WHERE user_claims.user_id = users.id AND user_claims.deleted_at IS NULL AND user_claims.claim_id = ?)`
+	userInNamedClaimSQL = `EXISTS (SELECT 1 FROM user_claims
+		INNER JOIN claims ON claims.id = user_claims.claim_id AND claims.deleted_at IS NULL
+		WHERE user_claims.user_id = users.id AND user_claims.deleted_at IS NULL AND lower(claims.claim) = lower(?))`
+	claimHasUserSQL = `EXISTS (SELECT 1 FROM user_claims
+		INNER JOIN users ON users.id = user_claims.user_id AND users.deleted_at IS NULL
+		WHERE user_claims.claim_id = claims.id AND user_claims.deleted_at IS NULL AND user_claims.user_id = ?)`
+)
+
+type ScimListQuery struct {
+	Filter    helpers.ScimFilter
+	SortBy    string
+	SortDesc  bool
+	Offset    int
+	Limit     int
+	CountOnly bool
+}
+
+type ScimRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func InitScimRepository(serviceCfg *config.ServiceConfig) *ScimRepository {
+	return &ScimRepository{
+		db:     serviceCfg.Db,
+		logger: serviceCfg.Logger,
+	}
+}
+
+// ListUsers returns a page of live users in the scope matching the filter
+// along with the total number that match. Erased users are never returned.
+func (r *ScimRepository) ListUsers(scope TenantScope, query ScimListQuery) ([]domain.User, int64, error) {
+	var users []domain.User
+
+	tx := r.db.Model(&domain.User{}).Scopes(scope.where("users")).Where("users.status <> ?", domain.AccountStatusErased)
+
+	total, err := r.list(tx, query, scimUserAttributes, "users.id", &users)
+	if err != nil {
+		r.logger.Errorf("error listing SCIM users with error %v", err)
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+func (r *ScimRepository) ListGroups(query ScimListQuery) ([]domain.Claim, int64, error) {
+	var claims []domain.Claim
+
+	total, err := r.list(r.db.Model(&domain.Claim{}), query, scimGroupAttributes, "claims.id", &claims)
+	if err != nil {
+		r.logger.Errorf("error listing SCIM groups with error %v", err)
+		return nil, 0, err
+	}
+
+	return claims, total, nil
+}
+
+func (r *ScimRepository) list(tx *gorm.DB, query ScimListQuery, attributes map[string]scimAttribute, idColumn string, dest interface{}) (int64, error) {
+	if query.Filter != nil {
+		where, args, err := compileScimFilter(query.Filter, attributes)
+		if err != nil {
+			return 0, err
+		}
+		tx = tx.Where(where, args...)
+	}
+
+	// a new session so the count and the page start from the same conditions
+	tx = tx.Session(&gorm.Session{})
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return 0, err
+	}
+
+	if query.CountOnly || query.Limit == 0 {
+		return total, nil
+	}
+
+	order := idColumn
+	if len(query.SortBy) > 0 {
+		attribute, ok := attributes[query.SortBy]
+		if !ok || attribute.kind == scimMember {
+			return 0, fmt.Errorf("%w: cannot sort by %s", helpers.ErrInvalidScimFilter, query.SortBy)
+		}
+
+		direction := "ASC"
+		if query.SortDesc {
+			direction = "DESC"
+		}
+		order = fmt.Sprintf("%s %s, %s", attribute.column, direction, idColumn)
+	}
+
+	err := tx.Order(order).Offset(query.Offset).Limit(query.Limit).Find(dest).Error
+	return total, err
+}
+
+// GetMembers returns the live users in the scope holding each of the claims.
+func (r *ScimRepository) GetMembers(scope TenantScope, claimIds []uint) (map[uint][]domain.User, error) {
+	members := map[uint][]domain.User{}
+	if len(claimIds) == 0 {
+		return members, nil
+	}
+
+	var rows []struct {
+		ClaimId uint
+		domain.User
+	}
+
+	err := r.db.
+		Table("users").
+		Select("user_claims.claim_id, users.*").
+		Joins("inner join user_claims on users.id = user_claims.user_id AND user_claims.deleted_at IS NULL").
+		Where("user_claims.claim_id IN ? AND users.deleted_at IS NULL", claimIds).
+		Scopes(scope.where("users")).
+		Order("users.id").
+		Scan(&rows).
+		Error
+	if err != nil {
+		r.logger.Errorf("error getting members of %d groups with error %v", len(claimIds), err)
+		return nil, err
+	}
+
+	for _, row := range rows {
+		members[row.ClaimId] = append(members[row.ClaimId], row.User)
+	}
+
+	return members, nil
+}
+
+func (r *ScimRepository) GetClaimById(claimId uint) (domain.Claim, error) {
+	var claim domain.Claim
+
+	if err := r.db.First(&claim, claimId).Error; err != nil {
+		return domain.Claim{}, err
+	}
+
+	return claim, nil
+}
+
+// compileScimFilter turns a parsed filter into a WHERE clause. Only the
+// attributes in the map can be filtered on, and values are always passed as
+// parameters.
+func compileScimFilter(filter helpers.ScimFilter, attributes map[string]scimAttribute) (string, []interface{}, error) {
+	switch f := filter.(type) {
+	case helpers.ScimLogicalFilter:
+		left, leftArgs, err := compileScimFilter(f.Left, attributes)
+		if err != nil {
+			return "", nil, err
+		}
+
+		right, rightArgs, err := compileScimFilter(f.Right, attributes)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return fmt.Sprintf("(%s %s %s)", left, strings.ToUpper(f.Operator), right), append(leftArgs, rightArgs...), nil
+	case helpers.ScimNotFilter:
+		inner, args, err := compileScimFilter(f.Filter, attributes)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return fmt.Sprintf("NOT (%s)", inner), args, nil
+	case helpers.ScimCompareFilter:
+		attribute, ok := attributes[f.Attribute]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: cannot filter on %s", helpers.ErrInvalidScimFilter, f.Attribute)
+		}
+
+		return compileScimComparison(f, attribute)
+	}
+
+	return "", nil, helpers.ErrInvalidScimFilter
+}
+
+func compileScimComparison(f helpers.ScimCompareFilter, attribute scimAttribute) (string, []interface{}, error) {
+	column := attribute.column
+
+	if f.Operator == "pr" {
+		switch attribute.kind {
+		case scimText, scimExactText:
+			return fmt.Sprintf("(%s IS NOT NULL AND %s <> '')", column, column), nil, nil
+		case scimMember:
+			return "", nil, fmt.Errorf("%w: pr is not supported for %s", helpers.ErrInvalidScimFilter, f.Attribute)
+		}
+		return fmt.Sprintf("%s IS NOT NULL", column), nil, nil
+	}
+
+	switch attribute.kind {
+	case scimActive:
+		active, ok := f.Value.(bool)
+		if !ok || (f.Operator != "eq" && f.Operator != "ne") {
+			return "", nil, fmt.Errorf("%w: active can only be compared with eq or ne and true or false", helpers.ErrInvalidScimFilter)
+		}
+
+		if active == (f.Operator == "eq") {
+			return fmt.Sprintf("%s = ?", column), []interface{}{domain.AccountStatusActive}, nil
+		}
+		return fmt.Sprintf("%s <> ?", column), []interface{}{domain.AccountStatusActive}, nil
+
+	case scimMember:
+		value, ok := f.Value.(string)
+		if !ok || f.Operator != "eq" {
+			return "", nil, fmt.Errorf("%w: %s can only be compared with eq and a string", helpers.ErrInvalidScimFilter, f.Attribute)
+		}
+
+		if column == userInNamedClaimSQL {
+			return column, []interface{}{value}, nil
+		}
+
+		id, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			// no resource has a non numeric id, so nothing matches
+			return "FALSE", nil, nil
+		}
+		return column, []interface{}{uint(id)}, nil
+
+	case scimId:
+		value, ok := f.Value.(string)
+		if !ok {
+			return "", nil, fmt.Errorf("%w: id must be compared with a string", helpers.ErrInvalidScimFilter)
+		}
+
+		id, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return fmt.Sprintf("%t", f.Operator == "ne"), nil, nil
+		}
+		return compileScimOperator(f, column, uint(id))
+
+	case scimTime:
+		value, ok := f.Value.(string)
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %s must be compared with a date time string", helpers.ErrInvalidScimFilter, f.Attribute)
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: %s must be compared with a date time string", helpers.ErrInvalidScimFilter, f.Attribute)
+		}
+		return compileScimOperator(f, column, t)
+	}
+
+	value, ok := f.Value.(string)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s must be compared with a string", helpers.ErrInvalidScimFilter, f.Attribute)
+	}
+
+	// only externalId is case exact, everything else compares case insensitively
+	if attribute.kind == scimText {
+		column = fmt.Sprintf("lower(%s)", column)
+		value = strings.ToLower(value)
+	}
+
+	switch f.Operator {
+	case "co":
+		return fmt.Sprintf("%s LIKE ?", column), []interface{}{"%" + escapeLike(value) + "%"}, nil
+	case "sw":
+		return fmt.Sprintf("%s LIKE ?", column), []interface{}{escapeLike(value) + "%"}, nil
+	case "ew":
+		return fmt.Sprintf("%s LIKE ?", column), []interface{}{"%" + escapeLike(value)}, nil
+	}
+
+	return compileScimOperator(f, column, value)
+}
+
+var scimSQLOperators = map[string]string{
+	"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<=",
+}
+
+func compileScimOperator(f helpers.ScimCompareFilter, column string, value interface{}) (string, []interface{}, error) {
+	operator, ok := scimSQLOperators[f.Operator]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s is not supported for %s", helpers.ErrInvalidScimFilter, f.Operator, f.Attribute)
+	}
+
+	return fmt.Sprintf("%s %s ?", column, operator), []interface{}{value}, nil
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// TenantScope limits queries to the users of one organization. Every query
+// reachable by an organization's administrators takes one, so the scope has
+// to be chosen at each call rather than forgotten.
+type TenantScope struct {
+	organizationId *uint
+	all            bool
+}
+
+// AllTenants is for platform administrators and for the service's own work,
+// such as signing users in.
+var AllTenants = TenantScope{all: true}
+
+// InTenant limits queries to the organization's users, or with nil to users
+// in no organization.
+func InTenant(organizationId *uint) TenantScope {
+	return TenantScope{organizationId: organizationId}
+}
+
+// OrganizationId is the organization users created in this scope join.
+func (t TenantScope) OrganizationId() *uint {
+	if t.all {
+		return nil
+	}
+	return t.organizationId
+}
+
+// Allows reports whether a user in the organization is within the scope.
+func (t TenantScope) Allows(organizationId *uint) bool {
+	switch {
+	case t.all:
+		return true
+	case t.organizationId == nil || organizationId == nil:
+		return t.organizationId == nil && organizationId == nil
+	default:
+		return *t.organizationId == *organizationId
+	}
+}
+
+// where limits the query on the table's organization_id column.
+func (t TenantScope) where(table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		switch {
+		case t.all:
+			return db
+		case t.organizationId == nil:
+			return db.Where(fmt.Sprintf("%s.organization_id IS NULL", table))
+		default:
+			return db.Where(fmt.Sprintf("%s.organization_id = ?", table), *t.organizationId)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"authservice/src/domain"
+	"strings"
+	"testing"
+)
+
+func TestTenantScopeAllows(t *testing.T) {
+	one, alsoOne, two := uint(1), uint(1), uint(2)
+
+	tests := []struct {
+		name           string
+		scope          TenantScope
+		organizationId *uint
+		want           bool
+	}{
+		{name: "all tenants, user in an organization", scope: AllTenants, organizationId: &one, want: true},
+		{name: "all tenants, user in none", scope: AllTenants, want: true},
+		{name: "same organization", scope: InTenant(&one), organizationId: &alsoOne, want: true},
+		{name: "another organization", scope: InTenant(&one), organizationId: &two},
+		{name: "organization, user in none", scope: InTenant(&one)},
+		{name: "no organization, user in one", scope: InTenant(nil), organizationId: &one},
+		{name: "no organization, user in none", scope: InTenant(nil), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scope.Allows(tt.organizationId); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTenantScopeOrganizationId(t *testing.T) {
+	one := uint(1)
+
+	if got := AllTenants.OrganizationId(); got != nil {
+		t.Errorf("AllTenants.OrganizationId() = %d, want nil", *got)
+	}
+	if got := InTenant(nil).OrganizationId(); got != nil {
+		t.Errorf("InTenant(nil).OrganizationId() = %d, want nil", *got)
+	}
+	if got := InTenant(&one).OrganizationId(); got == nil || *got != one {
+		t.Errorf("InTenant(1).OrganizationId() = %v, want 1", got)
+	}
+}
+
+func TestTenantScopeWhere(t *testing.T) {
+	one := uint(1)
+
+	tests := []struct {
+		name    string
+		scope   TenantScope
+		want    string
+		notWant string
+	}{
+		{name: "all tenants", scope: AllTenants, notWant: "organization_id"},
+		{name: "organization", scope: InTenant(&one), want: "users.organization_id = ?"},
+		{name: "no organization", scope: InTenant(nil), want: "users.organization_id IS NULL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, statements := newDryRunDb(t)
+
+			var users []domain.User
+			db.Model(&domain.User{}).Scopes(tt.scope.where("users")).Find(&users)
+
+			if len(*statements) != 1 {
+				t.Fatalf("ran %d statements, want 1", len(*statements))
+			}
+			sql := (*statements)[0]
+			if len(tt.want) > 0 && !strings.Contains(sql, tt.want) {
+				t.Errorf("SQL %q does not contain %q", sql, tt.want)
+			}
+			if len(tt.notWant) > 0 && strings.Contains(sql, tt.notWant) {
+				t.Errorf("SQL %q contains %q", sql, tt.notWant)
+			}
+		})
+	}
+}
@@ -7,6 +7,34 @@ import (
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// effectiveClaimIdsSQL selects the claims a user, given as both
+	// parameters, holds directly or inherits from their groups and the groups
+	// those are subgroups of. UNION stops the recursion going round a cycle.
+	effectiveClaimIdsSQL = `WITH RECURSIVE member_groups AS (
+			SELECT group_id FROM group_members WHERE user_id = ?
+			UNION
+			SELECT group_subgroups.group_id FROM group_subgroups
+			INNER JOIN member_groups ON member_groups.group_id = group_subgroups.subgroup_id
+		)
+		SELECT claim_id FROM user_claims WHERE user_id = ? AND deleted_at IS NULL
+		UNION
+		SELECT claim_id FROM group_claims WHERE group_id IN (SELECT group_id FROM member_groups)`
+
+	// claimHolderIdsSQL selects the users holding a claim, given as both
+	// parameters, directly or through a group.
+	claimHolderIdsSQL = `WITH RECURSIVE claim_groups AS (
+			SELECT group_id FROM group_claims WHERE claim_id = ?
+			UNION
+			SELECT group_subgroups.subgroup_id FROM group_subgroups
+			INNER JOIN claim_groups ON claim_groups.group_id = group_subgroups.group_id
+		)
+		SELECT user_id FROM user_claims WHERE claim_id = ? AND deleted_at IS NULL
+		UNION
+		SELECT user_id FROM group_members WHERE group_id IN (SELECT group_id FROM claim_groups)`
 )
 
 type UserClaimRepository struct {
@@ -21,8 +49,25 @@ func InitUserClaimRepository(servicecfg *config.ServiceConfig) *UserClaimReposit
 	}
 }
 
+// Add is idempotent, granting a claim the user already holds is a no-op and
+// emits no event. The claim is granted within the user's organization.
 func (r *UserClaimRepository) Add(userClaim domain.UserClaim) error {
-	if err := r.db.Create(&userClaim).Error; err != nil {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		organizationId, err := userOrganizationId(tx, userClaim.UserId)
+		if err != nil {
+			return err
+		}
+		userClaim.OrganizationId = organizationId
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&userClaim)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		return addUserClaimOutboxEvent(tx, domain.EventClaimGranted, userClaim)
+	})
+
+	if err != nil {
 		r.logger.Errorf("error creating claim for user id %d", userClaim.UserId)
 		return err
 	}
@@ -30,37 +75,162 @@ func (r *UserClaimRepository) Add(userClaim domain.UserClaim) error {
 	return nil
 }
 
-func (r *UserClaimRepository) Delete(userClaim domain.UserClaim) error {
-	if err := r.db.Delete(&userClaim).Error; err != nil {
-		r.logger.Errorf("error creating claim for user id %d", userClaim.UserId)
+// Delete removes the row outright so the claim can be granted again without
+// tripping the unique index on user_id and claim_id. It returns
+// ErrClaimUnheld, deleting nothing, when it would leave nobody in the
+// guard's scope holding the guarded claim.
+func (r *UserClaimRepository) Delete(userClaim domain.UserClaim, guard ClaimGuard) error {
+	err := guardClaim(r.db, guard, func(tx *gorm.DB) error {
+		result := tx.Unscoped().
+			Where("user_id = ? AND claim_id = ?", userClaim.UserId, userClaim.ClaimId).
+			Delete(&domain.UserClaim{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		return addUserClaimOutboxEvent(tx, domain.EventClaimRevoked, userClaim)
+	})
+
+	if err != nil && !errors.Is(err, ErrClaimUnheld) {
+		r.logger.Errorf("error deleting claim %d for user id %d", userClaim.ClaimId, userClaim.UserId)
+	}
+
+	return err
+}
+
+func userOrganizationId(tx *gorm.DB, userId uint) (*uint, error) {
+	var user domain.User
+	if err := tx.Unscoped().Select("organization_id").First(&user, userId).Error; err != nil {
+		return nil, err
+	}
+
+	return user.OrganizationId, nil
+}
+
+func addUserClaimOutboxEvent(tx *gorm.DB, eventType string, userClaim domain.UserClaim) error {
+	var claim domain.Claim
+	if err := tx.Unscoped().First(&claim, userClaim.ClaimId).Error; err != nil {
 		return err
 	}
 
-	return nil
+	return addUserOutboxEvent(tx, eventType, userClaim.UserId, map[string]interface{}{
+		"claim_id": claim.ID,
+		"claim":    claim.Claim,
+	})
 }
 
+// GetClaimsByUserId returns the user's effective claims, those granted to
+// them and those inherited from their groups.
 func (r *UserClaimRepository) GetClaimsByUserId(userId uint) ([]string, error) {
-	var userClaims []string
+	userClaims := []string{}
 
-	if err := r.db.Where(&userClaims, "user_id = ?", userId).Error; err != nil {
-		return []string{}, err
+	err := r.db.
+		Table("claims").
+		Where("claims.deleted_at IS NULL AND claims.id IN ("+effectiveClaimIdsSQL+")", userId, userId).
+		Order("claims.claim").
+		Pluck("claims.claim", &userClaims).
+		Error
+	if err != nil {
+		r.logger.Errorf("error locating user claims with error %v", err)
+		return []string{}, errors.New("error locating user claims")
 	}
 
-	rows, err := r.db.
+	return userClaims, nil
+}
+
+// GetDirectClaimsByUserId returns only the claims granted to the user
+// themselves.
+func (r *UserClaimRepository) GetDirectClaimsByUserId(userId uint) ([]string, error) {
+	userClaims := []string{}
+
+	err := r.db.
 		Table("claims").
-		Select("claims.claim").
 		Joins("inner join user_claims on claims.id = user_claims.claim_id").
-		Rows()
+		Where("user_claims.user_id = ? AND user_claims.deleted_at IS NULL AND claims.deleted_at IS NULL", userId).
+		Order("claims.claim").
+		Pluck("claims.claim", &userClaims).
+		Error
 	if err != nil {
 		r.logger.Errorf("error locating user claims with error %v", err)
 		return []string{}, errors.New("error locating user claims")
 	}
 
-	for rows.Next() {
-		var claim string
-		rows.Scan(&claim)
-		userClaims = append(userClaims, claim)
+	return userClaims, nil
+}
+
+// GetClaimsByUserIds returns the claims granted to each of the users, not
+// those inherited from groups, ordered by name.
+func (r *UserClaimRepository) GetClaimsByUserIds(userIds []uint) (map[uint][]domain.Claim, error) {
+	claims := map[uint][]domain.Claim{}
+	if len(userIds) == 0 {
+		return claims, nil
 	}
 
-	return userClaims, nil
+	var rows []struct {
+		UserId uint
+		domain.Claim
+	}
+
+	err := r.db.
+		Table("claims").
+		Select("user_claims.user_id, claims.*").
+		Joins("inner join user_claims on claims.id = user_claims.claim_id").
+		Where("user_claims.user_id IN ? AND user_claims.deleted_at IS NULL AND claims.deleted_at IS NULL", userIds).
+		Order("claims.claim").
+		Scan(&rows).
+		Error
+	if err != nil {
+		r.logger.Errorf("error locating claims for %d users with error %v", len(userIds), err)
+		return nil, err
+	}
+
+	for _, row := range rows {
+		claims[row.UserId] = append(claims[row.UserId], row.Claim)
+	}
+
+	return claims, nil
+}
+
+// GetUsersByClaimId returns the users holding the claim, directly or through
+// a group.
+func (r *UserClaimRepository) GetUsersByClaimId(scope TenantScope, claimId uint) ([]domain.User, error) {
+	var users []domain.User
+
+	err := r.db.
+		Scopes(scope.where("users")).
+		Where("users.id IN ("+claimHolderIdsSQL+")", claimId, claimId).
+		Order("users.username").
+		Find(&users).
+		Error
+	if err != nil {
+		r.logger.Errorf("error locating users for claim %d with error %v", claimId, err)
+		return []domain.User{}, errors.New("error locating users for claim")
+	}
+
+	return users, nil
+}
+
+func (r *UserClaimRepository) CountUsersByClaimId(scope TenantScope, claimId uint) (int64, error) {
+	count, err := countClaimHolders(r.db, scope, claimId)
+	if err != nil {
+		r.logger.Errorf("error counting users for claim %d with error %v", claimId, err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// countClaimHolders counts the live users in the scope holding the claim,
+// directly or through a group.
+func countClaimHolders(tx *gorm.DB, scope TenantScope, claimId uint) (int64, error) {
+	var count int64
+
+	err := tx.
+		Model(&domain.User{}).
+		Scopes(scope.where("users")).
+		Where("users.id IN ("+claimHolderIdsSQL+")", claimId, claimId).
+		Count(&count).
+		Error
+
+	return count, err
 }
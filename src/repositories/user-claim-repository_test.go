@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"authservice/src/domain"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestUserClaimDeleteGuarded(t *testing.T) {
+	organizationId := uint(5)
+
+	tests := []struct {
+		name    string
+		held    bool
+		holders []int64
+		wantErr error
+		want    []string
+	}{
+		{
+			name:    "other administrators left",
+			held:    true,
+			holders: []int64{2, 1},
+			want: []string{
+				"BEGIN", "pg_advisory_xact_lock", "claim_groups", "DELETE", "claims",
+				"pg_advisory_xact_lock", "INSERT", "claim_groups", "COMMIT",
+			},
+		},
+		{
+			name:    "last administrator",
+			held:    true,
+			holders: []int64{1, 0},
+			wantErr: ErrClaimUnheld,
+			want: []string{
+				"BEGIN", "pg_advisory_xact_lock", "claim_groups", "DELETE", "claims",
+				"pg_advisory_xact_lock", "INSERT", "claim_groups", "ROLLBACK",
+			},
+		},
+		{
+			name:    "claim the user does not hold",
+			holders: []int64{1, 1},
+			want:    []string{"BEGIN", "pg_advisory_xact_lock", "claim_groups", "DELETE", "claim_groups", "COMMIT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holders := tt.holders
+			db, fake := newFakeDb(t, func(query string, args []driver.Value) (fakeResult, error) {
+				switch {
+				case strings.Contains(query, "claim_groups"):
+					if !strings.Contains(query, "users.organization_id = $") {
+						t.Errorf("holders counted with %q, want it limited to the organization", query)
+					}
+
+					count := holders[0]
+					holders = holders[1:]
+					return fakeResult{columns: []string{"count"}, rows: [][]driver.Value{{count}}}, nil
+				case strings.HasPrefix(query, "DELETE") && !tt.held:
+					return fakeResult{}, nil
+				case strings.HasPrefix(query, "SELECT * FROM \"claims\""):
+					return fakeResult{columns: []string{"id", "claim"}, rows: [][]driver.Value{{int64(3), "Administrator"}}}, nil
+				case strings.HasPrefix(query, "INSERT"):
+					return fakeResult{columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}}}, nil
+				default:
+					return fakeResult{rowsAffected: 1}, nil
+				}
+			})
+			repo := &UserClaimRepository{db: db, logger: zap.NewNop().Sugar()}
+
+			guard := ClaimGuard{Scope: InTenant(&organizationId), ClaimId: 3}
+			err := repo.Delete(domain.UserClaim{UserId: 2, ClaimId: 3}, guard)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Delete() error = %v, want %v", err, tt.wantErr)
+			}
+
+			checkStatements(t, fake.statements, tt.want)
+		})
+	}
+}
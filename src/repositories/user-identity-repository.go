@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UserIdentityRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func InitUserIdentityRepository(serviceCfg *config.ServiceConfig) *UserIdentityRepository {
+	return &UserIdentityRepository{
+		db:     serviceCfg.Db,
+		logger: serviceCfg.Logger,
+	}
+}
+
+func (r *UserIdentityRepository) Add(identity domain.UserIdentity) (domain.UserIdentity, error) {
+	if err := r.db.Create(&identity).Error; err != nil {
+		r.logger.Errorf("error linking user id %d to %s with error %v", identity.UserId, identity.Provider, err)
+		return identity, err
+	}
+
+	return identity, nil
+}
+
+func (r *UserIdentityRepository) GetByProviderSubject(provider, subject string) (domain.UserIdentity, error) {
+	var identity domain.UserIdentity
+
+	if err := r.db.First(&identity, "provider = ? AND subject = ?", provider, subject).Error; err != nil {
+		return domain.UserIdentity{}, err
+	}
+
+	return identity, nil
+}
+
+func (r *UserIdentityRepository) GetByUserId(userId uint) ([]domain.UserIdentity, error) {
+	var identities []domain.UserIdentity
+
+	if err := r.db.Where("user_id = ?", userId).Order("created_at").Find(&identities).Error; err != nil {
+		r.logger.Errorf("error getting identities for user id %d with error %v", userId, err)
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// Unlink removes the identity if it belongs to the user and check, given the
+// user and all of their identities, allows it. The user's row is locked until
+// the identity is gone, so two unlinks made side by side cannot each count the
+// other's identity as one the user still has.
+func (r *UserIdentityRepository) Unlink(userId, identityId uint, check func(user domain.User, identities []domain.UserIdentity) error) (domain.UserIdentity, error) {
+	var unlinked domain.UserIdentity
+	var refused error
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var user domain.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userId).Error; err != nil {
+			return err
+		}
+
+		var identities []domain.UserIdentity
+		if err := tx.Where("user_id = ?", userId).Find(&identities).Error; err != nil {
+			return err
+		}
+
+		found := false
+		for _, identity := range identities {
+			if identity.ID == identityId {
+				unlinked, found = identity, true
+			}
+		}
+
+		if !found {
+			return gorm.ErrRecordNotFound
+		}
+
+		if refused = check(user, identities); refused != nil {
+			return refused
+		}
+
+		return tx.Delete(&unlinked).Error
+	})
+
+	if err != nil && err != refused && !errors.Is(err, gorm.ErrRecordNotFound) {
+		r.logger.Errorf("error unlinking identity %d from user id %d with error %v", identityId, userId, err)
+	}
+
+	return unlinked, err
+}
+
+// RecordLogin stores the time of the login along with the email address the
+// provider currently has for the account.
+func (r *UserIdentityRepository) RecordLogin(identityId uint, emailAddress string) error {
+	err := r.db.Model(&domain.UserIdentity{}).
+		Where("id = ?", identityId).
+		Updates(map[string]interface{}{
+			"email_address": emailAddress,
+			"last_login_at": time.Now(),
+		}).
+		Error
+
+	if err != nil {
+		r.logger.Errorf("error recording login for identity %d with error %v", identityId, err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,301 @@
+package repositories
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	UserImportCreated   = "created"
+	UserImportUpdated   = "updated"
+	UserImportUnchanged = "unchanged"
+)
+
+var errImportDryRun = errors.New("dry run")
+
+// UserImport is one validated row. The password is only used when the user is
+// created, and status and email_verified are only applied when set.
+type UserImport struct {
+	Row              int
+	User             domain.User
+	ClaimIds         []uint
+	SetStatus        bool
+	SetEmailVerified bool
+}
+
+type UserImportOutcome struct {
+	Row    int
+	Result string
+	Err    error
+}
+
+type UserImportRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func InitUserImportRepository(serviceCfg *config.ServiceConfig) *UserImportRepository {
+	return &UserImportRepository{
+		db:     serviceCfg.Db,
+		logger: serviceCfg.Logger,
+	}
+}
+
+// GetExistingUsernames returns which of the usernames belong to live users.
+func (r *UserImportRepository) GetExistingUsernames(usernames []string) (map[string]bool, error) {
+	var found []string
+
+	err := r.db.Model(&domain.User{}).Where("username IN ?", usernames).Pluck("username", &found).Error
+	if err != nil {
+		r.logger.Errorf("error looking up usernames to import with error %v", err)
+		return nil, err
+	}
+
+	existing := make(map[string]bool, len(found))
+	for _, username := range found {
+		existing[username] = true
+	}
+
+	return existing, nil
+}
+
+// ImportBatch creates or updates each user, keyed on username, in a single
+// transaction. Every row runs inside its own savepoint so a failing row is
+// reported without losing the rest of the batch. A dry run does all the work
+// and then rolls the transaction back. New users join the scope's
+// organization, and usernames held outside the scope are refused.
+func (r *UserImportRepository) ImportBatch(scope TenantScope, imports []UserImport, dryRun bool) ([]UserImportOutcome, error) {
+	outcomes := make([]UserImportOutcome, 0, len(imports))
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		usernames := make([]string, 0, len(imports))
+		for _, imp := range imports {
+			usernames = append(usernames, imp.User.Username)
+		}
+
+		var users []domain.User
+		if err := tx.Where("username IN ?", usernames).Find(&users).Error; err != nil {
+			return err
+		}
+
+		existing := map[string]domain.User{}
+		for _, user := range users {
+			existing[user.Username] = user
+		}
+
+		for _, imp := range imports {
+			outcome := UserImportOutcome{Row: imp.Row}
+
+			outcome.Err = tx.Transaction(func(rowTx *gorm.DB) error {
+				current, ok := existing[imp.User.Username]
+				if !ok {
+					outcome.Result = UserImportCreated
+					return r.create(rowTx, imp, scope.OrganizationId())
+				}
+
+				if !scope.Allows(current.OrganizationId) {
+					return errors.New("the username is already used by another user")
+				}
+
+				changed, err := r.update(rowTx, imp, current)
+				outcome.Result = UserImportUnchanged
+				if changed {
+					outcome.Result = UserImportUpdated
+				}
+				return err
+			})
+
+			outcomes = append(outcomes, outcome)
+		}
+
+		if dryRun {
+			return errImportDryRun
+		}
+
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errImportDryRun) {
+		r.logger.Errorf("error importing batch of %d users with error %v", len(imports), err)
+		return nil, err
+	}
+
+	return outcomes, nil
+}
+
+func (r *UserImportRepository) create(tx *gorm.DB, imp UserImport, organizationId *uint) error {
+	user := imp.User
+	user.OrganizationId = organizationId
+	if len(user.Password) == 0 {
+		return errors.New("a password or password_hash is required for new users")
+	}
+
+	if !imp.SetStatus {
+		user.Status = domain.AccountStatusActive
+	}
+
+	if err := r.checkEmailAvailable(tx, user); err != nil {
+		return err
+	}
+
+	if err := tx.Create(&user).Error; err != nil {
+		return err
+	}
+
+	err := addUserOutboxEvent(tx, domain.EventUserRegistered, user.ID, map[string]interface{}{
+		"username":      user.Username,
+		"email_address": user.EmailAddress,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.grantClaims(tx, user.ID, user.OrganizationId, imp.ClaimIds)
+	return err
+}
+
+func (r *UserImportRepository) update(tx *gorm.DB, imp UserImport, current domain.User) (bool, error) {
+	user := imp.User
+	updates := map[string]interface{}{}
+
+	if user.EmailAddress != current.EmailAddress {
+		if err := r.checkEmailAvailable(tx, user); err != nil {
+			return false, err
+		}
+		updates["email_address"] = user.EmailAddress
+	}
+
+	if user.FirstName != current.FirstName {
+		updates["first_name"] = user.FirstName
+	}
+
+	if user.Surname != current.Surname {
+		updates["surname"] = user.Surname
+	}
+
+	if imp.SetEmailVerified && user.EmailVerified != current.EmailVerified {
+		updates["email_verified"] = user.EmailVerified
+	}
+
+	statusChanged := imp.SetStatus && user.Status != current.Status
+	if statusChanged {
+		updates["status"] = user.Status
+		if user.Status != domain.AccountStatusActive {
+			updates["tokens_revoked_at"] = time.Now()
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := tx.Model(&domain.User{}).Where("id = ?", current.ID).Updates(updates).Error; err != nil {
+			return false, err
+		}
+
+		if err := r.addUpdateEvents(tx, current, user, statusChanged); err != nil {
+			return false, err
+		}
+	}
+
+	granted, err := r.grantClaims(tx, current.ID, current.OrganizationId, imp.ClaimIds)
+	if err != nil {
+		return false, err
+	}
+
+	return len(updates) > 0 || granted > 0, nil
+}
+
+func (r *UserImportRepository) addUpdateEvents(tx *gorm.DB, current, user domain.User, statusChanged bool) error {
+	if user.EmailAddress != current.EmailAddress {
+		err := addUserOutboxEvent(tx, domain.EventUserEmailChanged, current.ID, map[string]interface{}{
+			"previous_email_address": current.EmailAddress,
+			"email_address":          user.EmailAddress,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if statusChanged {
+		err := addUserOutboxEvent(tx, domain.EventUserStatusChanged, current.ID, map[string]interface{}{
+			"status": user.Status,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return addUserOutboxEvent(tx, domain.EventUserUpdated, current.ID, map[string]interface{}{
+		"username":      current.Username,
+		"email_address": user.EmailAddress,
+		"first_name":    user.FirstName,
+		"surname":       user.Surname,
+	})
+}
+
+// grantClaims only adds claims; claims the user holds that are not listed in
+// the import are left alone.
+func (r *UserImportRepository) grantClaims(tx *gorm.DB, userId uint, organizationId *uint, claimIds []uint) (int, error) {
+	granted := 0
+
+	for _, claimId := range claimIds {
+		userClaim := domain.UserClaim{UserId: userId, ClaimId: claimId, OrganizationId: organizationId}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&userClaim)
+		if result.Error != nil {
+			return granted, result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		if err := addUserClaimOutboxEvent(tx, domain.EventClaimGranted, userClaim); err != nil {
+			return granted, err
+		}
+		granted++
+	}
+
+	return granted, nil
+}
+
+func (r *UserImportRepository) checkEmailAvailable(tx *gorm.DB, user domain.User) error {
+	var count int64
+
+	err := tx.Model(&domain.User{}).
+		Where("email_address = ? AND username <> ?", user.EmailAddress, user.Username).
+		Count(&count).
+		Error
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return errors.New("the email address is already used by another user")
+	}
+
+	return nil
+}
+
+// GetExportPage returns live users with an id above afterId in id order.
+func (r *UserImportRepository) GetExportPage(scope TenantScope, afterId uint, limit int) ([]domain.User, error) {
+	var users []domain.User
+
+	err := r.db.
+		Scopes(scope.where("users")).
+		Where("id > ? AND status <> ?", afterId, domain.AccountStatusErased).
+		Order("id").
+		Limit(limit).
+		Find(&users).
+		Error
+	if err != nil {
+		r.logger.Errorf("error getting users to export with error %v", err)
+		return nil, err
+	}
+
+	return users, nil
+}
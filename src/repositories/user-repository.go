@@ -5,9 +5,13 @@ import (
 	"authservice/src/domain"
 	"authservice/src/dtos"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository struct {
@@ -23,7 +27,18 @@ func InitUserRepositoy(serviceCfg *config.ServiceConfig) *UserRepository {
 }
 
 func (r *UserRepository) Add(user domain.User) (domain.User, error) {
-	if err := r.db.Create(&user).Error; err != nil {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		return addUserOutboxEvent(tx, domain.EventUserRegistered, user.ID, map[string]interface{}{
+			"username":      user.Username,
+			"email_address": user.EmailAddress,
+		})
+	})
+
+	if err != nil {
 		r.logger.Errorf("error creating user: %s with error: %v", user.Username, err)
 		return user, err
 	}
@@ -31,10 +46,13 @@ func (r *UserRepository) Add(user domain.User) (domain.User, error) {
 	return user, nil
 }
 
-func (r *UserRepository) UpdateUserPassword(updatePasswordDto dtos.UserUpdatePasswordDto) error {
+func (r *UserRepository) UpdateUserPassword(userId uint, passwordHash, pepperId string) error {
 	err := r.db.Model(&domain.User{}).
-		Where("id = ?", updatePasswordDto.UserId).
-		Update("password", updatePasswordDto.NewPassword).
+		Where("id = ?", userId).
+		Updates(map[string]interface{}{
+			"password":  passwordHash,
+			"pepper_id": pepperId,
+		}).
 		Error
 
 	if err != nil {
@@ -45,25 +63,186 @@ func (r *UserRepository) UpdateUserPassword(updatePasswordDto dtos.UserUpdatePas
 	return nil
 }
 
-func (r *UserRepository) UpdateUser(user domain.User) error {
+// RevokeTokens invalidates every token issued to the user so far.
+func (r *UserRepository) RevokeTokens(userId uint) error {
 	err := r.db.Model(&domain.User{}).
+		Where("id = ?", userId).
+		Update("tokens_revoked_at", time.Now()).
+		Error
+
+	if err != nil {
+		r.logger.Errorf("error revoking tokens for user id %d with error: %v", userId, err)
+		return err
+	}
+
+	return nil
+}
+
+// CountByPepperId reports how many users have passwords hashed with each
+// pepper, the empty id being passwords hashed without one.
+func (r *UserRepository) CountByPepperId() (map[string]int64, error) {
+	var rows []struct {
+		PepperId string
+		Count    int64
+	}
+
+	err := r.db.Unscoped().
+		Model(&domain.User{}).
+		Select("COALESCE(pepper_id, '') AS pepper_id, COUNT(*) AS count").
+		Where("erased_at IS NULL").
+		Group("COALESCE(pepper_id, '')").
+		Scan(&rows).
+		Error
+	if err != nil {
+		r.logger.Errorf("error counting users by pepper with error: %v", err)
+		return nil, err
+	}
+
+	counts := map[string]int64{}
+	for _, row := range rows {
+		counts[row.PepperId] = row.Count
+	}
+
+	return counts, nil
+}
+
+func (r *UserRepository) UpdateUser(user domain.User) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		return updateUserDetails(tx, user)
+	})
+
+	if err != nil {
+		r.logger.Errorf("error updating user with error: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// UserChanges are written together by ApplyChanges, so either all of them
+// are made or none are. Changes left nil are not made.
+type UserChanges struct {
+	Details  *domain.User
+	Password *PasswordChange
+	Status   *StatusChange
+}
+
+// PasswordChange replaces the password hash and revokes the user's tokens.
+type PasswordChange struct {
+	Hash     string
+	PepperId string
+}
+
+type StatusChange struct {
+	Status       string
+	Reason       string
+	Actor        string
+	RevokeTokens bool
+}
+
+func (r *UserRepository) ApplyChanges(userId uint, changes UserChanges) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// held until the end, so concurrent changes to the user wait their turn
+		var user domain.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, userId).Error; err != nil {
+			return err
+		}
+
+		if changes.Details != nil {
+			details := *changes.Details
+			details.ID = userId
+			if err := updateUserDetails(tx, details); err != nil {
+				return err
+			}
+		}
+
+		if changes.Password != nil {
+			err := tx.Model(&domain.User{}).
+				Where("id = ?", userId).
+				Updates(map[string]interface{}{
+					"password":          changes.Password.Hash,
+					"pepper_id":         changes.Password.PepperId,
+					"tokens_revoked_at": time.Now(),
+				}).
+				Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if changes.Status != nil {
+			return updateUserStatus(tx, userId, *changes.Status)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		r.logger.Errorf("error applying changes to user id %d with error: %v", userId, err)
+		return err
+	}
+
+	return nil
+}
+
+func updateUserDetails(tx *gorm.DB, user domain.User) error {
+	var current domain.User
+	if err := tx.Select("id", "email_address").First(&current, user.ID).Error; err != nil {
+		return err
+	}
+
+	err := tx.Model(&domain.User{}).
 		Where("id = ?", user.ID).
 		Update("username", user.Username).
 		Update("email_address", user.EmailAddress).
 		Update("first_name", user.FirstName).
 		Update("surname", user.Surname).
+		Update("external_id", user.ExternalId).
 		Error
-
 	if err != nil {
-		r.logger.Errorf("error updating user with error: %v", err)
 		return err
 	}
 
-	return nil
+	// whether a new address is verified is for the caller to say
+	if current.EmailAddress != user.EmailAddress {
+		if err := tx.Model(&domain.User{}).Where("id = ?", user.ID).Update("email_verified", user.EmailVerified).Error; err != nil {
+			return err
+		}
+
+		err := addUserOutboxEvent(tx, domain.EventUserEmailChanged, user.ID, map[string]interface{}{
+			"previous_email_address": current.EmailAddress,
+			"email_address":          user.EmailAddress,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return addUserOutboxEvent(tx, domain.EventUserUpdated, user.ID, map[string]interface{}{
+		"username":      user.Username,
+		"email_address": user.EmailAddress,
+		"first_name":    user.FirstName,
+		"surname":       user.Surname,
+	})
 }
 
+// Delete soft-deletes the user and revokes their tokens so they are not
+// accepted again should the account later be restored.
 func (r *UserRepository) Delete(user domain.User) error {
-	if err := r.db.Delete(&user).Error; err != nil {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.User{}).Where("id = ?", user.ID).Update("tokens_revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		result := tx.Delete(&user)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		return addUserOutboxEvent(tx, domain.EventUserDeleted, user.ID, nil)
+	})
+
+	if err != nil {
 		r.logger.Errorf("error deleting user: %s with error: %v", user.Username, err)
 		return err
 	}
@@ -71,6 +250,157 @@ func (r *UserRepository) Delete(user domain.User) error {
 	return nil
 }
 
+// MarkEmailVerified also activates accounts that were only waiting on
+// verification. An address already verified emits no event.
+func (r *UserRepository) MarkEmailVerified(userId uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&domain.User{}).
+			Where("id = ? AND email_verified = ?", userId, false).
+			Update("email_verified", true)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		err := tx.Model(&domain.User{}).
+			Where("id = ? AND status = ?", userId, domain.AccountStatusPendingVerification).
+			Update("status", domain.AccountStatusActive).
+			Error
+		if err != nil || result.RowsAffected == 0 {
+			return err
+		}
+
+		return addUserOutboxEvent(tx, domain.EventUserEmailVerified, userId, nil)
+	})
+
+	if err != nil {
+		r.logger.Errorf("error marking email verified for user id %d with error: %v", userId, err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *UserRepository) GetDeletedById(scope TenantScope, userId uint) (domain.User, error) {
+	var user domain.User
+
+	if err := r.db.Unscoped().Scopes(scope.where("users")).Where("deleted_at IS NOT NULL").First(&user, userId).Error; err != nil {
+		return domain.User{}, err
+	}
+
+	return user, nil
+}
+
+// HasActiveConflict reports whether a live user already holds the username or
+// email address of the given, soft-deleted, user.
+func (r *UserRepository) HasActiveConflict(user domain.User) (bool, error) {
+	var count int64
+
+	err := r.db.Model(&domain.User{}).
+		Where("id <> ? AND (username = ? OR email_address = ?)", user.ID, user.Username, user.EmailAddress).
+		Count(&count).
+		Error
+
+	if err != nil {
+		r.logger.Errorf("error checking for conflicts with user %s with error: %v", user.Username, err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// Restore emits no event for a user who is not deleted.
+func (r *UserRepository) Restore(userId uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().
+			Model(&domain.User{}).
+			Where("id = ? AND deleted_at IS NOT NULL", userId).
+			Update("deleted_at", nil)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		return addUserOutboxEvent(tx, domain.EventUserRestored, userId, nil)
+	})
+
+	if err != nil {
+		r.logger.Errorf("error restoring user id %d with error: %v", userId, err)
+		return err
+	}
+
+	return nil
+}
+
+// PurgeDeletedBefore hard-deletes users soft-deleted before the cutoff along
+// with their claims and sessions, and strips their details from past events.
+func (r *UserRepository) PurgeDeletedBefore(cutoff time.Time) (int64, error) {
+	var purged int64
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var userIds []uint
+		err := tx.Unscoped().
+			Model(&domain.User{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Pluck("id", &userIds).
+			Error
+		if err != nil || len(userIds) == 0 {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("user_id IN ?", userIds).Delete(&domain.UserClaim{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id IN ?", userIds).Delete(&domain.UserSession{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id IN ?", userIds).Delete(&domain.UserIdentity{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id IN ?", userIds).Delete(&domain.MagicLink{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id IN ?", userIds).Delete(&domain.ApiKey{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id IN ?", userIds).Delete(&domain.GroupMember{}).Error; err != nil {
+			return err
+		}
+
+		err = tx.Model(&domain.OutboxEvent{}).
+			Where("user_id IN ?", userIds).
+			Update("payload", gorm.Expr("jsonb_build_object('user_id', user_id)")).
+			Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Where("id IN ?", userIds).Delete(&domain.User{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged = result.RowsAffected
+
+		for _, userId := range userIds {
+			if err := addUserOutboxEvent(tx, domain.EventUserPurged, userId, nil); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		r.logger.Errorf("error purging deleted users with error: %v", err)
+		return 0, err
+	}
+
+	return purged, nil
+}
+
 func (r *UserRepository) GetByUsername(username string) (domain.User, error) {
 	var user domain.User
 	if err := r.db.First(&user, "username = ?", username).Error; err != nil {
@@ -86,12 +416,246 @@ func (r *UserRepository) GetByUsername(username string) (domain.User, error) {
 	return user, nil
 }
 
-func (r *UserRepository) GetById(userId uint) (domain.User, error) {
+func (r *UserRepository) GetByEmailAddress(emailAddress string) (domain.User, error) {
+	var user domain.User
+
+	if err := r.db.First(&user, "email_address = ?", emailAddress).Error; err != nil {
+		return domain.User{}, err
+	}
+
+	return user, nil
+}
+
+func (r *UserRepository) GetById(scope TenantScope, userId uint) (domain.User, error) {
 	var user domain.User
 
-	if err := r.db.First(&user, user).Error; err != nil {
+	if err := r.db.Scopes(scope.where("users")).First(&user, userId).Error; err != nil {
 		return domain.User{}, err
 	}
 
 	return user, nil
 }
+
+// List returns at most query.Limit users ordered by query.SortBy, which must
+// already have been validated as a column of the users table.
+func (r *UserRepository) List(scope TenantScope, query dtos.UserListQueryDto, after *dtos.UserListCursorDto) ([]domain.User, error) {
+	var users []domain.User
+
+	tx := r.db.Model(&domain.User{}).Scopes(scope.where("users"))
+	if query.Deleted {
+		tx = tx.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+
+	if len(query.Search) > 0 {
+		pattern := "%" + escapeLike(query.Search) + "%"
+		tx = tx.Where("(username ILIKE ? OR email_address ILIKE ? OR first_name ILIKE ? OR surname ILIKE ?)",
+			pattern, pattern, pattern, pattern)
+	}
+
+	if len(query.Claim) > 0 {
+		claimId := r.db.Model(&domain.Claim{}).Select("id").Where("claim = ?", query.Claim)
+		tx = tx.Where("users.id IN ("+claimHolderIdsSQL+")", claimId, claimId)
+	}
+
+	if query.CreatedAfter != nil {
+		tx = tx.Where("created_at >= ?", *query.CreatedAfter)
+	}
+
+	if query.CreatedBefore != nil {
+		tx = tx.Where("created_at < ?", *query.CreatedBefore)
+	}
+
+	if query.EmailVerified != nil {
+		tx = tx.Where("email_verified = ?", *query.EmailVerified)
+	}
+
+	if query.Locked != nil {
+		if *query.Locked {
+			tx = tx.Where("status = ?", domain.AccountStatusLocked)
+		} else {
+			tx = tx.Where("status <> ?", domain.AccountStatusLocked)
+		}
+	}
+
+	if len(query.Status) > 0 {
+		tx = tx.Where("status = ?", query.Status)
+	}
+
+	if len(query.AuthSource) > 0 {
+		tx = tx.Where("auth_source = ?", query.AuthSource)
+	}
+
+	direction, comparison := "ASC", ">"
+	if query.SortDesc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if after != nil {
+		var sortValue interface{} = after.SortValue
+		if query.SortBy == "created_at" {
+			createdAt, err := time.Parse(time.RFC3339Nano, after.SortValue)
+			if err != nil {
+				return []domain.User{}, err
+			}
+			sortValue = createdAt
+		}
+
+		tx = tx.Where(fmt.Sprintf("(%s, id) %s (?, ?)", query.SortBy, comparison), sortValue, after.UserId)
+	}
+
+	err := tx.
+		Order(fmt.Sprintf("%s %s, id %s", query.SortBy, direction, direction)).
+		Limit(query.Limit).
+		Find(&users).
+		Error
+
+	if err != nil {
+		r.logger.Errorf("error listing users with error %v", err)
+		return []domain.User{}, err
+	}
+
+	return users, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (r *UserRepository) UpdateStatus(userId uint, status, reason, actor string, revokeTokens bool) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		return updateUserStatus(tx, userId, StatusChange{
+			Status:       status,
+			Reason:       reason,
+			Actor:        actor,
+			RevokeTokens: revokeTokens,
+		})
+	})
+
+	if err != nil {
+		r.logger.Errorf("error updating status for user id %d with error: %v", userId, err)
+		return err
+	}
+
+	return nil
+}
+
+func updateUserStatus(tx *gorm.DB, userId uint, change StatusChange) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":            change.Status,
+		"status_reason":     change.Reason,
+		"status_changed_by": change.Actor,
+		"status_changed_at": now,
+	}
+
+	if change.RevokeTokens {
+		updates["tokens_revoked_at"] = now
+	}
+
+	result := tx.Model(&domain.User{}).
+		Where("id = ?", userId).
+		Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	return addUserOutboxEvent(tx, domain.EventUserStatusChanged, userId, map[string]interface{}{
+		"status": change.Status,
+	})
+}
+
+func (r *UserRepository) GetByIdIncludingDeleted(scope TenantScope, userId uint) (domain.User, error) {
+	var user domain.User
+
+	if err := r.db.Unscoped().Scopes(scope.where("users")).First(&user, userId).Error; err != nil {
+		return domain.User{}, err
+	}
+
+	return user, nil
+}
+
+// Erase replaces the personal data held for a user with placeholders. The row
+// itself is kept so records that reference the user id stay intact. It
+// returns ErrClaimUnheld, erasing nothing, when it would leave nobody in the
+// guard's scope holding the guarded claim.
+func (r *UserRepository) Erase(user domain.User, reason, actor string, guard ClaimGuard) error {
+	now := time.Now()
+	placeholder := fmt.Sprintf("erased-%d", user.ID)
+
+	err := guardClaim(r.db, guard, func(tx *gorm.DB) error {
+		err := tx.Unscoped().
+			Model(&domain.User{}).
+			Where("id = ?", user.ID).
+			Updates(map[string]interface{}{
+				"username":          placeholder,
+				"email_address":     placeholder + "@erased.invalid",
+				"first_name":        "",
+				"surname":           "",
+				"password":          "",
+				"pepper_id":         "",
+				"external_id":       "",
+				"email_verified":    false,
+				"status":            domain.AccountStatusErased,
+				"status_reason":     reason,
+				"status_changed_by": actor,
+				"status_changed_at": now,
+				"tokens_revoked_at": now,
+				"erased_at":         now,
+			}).
+			Error
+		if err != nil {
+			return err
+		}
+
+		// status changes this user made to other accounts record their username
+		err = tx.Unscoped().
+			Model(&domain.User{}).
+			Where("status_changed_by = ?", user.Username).
+			Update("status_changed_by", placeholder).
+			Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&domain.UserSession{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&domain.UserIdentity{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&domain.MagicLink{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&domain.ApiKey{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&domain.GroupMember{}).Error; err != nil {
+			return err
+		}
+
+		// earlier events carried the user's details, keep only the id
+		err = tx.Model(&domain.OutboxEvent{}).
+			Where("user_id = ?", user.ID).
+			Update("payload", gorm.Expr("jsonb_build_object('user_id', user_id)")).
+			Error
+		if err != nil {
+			return err
+		}
+
+		if err := addUserOutboxEvent(tx, domain.EventUserErased, user.ID, nil); err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Where("user_id = ?", user.ID).Delete(&domain.UserClaim{}).Error
+	})
+
+	if err != nil && !errors.Is(err, ErrClaimUnheld) {
+		r.logger.Errorf("error erasing user id %d with error: %v", user.ID, err)
+	}
+
+	return err
+}
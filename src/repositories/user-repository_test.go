@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"authservice/src/domain"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestUserEraseGuarded(t *testing.T) {
+	tests := []struct {
+		name     string
+		holders  []int64
+		wantErr  error
+		wantLast string
+	}{
+		{name: "other administrators left", holders: []int64{2, 1}, wantLast: "COMMIT"},
+		{name: "last administrator", holders: []int64{1, 0}, wantErr: ErrClaimUnheld, wantLast: "ROLLBACK"},
+		{name: "not an administrator", holders: []int64{1, 1}, wantLast: "COMMIT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holders := tt.holders
+			db, fake := newFakeDb(t, func(query string, args []driver.Value) (fakeResult, error) {
+				switch {
+				case strings.Contains(query, "claim_groups"):
+					if !strings.Contains(query, "users.organization_id IS NULL") {
+						t.Errorf("holders counted with %q, want it limited to users in no organization", query)
+					}
+
+					count := holders[0]
+					holders = holders[1:]
+					return fakeResult{columns: []string{"count"}, rows: [][]driver.Value{{count}}}, nil
+				case strings.HasPrefix(query, "INSERT"):
+					return fakeResult{columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}}}, nil
+				default:
+					return fakeResult{rowsAffected: 1}, nil
+				}
+			})
+			repo := &UserRepository{db: db, logger: zap.NewNop().Sugar()}
+
+			user := domain.User{Username: "alice"}
+			user.ID = 2
+			err := repo.Erase(user, "requested", "admin", ClaimGuard{Scope: InTenant(nil), ClaimId: 3})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Erase() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// counted under the lock before the first change and after the last
+			statements := fake.statements
+			n := len(statements)
+			if n < 6 {
+				t.Fatalf("statements = %q, want the erasure between two counts", statements)
+			}
+			checkStatements(t, statements[:4], []string{"BEGIN", "pg_advisory_xact_lock", "claim_groups", "UPDATE \"users\""})
+			checkStatements(t, statements[n-3:], []string{"DELETE FROM \"user_claims\"", "claim_groups", tt.wantLast})
+		})
+	}
+}
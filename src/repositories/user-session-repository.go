@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type UserSessionRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func InitUserSessionRepository(serviceCfg *config.ServiceConfig) *UserSessionRepository {
+	return &UserSessionRepository{
+		db:     serviceCfg.Db,
+		logger: serviceCfg.Logger,
+	}
+}
+
+func (r *UserSessionRepository) Add(session domain.UserSession) (domain.UserSession, error) {
+	if err := r.db.Create(&session).Error; err != nil {
+		r.logger.Errorf("error creating session for user id %d with error %v", session.UserId, err)
+		return session, err
+	}
+
+	return session, nil
+}
+
+func (r *UserSessionRepository) GetBySessionId(sessionId string) (domain.UserSession, error) {
+	var session domain.UserSession
+
+	if err := r.db.First(&session, "session_id = ?", sessionId).Error; err != nil {
+		return domain.UserSession{}, err
+	}
+
+	return session, nil
+}
+
+func (r *UserSessionRepository) GetActiveByUserId(userId uint) ([]domain.UserSession, error) {
+	var sessions []domain.UserSession
+
+	err := r.db.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userId, time.Now()).
+		Order("created_at DESC").
+		Find(&sessions).
+		Error
+	if err != nil {
+		r.logger.Errorf("error getting active sessions for user id %d with error %v", userId, err)
+		return []domain.UserSession{}, err
+	}
+
+	return sessions, nil
+}
+
+// GetHistoryByUserId returns the most recent logins first. A limit of zero
+// returns the full history.
+func (r *UserSessionRepository) GetHistoryByUserId(userId uint, limit int) ([]domain.UserSession, error) {
+	var sessions []domain.UserSession
+
+	tx := r.db.Where("user_id = ?", userId).Order("created_at DESC")
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+
+	if err := tx.Find(&sessions).Error; err != nil {
+		r.logger.Errorf("error getting login history for user id %d with error %v", userId, err)
+		return []domain.UserSession{}, err
+	}
+
+	return sessions, nil
+}
+
+func (r *UserSessionRepository) TouchLastSeen(sessionId string, seenAt time.Time) error {
+	return r.db.Model(&domain.UserSession{}).
+		Where("session_id = ?", sessionId).
+		Update("last_seen_at", seenAt).
+		Error
+}
+
+func (r *UserSessionRepository) Revoke(userId uint, sessionId string) (int64, error) {
+	result := r.db.Model(&domain.UserSession{}).
+		Where("user_id = ? AND session_id = ? AND revoked_at IS NULL", userId, sessionId).
+		Update("revoked_at", time.Now())
+
+	if result.Error != nil {
+		r.logger.Errorf("error revoking session for user id %d with error %v", userId, result.Error)
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
+
+// RevokeAllExcept revokes every live session for the user apart from the
+// one given, which may be empty to revoke them all.
+func (r *UserSessionRepository) RevokeAllExcept(userId uint, sessionId string) (int64, error) {
+	result := r.db.Model(&domain.UserSession{}).
+		Where("user_id = ? AND session_id <> ? AND revoked_at IS NULL AND expires_at > ?", userId, sessionId, time.Now()).
+		Update("revoked_at", time.Now())
+
+	if result.Error != nil {
+		r.logger.Errorf("error revoking sessions for user id %d with error %v", userId, result.Error)
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
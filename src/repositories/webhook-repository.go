@@ -0,0 +1,192 @@
+package repositories
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func InitWebhookRepository(serviceCfg *config.ServiceConfig) *WebhookRepository {
+	return &WebhookRepository{
+		db:     serviceCfg.Db,
+		logger: serviceCfg.Logger,
+	}
+}
+
+func (r *WebhookRepository) AddSubscription(subscription domain.WebhookSubscription) (domain.WebhookSubscription, error) {
+	if err := r.db.Create(&subscription).Error; err != nil {
+		r.logger.Errorf("error creating webhook subscription for %s with error %v", subscription.Url, err)
+		return subscription, err
+	}
+
+	return subscription, nil
+}
+
+func (r *WebhookRepository) GetSubscriptions() ([]domain.WebhookSubscription, error) {
+	var subscriptions []domain.WebhookSubscription
+
+	if err := r.db.Order("id").Find(&subscriptions).Error; err != nil {
+		r.logger.Errorf("error getting webhook subscriptions with error %v", err)
+		return []domain.WebhookSubscription{}, err
+	}
+
+	return subscriptions, nil
+}
+
+func (r *WebhookRepository) GetSubscriptionById(subscriptionId uint) (domain.WebhookSubscription, error) {
+	var subscription domain.WebhookSubscription
+
+	if err := r.db.First(&subscription, subscriptionId).Error; err != nil {
+		return domain.WebhookSubscription{}, err
+	}
+
+	return subscription, nil
+}
+
+// DeleteSubscription removes the subscription and abandons any deliveries
+// still waiting to be sent to it.
+func (r *WebhookRepository) DeleteSubscription(subscriptionId uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&domain.WebhookDelivery{}).
+			Where("subscription_id = ? AND status = ?", subscriptionId, domain.WebhookDeliveryPending).
+			Updates(map[string]interface{}{
+				"status":     domain.WebhookDeliveryFailed,
+				"last_error": "subscription deleted",
+			}).
+			Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&domain.WebhookSubscription{}, subscriptionId).Error
+	})
+
+	if err != nil {
+		r.logger.Errorf("error deleting webhook subscription id %d with error %v", subscriptionId, err)
+		return err
+	}
+
+	return nil
+}
+
+// AddDeliveries queues a delivery of each event to every subscription that
+// asked for it. It runs inside the outbox dispatch transaction.
+func (r *WebhookRepository) AddDeliveries(tx *gorm.DB, events []domain.OutboxEvent) error {
+	var subscriptions []domain.WebhookSubscription
+	if err := tx.Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deliveries := []domain.WebhookDelivery{}
+
+	for _, event := range events {
+		for _, subscription := range subscriptions {
+			if !subscription.IsSubscribedTo(event.EventType) {
+				continue
+			}
+
+			deliveries = append(deliveries, domain.WebhookDelivery{
+				SubscriptionId: subscription.ID,
+				OutboxEventId:  event.ID,
+				EventType:      event.EventType,
+				Status:         domain.WebhookDeliveryPending,
+				NextAttemptAt:  now,
+			})
+		}
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error
+}
+
+// ClaimDueDeliveries returns pending deliveries whose next attempt is due and
+// pushes their next attempt back by lease, so another instance polling at the
+// same time does not send them too.
+func (r *WebhookRepository) ClaimDueDeliveries(limit int, lease time.Duration) ([]domain.WebhookDelivery, error) {
+	var deliveries []domain.WebhookDelivery
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", domain.WebhookDeliveryPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&deliveries).
+			Error
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		ids := make([]uint, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.ID)
+		}
+
+		return tx.Model(&domain.WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+
+	if err != nil {
+		r.logger.Errorf("error claiming webhook deliveries with error %v", err)
+		return []domain.WebhookDelivery{}, err
+	}
+
+	return deliveries, nil
+}
+
+func (r *WebhookRepository) UpdateDelivery(delivery domain.WebhookDelivery) error {
+	err := r.db.Model(&domain.WebhookDelivery{}).
+		Where("id = ?", delivery.ID).
+		Updates(map[string]interface{}{
+			"status":          delivery.Status,
+			"attempts":        delivery.Attempts,
+			"next_attempt_at": delivery.NextAttemptAt,
+			"last_attempt_at": delivery.LastAttemptAt,
+			"response_status": delivery.ResponseStatus,
+			"last_error":      delivery.LastError,
+			"delivered_at":    delivery.DeliveredAt,
+		}).
+		Error
+
+	if err != nil {
+		r.logger.Errorf("error updating webhook delivery id %d with error %v", delivery.ID, err)
+		return err
+	}
+
+	return nil
+}
+
+// GetDeliveries returns the newest deliveries for a subscription first,
+// starting before the given delivery id when one is supplied.
+func (r *WebhookRepository) GetDeliveries(subscriptionId uint, status string, beforeId uint, limit int) ([]domain.WebhookDelivery, error) {
+	var deliveries []domain.WebhookDelivery
+
+	tx := r.db.Where("subscription_id = ?", subscriptionId)
+	if len(status) > 0 {
+		tx = tx.Where("status = ?", status)
+	}
+
+	if beforeId > 0 {
+		tx = tx.Where("id < ?", beforeId)
+	}
+
+	if err := tx.Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		r.logger.Errorf("error getting deliveries for webhook subscription id %d with error %v", subscriptionId, err)
+		return []domain.WebhookDelivery{}, err
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,124 @@
+package routes
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/services"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	auditErrSrc = "AuditRoutes"
+)
+
+type AuditRoutes struct {
+	baseEndpoint string
+	mux          *chi.Mux
+	auditService *services.AuditService
+	userService  *services.UserService
+	jsonHelpers  *helpers.JsonHelpers
+	logger       *zap.SugaredLogger
+}
+
+func InitAuditRoutes(serviceCfg *config.ServiceConfig) *AuditRoutes {
+	return &AuditRoutes{
+		baseEndpoint: "/audit-events",
+		mux:          serviceCfg.Mux,
+		auditService: services.InitAuditService(serviceCfg),
+		userService:  services.InitUserService(serviceCfg),
+		jsonHelpers:  helpers.InitJsonHelpers(serviceCfg.Logger),
+		logger:       serviceCfg.Logger,
+	}
+}
+
+func (a *AuditRoutes) Register() {
+	a.mux.Group(func(r chi.Router) {
+		r.Use(a.userService.CustomJWTAuthVerifier)
+		r.Use(a.userService.RequirePermission(domain.PermissionAuditRead))
+
+		r.Get(a.baseEndpoint, a.queryEvents)
+	})
+}
+
+func (a *AuditRoutes) queryEvents(w http.ResponseWriter, r *http.Request) {
+	query, err := parseAuditEventQuery(r.URL.Query())
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, auditErrSrc)
+		return
+	}
+
+	events, err := a.auditService.Query(r.Context(), query)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), auditErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, events)
+}
+
+func parseAuditEventQuery(values url.Values) (dtos.AuditEventQueryDto, error) {
+	query := dtos.AuditEventQueryDto{
+		EventType: values.Get("event_type"),
+		Outcome:   values.Get("outcome"),
+		RequestId: values.Get("request_id"),
+	}
+
+	var err error
+	if query.ActorUserId, err = parseUintParam(values, "actor_user_id"); err != nil {
+		return query, err
+	}
+
+	if query.TargetUserId, err = parseUintParam(values, "target_user_id"); err != nil {
+		return query, err
+	}
+
+	if query.From, err = parseTimeParam(values, "from"); err != nil {
+		return query, err
+	}
+
+	if query.To, err = parseTimeParam(values, "to"); err != nil {
+		return query, err
+	}
+
+	cursor, err := parseUintParam(values, "cursor")
+	if err != nil {
+		return query, err
+	}
+	if cursor != nil {
+		query.BeforeId = *cursor
+	}
+
+	if v := values.Get("limit"); len(v) > 0 {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return query, errors.New("limit must be a number")
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
+}
+
+func parseUintParam(values url.Values, param string) (*uint, error) {
+	v := values.Get(param)
+	if len(v) == 0 {
+		return nil, nil
+	}
+
+	n, err := strconv.ParseUint(v, 10, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a positive number", param)
+	}
+
+	value := uint(n)
+	return &value, nil
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"authservice/src/config"
 	"authservice/src/domain"
+	"authservice/src/dtos"
 	"authservice/src/helpers"
 	"authservice/src/services"
 	"fmt"
@@ -13,11 +14,14 @@ import (
 )
 
 type ClaimsRoutes struct {
-	baseEndpoint string
-	mux          *chi.Mux
-	claimService *services.ClaimService
-	jsonHelpers  *helpers.JsonHelpers
-	logger       *zap.SugaredLogger
+	baseEndpoint      string
+	mux               *chi.Mux
+	claimService      *services.ClaimService
+	permissionService *services.PermissionService
+	userService       *services.UserService
+	userClaimService  *services.UserClaimService
+	jsonHelpers       *helpers.JsonHelpers
+	logger            *zap.SugaredLogger
 }
 
 const (
@@ -26,20 +30,44 @@ const (
 
 func InitClaimRoutes(serviceCfg *config.ServiceConfig) *ClaimsRoutes {
 	return &ClaimsRoutes{
-		baseEndpoint: "/claims",
-		mux:          serviceCfg.Mux,
-		claimService: services.InitClaimService(serviceCfg),
-		jsonHelpers:  helpers.InitJsonHelpers(serviceCfg.Logger),
-		logger:       serviceCfg.Logger,
+		baseEndpoint:      "/claims",
+		mux:               serviceCfg.Mux,
+		claimService:      services.InitClaimService(serviceCfg),
+		permissionService: services.InitPermissionService(serviceCfg),
+		userService:       services.InitUserService(serviceCfg),
+		userClaimService:  services.InitUserClaimService(serviceCfg),
+		jsonHelpers:       helpers.InitJsonHelpers(serviceCfg.Logger),
+		logger:            serviceCfg.Logger,
 	}
 }
 
+// Register serves the claims, which are the roles users hold, and the
+// permissions each role bundles. Roles are shared by every organization, so
+// only platform administrators change them.
 func (a *ClaimsRoutes) Register() {
-	a.mux.Post(a.baseEndpoint, a.addClaim)
-	a.mux.Put(a.baseEndpoint, a.updateClaim)
-	a.mux.Delete(a.baseEndpoint, a.deleteClaim)
-
 	a.mux.Get(fmt.Sprintf("%s/get-all", a.baseEndpoint), a.getAll)
+
+	a.mux.Group(func(r chi.Router) {
+		r.Use(a.userService.CustomJWTAuthVerifier)
+
+		read := a.userService.RequirePermission(domain.PermissionClaimsRead)
+		write := a.userService.RequirePermission(domain.PermissionClaimsWrite)
+
+		r.With(read).Get(fmt.Sprintf("%s/{claim}/users", a.baseEndpoint), a.getUsersWithClaim)
+		r.With(read).Get(fmt.Sprintf("%s/{claim}/permissions", a.baseEndpoint), a.getPermissions)
+
+		r.Group(func(r chi.Router) {
+			r.Use(write)
+			r.Use(a.userService.RequirePlatform)
+
+			r.Post(a.baseEndpoint, a.addClaim)
+			r.Put(a.baseEndpoint, a.updateClaim)
+			r.Delete(a.baseEndpoint, a.deleteClaim)
+
+			r.Post(fmt.Sprintf("%s/{claim}/permissions", a.baseEndpoint), a.grantPermission)
+			r.Delete(fmt.Sprintf("%s/{claim}/permissions/{permission}", a.baseEndpoint), a.revokePermission)
+		})
+	})
 }
 
 func (a *ClaimsRoutes) addClaim(w http.ResponseWriter, r *http.Request) {
@@ -49,7 +77,7 @@ func (a *ClaimsRoutes) addClaim(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	claim, err := a.claimService.Add(claim)
+	claim, err := a.claimService.Add(r.Context(), claim)
 	if err != nil {
 		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, claimErrSrc)
 		return
@@ -65,7 +93,7 @@ func (a *ClaimsRoutes) updateClaim(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := a.claimService.Update(claim)
+	err := a.claimService.Update(r.Context(), claim)
 	if err != nil {
 		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, claimErrSrc)
 		return
@@ -81,7 +109,7 @@ func (a *ClaimsRoutes) deleteClaim(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := a.claimService.Delete(claim)
+	err := a.claimService.Delete(r.Context(), claim)
 	if err != nil {
 		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, claimErrSrc)
 		return
@@ -99,3 +127,49 @@ func (a *ClaimsRoutes) getAll(w http.ResponseWriter, r *http.Request) {
 
 	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, claims)
 }
+
+func (a *ClaimsRoutes) getUsersWithClaim(w http.ResponseWriter, r *http.Request) {
+	users, err := a.userClaimService.GetUsersWithClaim(r.Context(), chi.URLParam(r, "claim"))
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), claimErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, users)
+}
+
+func (a *ClaimsRoutes) getPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := a.permissionService.GetRolePermissions(chi.URLParam(r, "claim"))
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), claimErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, permissions)
+}
+
+func (a *ClaimsRoutes) grantPermission(w http.ResponseWriter, r *http.Request) {
+	var grant dtos.RolePermissionDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &grant); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, claimErrSrc)
+		return
+	}
+
+	err := a.permissionService.GrantPermission(r.Context(), chi.URLParam(r, "claim"), grant.Permission)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), claimErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusCreated, nil)
+}
+
+func (a *ClaimsRoutes) revokePermission(w http.ResponseWriter, r *http.Request) {
+	err := a.permissionService.RevokePermission(r.Context(), chi.URLParam(r, "claim"), chi.URLParam(r, "permission"))
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), claimErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil)
+}
@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/services"
+	"expvar"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type DebugRoutes struct {
+	baseEndpoint string
+	mux          *chi.Mux
+	userService  *services.UserService
+}
+
+func InitDebugRoutes(serviceCfg *config.ServiceConfig) *DebugRoutes {
+	return &DebugRoutes{
+		baseEndpoint: "/debug",
+		mux:          serviceCfg.Mux,
+		userService:  services.InitUserService(serviceCfg),
+	}
+}
+
+// Register serves the service's metrics, such as the password hashing queue,
+// to platform users allowed to read them.
+func (a *DebugRoutes) Register() {
+	a.mux.Group(func(r chi.Router) {
+		r.Use(a.userService.CustomJWTAuthVerifier)
+		r.Use(a.userService.RequirePermission(domain.PermissionMetricsRead))
+		r.Use(a.userService.RequirePlatform)
+
+		r.Handle(a.baseEndpoint+"/vars", expvar.Handler())
+	})
+}
@@ -0,0 +1,184 @@
+package routes
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/helpers"
+	"authservice/src/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	eventErrSrc = "EventRoutes"
+
+	eventStreamPollInterval = 1 * time.Second
+	eventStreamHeartbeat    = 15 * time.Second
+	eventStreamRetry        = 5 * time.Second
+)
+
+type EventRoutes struct {
+	baseEndpoint string
+	mux          *chi.Mux
+	eventService *services.EventService
+	userService  *services.UserService
+	jsonHelpers  *helpers.JsonHelpers
+	logger       *zap.SugaredLogger
+}
+
+func InitEventRoutes(serviceCfg *config.ServiceConfig) *EventRoutes {
+	return &EventRoutes{
+		baseEndpoint: "/events",
+		mux:          serviceCfg.Mux,
+		eventService: services.InitEventService(serviceCfg),
+		userService:  services.InitUserService(serviceCfg),
+		jsonHelpers:  helpers.InitJsonHelpers(serviceCfg.Logger),
+		logger:       serviceCfg.Logger,
+	}
+}
+
+func (a *EventRoutes) Register() {
+	a.mux.Group(func(r chi.Router) {
+		r.Use(a.userService.CustomJWTAuthVerifier)
+		r.Use(a.userService.RequirePermission(domain.PermissionEventsRead))
+		// the feed carries the events of every organization's users
+		r.Use(a.userService.RequirePlatform)
+
+		r.Get(a.baseEndpoint, a.getEvents)
+		r.Get(fmt.Sprintf("%s/stream", a.baseEndpoint), a.streamEvents)
+	})
+}
+
+func (a *EventRoutes) getEvents(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	after, err := parseEventCursor(values.Get("after"))
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, eventErrSrc)
+		return
+	}
+
+	limit := 0
+	if v := values.Get("limit"); len(v) > 0 {
+		if limit, err = strconv.Atoi(v); err != nil {
+			a.jsonHelpers.ErrorJSON(w, errors.New("limit must be a number"), http.StatusBadRequest, eventErrSrc)
+			return
+		}
+	}
+
+	events, err := a.eventService.GetEvents(after, parseEventTypes(values), limit)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, eventErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, events)
+}
+
+// streamEvents sends events as Server-Sent Events, polling for new ones until
+// the client disconnects. A reconnecting client resumes from its
+// Last-Event-ID header, which takes precedence over the after parameter.
+func (a *EventRoutes) streamEvents(w http.ResponseWriter, r *http.Request) {
+	cursor := r.Header.Get("Last-Event-ID")
+	if len(cursor) == 0 {
+		cursor = r.URL.Query().Get("after")
+	}
+
+	after, err := parseEventCursor(cursor)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, eventErrSrc)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("streaming is not supported"), http.StatusInternalServerError, eventErrSrc)
+		return
+	}
+
+	eventTypes := parseEventTypes(r.URL.Query())
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventStreamRetry.Milliseconds())
+	flusher.Flush()
+
+	poll := time.NewTicker(eventStreamPollInterval)
+	defer poll.Stop()
+	lastWrite := time.Now()
+
+	for {
+		events, err := a.eventService.GetEvents(after, eventTypes, 0)
+		if err != nil {
+			return
+		}
+
+		for _, event := range events.Events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data); err != nil {
+				return
+			}
+			after = event.Id
+		}
+
+		if len(events.Events) > 0 {
+			lastWrite = time.Now()
+			flusher.Flush()
+		} else if time.Since(lastWrite) >= eventStreamHeartbeat {
+			// comments keep proxies from closing an idle connection
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			lastWrite = time.Now()
+			flusher.Flush()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-poll.C:
+		}
+	}
+}
+
+func parseEventCursor(v string) (uint, error) {
+	if len(v) == 0 {
+		return 0, nil
+	}
+
+	after, err := strconv.ParseUint(v, 10, 0)
+	if err != nil {
+		return 0, errors.New("the event cursor must be a positive number")
+	}
+
+	return uint(after), nil
+}
+
+// parseEventTypes accepts the type parameter repeated or comma separated.
+func parseEventTypes(values url.Values) []string {
+	eventTypes := []string{}
+	for _, v := range values["type"] {
+		for _, eventType := range strings.Split(v, ",") {
+			if eventType = strings.TrimSpace(eventType); len(eventType) > 0 {
+				eventTypes = append(eventTypes, eventType)
+			}
+		}
+	}
+
+	return eventTypes
+}
@@ -0,0 +1,248 @@
+package routes
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/services"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	federationErrSrc = "FederationRoutes"
+
+	// binds the login to the browser that started it, so a callback carrying
+	// someone else's state cannot sign this browser in as them
+	federatedLoginCookie = "federated_login"
+
+	// the only body type a SAML provider posts its response as
+	samlResponseContentType = "application/x-www-form-urlencoded"
+)
+
+type FederationRoutes struct {
+	baseEndpoint      string
+	mux               *chi.Mux
+	contentTypes      *helpers.ContentTypes
+	userService       *services.UserService
+	federationService *services.FederationService
+	redirectUrl       string
+	secureCookie      bool
+	loginTimeout      time.Duration
+	jsonHelpers       *helpers.JsonHelpers
+	logger            *zap.SugaredLogger
+}
+
+func InitFederationRoutes(serviceCfg *config.ServiceConfig) *FederationRoutes {
+	return &FederationRoutes{
+		baseEndpoint:      "/auth",
+		mux:               serviceCfg.Mux,
+		contentTypes:      serviceCfg.ContentTypes,
+		userService:       services.InitUserService(serviceCfg),
+		federationService: services.InitFederationService(serviceCfg),
+		redirectUrl:       serviceCfg.Federation.RedirectUrl,
+		secureCookie:      strings.HasPrefix(serviceCfg.Federation.CallbackBaseUrl, "https://"),
+		loginTimeout:      serviceCfg.Federation.LoginTimeout,
+		jsonHelpers:       helpers.InitJsonHelpers(serviceCfg.Logger),
+		logger:            serviceCfg.Logger,
+	}
+}
+
+func (a *FederationRoutes) Register() {
+	a.contentTypes.Allow(http.MethodPost, fmt.Sprintf("%s/{provider}/callback", a.baseEndpoint), samlResponseContentType)
+
+	a.mux.Get(fmt.Sprintf("%s/providers", a.baseEndpoint), a.listProviders)
+	a.mux.Get(fmt.Sprintf("%s/{provider}/login", a.baseEndpoint), a.startLogin)
+	a.mux.Get(fmt.Sprintf("%s/{provider}/callback", a.baseEndpoint), a.completeLogin)
+	a.mux.Post(fmt.Sprintf("%s/{provider}/callback", a.baseEndpoint), a.completeLogin)
+	a.mux.Get(fmt.Sprintf("%s/{provider}/metadata", a.baseEndpoint), a.samlMetadata)
+
+	// linking shares the login's callback and cookie, so it is served here
+	// rather than with the rest of /user/identities
+	a.mux.Group(func(r chi.Router) {
+		r.Use(a.userService.CustomJWTAuthVerifier)
+		r.Use(a.userService.RequireSession)
+		r.Post("/user/identities/{provider}", a.startLink)
+	})
+}
+
+func (a *FederationRoutes) listProviders(w http.ResponseWriter, r *http.Request) {
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, a.federationService.ListProviders(), nil)
+}
+
+func (a *FederationRoutes) samlMetadata(w http.ResponseWriter, r *http.Request) {
+	metadata, err := a.federationService.SamlMetadata(chi.URLParam(r, "provider"))
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), federationErrSrc)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(metadata)
+}
+
+// startLogin sends the browser to the provider's sign in page.
+func (a *FederationRoutes) startLogin(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	authUrl, state, err := a.federationService.StartLogin(r.Context(), provider)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), federationErrSrc)
+		return
+	}
+
+	http.SetCookie(w, a.loginCookie(provider, state, int(a.loginTimeout.Seconds())))
+	http.Redirect(w, r, authUrl, http.StatusFound)
+}
+
+// startLink returns the provider url to send the browser to. The request must
+// be sent with credentials for the login cookie to be set.
+func (a *FederationRoutes) startLink(w http.ResponseWriter, r *http.Request) {
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, federationErrSrc)
+		return
+	}
+
+	provider := chi.URLParam(r, "provider")
+
+	authUrl, state, err := a.federationService.StartLink(r.Context(), provider, userId)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), federationErrSrc)
+		return
+	}
+
+	http.SetCookie(w, a.loginCookie(provider, state, int(a.loginTimeout.Seconds())))
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, dtos.FederatedLinkDto{AuthUrl: authUrl}, nil)
+}
+
+// completeLogin is where the provider sends the browser back to, or where a
+// SAML provider posts its response with the state as the RelayState. The
+// token is handed to the configured redirect url in the fragment, so it never
+// reaches a server log, or returned as JSON when there is none.
+func (a *FederationRoutes) completeLogin(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	if r.Method == http.MethodPost && !a.federationService.PostsCallback(provider) {
+		a.jsonHelpers.ErrorJSON(w, errors.New("the provider does not post its callback"), http.StatusMethodNotAllowed, federationErrSrc)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, federationErrSrc)
+		return
+	}
+	values := r.Form
+
+	http.SetCookie(w, a.loginCookie(provider, "", -1))
+
+	if providerErr := values.Get("error"); len(providerErr) > 0 {
+		a.loginFailed(w, r, fmt.Errorf("%w: %s %s", services.ErrFederatedLoginFailed, providerErr, values.Get("error_description")))
+		return
+	}
+
+	state, code, err := callbackState(r)
+	if err != nil {
+		a.loginFailed(w, r, err)
+		return
+	}
+
+	user, linked, err := a.federationService.CompleteLogin(r.Context(), provider, state, code)
+	if err != nil {
+		a.loginFailed(w, r, err)
+		return
+	}
+
+	if linked {
+		if len(a.redirectUrl) > 0 {
+			http.Redirect(w, r, a.redirectUrl+"#linked="+url.QueryEscape(provider), http.StatusFound)
+			return
+		}
+
+		a.jsonHelpers.WriteJSON(w, http.StatusOK, nil, nil)
+		return
+	}
+
+	token, err := a.userService.GenerateUserToken(r.Context(), user, domain.AuthMethodFederated)
+	if err != nil {
+		a.loginFailed(w, r, err)
+		return
+	}
+
+	if len(a.redirectUrl) > 0 {
+		http.Redirect(w, r, a.redirectUrl+"#access_token="+url.QueryEscape(token), http.StatusFound)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, token, nil)
+}
+
+// callbackState returns the state and code of a parsed callback, refusing a
+// state other than the one in this browser's login cookie.
+func callbackState(r *http.Request) (string, string, error) {
+	state, code := r.Form.Get("state"), r.Form.Get("code")
+	if r.Method == http.MethodPost {
+		state, code = r.Form.Get("RelayState"), r.Form.Get("SAMLResponse")
+	}
+
+	cookie, err := r.Cookie(federatedLoginCookie)
+	if err != nil || len(state) == 0 || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		return "", "", services.ErrInvalidFederatedState
+	}
+
+	return state, code, nil
+}
+
+// loginCookie is only sent back to the provider's callback. A SAML response
+// is posted from the provider's site, which browsers only send cookies with
+// when they are SameSite=None, and so Secure.
+func (a *FederationRoutes) loginCookie(provider, state string, maxAge int) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     federatedLoginCookie,
+		Value:    state,
+		Path:     fmt.Sprintf("%s/%s/callback", a.baseEndpoint, provider),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   a.secureCookie,
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if a.federationService.PostsCallback(provider) {
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+
+	return cookie
+}
+
+func (a *FederationRoutes) loginFailed(w http.ResponseWriter, r *http.Request, err error) {
+	status := errorStatus(err, http.StatusInternalServerError)
+
+	if len(a.redirectUrl) > 0 {
+		message := err.Error()
+		if status == http.StatusInternalServerError {
+			a.logger.Errorf("%s: %v", federationErrSrc, err)
+			message = "the login could not be completed"
+		}
+
+		http.Redirect(w, r, a.redirectUrl+"#error="+url.QueryEscape(message), http.StatusFound)
+		return
+	}
+
+	if code := errorCode(err); len(code) > 0 {
+		a.jsonHelpers.ErrorCodeJSON(w, err, status, code, federationErrSrc)
+		return
+	}
+
+	a.jsonHelpers.ErrorJSON(w, err, status, federationErrSrc)
+}
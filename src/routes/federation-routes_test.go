@@ -0,0 +1,100 @@
+package routes
+
+import (
+	"authservice/src/services"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCallbackState(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		form      url.Values
+		cookie    string
+		wantState string
+		wantCode  string
+		wantErr   error
+	}{
+		{
+			name:      "redirect with the browser's state",
+			method:    http.MethodGet,
+			form:      url.Values{"state": {"state-1"}, "code": {"code-1"}},
+			cookie:    "state-1",
+			wantState: "state-1",
+			wantCode:  "code-1",
+		},
+		{
+			name:      "SAML post with the browser's relay state",
+			method:    http.MethodPost,
+			form:      url.Values{"RelayState": {"state-1"}, "SAMLResponse": {"response"}},
+			cookie:    "state-1",
+			wantState: "state-1",
+			wantCode:  "response",
+		},
+		{
+			name:    "SAML post with the relay state of another browser",
+			method:  http.MethodPost,
+			form:    url.Values{"RelayState": {"state-2"}, "SAMLResponse": {"response"}},
+			cookie:  "state-1",
+			wantErr: services.ErrInvalidFederatedState,
+		},
+		{
+			name:    "state of another browser",
+			method:  http.MethodGet,
+			form:    url.Values{"state": {"state-2"}, "code": {"code-1"}},
+			cookie:  "state-1",
+			wantErr: services.ErrInvalidFederatedState,
+		},
+		{
+			name:    "no login cookie",
+			method:  http.MethodGet,
+			form:    url.Values{"state": {"state-1"}, "code": {"code-1"}},
+			wantErr: services.ErrInvalidFederatedState,
+		},
+		{
+			name:    "no state",
+			method:  http.MethodGet,
+			form:    url.Values{"code": {"code-1"}},
+			cookie:  "",
+			wantErr: services.ErrInvalidFederatedState,
+		},
+		{
+			name:    "query state on a SAML post",
+			method:  http.MethodPost,
+			form:    url.Values{"state": {"state-1"}, "SAMLResponse": {"response"}},
+			cookie:  "state-1",
+			wantErr: services.ErrInvalidFederatedState,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r *http.Request
+			if tt.method == http.MethodPost {
+				r = httptest.NewRequest(tt.method, "/auth/idp/callback", strings.NewReader(tt.form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				r = httptest.NewRequest(tt.method, "/auth/idp/callback?"+tt.form.Encode(), nil)
+			}
+			if len(tt.cookie) > 0 {
+				r.AddCookie(&http.Cookie{Name: federatedLoginCookie, Value: tt.cookie})
+			}
+			if err := r.ParseForm(); err != nil {
+				t.Fatalf("ParseForm() error = %v", err)
+			}
+
+			state, code, err := callbackState(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("callbackState() error = %v, want %v", err, tt.wantErr)
+			}
+			if state != tt.wantState || code != tt.wantCode {
+				t.Errorf("callbackState() = %q, %q, want %q, %q", state, code, tt.wantState, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package routes
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/services"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	groupErrSrc = "GroupRoutes"
+)
+
+type GroupRoutes struct {
+	baseEndpoint string
+	mux          *chi.Mux
+	userService  *services.UserService
+	groupService *services.GroupService
+	jsonHelpers  *helpers.JsonHelpers
+	logger       *zap.SugaredLogger
+}
+
+func InitGroupRoutes(serviceCfg *config.ServiceConfig) *GroupRoutes {
+	return &GroupRoutes{
+		baseEndpoint: "/groups",
+		mux:          serviceCfg.Mux,
+		userService:  services.InitUserService(serviceCfg),
+		groupService: services.InitGroupService(serviceCfg),
+		jsonHelpers:  helpers.InitJsonHelpers(serviceCfg.Logger),
+		logger:       serviceCfg.Logger,
+	}
+}
+
+func (a *GroupRoutes) Register() {
+	a.mux.Group(func(r chi.Router) {
+		r.Use(a.userService.CustomJWTAuthVerifier)
+
+		read := a.userService.RequirePermission(domain.PermissionGroupsRead)
+		write := a.userService.RequirePermission(domain.PermissionGroupsWrite)
+
+		r.With(read).Get(a.baseEndpoint, a.getGroups)
+		r.With(write).Post(a.baseEndpoint, a.createGroup)
+		r.With(read).Get(fmt.Sprintf("%s/{groupId}", a.baseEndpoint), a.getGroup)
+		r.With(write).Delete(fmt.Sprintf("%s/{groupId}", a.baseEndpoint), a.deleteGroup)
+
+		r.With(write).Post(fmt.Sprintf("%s/{groupId}/members", a.baseEndpoint), a.addMember)
+		r.With(write).Delete(fmt.Sprintf("%s/{groupId}/members/{userId}", a.baseEndpoint), a.removeMember)
+
+		r.With(write).Post(fmt.Sprintf("%s/{groupId}/claims", a.baseEndpoint), a.grantClaim)
+		r.With(write).Delete(fmt.Sprintf("%s/{groupId}/claims/{claim}", a.baseEndpoint), a.revokeClaim)
+
+		r.With(write).Post(fmt.Sprintf("%s/{groupId}/subgroups", a.baseEndpoint), a.addSubgroup)
+		r.With(write).Delete(fmt.Sprintf("%s/{groupId}/subgroups/{subgroupId}", a.baseEndpoint), a.removeSubgroup)
+	})
+}
+
+func (a *GroupRoutes) getGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := a.groupService.GetGroups(r.Context())
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, groupErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, groups)
+}
+
+func (a *GroupRoutes) createGroup(w http.ResponseWriter, r *http.Request) {
+	var create dtos.GroupCreateDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &create); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, groupErrSrc)
+		return
+	}
+
+	group, err := a.groupService.CreateGroup(r.Context(), create)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), groupErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusCreated, group)
+}
+
+func (a *GroupRoutes) getGroup(w http.ResponseWriter, r *http.Request) {
+	groupId, err := uintURLParam(r, "groupId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, groupErrSrc)
+		return
+	}
+
+	group, err := a.groupService.GetGroup(r.Context(), groupId)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), groupErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, group)
+}
+
+func (a *GroupRoutes) deleteGroup(w http.ResponseWriter, r *http.Request) {
+	groupId, err := uintURLParam(r, "groupId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, groupErrSrc)
+		return
+	}
+
+	if err := a.groupService.DeleteGroup(r.Context(), groupId); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), groupErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil)
+}
+
+func (a *GroupRoutes) addMember(w http.ResponseWriter, r *http.Request) {
+	groupId, err := uintURLParam(r, "groupId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, groupErrSrc)
+		return
+	}
+
+	var member dtos.GroupMemberDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &member); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, groupErrSrc)
+		return
+	}
+
+	if err := a.groupService.AddMember(r.Context(), groupId, member.UserId); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), groupErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusCreated, nil)
+}
+
+func (a *GroupRoutes) removeMember(w http.ResponseWriter, r *http.Request) {
+	groupId, err := uintURLParam(r, "groupId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, groupErrSrc)
+		return
+	}
+
+	userId, err := uintURLParam(r, "userId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, groupErrSrc)
+		return
+	}
+
+	if err := a.groupService.RemoveMember(r.Context(), groupId, userId); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), groupErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil)
+}
+
+func (a *GroupRoutes) grantClaim(w http.ResponseWriter, r *http.Request) {
+	groupId, err := uintURLParam(r, "groupId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, groupErrSrc)
+		return
+	}
+
+	var groupClaim dtos.UserClaimDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &groupClaim); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, groupErrSrc)
+		return
+	}
+
+	if err := a.groupService.GrantClaim(r.Context(), groupId, groupClaim.Claim); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), groupErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusCreated, nil)
+}
+
+func (a *GroupRoutes) revokeClaim(w http.ResponseWriter, r *http.Request) {
+	groupId, err := uintURLParam(r, "groupId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, groupErrSrc)
+		return
+	}
+
+	if err := a.groupService.RevokeClaim(r.Context(), groupId, chi.URLParam(r, "claim")); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), groupErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil)
+}
+
+func (a *GroupRoutes) addSubgroup(w http.ResponseWriter, r *http.Request) {
+	groupId, err := uintURLParam(r, "groupId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, groupErrSrc)
+		return
+	}
+
+	var subgroup dtos.GroupSubgroupDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &subgroup); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, groupErrSrc)
+		return
+	}
+
+	if err := a.groupService.AddSubgroup(r.Context(), groupId, subgroup.GroupId); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), groupErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusCreated, nil)
+}
+
+func (a *GroupRoutes) removeSubgroup(w http.ResponseWriter, r *http.Request) {
+	groupId, err := uintURLParam(r, "groupId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, groupErrSrc)
+		return
+	}
+
+	subgroupId, err := uintURLParam(r, "subgroupId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, groupErrSrc)
+		return
+	}
+
+	if err := a.groupService.RemoveSubgroup(r.Context(), groupId, subgroupId); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), groupErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil)
+}
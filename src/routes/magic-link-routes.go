@@ -0,0 +1,149 @@
+package routes
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/services"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	magicLinkErrSrc = "MagicLinkRoutes"
+
+	// holds the secret a link is bound to, so only the browser that asked for
+	// the link can use it
+	magicLinkCookie = "magic_link"
+)
+
+type MagicLinkRoutes struct {
+	baseEndpoint     string
+	mux              *chi.Mux
+	userService      *services.UserService
+	magicLinkService *services.MagicLinkService
+	limiter          *helpers.RateLimiter
+	secureCookie     bool
+	ttl              time.Duration
+	jsonHelpers      *helpers.JsonHelpers
+	logger           *zap.SugaredLogger
+}
+
+func InitMagicLinkRoutes(serviceCfg *config.ServiceConfig) *MagicLinkRoutes {
+	return &MagicLinkRoutes{
+		baseEndpoint:     "/user/login/magic-link",
+		mux:              serviceCfg.Mux,
+		userService:      services.InitUserService(serviceCfg),
+		magicLinkService: services.InitMagicLinkService(serviceCfg),
+		limiter:          helpers.InitRateLimiter(serviceCfg.MagicLink.MaxRequestsPerIp, time.Hour),
+		secureCookie:     strings.HasPrefix(serviceCfg.MagicLink.LinkUrl, "https://"),
+		ttl:              serviceCfg.MagicLink.Ttl,
+		jsonHelpers:      helpers.InitJsonHelpers(serviceCfg.Logger),
+		logger:           serviceCfg.Logger,
+	}
+}
+
+func (a *MagicLinkRoutes) Register() {
+	a.mux.Group(func(r chi.Router) {
+		r.Use(a.limitRequests)
+		r.Post(a.baseEndpoint, a.requestLink)
+	})
+	a.mux.Post(fmt.Sprintf("%s/consume", a.baseEndpoint), a.consumeLink)
+}
+
+// limitRequests limits how many links each IP address can ask for, on top of
+// the limit on links sent to each user.
+func (a *MagicLinkRoutes) limitRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := helpers.RequestMetadataFromContext(r.Context()).IPAddress
+
+		if ok, retryAfter := a.limiter.Allow(ip); !ok {
+			a.logger.Warnf("magic link requests from %s are over the limit", ip)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			a.jsonHelpers.ErrorJSON(w, errors.New("too many requests, please try again later"), http.StatusTooManyRequests, magicLinkErrSrc)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestLink always answers 202 so it cannot be used to find out which
+// email addresses have accounts. The request must be sent with credentials
+// for the cookie to be set.
+func (a *MagicLinkRoutes) requestLink(w http.ResponseWriter, r *http.Request) {
+	var requestDto dtos.MagicLinkRequestDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &requestDto); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, magicLinkErrSrc)
+		return
+	}
+
+	binding, err := a.magicLinkService.RequestLink(r.Context(), requestDto.EmailAddress)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, magicLinkErrSrc)
+		return
+	}
+
+	http.SetCookie(w, a.bindingCookie(binding, int(a.ttl.Seconds())))
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil, nil)
+}
+
+// consumeLink exchanges the token from a link for the same token /user/login
+// issues.
+func (a *MagicLinkRoutes) consumeLink(w http.ResponseWriter, r *http.Request) {
+	var consumeDto dtos.MagicLinkConsumeDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &consumeDto); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, magicLinkErrSrc)
+		return
+	}
+
+	var binding string
+	if cookie, err := r.Cookie(magicLinkCookie); err == nil {
+		binding = cookie.Value
+	}
+
+	user, err := a.magicLinkService.ConsumeLink(r.Context(), consumeDto.Token, binding)
+	if err != nil {
+		status := errorStatus(err, http.StatusInternalServerError)
+		if code := errorCode(err); len(code) > 0 {
+			a.jsonHelpers.ErrorCodeJSON(w, err, status, code, magicLinkErrSrc)
+			return
+		}
+
+		a.jsonHelpers.ErrorJSON(w, err, status, magicLinkErrSrc)
+		return
+	}
+
+	http.SetCookie(w, a.bindingCookie("", -1))
+
+	token, err := a.userService.GenerateUserToken(r.Context(), user, domain.AuthMethodMagicLink)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, magicLinkErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, token, nil)
+}
+
+// bindingCookie is only sent to these endpoints, and never with requests
+// started by other sites.
+func (a *MagicLinkRoutes) bindingCookie(binding string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     magicLinkCookie,
+		Value:    binding,
+		Path:     a.baseEndpoint,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   a.secureCookie,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/services"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	organizationErrSrc = "OrganizationRoutes"
+)
+
+type OrganizationRoutes struct {
+	baseEndpoint        string
+	mux                 *chi.Mux
+	organizationService *services.OrganizationService
+	userService         *services.UserService
+	jsonHelpers         *helpers.JsonHelpers
+	logger              *zap.SugaredLogger
+}
+
+func InitOrganizationRoutes(serviceCfg *config.ServiceConfig) *OrganizationRoutes {
+	return &OrganizationRoutes{
+		baseEndpoint:        "/organizations",
+		mux:                 serviceCfg.Mux,
+		organizationService: services.InitOrganizationService(serviceCfg),
+		userService:         services.InitUserService(serviceCfg),
+		jsonHelpers:         helpers.InitJsonHelpers(serviceCfg.Logger),
+		logger:              serviceCfg.Logger,
+	}
+}
+
+// Register serves the endpoints platform administrators manage organizations
+// and their members with. An organization's own administrators manage its
+// users under /users, and only see those.
+func (a *OrganizationRoutes) Register() {
+	a.mux.Group(func(r chi.Router) {
+		r.Use(a.userService.CustomJWTAuthVerifier)
+		r.Use(a.userService.RequirePlatform)
+
+		read := a.userService.RequirePermission(domain.PermissionOrganizationsRead)
+		write := a.userService.RequirePermission(domain.PermissionOrganizationsWrite)
+
+		r.With(read).Get(a.baseEndpoint, a.getOrganizations)
+		r.With(write).Post(a.baseEndpoint, a.createOrganization)
+		r.With(write).Put("/users/{userId}/organization", a.moveUser)
+	})
+}
+
+func (a *OrganizationRoutes) getOrganizations(w http.ResponseWriter, r *http.Request) {
+	organizations, err := a.organizationService.GetOrganizations()
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, organizationErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, organizations)
+}
+
+func (a *OrganizationRoutes) createOrganization(w http.ResponseWriter, r *http.Request) {
+	var create dtos.OrganizationCreateDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &create); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, organizationErrSrc)
+		return
+	}
+
+	organization, err := a.organizationService.CreateOrganization(r.Context(), create)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), organizationErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusCreated, organization)
+}
+
+func (a *OrganizationRoutes) moveUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := uintURLParam(r, "userId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, organizationErrSrc)
+		return
+	}
+
+	var membership dtos.UserOrganizationDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &membership); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, organizationErrSrc)
+		return
+	}
+
+	if err := a.organizationService.MoveUser(r.Context(), userId, membership.OrganizationId); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), organizationErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil)
+}
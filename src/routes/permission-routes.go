@@ -0,0 +1,92 @@
+package routes
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/services"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	permissionErrSrc = "PermissionRoutes"
+)
+
+type PermissionRoutes struct {
+	baseEndpoint      string
+	mux               *chi.Mux
+	permissionService *services.PermissionService
+	userService       *services.UserService
+	jsonHelpers       *helpers.JsonHelpers
+	logger            *zap.SugaredLogger
+}
+
+func InitPermissionRoutes(serviceCfg *config.ServiceConfig) *PermissionRoutes {
+	return &PermissionRoutes{
+		baseEndpoint:      "/permissions",
+		mux:               serviceCfg.Mux,
+		permissionService: services.InitPermissionService(serviceCfg),
+		userService:       services.InitUserService(serviceCfg),
+		jsonHelpers:       helpers.InitJsonHelpers(serviceCfg.Logger),
+		logger:            serviceCfg.Logger,
+	}
+}
+
+// Register serves the permissions roles can bundle. They are managed
+// alongside the roles, with the claims permissions.
+func (a *PermissionRoutes) Register() {
+	a.mux.Group(func(r chi.Router) {
+		r.Use(a.userService.CustomJWTAuthVerifier)
+
+		r.With(a.userService.RequirePermission(domain.PermissionClaimsRead)).
+			Get(a.baseEndpoint, a.getPermissions)
+
+		r.Group(func(r chi.Router) {
+			r.Use(a.userService.RequirePermission(domain.PermissionClaimsWrite))
+			r.Use(a.userService.RequirePlatform)
+
+			r.Post(a.baseEndpoint, a.createPermission)
+			r.Delete(fmt.Sprintf("%s/{permission}", a.baseEndpoint), a.deletePermission)
+		})
+	})
+}
+
+func (a *PermissionRoutes) getPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := a.permissionService.GetPermissions()
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, permissionErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, permissions)
+}
+
+func (a *PermissionRoutes) createPermission(w http.ResponseWriter, r *http.Request) {
+	var create dtos.PermissionCreateDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &create); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, permissionErrSrc)
+		return
+	}
+
+	permission, err := a.permissionService.CreatePermission(r.Context(), create)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), permissionErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusCreated, permission)
+}
+
+func (a *PermissionRoutes) deletePermission(w http.ResponseWriter, r *http.Request) {
+	if err := a.permissionService.DeletePermission(r.Context(), chi.URLParam(r, "permission")); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), permissionErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil)
+}
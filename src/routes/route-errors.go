@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"authservice/src/helpers"
+	"authservice/src/services"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func errorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, helpers.ErrHashQueueTimeout), errors.Is(err, services.ErrDirectoryUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrClaimNotFound),
+		errors.Is(err, services.ErrSessionNotFound), errors.Is(err, services.ErrWebhookNotFound),
+		errors.Is(err, services.ErrUnknownProvider), errors.Is(err, services.ErrIdentityNotFound),
+		errors.Is(err, services.ErrApiKeyNotFound), errors.Is(err, services.ErrNotServiceAccount),
+		errors.Is(err, services.ErrOrganizationNotFound), errors.Is(err, services.ErrGroupNotFound),
+		errors.Is(err, services.ErrPermissionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidListQuery),
+		errors.Is(err, services.ErrInvalidWebhookUrl), errors.Is(err, services.ErrInvalidWebhookEvent),
+		errors.Is(err, services.ErrUnsupportedFormat), errors.Is(err, services.ErrInvalidImportFile),
+		errors.Is(err, services.ErrInvalidFederatedState),
+		errors.Is(err, services.ErrInvalidApiKeyScope), errors.Is(err, services.ErrInvalidApiKeyExpiry),
+		errors.Is(err, services.ErrApiKeyNameRequired), errors.Is(err, services.ErrInvalidServiceAccount),
+		errors.Is(err, services.ErrInvalidOrganization), errors.Is(err, services.ErrInvalidGroup),
+		errors.Is(err, services.ErrInvalidPermission):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrCannotChangeOwnStatus), errors.Is(err, services.ErrLastAdministrator),
+		errors.Is(err, services.ErrRestoreConflict), errors.Is(err, services.ErrPasswordManagedExternally),
+		errors.Is(err, services.ErrExternalUserConflict), errors.Is(err, services.ErrFederatedLinkUnverified),
+		errors.Is(err, services.ErrIdentityAlreadyLinked), errors.Is(err, services.ErrLastLoginMethod),
+		errors.Is(err, services.ErrOrganizationSlugTaken), errors.Is(err, services.ErrGroupNameTaken),
+		errors.Is(err, services.ErrGroupCycle), errors.Is(err, services.ErrGroupOrganizationMismatch),
+		errors.Is(err, services.ErrPermissionNameTaken), errors.Is(err, services.ErrBuiltInPermission):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrRestoreWindowExpired),
+		errors.Is(err, services.ErrAlreadyErased):
+		return http.StatusGone
+	case errors.Is(err, services.ErrPasswordMismatch), errors.Is(err, services.ErrFederatedLoginFailed),
+		errors.Is(err, services.ErrInvalidMagicLink):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrAccountSuspended),
+		errors.Is(err, services.ErrAccountLocked),
+		errors.Is(err, services.ErrAccountPendingVerification),
+		errors.Is(err, services.ErrFederatedEmailUnverified), errors.Is(err, services.ErrFederatedDomainNotAllowed),
+		errors.Is(err, services.ErrFederatedSignupDisabled), errors.Is(err, services.ErrMagicLinkOtherBrowser):
+		return http.StatusForbidden
+	}
+
+	return fallback
+}
+
+// errorCode returns the machine readable code for errors clients are
+// expected to handle differently, or an empty string.
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, services.ErrAccountSuspended):
+		return "account_suspended"
+	case errors.Is(err, services.ErrAccountLocked):
+		return "account_locked"
+	case errors.Is(err, services.ErrAccountPendingVerification):
+		return "account_pending_verification"
+	}
+
+	return ""
+}
+
+func exportHeaders(userId uint) http.Header {
+	return http.Header{
+		"Content-Disposition": []string{fmt.Sprintf(`attachment; filename="user-%d-export.json"`, userId)},
+	}
+}
+
+func uintURLParam(r *http.Request, name string) (uint, error) {
+	value, err := strconv.ParseUint(chi.URLParam(r, name), 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a positive number", name)
+	}
+
+	return uint(value), nil
+}
@@ -0,0 +1,427 @@
+package routes
+
+import (
+	"authservice/src/config"
+	"authservice/src/dtos"
+	"authservice/src/services"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	scimErrSrc = "ScimRoutes"
+
+	scimContentType = "application/scim+json"
+	maxScimBytes    = 1 << 20
+)
+
+type ScimRoutes struct {
+	baseEndpoint string
+	mux          *chi.Mux
+	scimService  *services.ScimService
+	tokenDigest  [sha256.Size]byte
+	baseUrl      string
+	logger       *zap.SugaredLogger
+}
+
+func InitScimRoutes(serviceCfg *config.ServiceConfig) *ScimRoutes {
+	return &ScimRoutes{
+		baseEndpoint: "/scim/v2",
+		mux:          serviceCfg.Mux,
+		scimService:  services.InitScimService(serviceCfg),
+		tokenDigest:  sha256.Sum256(serviceCfg.ScimToken),
+		baseUrl:      serviceCfg.ScimBaseUrl,
+		logger:       serviceCfg.Logger,
+	}
+}
+
+func (a *ScimRoutes) Register() {
+	a.mux.Route(a.baseEndpoint, func(r chi.Router) {
+		r.Use(a.requireScimToken)
+
+		r.Get("/ServiceProviderConfig", a.getServiceProviderConfig)
+		r.Get("/ResourceTypes", a.getResourceTypes)
+
+		r.Get("/Users", a.listUsers)
+		r.Post("/Users", a.createUser)
+		r.Get("/Users/{id}", a.getUser)
+		r.Put("/Users/{id}", a.replaceUser)
+		r.Patch("/Users/{id}", a.patchUser)
+		r.Delete("/Users/{id}", a.deleteUser)
+
+		r.Get("/Groups", a.listGroups)
+		r.Post("/Groups", a.createGroup)
+		r.Get("/Groups/{id}", a.getGroup)
+		r.Put("/Groups/{id}", a.replaceGroup)
+		r.Patch("/Groups/{id}", a.patchGroup)
+		r.Delete("/Groups/{id}", a.deleteGroup)
+	})
+}
+
+// requireScimToken checks the bearer token of the provisioning client and
+// confines the request to the organization the token is bound to. The
+// digests are compared so the comparison takes the same time whatever the
+// length of the presented token.
+func (a *ScimRoutes) requireScimToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		digest := sha256.Sum256([]byte(strings.TrimSpace(token)))
+
+		if !ok || subtle.ConstantTimeCompare(digest[:], a.tokenDigest[:]) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			a.writeError(w, &services.ScimError{Status: http.StatusUnauthorized, Detail: "invalid or missing bearer token"})
+			return
+		}
+
+		ctx, err := a.scimService.WithOrganization(r.Context())
+		if err != nil {
+			a.writeError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (a *ScimRoutes) listUsers(w http.ResponseWriter, r *http.Request) {
+	query, err := parseScimListQuery(r)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	list, err := a.scimService.ListUsers(r.Context(), query)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	a.writeScim(w, http.StatusOK, list, "")
+}
+
+func (a *ScimRoutes) getUser(w http.ResponseWriter, r *http.Request) {
+	user, err := a.scimService.GetUser(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	a.writeResource(w, r, user, user.Meta)
+}
+
+func (a *ScimRoutes) createUser(w http.ResponseWriter, r *http.Request) {
+	var user dtos.ScimUserDto
+	if err := a.readScim(w, r, &user); err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	user, err := a.scimService.CreateUser(r.Context(), user)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", user.Meta.Location)
+	a.writeScim(w, http.StatusCreated, user, user.Meta.Version)
+}
+
+func (a *ScimRoutes) replaceUser(w http.ResponseWriter, r *http.Request) {
+	var user dtos.ScimUserDto
+	if err := a.readScim(w, r, &user); err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	user, err := a.scimService.ReplaceUser(r.Context(), chi.URLParam(r, "id"), user, r.Header.Get("If-Match"))
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	a.writeScim(w, http.StatusOK, user, user.Meta.Version)
+}
+
+func (a *ScimRoutes) patchUser(w http.ResponseWriter, r *http.Request) {
+	var patch dtos.ScimPatchDto
+	if err := a.readScim(w, r, &patch); err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	user, err := a.scimService.PatchUser(r.Context(), chi.URLParam(r, "id"), patch, r.Header.Get("If-Match"))
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	a.writeScim(w, http.StatusOK, user, user.Meta.Version)
+}
+
+func (a *ScimRoutes) deleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := a.scimService.DeleteUser(r.Context(), chi.URLParam(r, "id"), r.Header.Get("If-Match")); err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *ScimRoutes) listGroups(w http.ResponseWriter, r *http.Request) {
+	query, err := parseScimListQuery(r)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	list, err := a.scimService.ListGroups(r.Context(), query)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	a.writeScim(w, http.StatusOK, list, "")
+}
+
+func (a *ScimRoutes) getGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := a.scimService.GetGroup(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	a.writeResource(w, r, group, group.Meta)
+}
+
+func (a *ScimRoutes) createGroup(w http.ResponseWriter, r *http.Request) {
+	var group dtos.ScimGroupDto
+	if err := a.readScim(w, r, &group); err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	group, err := a.scimService.CreateGroup(r.Context(), group)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", group.Meta.Location)
+	a.writeScim(w, http.StatusCreated, group, group.Meta.Version)
+}
+
+func (a *ScimRoutes) replaceGroup(w http.ResponseWriter, r *http.Request) {
+	var group dtos.ScimGroupDto
+	if err := a.readScim(w, r, &group); err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	group, err := a.scimService.ReplaceGroup(r.Context(), chi.URLParam(r, "id"), group, r.Header.Get("If-Match"))
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	a.writeScim(w, http.StatusOK, group, group.Meta.Version)
+}
+
+func (a *ScimRoutes) patchGroup(w http.ResponseWriter, r *http.Request) {
+	var patch dtos.ScimPatchDto
+	if err := a.readScim(w, r, &patch); err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	group, err := a.scimService.PatchGroup(r.Context(), chi.URLParam(r, "id"), patch, r.Header.Get("If-Match"))
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	a.writeScim(w, http.StatusOK, group, group.Meta.Version)
+}
+
+func (a *ScimRoutes) deleteGroup(w http.ResponseWriter, r *http.Request) {
+	if err := a.scimService.DeleteGroup(r.Context(), chi.URLParam(r, "id"), r.Header.Get("If-Match")); err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *ScimRoutes) getServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	supported := func(supported bool) map[string]bool {
+		return map[string]bool{"supported": supported}
+	}
+
+	a.writeScim(w, http.StatusOK, map[string]interface{}{
+		"schemas":        []string{dtos.ScimServiceProviderConfigSchema},
+		"patch":          supported(true),
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": 1000},
+		"changePassword": supported(true),
+		"sort":           supported(true),
+		"etag":           supported(true),
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "Authentication with the configured SCIM bearer token",
+			"primary":     true,
+		}},
+		"meta": map[string]string{
+			"resourceType": "ServiceProviderConfig",
+			"location":     a.baseUrl + "/ServiceProviderConfig",
+		},
+	}, "")
+}
+
+func (a *ScimRoutes) getResourceTypes(w http.ResponseWriter, r *http.Request) {
+	resourceType := func(name, endpoint, schema string) map[string]interface{} {
+		return map[string]interface{}{
+			"schemas":  []string{dtos.ScimResourceTypeSchema},
+			"id":       name,
+			"name":     name,
+			"endpoint": "/" + endpoint,
+			"schema":   schema,
+			"meta": map[string]string{
+				"resourceType": "ResourceType",
+				"location":     a.baseUrl + "/ResourceTypes/" + name,
+			},
+		}
+	}
+
+	resources := []map[string]interface{}{
+		resourceType("User", "Users", dtos.ScimUserSchema),
+		resourceType("Group", "Groups", dtos.ScimGroupSchema),
+	}
+
+	a.writeScim(w, http.StatusOK, dtos.ScimListResponseDto{
+		Schemas:      []string{dtos.ScimListResponseSchema},
+		TotalResults: int64(len(resources)),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, "")
+}
+
+// writeResource answers a GET of a single resource, or 304 when the client
+// already holds the current version.
+func (a *ScimRoutes) writeResource(w http.ResponseWriter, r *http.Request, resource interface{}, meta *dtos.ScimMetaDto) {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); len(ifNoneMatch) > 0 &&
+		services.ScimVersionMatches(meta.Version, ifNoneMatch) {
+		w.Header().Set("ETag", meta.Version)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	a.writeScim(w, http.StatusOK, resource, meta.Version)
+}
+
+func (a *ScimRoutes) readScim(w http.ResponseWriter, r *http.Request, data any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxScimBytes))
+
+	if err := dec.Decode(data); err != nil {
+		return &services.ScimError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: err.Error()}
+	}
+
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return &services.ScimError{Status: http.StatusBadRequest, ScimType: "invalidSyntax", Detail: "body must have only a single JSON value"}
+	}
+
+	return nil
+}
+
+func (a *ScimRoutes) writeScim(w http.ResponseWriter, status int, data any, version string) {
+	out, err := json.Marshal(data)
+	if err != nil {
+		a.logger.Errorf("error encoding SCIM response with error %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(version) > 0 {
+		w.Header().Set("ETag", version)
+	}
+
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+
+	if _, err := w.Write(out); err != nil {
+		a.logger.Errorf("error writing SCIM response with error %v", err)
+	}
+}
+
+// writeError answers in the SCIM error format. Errors the SCIM service did
+// not classify fall back to the statuses used by the rest of the API.
+func (a *ScimRoutes) writeError(w http.ResponseWriter, err error) {
+	var scimErr *services.ScimError
+	if !errors.As(err, &scimErr) {
+		status := errorStatus(err, http.StatusInternalServerError)
+		if status == http.StatusInternalServerError {
+			a.logger.Errorf("%s: %v", scimErrSrc, err)
+			err = errors.New("internal server error")
+		}
+		scimErr = &services.ScimError{Status: status, Detail: err.Error()}
+	}
+
+	a.writeScim(w, scimErr.Status, dtos.ScimErrorDto{
+		Schemas:  []string{dtos.ScimErrorSchema},
+		Status:   strconv.Itoa(scimErr.Status),
+		ScimType: scimErr.ScimType,
+		Detail:   scimErr.Detail,
+	}, "")
+}
+
+// parseScimListQuery reads the paging, sorting and filtering parameters of
+// RFC 7644 section 3.4.2.
+func parseScimListQuery(r *http.Request) (dtos.ScimListQueryDto, error) {
+	values := r.URL.Query()
+	query := dtos.ScimListQueryDto{
+		Filter: values.Get("filter"),
+		SortBy: values.Get("sortBy"),
+	}
+
+	for _, name := range []string{"startIndex", "count"} {
+		value := values.Get(name)
+		if len(value) == 0 {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return query, &services.ScimError{Status: http.StatusBadRequest, ScimType: "invalidValue", Detail: fmt.Sprintf("%s must be a number", name)}
+		}
+
+		if name == "startIndex" {
+			query.StartIndex = n
+		} else {
+			query.Count = &n
+		}
+	}
+
+	switch sortOrder := values.Get("sortOrder"); sortOrder {
+	case "", "ascending":
+	case "descending":
+		query.SortDescending = true
+	default:
+		return query, &services.ScimError{Status: http.StatusBadRequest, ScimType: "invalidValue", Detail: "sortOrder must be ascending or descending"}
+	}
+
+	if excluded := values.Get("excludedAttributes"); len(excluded) > 0 {
+		query.ExcludedAttributes = strings.Split(excluded, ",")
+	}
+
+	return query, nil
+}
@@ -0,0 +1,149 @@
+package routes
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/services"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	serviceAccountErrSrc = "ServiceAccountRoutes"
+)
+
+type ServiceAccountRoutes struct {
+	baseEndpoint          string
+	mux                   *chi.Mux
+	userService           *services.UserService
+	serviceAccountService *services.ServiceAccountService
+	apiKeyService         *services.ApiKeyService
+	jsonHelpers           *helpers.JsonHelpers
+	logger                *zap.SugaredLogger
+}
+
+func InitServiceAccountRoutes(serviceCfg *config.ServiceConfig) *ServiceAccountRoutes {
+	return &ServiceAccountRoutes{
+		baseEndpoint:          "/service-accounts",
+		mux:                   serviceCfg.Mux,
+		userService:           services.InitUserService(serviceCfg),
+		serviceAccountService: services.InitServiceAccountService(serviceCfg),
+		apiKeyService:         services.InitApiKeyService(serviceCfg),
+		jsonHelpers:           helpers.InitJsonHelpers(serviceCfg.Logger),
+		logger:                serviceCfg.Logger,
+	}
+}
+
+// Register serves the endpoints that create service accounts and manage
+// their keys. Service accounts are otherwise users, listed with
+// /users?auth_source=service_account and given claims, suspended and erased
+// under /users.
+func (a *ServiceAccountRoutes) Register() {
+	a.mux.Group(func(r chi.Router) {
+		r.Use(a.userService.CustomJWTAuthVerifier)
+		r.Use(a.userService.RequireSession)
+
+		read := a.userService.RequirePermission(domain.PermissionServiceAccountsRead)
+		write := a.userService.RequirePermission(domain.PermissionServiceAccountsWrite)
+
+		r.With(write).Post(a.baseEndpoint, a.createServiceAccount)
+
+		r.With(read).Get(fmt.Sprintf("%s/{userId}/api-keys", a.baseEndpoint), a.getApiKeys)
+		r.With(write).Post(fmt.Sprintf("%s/{userId}/api-keys", a.baseEndpoint), a.createApiKey)
+		r.With(write).Delete(fmt.Sprintf("%s/{userId}/api-keys/{keyId}", a.baseEndpoint), a.revokeApiKey)
+	})
+}
+
+func (a *ServiceAccountRoutes) createServiceAccount(w http.ResponseWriter, r *http.Request) {
+	var create dtos.ServiceAccountCreateDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &create); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, serviceAccountErrSrc)
+		return
+	}
+
+	user, err := a.serviceAccountService.CreateServiceAccount(r.Context(), create)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), serviceAccountErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusCreated, user, nil)
+}
+
+func (a *ServiceAccountRoutes) getApiKeys(w http.ResponseWriter, r *http.Request) {
+	userId, ok := a.serviceAccountId(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := a.apiKeyService.GetKeys(userId)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, serviceAccountErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, keys, nil)
+}
+
+func (a *ServiceAccountRoutes) createApiKey(w http.ResponseWriter, r *http.Request) {
+	userId, ok := a.serviceAccountId(w, r)
+	if !ok {
+		return
+	}
+
+	var create dtos.ApiKeyCreateDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &create); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, serviceAccountErrSrc)
+		return
+	}
+
+	key, err := a.apiKeyService.CreateKey(r.Context(), userId, create)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), serviceAccountErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusCreated, key, nil)
+}
+
+func (a *ServiceAccountRoutes) revokeApiKey(w http.ResponseWriter, r *http.Request) {
+	userId, ok := a.serviceAccountId(w, r)
+	if !ok {
+		return
+	}
+
+	keyId, err := uintURLParam(r, "keyId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, serviceAccountErrSrc)
+		return
+	}
+
+	if err := a.apiKeyService.RevokeKey(r.Context(), userId, keyId); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), serviceAccountErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil, nil)
+}
+
+// serviceAccountId reads the userId parameter, writing the error response
+// when it is not a service account.
+func (a *ServiceAccountRoutes) serviceAccountId(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	userId, err := uintURLParam(r, "userId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, serviceAccountErrSrc)
+		return 0, false
+	}
+
+	if _, err := a.serviceAccountService.GetServiceAccount(r.Context(), userId); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), serviceAccountErrSrc)
+		return 0, false
+	}
+
+	return userId, true
+}
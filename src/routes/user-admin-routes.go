@@ -0,0 +1,343 @@
+package routes
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/services"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	userAdminErrSrc = "UserAdminRoutes"
+)
+
+type UserAdminRoutes struct {
+	baseEndpoint     string
+	mux              *chi.Mux
+	userService      *services.UserService
+	userClaimService *services.UserClaimService
+	userDataService  *services.UserDataService
+	jsonHelpers      *helpers.JsonHelpers
+	logger           *zap.SugaredLogger
+}
+
+func InitUserAdminRoutes(serviceCfg *config.ServiceConfig) *UserAdminRoutes {
+	return &UserAdminRoutes{
+		baseEndpoint:     "/users",
+		mux:              serviceCfg.Mux,
+		userService:      services.InitUserService(serviceCfg),
+		userClaimService: services.InitUserClaimService(serviceCfg),
+		userDataService:  services.InitUserDataService(serviceCfg),
+		jsonHelpers:      helpers.InitJsonHelpers(serviceCfg.Logger),
+		logger:           serviceCfg.Logger,
+	}
+}
+
+func (a *UserAdminRoutes) Register() {
+	a.mux.Group(func(r chi.Router) {
+		r.Use(a.userService.CustomJWTAuthVerifier)
+
+		usersRead := a.userService.RequirePermission(domain.PermissionUsersRead)
+		usersWrite := a.userService.RequirePermission(domain.PermissionUsersWrite)
+		usersErase := a.userService.RequirePermission(domain.PermissionUsersErase)
+		claimsRead := a.userService.RequirePermission(domain.PermissionClaimsRead)
+		claimsWrite := a.userService.RequirePermission(domain.PermissionClaimsWrite)
+
+		r.With(usersRead).Get(a.baseEndpoint, a.listUsers)
+
+		r.With(usersWrite).Put(fmt.Sprintf("%s/{userId}/suspend", a.baseEndpoint), a.suspendUser)
+		r.With(usersWrite).Put(fmt.Sprintf("%s/{userId}/reactivate", a.baseEndpoint), a.reactivateUser)
+		r.With(usersWrite).Put(fmt.Sprintf("%s/{userId}/restore", a.baseEndpoint), a.restoreUser)
+		r.With(usersWrite).Put(fmt.Sprintf("%s/{userId}/verify-email", a.baseEndpoint), a.verifyEmail)
+
+		r.With(usersRead).Get(fmt.Sprintf("%s/{userId}/export", a.baseEndpoint), a.exportUserData)
+		r.With(usersErase).Post(fmt.Sprintf("%s/{userId}/erase", a.baseEndpoint), a.eraseUser)
+
+		r.With(claimsRead).Get(fmt.Sprintf("%s/{userId}/claims", a.baseEndpoint), a.getUserClaims)
+		r.With(claimsWrite).Post(fmt.Sprintf("%s/{userId}/claims", a.baseEndpoint), a.grantClaim)
+		r.With(claimsWrite).Delete(fmt.Sprintf("%s/{userId}/claims/{claim}", a.baseEndpoint), a.revokeClaim)
+	})
+}
+
+func (a *UserAdminRoutes) listUsers(w http.ResponseWriter, r *http.Request) {
+	query, err := parseUserListQuery(r.URL.Query())
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	users, err := a.userService.ListUsers(r.Context(), query)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userAdminErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, users)
+}
+
+func (a *UserAdminRoutes) suspendUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := uintURLParam(r, "userId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	var statusChange dtos.UserStatusChangeDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &statusChange); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	if len(strings.TrimSpace(statusChange.Reason)) == 0 {
+		a.jsonHelpers.ErrorJSON(w, errors.New("a reason must be supplied"), http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	actor := services.UsernameFromContext(r.Context())
+	if err := a.userService.SuspendUser(r.Context(), userId, statusChange.Reason, actor); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userAdminErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil, nil)
+}
+
+func (a *UserAdminRoutes) reactivateUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := uintURLParam(r, "userId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	var statusChange dtos.UserStatusChangeDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &statusChange); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	actor := services.UsernameFromContext(r.Context())
+	if err := a.userService.ReactivateUser(r.Context(), userId, statusChange.Reason, actor); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userAdminErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil, nil)
+}
+
+func (a *UserAdminRoutes) restoreUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := uintURLParam(r, "userId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	actor := services.UsernameFromContext(r.Context())
+	if err := a.userService.RestoreUser(r.Context(), userId, actor); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userAdminErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil, nil)
+}
+
+func (a *UserAdminRoutes) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	userId, err := uintURLParam(r, "userId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	actor := services.UsernameFromContext(r.Context())
+	if err := a.userService.VerifyEmail(r.Context(), userId, actor); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userAdminErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil, nil)
+}
+
+func (a *UserAdminRoutes) exportUserData(w http.ResponseWriter, r *http.Request) {
+	userId, err := uintURLParam(r, "userId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	export, err := a.userDataService.ExportUser(r.Context(), userId)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userAdminErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, export, exportHeaders(userId))
+}
+
+func (a *UserAdminRoutes) eraseUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := uintURLParam(r, "userId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	var statusChange dtos.UserStatusChangeDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &statusChange); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	if len(strings.TrimSpace(statusChange.Reason)) == 0 {
+		a.jsonHelpers.ErrorJSON(w, errors.New("a reason must be supplied"), http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	actor := services.UsernameFromContext(r.Context())
+	if err := a.userDataService.EraseUser(r.Context(), userId, statusChange.Reason, actor); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userAdminErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil, nil)
+}
+
+func (a *UserAdminRoutes) getUserClaims(w http.ResponseWriter, r *http.Request) {
+	userId, err := uintURLParam(r, "userId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	claims, err := a.userClaimService.GetUserClaims(r.Context(), userId)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userAdminErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, claims)
+}
+
+func (a *UserAdminRoutes) grantClaim(w http.ResponseWriter, r *http.Request) {
+	userId, err := uintURLParam(r, "userId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	var userClaim dtos.UserClaimDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &userClaim); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	if err := a.userClaimService.GrantClaim(r.Context(), userId, userClaim.Claim); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userAdminErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusCreated, nil, nil)
+}
+
+func (a *UserAdminRoutes) revokeClaim(w http.ResponseWriter, r *http.Request) {
+	userId, err := uintURLParam(r, "userId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userAdminErrSrc)
+		return
+	}
+
+	if err := a.userClaimService.RevokeClaim(r.Context(), userId, chi.URLParam(r, "claim")); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userAdminErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil, nil)
+}
+
+func parseUserListQuery(values url.Values) (dtos.UserListQueryDto, error) {
+	query := dtos.UserListQueryDto{
+		Search:     strings.TrimSpace(values.Get("q")),
+		Claim:      values.Get("claim"),
+		Status:     values.Get("status"),
+		AuthSource: values.Get("auth_source"),
+		SortBy:     values.Get("sort"),
+		Cursor:     values.Get("cursor"),
+	}
+
+	switch strings.ToLower(values.Get("order")) {
+	case "", "asc":
+	case "desc":
+		query.SortDesc = true
+	default:
+		return query, errors.New("order must be asc or desc")
+	}
+
+	if v := values.Get("limit"); len(v) > 0 {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return query, errors.New("limit must be a number")
+		}
+		query.Limit = limit
+	}
+
+	var err error
+	if query.CreatedAfter, err = parseTimeParam(values, "created_after"); err != nil {
+		return query, err
+	}
+
+	if query.CreatedBefore, err = parseTimeParam(values, "created_before"); err != nil {
+		return query, err
+	}
+
+	if query.EmailVerified, err = parseBoolParam(values, "verified"); err != nil {
+		return query, err
+	}
+
+	if query.Locked, err = parseBoolParam(values, "locked"); err != nil {
+		return query, err
+	}
+
+	deleted, err := parseBoolParam(values, "deleted")
+	if err != nil {
+		return query, err
+	}
+	query.Deleted = deleted != nil && *deleted
+
+	return query, nil
+}
+
+func parseTimeParam(values url.Values, param string) (*time.Time, error) {
+	v := values.Get(param)
+	if len(v) == 0 {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC3339 timestamp", param)
+	}
+
+	return &t, nil
+}
+
+func parseBoolParam(values url.Values, param string) (*bool, error) {
+	v := values.Get(param)
+	if len(v) == 0 {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", param)
+	}
+
+	return &b, nil
+}
@@ -0,0 +1,124 @@
+package routes
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/helpers"
+	"authservice/src/services"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	userImportErrSrc = "UserImportRoutes"
+
+	// large enough for tens of thousands of users in a single upload
+	maxUserImportBytes = 100 << 20
+)
+
+var userFileContentTypes = map[string]string{
+	services.UserFileFormatCSV:   "text/csv",
+	services.UserFileFormatJSONL: "application/x-ndjson",
+}
+
+type UserImportRoutes struct {
+	baseEndpoint      string
+	mux               *chi.Mux
+	contentTypes      *helpers.ContentTypes
+	userService       *services.UserService
+	userImportService *services.UserImportService
+	jsonHelpers       *helpers.JsonHelpers
+	logger            *zap.SugaredLogger
+}
+
+func InitUserImportRoutes(serviceCfg *config.ServiceConfig) *UserImportRoutes {
+	return &UserImportRoutes{
+		baseEndpoint:      "/users",
+		mux:               serviceCfg.Mux,
+		contentTypes:      serviceCfg.ContentTypes,
+		userService:       services.InitUserService(serviceCfg),
+		userImportService: services.InitUserImportService(serviceCfg),
+		jsonHelpers:       helpers.InitJsonHelpers(serviceCfg.Logger),
+		logger:            serviceCfg.Logger,
+	}
+}
+
+func (a *UserImportRoutes) Register() {
+	a.contentTypes.Allow(http.MethodPost, fmt.Sprintf("%s/import", a.baseEndpoint), userFileContentTypes[services.UserFileFormatCSV])
+
+	a.mux.Group(func(r chi.Router) {
+		r.Use(a.userService.CustomJWTAuthVerifier)
+
+		r.With(a.userService.RequirePermission(domain.PermissionUsersWrite)).
+			Post(fmt.Sprintf("%s/import", a.baseEndpoint), a.importUsers)
+		r.With(a.userService.RequirePermission(domain.PermissionUsersRead)).
+			Get(fmt.Sprintf("%s/export", a.baseEndpoint), a.exportUsers)
+	})
+}
+
+// importUsers reads the file from the request body. The format comes from the
+// format parameter or, failing that, the Content-Type of the body.
+func (a *UserImportRoutes) importUsers(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	format := values.Get("format")
+	if len(format) == 0 {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		for f, contentType := range userFileContentTypes {
+			if contentType == mediaType {
+				format = f
+			}
+		}
+	}
+
+	format, err := services.ParseUserFileFormat(format)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userImportErrSrc)
+		return
+	}
+
+	dryRun, err := parseBoolParam(values, "dry_run")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userImportErrSrc)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxUserImportBytes)
+	result, err := a.userImportService.ImportUsers(r.Context(), body, format, dryRun != nil && *dryRun,
+		services.UsernameFromContext(r.Context()))
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userImportErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, result)
+}
+
+// exportUsers streams the file, so a failure part way through can only be
+// logged; the truncated response is not a complete file.
+func (a *UserImportRoutes) exportUsers(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if len(format) == 0 {
+		format = services.UserFileFormatJSONL
+	}
+
+	format, err := services.ParseUserFileFormat(format)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userImportErrSrc)
+		return
+	}
+
+	fileName := fmt.Sprintf("users-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	w.Header().Set("Content-Type", userFileContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := a.userImportService.ExportUsers(r.Context(), w, format, services.UsernameFromContext(r.Context())); err != nil {
+		a.logger.Errorf("error exporting users with error %v", err)
+	}
+}
@@ -19,20 +19,28 @@ const (
 )
 
 type UserRoutes struct {
-	baseEndpoint string
-	mux          *chi.Mux
-	userService  *services.UserService
-	jsonHelpers  *helpers.JsonHelpers
-	logger       *zap.SugaredLogger
+	baseEndpoint    string
+	mux             *chi.Mux
+	userService     *services.UserService
+	userDataService *services.UserDataService
+	sessionService  *services.SessionService
+	identityService *services.UserIdentityService
+	apiKeyService   *services.ApiKeyService
+	jsonHelpers     *helpers.JsonHelpers
+	logger          *zap.SugaredLogger
 }
 
 func InitUserRoutes(serviceCfg *config.ServiceConfig) *UserRoutes {
 	return &UserRoutes{
-		baseEndpoint: "/user",
-		mux:          serviceCfg.Mux,
-		userService:  services.InitUserService(serviceCfg),
-		jsonHelpers:  helpers.InitJsonHelpers(serviceCfg.Logger),
-		logger:       serviceCfg.Logger,
+		baseEndpoint:    "/user",
+		mux:             serviceCfg.Mux,
+		userService:     services.InitUserService(serviceCfg),
+		userDataService: services.InitUserDataService(serviceCfg),
+		sessionService:  services.InitSessionService(serviceCfg),
+		identityService: services.InitUserIdentityService(serviceCfg),
+		apiKeyService:   services.InitApiKeyService(serviceCfg),
+		jsonHelpers:     helpers.InitJsonHelpers(serviceCfg.Logger),
+		logger:          serviceCfg.Logger,
 	}
 }
 
@@ -44,25 +52,53 @@ func (a *UserRoutes) Register() {
 	a.mux.Group(func(r chi.Router) {
 		r.Use(a.userService.CustomJWTAuthVerifier)
 
-		r.Post(fmt.Sprintf("%s/add-admin-user", a.baseEndpoint), a.addAdminUser)
-		r.Put(fmt.Sprintf("%s/update-password", a.baseEndpoint), a.updateUserPassword)
-		r.Put(fmt.Sprintf("%s/update-user", a.baseEndpoint), a.updateUser)
-		r.Delete(a.baseEndpoint, a.deleteUser)
+		r.With(
+			a.userService.RequirePermission(domain.PermissionUsersWrite),
+			a.userService.RequirePermission(domain.PermissionClaimsWrite),
+		).Post(fmt.Sprintf("%s/add-admin-user", a.baseEndpoint), a.addAdminUser)
 
-		r.Get(fmt.Sprintf("%s/get-by-username", a.baseEndpoint), a.getByUsername)
+		r.With(a.userService.RequirePermission(domain.PermissionUsersRead)).
+			Get(fmt.Sprintf("%s/get-by-username", a.baseEndpoint), a.getByUsername)
+
+		r.Get(fmt.Sprintf("%s/export", a.baseEndpoint), a.exportOwnData)
+
+		r.Get(fmt.Sprintf("%s/login-history", a.baseEndpoint), a.getLoginHistory)
+		r.Get(fmt.Sprintf("%s/sessions", a.baseEndpoint), a.getSessions)
+
+		r.Get(fmt.Sprintf("%s/identities", a.baseEndpoint), a.getIdentities)
+
+		// the account and its credentials can only be changed by the user
+		// having signed in, not with an API key
+		r.Group(func(r chi.Router) {
+			r.Use(a.userService.RequireSession)
+
+			r.Put(fmt.Sprintf("%s/update-user", a.baseEndpoint), a.updateUser)
+			r.Put(fmt.Sprintf("%s/update-password", a.baseEndpoint), a.updateUserPassword)
+			r.Delete(a.baseEndpoint, a.deleteUser)
+			r.Delete(fmt.Sprintf("%s/erase", a.baseEndpoint), a.eraseOwnAccount)
+
+			r.Delete(fmt.Sprintf("%s/sessions/{sessionId}", a.baseEndpoint), a.revokeSession)
+			r.Post(fmt.Sprintf("%s/sessions/revoke-others", a.baseEndpoint), a.revokeOtherSessions)
+
+			r.Delete(fmt.Sprintf("%s/identities/{identityId}", a.baseEndpoint), a.unlinkIdentity)
+
+			r.Get(fmt.Sprintf("%s/api-keys", a.baseEndpoint), a.getApiKeys)
+			r.Post(fmt.Sprintf("%s/api-keys", a.baseEndpoint), a.createApiKey)
+			r.Delete(fmt.Sprintf("%s/api-keys/{keyId}", a.baseEndpoint), a.revokeApiKey)
+		})
 	})
 }
 
 func (a *UserRoutes) addUser(w http.ResponseWriter, r *http.Request) {
-	var user domain.User
-	if err := a.jsonHelpers.ReadJSON(w, r, &user); err != nil {
+	var registration dtos.UserRegistrationDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &registration); err != nil {
 		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userErrSrc)
 		return
 	}
 
-	user, err := a.userService.AddUser(user, false)
+	_, err := a.userService.AddUser(r.Context(), newRegisteredUser(registration), false)
 	if err != nil {
-		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, userErrSrc)
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userErrSrc)
 		return
 	}
 
@@ -70,29 +106,38 @@ func (a *UserRoutes) addUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *UserRoutes) addAdminUser(w http.ResponseWriter, r *http.Request) {
-	var user domain.User
-	if err := a.jsonHelpers.ReadJSON(w, r, &user); err != nil {
+	var registration dtos.UserRegistrationDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &registration); err != nil {
 		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userErrSrc)
 		return
 	}
 
-	user, err := a.userService.AddUser(user, true)
+	_, err := a.userService.AddUser(r.Context(), newRegisteredUser(registration), true)
 	if err != nil {
-		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, userErrSrc)
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userErrSrc)
 		return
 	}
 
 	a.jsonHelpers.WriteJSON(w, http.StatusCreated, nil, nil)
 }
 
+// updateUser changes the signed in user's own details, whatever UserId the
+// body names.
 func (a *UserRoutes) updateUser(w http.ResponseWriter, r *http.Request) {
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, userErrSrc)
+		return
+	}
+
 	var user dtos.UserDto
 	if err := a.jsonHelpers.ReadJSON(w, r, &user); err != nil {
 		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userErrSrc)
 		return
 	}
+	user.UserId = userId
 
-	if err := a.userService.UpdateUserDetails(user); err != nil {
+	if err := a.userService.UpdateUserDetails(r.Context(), user); err != nil {
 		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, userErrSrc)
 		return
 	}
@@ -101,14 +146,21 @@ func (a *UserRoutes) updateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *UserRoutes) updateUserPassword(w http.ResponseWriter, r *http.Request) {
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, userErrSrc)
+		return
+	}
+
 	var updatePasswordDto dtos.UserUpdatePasswordDto
 	if err := a.jsonHelpers.ReadJSON(w, r, &updatePasswordDto); err != nil {
 		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userErrSrc)
 		return
 	}
+	updatePasswordDto.UserId = userId
 
-	if err := a.userService.UpdateUserPassword(updatePasswordDto); err != nil {
-		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, userErrSrc)
+	if err := a.userService.UpdateUserPassword(r.Context(), updatePasswordDto); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userErrSrc)
 		return
 	}
 
@@ -116,13 +168,13 @@ func (a *UserRoutes) updateUserPassword(w http.ResponseWriter, r *http.Request)
 }
 
 func (a *UserRoutes) deleteUser(w http.ResponseWriter, r *http.Request) {
-	var user domain.User
-	if err := a.jsonHelpers.ReadJSON(w, r, &user); err != nil {
-		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userErrSrc)
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, userErrSrc)
 		return
 	}
 
-	if err := a.userService.DeleteUser(user); err != nil {
+	if err := a.userService.DeleteUser(r.Context(), userId); err != nil {
 		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, userErrSrc)
 		return
 	}
@@ -137,7 +189,7 @@ func (a *UserRoutes) getByUsername(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := a.userService.GetByUsername(username)
+	user, err := a.userService.GetByUsername(r.Context(), username)
 	if err != nil {
 		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, userErrSrc)
 		return
@@ -153,13 +205,23 @@ func (a *UserRoutes) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := a.userService.GetByUsernameAndPassword(loginDto.Username, loginDto.Password)
+	user, err := a.userService.GetByUsernameAndPassword(r.Context(), loginDto.Username, loginDto.Password)
 	if err != nil {
+		if errors.Is(err, helpers.ErrHashQueueTimeout) || errors.Is(err, services.ErrDirectoryUnavailable) {
+			a.jsonHelpers.ErrorJSON(w, err, http.StatusServiceUnavailable, userErrSrc)
+			return
+		}
+
+		if code := errorCode(err); len(code) > 0 {
+			a.jsonHelpers.ErrorCodeJSON(w, err, errorStatus(err, http.StatusForbidden), code, userErrSrc)
+			return
+		}
+
 		a.jsonHelpers.ErrorJSON(w, errors.New("invalid login attempt"), http.StatusUnauthorized, userErrSrc)
 		return
 	}
 
-	token, err := a.userService.GenerateUserToken(user)
+	token, err := a.userService.GenerateUserToken(r.Context(), user, domain.AuthMethodPassword)
 	if err != nil {
 		a.jsonHelpers.ErrorJSON(w, errors.New("invalid login attempt"), http.StatusUnauthorized, userErrSrc)
 		return
@@ -167,3 +229,210 @@ func (a *UserRoutes) login(w http.ResponseWriter, r *http.Request) {
 
 	a.jsonHelpers.WriteJSON(w, http.StatusOK, token, nil)
 }
+
+func (a *UserRoutes) exportOwnData(w http.ResponseWriter, r *http.Request) {
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, userErrSrc)
+		return
+	}
+
+	export, err := a.userDataService.ExportUser(r.Context(), userId)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, export, exportHeaders(userId))
+}
+
+func (a *UserRoutes) eraseOwnAccount(w http.ResponseWriter, r *http.Request) {
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, userErrSrc)
+		return
+	}
+
+	var eraseDto dtos.UserEraseDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &eraseDto); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userErrSrc)
+		return
+	}
+
+	if err := a.userDataService.EraseOwnAccount(r.Context(), userId, eraseDto.Password); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil, nil)
+}
+
+func (a *UserRoutes) getSessions(w http.ResponseWriter, r *http.Request) {
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, userErrSrc)
+		return
+	}
+
+	sessions, err := a.sessionService.GetActiveSessions(userId, services.SessionIdFromContext(r.Context()))
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, userErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, sessions, nil)
+}
+
+func (a *UserRoutes) getLoginHistory(w http.ResponseWriter, r *http.Request) {
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, userErrSrc)
+		return
+	}
+
+	history, err := a.sessionService.GetLoginHistory(userId, services.SessionIdFromContext(r.Context()))
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, userErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, history, nil)
+}
+
+func (a *UserRoutes) revokeSession(w http.ResponseWriter, r *http.Request) {
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, userErrSrc)
+		return
+	}
+
+	if err := a.sessionService.RevokeSession(r.Context(), userId, chi.URLParam(r, "sessionId")); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil, nil)
+}
+
+// revokeOtherSessions signs the user out everywhere except the session the
+// request was made with.
+func (a *UserRoutes) revokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, userErrSrc)
+		return
+	}
+
+	if _, err := a.sessionService.RevokeOtherSessions(r.Context(), userId, services.SessionIdFromContext(r.Context())); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, userErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil, nil)
+}
+
+func (a *UserRoutes) getIdentities(w http.ResponseWriter, r *http.Request) {
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, userErrSrc)
+		return
+	}
+
+	identities, err := a.identityService.GetIdentities(userId)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, userErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, identities, nil)
+}
+
+func (a *UserRoutes) unlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, userErrSrc)
+		return
+	}
+
+	identityId, err := uintURLParam(r, "identityId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userErrSrc)
+		return
+	}
+
+	if err := a.identityService.Unlink(r.Context(), userId, identityId); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil, nil)
+}
+
+func (a *UserRoutes) getApiKeys(w http.ResponseWriter, r *http.Request) {
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, userErrSrc)
+		return
+	}
+
+	keys, err := a.apiKeyService.GetKeys(userId)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, userErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, keys, nil)
+}
+
+func (a *UserRoutes) createApiKey(w http.ResponseWriter, r *http.Request) {
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, userErrSrc)
+		return
+	}
+
+	var create dtos.ApiKeyCreateDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &create); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userErrSrc)
+		return
+	}
+
+	key, err := a.apiKeyService.CreateKey(r.Context(), userId, create)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusCreated, key, nil)
+}
+
+func (a *UserRoutes) revokeApiKey(w http.ResponseWriter, r *http.Request) {
+	userId, ok := services.UserIdFromContext(r.Context())
+	if !ok {
+		a.jsonHelpers.ErrorJSON(w, errors.New("user not found"), http.StatusUnauthorized, userErrSrc)
+		return
+	}
+
+	keyId, err := uintURLParam(r, "keyId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, userErrSrc)
+		return
+	}
+
+	if err := a.apiKeyService.RevokeKey(r.Context(), userId, keyId); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), userErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil, nil)
+}
+
+func newRegisteredUser(registration dtos.UserRegistrationDto) domain.User {
+	return domain.User{
+		Username:     registration.Username,
+		EmailAddress: registration.EmailAddress,
+		Password:     registration.Password,
+		FirstName:    registration.FirstName,
+		Surname:      registration.Surname,
+	}
+}
@@ -0,0 +1,134 @@
+package routes
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/services"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	webhookErrSrc = "WebhookRoutes"
+)
+
+type WebhookRoutes struct {
+	baseEndpoint   string
+	mux            *chi.Mux
+	webhookService *services.WebhookService
+	userService    *services.UserService
+	jsonHelpers    *helpers.JsonHelpers
+	logger         *zap.SugaredLogger
+}
+
+func InitWebhookRoutes(serviceCfg *config.ServiceConfig) *WebhookRoutes {
+	return &WebhookRoutes{
+		baseEndpoint:   "/webhooks",
+		mux:            serviceCfg.Mux,
+		webhookService: services.InitWebhookService(serviceCfg),
+		userService:    services.InitUserService(serviceCfg),
+		jsonHelpers:    helpers.InitJsonHelpers(serviceCfg.Logger),
+		logger:         serviceCfg.Logger,
+	}
+}
+
+func (a *WebhookRoutes) Register() {
+	a.mux.Group(func(r chi.Router) {
+		r.Use(a.userService.CustomJWTAuthVerifier)
+		// subscriptions are sent the events of every organization's users
+		r.Use(a.userService.RequirePlatform)
+
+		read := a.userService.RequirePermission(domain.PermissionWebhooksRead)
+		write := a.userService.RequirePermission(domain.PermissionWebhooksWrite)
+
+		r.With(read).Get(a.baseEndpoint, a.getSubscriptions)
+		r.With(write).Post(a.baseEndpoint, a.createSubscription)
+		r.With(write).Delete(fmt.Sprintf("%s/{webhookId}", a.baseEndpoint), a.deleteSubscription)
+		r.With(read).Get(fmt.Sprintf("%s/{webhookId}/deliveries", a.baseEndpoint), a.getDeliveries)
+	})
+}
+
+func (a *WebhookRoutes) getSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := a.webhookService.GetSubscriptions()
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusInternalServerError, webhookErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, subscriptions)
+}
+
+func (a *WebhookRoutes) createSubscription(w http.ResponseWriter, r *http.Request) {
+	var create dtos.WebhookSubscriptionCreateDto
+	if err := a.jsonHelpers.ReadJSON(w, r, &create); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, webhookErrSrc)
+		return
+	}
+
+	subscription, err := a.webhookService.CreateSubscription(r.Context(), create)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), webhookErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusCreated, subscription)
+}
+
+func (a *WebhookRoutes) deleteSubscription(w http.ResponseWriter, r *http.Request) {
+	webhookId, err := uintURLParam(r, "webhookId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, webhookErrSrc)
+		return
+	}
+
+	if err := a.webhookService.DeleteSubscription(r.Context(), webhookId); err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), webhookErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusAccepted, nil)
+}
+
+func (a *WebhookRoutes) getDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhookId, err := uintURLParam(r, "webhookId")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, webhookErrSrc)
+		return
+	}
+
+	values := r.URL.Query()
+
+	cursor, err := parseUintParam(values, "cursor")
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, http.StatusBadRequest, webhookErrSrc)
+		return
+	}
+
+	var beforeId uint
+	if cursor != nil {
+		beforeId = *cursor
+	}
+
+	limit := 0
+	if v := values.Get("limit"); len(v) > 0 {
+		if limit, err = strconv.Atoi(v); err != nil {
+			a.jsonHelpers.ErrorJSON(w, errors.New("limit must be a number"), http.StatusBadRequest, webhookErrSrc)
+			return
+		}
+	}
+
+	deliveries, err := a.webhookService.GetDeliveries(webhookId, values.Get("status"), beforeId, limit)
+	if err != nil {
+		a.jsonHelpers.ErrorJSON(w, err, errorStatus(err, http.StatusInternalServerError), webhookErrSrc)
+		return
+	}
+
+	a.jsonHelpers.WriteJSON(w, http.StatusOK, deliveries)
+}
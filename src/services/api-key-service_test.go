@@ -0,0 +1,30 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHeldScopes(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		claims []string
+		want   []string
+	}{
+		{name: "all held", scopes: []string{"User", "Auditor"}, claims: []string{"Auditor", "User"}, want: []string{"User", "Auditor"}},
+		{name: "claim revoked since the key was created", scopes: []string{"User", "Administrator"}, claims: []string{"User"}, want: []string{"User"}},
+		{name: "claims outside the scopes not added", scopes: []string{"User"}, claims: []string{"User", "Administrator"}, want: []string{"User"}},
+		{name: "nothing held", scopes: []string{"Administrator"}, claims: []string{"User"}, want: []string{}},
+		{name: "no claims", scopes: []string{"User"}, want: []string{}},
+		{name: "names are case sensitive", scopes: []string{"administrator"}, claims: []string{"Administrator"}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := heldScopes(tt.scopes, tt.claims); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("heldScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
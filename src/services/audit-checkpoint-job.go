@@ -0,0 +1,58 @@
+package services
+
+import (
+	"authservice/src/config"
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type AuditCheckpointJob struct {
+	auditService *AuditService
+	interval     time.Duration
+	enabled      bool
+	logger       *zap.SugaredLogger
+}
+
+func InitAuditCheckpointJob(serviceCfg *config.ServiceConfig) *AuditCheckpointJob {
+	return &AuditCheckpointJob{
+		auditService: InitAuditService(serviceCfg),
+		interval:     serviceCfg.AuditCheckpointInterval,
+		enabled:      serviceCfg.AuditSigningKey != nil,
+		logger:       serviceCfg.Logger,
+	}
+}
+
+func (j *AuditCheckpointJob) Start(ctx context.Context) {
+	if !j.enabled || j.interval <= 0 {
+		j.logger.Warn("audit checkpoints disabled as no signing key or interval is configured")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				j.RunOnce()
+			}
+		}
+	}()
+}
+
+func (j *AuditCheckpointJob) RunOnce() {
+	checkpoint, err := j.auditService.CreateCheckpoint()
+	if err != nil {
+		j.logger.Errorf("error creating audit checkpoint with error %v", err)
+		return
+	}
+
+	if checkpoint.ID > 0 {
+		j.logger.Infof("audit checkpoint %d covers events up to %d", checkpoint.ID, checkpoint.LastEventId)
+	}
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/repositories"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAuditEventLimit = 100
+	maxAuditEventLimit     = 500
+	auditVerifyBatchSize   = 1000
+)
+
+var ErrNoAuditSigningKey = errors.New("no audit checkpoint signing key has been configured")
+
+type AuditService struct {
+	auditEventRepo *repositories.AuditEventRepository
+	signingKey     ed25519.PrivateKey
+	verifyKeys     []ed25519.PublicKey
+	pseudonymKey   []byte
+	logger         *zap.SugaredLogger
+}
+
+func InitAuditService(serviceCfg *config.ServiceConfig) *AuditService {
+	return &AuditService{
+		auditEventRepo: repositories.InitAuditEventRepository(serviceCfg),
+		signingKey:     serviceCfg.AuditSigningKey,
+		verifyKeys:     serviceCfg.AuditVerifyKeys,
+		pseudonymKey:   pseudonymKey(serviceCfg.ClientSecret),
+		logger:         serviceCfg.Logger,
+	}
+}
+
+// Record stores the event along with the request metadata and, unless the
+// caller set one, the authenticated user as the actor. The IP address is cut
+// down to its network, as the rows outlive the erasure of their users. Failures
+// are logged rather than returned so auditing never blocks the action being
+// audited.
+func (s *AuditService) Record(ctx context.Context, event domain.AuditEvent, details map[string]interface{}) {
+	metadata := helpers.RequestMetadataFromContext(ctx)
+	event.IPAddress = truncateIPAddress(metadata.IPAddress)
+	event.UserAgent = metadata.UserAgent
+	event.RequestId = metadata.RequestId
+
+	if event.ActorUserId == nil {
+		if actorId, ok := UserIdFromContext(ctx); ok {
+			event.ActorUserId = &actorId
+		}
+	}
+
+	if len(event.Outcome) == 0 {
+		event.Outcome = domain.AuditOutcomeSuccess
+	}
+
+	if len(details) > 0 {
+		out, err := json.Marshal(details)
+		if err != nil {
+			s.logger.Warnf("unable to encode details for audit event %s with error %v", event.EventType, err)
+		} else {
+			event.Details = string(out)
+		}
+	}
+
+	if _, err := s.auditEventRepo.Add(event); err != nil {
+		s.logger.Errorf("audit event %s was not recorded: %+v", event.EventType, event)
+	}
+}
+
+// Pseudonym stands in for personal data, such as the username given to a
+// failed login, in an event's details. It is keyed, so it cannot be reversed
+// by hashing guesses without the service's secret, but the same value always
+// gives the same pseudonym.
+func (s *AuditService) Pseudonym(value string) string {
+	mac := hmac.New(sha256.New, s.pseudonymKey)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *AuditService) Query(ctx context.Context, query dtos.AuditEventQueryDto) (dtos.AuditEventListResponseDto, error) {
+	if query.Limit <= 0 {
+		query.Limit = defaultAuditEventLimit
+	}
+
+	if query.Limit > maxAuditEventLimit {
+		query.Limit = maxAuditEventLimit
+	}
+
+	limit := query.Limit
+	query.Limit = limit + 1
+
+	events, err := s.auditEventRepo.List(tenantScope(ctx), query)
+	if err != nil {
+		return dtos.AuditEventListResponseDto{}, err
+	}
+
+	resp := dtos.AuditEventListResponseDto{
+		Events: events,
+	}
+
+	if len(events) > limit {
+		resp.Events = events[:limit]
+		resp.NextCursor = strconv.FormatUint(uint64(resp.Events[limit-1].ID), 10)
+	}
+
+	return resp, nil
+}
+
+func (s *AuditService) GetByUserId(userId uint) ([]domain.AuditEvent, error) {
+	return s.auditEventRepo.GetByUserId(userId)
+}
+
+// CreateCheckpoint signs the current head of the chain. Nothing is written
+// when no events have been recorded since the previous checkpoint.
+func (s *AuditService) CreateCheckpoint() (domain.AuditCheckpoint, error) {
+	if s.signingKey == nil {
+		return domain.AuditCheckpoint{}, ErrNoAuditSigningKey
+	}
+
+	head, err := s.auditEventRepo.GetLatest()
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.AuditCheckpoint{}, nil
+		}
+		return domain.AuditCheckpoint{}, err
+	}
+
+	previous, err := s.auditEventRepo.GetLatestCheckpoint()
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.AuditCheckpoint{}, err
+	}
+
+	if previous.LastEventId == head.ID {
+		return previous, nil
+	}
+
+	checkpoint := domain.AuditCheckpoint{
+		CreatedAt:     time.Now().UTC().Truncate(time.Microsecond),
+		LastEventId:   head.ID,
+		LastEventHash: head.Hash,
+		KeyId:         auditKeyId(s.signingKey.Public().(ed25519.PublicKey)),
+	}
+	checkpoint.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.signingKey, checkpoint.SigningPayload()))
+
+	return s.auditEventRepo.AddCheckpoint(checkpoint)
+}
+
+// VerifyChain walks every event in order, recomputing hashes and links, then
+// checks each checkpoint's signature and that it matches the chain. It stops
+// at the first problem found.
+func (s *AuditService) VerifyChain() (dtos.AuditVerificationDto, error) {
+	result := dtos.AuditVerificationDto{}
+
+	checkpoints, err := s.auditEventRepo.GetCheckpoints()
+	if err != nil {
+		return result, err
+	}
+
+	checkpointsByEvent := map[uint][]domain.AuditCheckpoint{}
+	for _, checkpoint := range checkpoints {
+		if !s.isCheckpointSignatureValid(checkpoint) {
+			result.BrokenCheckpointId = checkpoint.ID
+			result.Problem = fmt.Sprintf("checkpoint %d has an invalid signature or unknown key %s", checkpoint.ID, checkpoint.KeyId)
+			return result, nil
+		}
+		checkpointsByEvent[checkpoint.LastEventId] = append(checkpointsByEvent[checkpoint.LastEventId], checkpoint)
+	}
+
+	prevHash := ""
+	var lastId uint
+
+	for {
+		events, err := s.auditEventRepo.GetBatchAfter(lastId, auditVerifyBatchSize)
+		if err != nil {
+			return result, err
+		}
+
+		if len(events) == 0 {
+			break
+		}
+
+		for _, event := range events {
+			if event.PrevHash != prevHash {
+				result.BrokenEventId = event.ID
+				result.Problem = fmt.Sprintf("event %d does not link to the event before it, an event may have been removed", event.ID)
+				return result, nil
+			}
+
+			if event.ComputeHash() != event.Hash {
+				result.BrokenEventId = event.ID
+				result.Problem = fmt.Sprintf("event %d does not match its hash, it has been altered", event.ID)
+				return result, nil
+			}
+
+			for _, checkpoint := range checkpointsByEvent[event.ID] {
+				if checkpoint.LastEventHash != event.Hash {
+					result.BrokenCheckpointId = checkpoint.ID
+					result.Problem = fmt.Sprintf("checkpoint %d does not match event %d, the chain has been rewritten", checkpoint.ID, event.ID)
+					return result, nil
+				}
+				result.CheckpointsChecked++
+			}
+			delete(checkpointsByEvent, event.ID)
+
+			prevHash = event.Hash
+			lastId = event.ID
+			result.EventsChecked++
+		}
+	}
+
+	for eventId, missed := range checkpointsByEvent {
+		result.BrokenCheckpointId = missed[0].ID
+		result.Problem = fmt.Sprintf("checkpoint %d refers to event %d which no longer exists", missed[0].ID, eventId)
+		return result, nil
+	}
+
+	result.Valid = true
+	return result, nil
+}
+
+func (s *AuditService) isCheckpointSignatureValid(checkpoint domain.AuditCheckpoint) bool {
+	signature, err := base64.StdEncoding.DecodeString(checkpoint.Signature)
+	if err != nil {
+		return false
+	}
+
+	for _, key := range s.verifyKeys {
+		if auditKeyId(key) == checkpoint.KeyId {
+			return ed25519.Verify(key, checkpoint.SigningPayload(), signature)
+		}
+	}
+
+	return false
+}
+
+func auditKeyId(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+func userTarget(userId uint) *uint {
+	return &userId
+}
+
+func claimTarget(claim domain.Claim) string {
+	return fmt.Sprintf("claim:%s", claim.Claim)
+}
+
+// pseudonymKey derives the audit pseudonym key from the client secret, so it
+// differs from the keys the secret signs tokens and links with.
+func pseudonymKey(clientSecret string) []byte {
+	mac := hmac.New(sha256.New, []byte(clientSecret))
+	mac.Write([]byte("audit pseudonyms"))
+	return mac.Sum(nil)
+}
+
+// truncateIPAddress keeps the /24 of an IPv4 address and the /48 of an IPv6
+// one. Anything that is not an IP address, such as the operator commands'
+// "local", is kept as it is.
+func truncateIPAddress(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return address
+	}
+
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return ipv4.Mask(net.CIDRMask(24, 32)).String()
+	}
+
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/helpers"
+	"authservice/src/repositories"
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Authenticator checks a username and password against one source of users
+// and returns the local user they sign in as. It returns errUserNotHandled
+// for usernames it does not own, so the next authenticator can try, and
+// ErrPasswordMismatch, along with the user when known, for a wrong password.
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, username, password string) (domain.User, error)
+}
+
+var errUserNotHandled = errors.New("the user is not handled by this authenticator")
+
+// initAuthenticators builds the chain in the configured order, falling back
+// to local users only.
+func initAuthenticators(serviceCfg *config.ServiceConfig) []Authenticator {
+	authenticators := []Authenticator{}
+
+	for _, name := range serviceCfg.Authenticators {
+		switch name {
+		case config.AuthenticatorLocal:
+			authenticators = append(authenticators, initLocalAuthenticator(serviceCfg))
+		case config.AuthenticatorLdap:
+			authenticators = append(authenticators, InitLdapAuthenticator(serviceCfg))
+		}
+	}
+
+	if len(authenticators) == 0 {
+		authenticators = append(authenticators, initLocalAuthenticator(serviceCfg))
+	}
+
+	return authenticators
+}
+
+// localAuthenticator checks passwords against the hashes in the users table.
+type localAuthenticator struct {
+	userRepo     *repositories.UserRepository
+	cryptoHelper *helpers.CryptoHelper
+	logger       *zap.SugaredLogger
+}
+
+func initLocalAuthenticator(serviceCfg *config.ServiceConfig) *localAuthenticator {
+	return &localAuthenticator{
+		userRepo:     repositories.InitUserRepositoy(serviceCfg),
+		cryptoHelper: helpers.InitCryptoHelper(serviceCfg.HashExecutor, serviceCfg.Peppers),
+		logger:       serviceCfg.Logger,
+	}
+}
+
+func (a *localAuthenticator) Name() string {
+	return config.AuthenticatorLocal
+}
+
+func (a *localAuthenticator) Authenticate(ctx context.Context, username, password string) (domain.User, error) {
+	user, err := a.userRepo.GetByUsername(username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.User{}, errUserNotHandled
+		}
+		return domain.User{}, err
+	}
+
+	if !isLocalUser(user) {
+		return domain.User{}, errUserNotHandled
+	}
+
+	matched, err := a.cryptoHelper.IsPasswordMatched(user.Password, user.PepperId, password)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	if !matched {
+		return user, ErrPasswordMismatch
+	}
+
+	if a.cryptoHelper.NeedsRehash(user.PepperId) {
+		a.rehashPassword(user, password)
+	}
+
+	return user, nil
+}
+
+// rehashPassword moves a hash onto the current pepper once the plain text
+// password is known. Failures are logged and retried on the next login.
+func (a *localAuthenticator) rehashPassword(user domain.User, password string) {
+	pwd, pepperId, err := a.cryptoHelper.HashPassword(password)
+	if err != nil {
+		a.logger.Warnf("unable to rehash password for user %s with error %v", user.Username, err)
+		return
+	}
+
+	if err := a.userRepo.UpdateUserPassword(user.ID, pwd, pepperId); err != nil {
+		a.logger.Warnf("unable to store rehashed password for user %s with error %v", user.Username, err)
+	}
+}
+
+// isLocalUser reports whether the user's password is held here rather than
+// in a directory. Users created before directories were supported have no
+// source recorded.
+func isLocalUser(user domain.User) bool {
+	return user.AuthSource == domain.AuthSourceLocal || len(user.AuthSource) == 0
+}
+
+// userProvisioner creates the local users of directories and identity
+// providers on their first login. They have no password, and their email
+// address is taken as verified as the directory or provider vouches for it.
+type userProvisioner struct {
+	userRepo      *repositories.UserRepository
+	claimRepo     *repositories.ClaimRepository
+	userClaimRepo *repositories.UserClaimRepository
+	emailService  *EmailService
+	auditService  *AuditService
+	logger        *zap.SugaredLogger
+}
+
+func initUserProvisioner(serviceCfg *config.ServiceConfig) *userProvisioner {
+	return &userProvisioner{
+		userRepo:      repositories.InitUserRepositoy(serviceCfg),
+		claimRepo:     repositories.InitClaimRepository(serviceCfg),
+		userClaimRepo: repositories.InitUserClaimRepository(serviceCfg),
+		emailService:  InitEmailService(),
+		auditService:  InitAuditService(serviceCfg),
+		logger:        serviceCfg.Logger,
+	}
+}
+
+func (p *userProvisioner) provision(ctx context.Context, user domain.User, authSource, authenticator string) (domain.User, error) {
+	if err := p.checkAvailable(user); err != nil {
+		return domain.User{}, err
+	}
+
+	user.AuthSource = authSource
+	user.EmailVerified = true
+
+	user, err := p.userRepo.Add(user)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	claim, err := p.claimRepo.GetByName(domain.UserClaimName)
+	if err != nil {
+		p.logger.Errorf("error locating claim %s for user %s with error %v", domain.UserClaimName, user.Username, err)
+		return user, err
+	}
+
+	if err := p.userClaimRepo.Add(domain.UserClaim{UserId: user.ID, ClaimId: claim.ID}); err != nil {
+		p.logger.Errorf("error adding user claim for user %s with error %v", user.Username, err)
+		return user, err
+	}
+
+	p.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserRegistered,
+		TargetUserId: userTarget(user.ID),
+	}, map[string]interface{}{"claim": domain.UserClaimName, "authenticator": authenticator})
+
+	p.logger.Infof("user %s provisioned by the %s authenticator", user.Username, authenticator)
+	return user, nil
+}
+
+// checkAvailable refuses users without a usable email address, as every
+// user needs a unique one, and users whose username or email address another
+// user already has.
+func (p *userProvisioner) checkAvailable(user domain.User) error {
+	if !p.emailService.ValidateEmail(user.EmailAddress) {
+		return fmt.Errorf("user %s has no valid email address", user.Username)
+	}
+
+	conflict, err := p.userRepo.HasActiveConflict(user)
+	if err != nil {
+		return err
+	}
+
+	if conflict {
+		return ErrExternalUserConflict
+	}
+
+	return nil
+}
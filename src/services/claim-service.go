@@ -4,40 +4,71 @@ import (
 	"authservice/src/config"
 	"authservice/src/domain"
 	"authservice/src/repositories"
+	"context"
 
 	"go.uber.org/zap"
 )
 
 type ClaimService struct {
-	claimRepo *repositories.ClaimRepository
-	logger    *zap.SugaredLogger
+	claimRepo    *repositories.ClaimRepository
+	auditService *AuditService
+	logger       *zap.SugaredLogger
 }
 
 func InitClaimService(serviceCfg *config.ServiceConfig) *ClaimService {
 	return &ClaimService{
-		claimRepo: repositories.InitClaimRepository(serviceCfg),
-		logger:    serviceCfg.Logger,
+		claimRepo:    repositories.InitClaimRepository(serviceCfg),
+		auditService: InitAuditService(serviceCfg),
+		logger:       serviceCfg.Logger,
 	}
 }
 
-func (s *ClaimService) Add(claim domain.Claim) (domain.Claim, error) {
+func (s *ClaimService) Add(ctx context.Context, claim domain.Claim) (domain.Claim, error) {
 	if len(claim.Claim) <= 0 {
 		s.logger.Warn("claim name cannot be empty")
 	}
 
-	return s.claimRepo.Add(claim)
+	claim, err := s.claimRepo.Add(claim)
+	if err != nil {
+		return claim, err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType: domain.AuditClaimCreated,
+		Target:    claimTarget(claim),
+	}, nil)
+
+	return claim, nil
 }
 
-func (s *ClaimService) Update(claim domain.Claim) error {
+func (s *ClaimService) Update(ctx context.Context, claim domain.Claim) error {
 	if len(claim.Claim) <= 0 {
 		s.logger.Warn("claim name cannot be empty")
 	}
 
-	return s.claimRepo.Update(claim)
+	if err := s.claimRepo.Update(claim); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType: domain.AuditClaimUpdated,
+		Target:    claimTarget(claim),
+	}, map[string]interface{}{"claim_id": claim.ID})
+
+	return nil
 }
 
-func (s *ClaimService) Delete(claim domain.Claim) error {
-	return s.claimRepo.Delete(claim)
+func (s *ClaimService) Delete(ctx context.Context, claim domain.Claim) error {
+	if err := s.claimRepo.Delete(claim); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType: domain.AuditClaimDeleted,
+		Target:    claimTarget(claim),
+	}, map[string]interface{}{"claim_id": claim.ID})
+
+	return nil
 }
 
 func (s *ClaimService) GetAll() ([]domain.Claim, error) {
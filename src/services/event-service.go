@@ -0,0 +1,71 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/repositories"
+	"encoding/json"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultEventLimit = 100
+	maxEventLimit     = 1000
+)
+
+type EventService struct {
+	outboxRepo *repositories.OutboxRepository
+	logger     *zap.SugaredLogger
+}
+
+func InitEventService(serviceCfg *config.ServiceConfig) *EventService {
+	return &EventService{
+		outboxRepo: repositories.InitOutboxRepository(serviceCfg),
+		logger:     serviceCfg.Logger,
+	}
+}
+
+// GetEvents returns events recorded after the given event id, oldest first.
+// NextCursor is always set, to the last event returned or to afterId when
+// there was nothing new, so consumers can simply poll with it.
+func (s *EventService) GetEvents(afterId uint, eventTypes []string, limit int) (dtos.EventListResponseDto, error) {
+	if limit <= 0 {
+		limit = defaultEventLimit
+	}
+
+	if limit > maxEventLimit {
+		limit = maxEventLimit
+	}
+
+	events, err := s.outboxRepo.GetAfter(afterId, eventTypes, limit)
+	if err != nil {
+		return dtos.EventListResponseDto{}, err
+	}
+
+	resp := dtos.EventListResponseDto{
+		Events:     []dtos.EventDto{},
+		NextCursor: strconv.FormatUint(uint64(afterId), 10),
+	}
+
+	for _, event := range events {
+		resp.Events = append(resp.Events, newEventDto(event))
+	}
+
+	if len(events) > 0 {
+		resp.NextCursor = strconv.FormatUint(uint64(events[len(events)-1].ID), 10)
+	}
+
+	return resp, nil
+}
+
+func newEventDto(event domain.OutboxEvent) dtos.EventDto {
+	return dtos.EventDto{
+		Id:        event.ID,
+		Type:      event.EventType,
+		CreatedAt: event.CreatedAt,
+		Data:      json.RawMessage(event.Payload),
+	}
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"authservice/src/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const federatedProviderTimeout = 10 * time.Second
+
+// federatedIdentity is what a provider tells us about the account that
+// signed in. Attributes holds the provider's raw claims for claim rules.
+type federatedIdentity struct {
+	Subject       string
+	EmailAddress  string
+	EmailVerified bool
+	FirstName     string
+	Surname       string
+	Attributes    map[string]interface{}
+}
+
+// federatedProvider runs the authorization code flow against one identity
+// provider. The code verifier is sent as a PKCE challenge with the redirect
+// and the nonce, for providers that issue ID tokens, is checked in the token.
+type federatedProvider interface {
+	authCodeURL(ctx context.Context, redirectUrl, state, nonce, verifier string) (string, error)
+	exchange(ctx context.Context, redirectUrl, code, nonce, verifier string) (federatedIdentity, error)
+}
+
+func newFederatedProvider(cfg config.FederatedProviderConfig, federationCfg *config.FederationConfig) federatedProvider {
+	client := &http.Client{Timeout: federatedProviderTimeout}
+
+	switch cfg.Type {
+	case config.FederatedProviderGithub:
+		return &githubProvider{cfg: cfg, client: client}
+	case config.FederatedProviderSaml:
+		return &samlProvider{cfg: cfg, federation: federationCfg, client: client}
+	}
+
+	return &oidcProvider{cfg: cfg, client: client}
+}
+
+// oidcProvider discovers the provider's endpoints and keys from its issuer on
+// first use, so an unreachable provider does not stop the service starting.
+type oidcProvider struct {
+	cfg    config.FederatedProviderConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider != nil {
+		return p.provider, nil
+	}
+
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, p.client), p.cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: discovery of %s failed: %v", ErrFederatedLoginFailed, p.cfg.Issuer, err)
+	}
+
+	p.provider = provider
+	return provider, nil
+}
+
+func (p *oidcProvider) oauth2Config(provider *oidc.Provider, redirectUrl string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientId,
+		ClientSecret: string(p.cfg.ClientSecret),
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectUrl,
+		Scopes:       p.cfg.Scopes,
+	}
+}
+
+func (p *oidcProvider) authCodeURL(ctx context.Context, redirectUrl, state, nonce, verifier string) (string, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return p.oauth2Config(provider, redirectUrl).
+		AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+func (p *oidcProvider) exchange(ctx context.Context, redirectUrl, code, nonce, verifier string) (federatedIdentity, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return federatedIdentity{}, err
+	}
+
+	ctx = oidc.ClientContext(ctx, p.client)
+
+	token, err := p.oauth2Config(provider, redirectUrl).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return federatedIdentity{}, fmt.Errorf("%w: code exchange failed: %v", ErrFederatedLoginFailed, err)
+	}
+
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return federatedIdentity{}, fmt.Errorf("%w: no id token was returned", ErrFederatedLoginFailed)
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientId}).Verify(ctx, rawIdToken)
+	if err != nil {
+		return federatedIdentity{}, fmt.Errorf("%w: invalid id token: %v", ErrFederatedLoginFailed, err)
+	}
+
+	if idToken.Nonce != nonce {
+		return federatedIdentity{}, fmt.Errorf("%w: the id token nonce does not match", ErrFederatedLoginFailed)
+	}
+
+	attributes := map[string]interface{}{}
+	if err := idToken.Claims(&attributes); err != nil {
+		return federatedIdentity{}, fmt.Errorf("%w: invalid id token claims: %v", ErrFederatedLoginFailed, err)
+	}
+
+	// some providers leave the email address out of the id token
+	if _, ok := attributes["email"]; !ok && len(provider.UserInfoEndpoint()) > 0 {
+		userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return federatedIdentity{}, fmt.Errorf("%w: userinfo request failed: %v", ErrFederatedLoginFailed, err)
+		}
+
+		// the userinfo response is not signed, so it must describe the user
+		// the id token was issued for
+		if userInfo.Subject != idToken.Subject {
+			return federatedIdentity{}, fmt.Errorf("%w: the userinfo subject does not match the id token", ErrFederatedLoginFailed)
+		}
+
+		extra := map[string]interface{}{}
+		if err := userInfo.Claims(&extra); err == nil {
+			for name, value := range extra {
+				if _, ok := attributes[name]; !ok {
+					attributes[name] = value
+				}
+			}
+		}
+	}
+
+	identity := federatedIdentity{
+		Subject:       idToken.Subject,
+		EmailAddress:  stringAttribute(attributes, "email"),
+		EmailVerified: boolAttribute(attributes, "email_verified"),
+		FirstName:     stringAttribute(attributes, "given_name"),
+		Surname:       stringAttribute(attributes, "family_name"),
+		Attributes:    attributes,
+	}
+
+	if len(identity.FirstName) == 0 && len(identity.Surname) == 0 {
+		identity.FirstName, identity.Surname = splitName(stringAttribute(attributes, "name"))
+	}
+
+	return identity, nil
+}
+
+// githubProvider signs in with GitHub, or GitHub Enterprise through BaseUrl
+// and ApiUrl, which use plain OAuth 2.0 rather than OpenID Connect.
+type githubProvider struct {
+	cfg    config.FederatedProviderConfig
+	client *http.Client
+}
+
+func (p *githubProvider) oauth2Config(redirectUrl string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientId,
+		ClientSecret: string(p.cfg.ClientSecret),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  p.cfg.BaseUrl + "/login/oauth/authorize",
+			TokenURL: p.cfg.BaseUrl + "/login/oauth/access_token",
+		},
+		RedirectURL: redirectUrl,
+		Scopes:      p.cfg.Scopes,
+	}
+}
+
+func (p *githubProvider) authCodeURL(ctx context.Context, redirectUrl, state, nonce, verifier string) (string, error) {
+	return p.oauth2Config(redirectUrl).AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), nil
+}
+
+func (p *githubProvider) exchange(ctx context.Context, redirectUrl, code, nonce, verifier string) (federatedIdentity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+
+	token, err := p.oauth2Config(redirectUrl).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return federatedIdentity{}, fmt.Errorf("%w: code exchange failed: %v", ErrFederatedLoginFailed, err)
+	}
+
+	attributes := map[string]interface{}{}
+	if err := p.get(ctx, token, "/user", &attributes); err != nil {
+		return federatedIdentity{}, err
+	}
+
+	id, ok := attributes["id"].(float64)
+	if !ok {
+		return federatedIdentity{}, fmt.Errorf("%w: the user has no id", ErrFederatedLoginFailed)
+	}
+
+	// the profile email is whatever the user chose to make public, so the
+	// primary address is taken from the email list along with whether it
+	// has been verified
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.get(ctx, token, "/user/emails", &emails); err != nil {
+		return federatedIdentity{}, err
+	}
+
+	identity := federatedIdentity{
+		Subject:    strconv.FormatInt(int64(id), 10),
+		Attributes: attributes,
+	}
+
+	for _, email := range emails {
+		if email.Primary {
+			identity.EmailAddress = email.Email
+			identity.EmailVerified = email.Verified
+		}
+	}
+
+	identity.FirstName, identity.Surname = splitName(stringAttribute(attributes, "name"))
+	return identity, nil
+}
+
+func (p *githubProvider) get(ctx context.Context, token *oauth2.Token, path string, dest interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.ApiUrl+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	token.SetAuthHeader(req)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: request for %s failed: %v", ErrFederatedLoginFailed, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: request for %s returned %s", ErrFederatedLoginFailed, path, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+		return fmt.Errorf("%w: invalid response for %s: %v", ErrFederatedLoginFailed, path, err)
+	}
+
+	return nil
+}
+
+// lookupAttribute follows a dotted path such as realm_access.roles into the
+// provider's claims, unless a claim has the whole path as its name, as SAML
+// attributes named by URIs and OIDs do.
+func lookupAttribute(attributes map[string]interface{}, path string) (interface{}, bool) {
+	if value, ok := attributes[path]; ok {
+		return value, true
+	}
+
+	var value interface{} = attributes
+
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if value, ok = object[name]; !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+func stringAttribute(attributes map[string]interface{}, name string) string {
+	value, _ := attributes[name].(string)
+	return strings.TrimSpace(value)
+}
+
+// boolAttribute accepts "true" as well, as some providers send their boolean
+// claims as strings.
+func boolAttribute(attributes map[string]interface{}, name string) bool {
+	switch value := attributes[name].(type) {
+	case bool:
+		return value
+	case string:
+		verified, _ := strconv.ParseBool(value)
+		return verified
+	}
+
+	return false
+}
+
+// attributeMatches reports whether the attribute equals the value or is a
+// list containing it.
+func attributeMatches(attributes map[string]interface{}, path, expected string) bool {
+	value, ok := lookupAttribute(attributes, path)
+	if !ok {
+		return false
+	}
+
+	if values, ok := value.([]interface{}); ok {
+		for _, v := range values {
+			if fmt.Sprint(v) == expected {
+				return true
+			}
+		}
+		return false
+	}
+
+	return fmt.Sprint(value) == expected
+}
+
+func splitName(name string) (string, string) {
+	first, rest, _ := strings.Cut(strings.TrimSpace(name), " ")
+	return first, strings.TrimSpace(rest)
+}
@@ -0,0 +1,341 @@
+package services
+
+import (
+	"authservice/src/config"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	mockIdpClientId = "auth-service"
+	mockIdpKeyId    = "mock-idp-key"
+)
+
+// mockIdp is an OpenID Connect provider that issues codes for the logins it
+// is told about and checks their PKCE verifier before issuing an id token.
+type mockIdp struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu       sync.Mutex
+	codes    map[string]mockIdpLogin
+	userInfo jwt.MapClaims
+}
+
+// mockIdpLogin overrides the claims of the id token and of the userinfo
+// response, leaving out those set to nil.
+type mockIdpLogin struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+	userInfo  jwt.MapClaims
+	signWith  *rsa.PrivateKey
+}
+
+func newMockIdp(t *testing.T) *mockIdp {
+	t.Helper()
+
+	idp := &mockIdp{key: newTestRSAKey(t), codes: map[string]mockIdpLogin{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"userinfo_endpoint":                     idp.server.URL + "/userinfo",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": mockIdpKeyId,
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer access-token" || idp.userInfo == nil {
+			writeTestJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+			return
+		}
+		writeTestJSON(w, http.StatusOK, idp.userInfo)
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+// authorize plays the provider's side of the redirect, issuing a code for the
+// challenge and nonce the authorization url carries.
+func (idp *mockIdp) authorize(t *testing.T, authUrl, code string, login mockIdpLogin) {
+	t.Helper()
+
+	u, err := url.Parse(authUrl)
+	if err != nil {
+		t.Fatalf("invalid authorization url %q: %v", authUrl, err)
+	}
+
+	login.challenge = u.Query().Get("code_challenge")
+	login.nonce = u.Query().Get("nonce")
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.codes[code] = login
+}
+
+func (idp *mockIdp) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	idp.mu.Lock()
+	login, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	if !ok || pkceChallenge(r.PostForm.Get("code_verifier")) != login.challenge {
+		writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	userInfo := jwt.MapClaims{
+		"sub":            "subject-1",
+		"email":          "alice@example.com",
+		"email_verified": true,
+	}
+	overrideClaims(userInfo, login.userInfo)
+
+	idp.mu.Lock()
+	idp.userInfo = userInfo
+	idp.mu.Unlock()
+
+	claims := jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"sub":            "subject-1",
+		"aud":            mockIdpClientId,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          login.nonce,
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice Smith",
+	}
+	overrideClaims(claims, login.claims)
+
+	key := idp.key
+	if login.signWith != nil {
+		key = login.signWith
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = mockIdpKeyId
+	signed, err := idToken.SignedString(key)
+	if err != nil {
+		writeTestJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeTestJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     signed,
+	})
+}
+
+func TestOidcAuthCodeURL(t *testing.T) {
+	idp := newMockIdp(t)
+	provider := newFederatedProvider(config.FederatedProviderConfig{
+		Issuer:   idp.server.URL,
+		ClientId: mockIdpClientId,
+		Scopes:   []string{"openid", "email"},
+	}, nil)
+
+	authUrl, err := provider.authCodeURL(context.Background(), "https://auth.example.com/auth/idp/callback", "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("authCodeURL() error = %v", err)
+	}
+
+	u, err := url.Parse(authUrl)
+	if err != nil {
+		t.Fatalf("invalid authorization url %q: %v", authUrl, err)
+	}
+
+	want := map[string]string{
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        pkceChallenge("verifier-1"),
+		"code_challenge_method": "S256",
+		"client_id":             mockIdpClientId,
+		"redirect_uri":          "https://auth.example.com/auth/idp/callback",
+		"response_type":         "code",
+	}
+	for name, value := range want {
+		if got := u.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if u.Query().Has("code_verifier") {
+		t.Error("the code verifier was sent with the redirect")
+	}
+}
+
+func TestOidcExchange(t *testing.T) {
+	otherKey := newTestRSAKey(t)
+	withoutEmail := jwt.MapClaims{"email": nil, "email_verified": nil}
+
+	tests := []struct {
+		name     string
+		login    mockIdpLogin
+		verifier string
+		nonce    string
+		wantErr  bool
+	}{
+		{name: "valid login"},
+		{name: "wrong code verifier", verifier: "another-verifier", wantErr: true},
+		{name: "nonce of another login", nonce: "another-nonce", wantErr: true},
+		{name: "id token without a nonce", login: mockIdpLogin{claims: jwt.MapClaims{"nonce": ""}}, wantErr: true},
+		{name: "id token for another client", login: mockIdpLogin{claims: jwt.MapClaims{"aud": "another-client"}}, wantErr: true},
+		{name: "id token from another issuer", login: mockIdpLogin{claims: jwt.MapClaims{"iss": "https://evil.example.com"}}, wantErr: true},
+		{name: "expired id token", login: mockIdpLogin{claims: jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}}, wantErr: true},
+		{name: "id token signed with another key", login: mockIdpLogin{signWith: otherKey}, wantErr: true},
+		{name: "email address from userinfo", login: mockIdpLogin{claims: withoutEmail}},
+		{
+			name:    "userinfo for another subject",
+			login:   mockIdpLogin{claims: withoutEmail, userInfo: jwt.MapClaims{"sub": "subject-2"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdp(t)
+			provider := newFederatedProvider(config.FederatedProviderConfig{
+				Issuer:       idp.server.URL,
+				ClientId:     mockIdpClientId,
+				ClientSecret: []byte("client-secret"),
+				Scopes:       []string{"openid", "email"},
+			}, nil)
+
+			ctx := context.Background()
+			redirectUrl := "https://auth.example.com/auth/idp/callback"
+
+			authUrl, err := provider.authCodeURL(ctx, redirectUrl, "state-1", "nonce-1", "verifier-1")
+			if err != nil {
+				t.Fatalf("authCodeURL() error = %v", err)
+			}
+			idp.authorize(t, authUrl, "code-1", tt.login)
+
+			verifier, nonce := "verifier-1", "nonce-1"
+			if len(tt.verifier) > 0 {
+				verifier = tt.verifier
+			}
+			if len(tt.nonce) > 0 {
+				nonce = tt.nonce
+			}
+
+			identity, err := provider.exchange(ctx, redirectUrl, "code-1", nonce, verifier)
+			if tt.wantErr {
+				if !errors.Is(err, ErrFederatedLoginFailed) {
+					t.Fatalf("exchange() error = %v, want %v", err, ErrFederatedLoginFailed)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("exchange() error = %v", err)
+			}
+			want := federatedIdentity{
+				Subject:       "subject-1",
+				EmailAddress:  "alice@example.com",
+				EmailVerified: true,
+				FirstName:     "Alice",
+				Surname:       "Smith",
+			}
+			identity.Attributes = nil
+			if !reflect.DeepEqual(identity, want) {
+				t.Errorf("exchange() = %+v, want %+v", identity, want)
+			}
+		})
+	}
+}
+
+func TestOidcExchangeCodeIsSingleUse(t *testing.T) {
+	idp := newMockIdp(t)
+	provider := newFederatedProvider(config.FederatedProviderConfig{Issuer: idp.server.URL, ClientId: mockIdpClientId}, nil)
+
+	ctx := context.Background()
+	authUrl, err := provider.authCodeURL(ctx, "https://auth.example.com/cb", "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("authCodeURL() error = %v", err)
+	}
+	idp.authorize(t, authUrl, "code-1", mockIdpLogin{})
+
+	if _, err := provider.exchange(ctx, "https://auth.example.com/cb", "code-1", "nonce-1", "verifier-1"); err != nil {
+		t.Fatalf("first exchange() error = %v", err)
+	}
+	if _, err := provider.exchange(ctx, "https://auth.example.com/cb", "code-1", "nonce-1", "verifier-1"); !errors.Is(err, ErrFederatedLoginFailed) {
+		t.Fatalf("second exchange() error = %v, want %v", err, ErrFederatedLoginFailed)
+	}
+}
+
+func overrideClaims(claims, overrides jwt.MapClaims) {
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+}
+
+func pkceChallenge(verifier string) string {
+	digest := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+func newTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	return key
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,426 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/repositories"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// FederationService signs users in with external identity providers. A
+// provider account is linked to a user the first time it signs in, either to
+// the existing user with the same verified email address or to a new user
+// provisioned for it.
+type FederationService struct {
+	providers          map[string]federatedProvider
+	providerCfgs       map[string]config.FederatedProviderConfig
+	providerNames      []string
+	callbackBaseUrl    string
+	loginTimeout       time.Duration
+	federatedLoginRepo *repositories.FederatedLoginRepository
+	userIdentityRepo   *repositories.UserIdentityRepository
+	userRepo           *repositories.UserRepository
+	userClaimRepo      *repositories.UserClaimRepository
+	userService        *UserService
+	userClaimService   *UserClaimService
+	provisioner        *userProvisioner
+	auditService       *AuditService
+	logger             *zap.SugaredLogger
+}
+
+func InitFederationService(serviceCfg *config.ServiceConfig) *FederationService {
+	s := &FederationService{
+		providers:          map[string]federatedProvider{},
+		providerCfgs:       map[string]config.FederatedProviderConfig{},
+		federatedLoginRepo: repositories.InitFederatedLoginRepository(serviceCfg),
+		userIdentityRepo:   repositories.InitUserIdentityRepository(serviceCfg),
+		userRepo:           repositories.InitUserRepositoy(serviceCfg),
+		userClaimRepo:      repositories.InitUserClaimRepository(serviceCfg),
+		userService:        InitUserService(serviceCfg),
+		userClaimService:   InitUserClaimService(serviceCfg),
+		provisioner:        initUserProvisioner(serviceCfg),
+		auditService:       InitAuditService(serviceCfg),
+		logger:             serviceCfg.Logger,
+	}
+
+	if serviceCfg.Federation != nil {
+		s.callbackBaseUrl = serviceCfg.Federation.CallbackBaseUrl
+		s.loginTimeout = serviceCfg.Federation.LoginTimeout
+
+		for _, providerCfg := range serviceCfg.Federation.Providers {
+			s.providers[providerCfg.Name] = newFederatedProvider(providerCfg, serviceCfg.Federation)
+			s.providerCfgs[providerCfg.Name] = providerCfg
+			s.providerNames = append(s.providerNames, providerCfg.Name)
+		}
+	}
+
+	return s
+}
+
+// ListProviders returns the providers in the order they are configured.
+func (s *FederationService) ListProviders() []dtos.FederatedProviderDto {
+	providers := []dtos.FederatedProviderDto{}
+
+	for _, name := range s.providerNames {
+		providers = append(providers, dtos.FederatedProviderDto{
+			Name:        name,
+			DisplayName: s.providerCfgs[name].DisplayName,
+			LoginUrl:    fmt.Sprintf("/auth/%s/login", name),
+		})
+	}
+
+	return providers
+}
+
+// SamlMetadata returns the service provider metadata to register with a SAML
+// identity provider.
+func (s *FederationService) SamlMetadata(providerName string) ([]byte, error) {
+	provider, ok := s.providers[providerName].(*samlProvider)
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	return provider.metadata(s.callbackUrl(providerName))
+}
+
+// PostsCallback reports whether the provider posts its callback from its own
+// site, as SAML providers do, rather than redirecting to it.
+func (s *FederationService) PostsCallback(providerName string) bool {
+	_, ok := s.providers[providerName].(*samlProvider)
+	return ok
+}
+
+// StartLogin records a new login and returns the provider's authorization
+// url to send the user to, along with the state the callback must carry.
+func (s *FederationService) StartLogin(ctx context.Context, providerName string) (string, string, error) {
+	return s.startLogin(ctx, providerName, nil)
+}
+
+// StartLink starts a login that links the provider account to the signed in
+// user instead of signing in with it.
+func (s *FederationService) StartLink(ctx context.Context, providerName string, userId uint) (string, string, error) {
+	return s.startLogin(ctx, providerName, &userId)
+}
+
+func (s *FederationService) startLogin(ctx context.Context, providerName string, linkUserId *uint) (string, string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	state, err := helpers.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := helpers.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	login := domain.FederatedLogin{
+		State:        state,
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		ExpiresAt:    time.Now().Add(s.loginTimeout),
+		LinkUserId:   linkUserId,
+	}
+
+	authUrl, err := provider.authCodeURL(ctx, s.callbackUrl(providerName), state, login.Nonce, login.CodeVerifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.federatedLoginRepo.Add(login); err != nil {
+		return "", "", err
+	}
+
+	return authUrl, state, nil
+}
+
+// CompleteLogin handles the provider's callback, exchanging the code for the
+// identity of the account that signed in and returning the user it signs in
+// as. For a login started by StartLink it instead reports that the account
+// was linked, and the user is not signed in again.
+func (s *FederationService) CompleteLogin(ctx context.Context, providerName, state, code string) (dtos.UserLoginResponseDto, bool, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return dtos.UserLoginResponseDto{}, false, ErrUnknownProvider
+	}
+	providerCfg := s.providerCfgs[providerName]
+	authenticator := "federated:" + providerName
+
+	login, err := s.federatedLoginRepo.Consume(state)
+	if err != nil {
+		return dtos.UserLoginResponseDto{}, false, notFoundOr(err, ErrInvalidFederatedState)
+	}
+
+	if login.Provider != providerName {
+		return dtos.UserLoginResponseDto{}, false, ErrInvalidFederatedState
+	}
+
+	identity, err := provider.exchange(ctx, s.callbackUrl(providerName), code, login.Nonce, login.CodeVerifier)
+	if err != nil {
+		s.logger.Warnf("%s login failed with error %v", providerName, err)
+		if login.LinkUserId == nil {
+			s.userService.recordLoginFailure(ctx, nil, "identity provider did not confirm the login",
+				map[string]interface{}{"authenticator": authenticator})
+		}
+		return dtos.UserLoginResponseDto{}, false, err
+	}
+
+	if login.LinkUserId != nil {
+		if err := s.linkIdentity(ctx, providerCfg, identity, *login.LinkUserId); err != nil {
+			s.logger.Warnf("%s account %s not linked to user id %d with error %v", providerName, identity.Subject, *login.LinkUserId, err)
+			return dtos.UserLoginResponseDto{}, false, err
+		}
+		return dtos.UserLoginResponseDto{}, true, nil
+	}
+
+	user, err := s.signIn(ctx, providerCfg, identity)
+	return user, false, err
+}
+
+// signIn completes a login with the identity, returning the user it signs in
+// as.
+func (s *FederationService) signIn(ctx context.Context, providerCfg config.FederatedProviderConfig, identity federatedIdentity) (dtos.UserLoginResponseDto, error) {
+	providerName := providerCfg.Name
+	authenticator := "federated:" + providerName
+
+	user, err := s.resolveUser(ctx, providerCfg, identity)
+	if err != nil {
+		s.logger.Warnf("%s login for subject %s refused with error %v", providerName, identity.Subject, err)
+		s.userService.recordLoginFailure(ctx, nil, err.Error(), map[string]interface{}{
+			"authenticator":           authenticator,
+			"email_address_pseudonym": s.auditService.Pseudonym(identity.EmailAddress),
+		})
+		return dtos.UserLoginResponseDto{}, err
+	}
+
+	if err := accountStatusError(user.Status); err != nil {
+		s.logger.Warnf("login refused for user %s with account status %s", user.Username, user.Status)
+		s.userService.recordLoginFailure(ctx, userTarget(user.ID), "account is "+user.Status, nil)
+		return dtos.UserLoginResponseDto{}, err
+	}
+
+	if err := s.userClaimService.SyncClaims(ctx, user, federatedClaimEntitlements(providerCfg, identity)); err != nil {
+		return dtos.UserLoginResponseDto{}, err
+	}
+
+	claims, err := s.userClaimRepo.GetClaimsByUserId(user.ID)
+	if err != nil {
+		return dtos.UserLoginResponseDto{}, err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserLoginSucceeded,
+		ActorUserId:  userTarget(user.ID),
+		TargetUserId: userTarget(user.ID),
+	}, map[string]interface{}{"authenticator": authenticator})
+
+	return dtos.UserLoginResponseDto{
+		UserId:       user.ID,
+		Username:     user.Username,
+		EmailAddress: user.EmailAddress,
+		UserClaims:   claims,
+	}, nil
+}
+
+// resolveUser finds the user the provider account is linked to, linking or
+// provisioning one on its first login.
+func (s *FederationService) resolveUser(ctx context.Context, providerCfg config.FederatedProviderConfig, identity federatedIdentity) (domain.User, error) {
+	// checked on every login so narrowing the domains also shuts out accounts
+	// that are already linked
+	if err := checkAllowedDomain(providerCfg, identity); err != nil {
+		return domain.User{}, err
+	}
+
+	linked, err := s.userIdentityRepo.GetByProviderSubject(providerCfg.Name, identity.Subject)
+	if err == nil {
+		user, err := s.userRepo.GetById(repositories.AllTenants, linked.UserId)
+		if err != nil {
+			return domain.User{}, notFoundOr(err, ErrUserNotFound)
+		}
+
+		if err := s.userIdentityRepo.RecordLogin(linked.ID, identity.EmailAddress); err != nil {
+			return domain.User{}, err
+		}
+
+		return user, nil
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.User{}, err
+	}
+
+	// from here on the email address decides which user the account belongs
+	// to, so it has to be one the provider has verified
+	if !isEmailVerified(providerCfg, identity) {
+		return domain.User{}, ErrFederatedEmailUnverified
+	}
+
+	user, err := s.userRepo.GetByEmailAddress(identity.EmailAddress)
+	switch {
+	case err == nil:
+		// service accounts only ever use API keys
+		if user.AuthSource == domain.AuthSourceServiceAccount {
+			return domain.User{}, ErrExternalUserConflict
+		}
+
+		// otherwise whoever registered the address first, without proving
+		// they own it, would be handed the owner's sign in
+		if !user.EmailVerified {
+			return domain.User{}, ErrFederatedLinkUnverified
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return domain.User{}, err
+	case !providerCfg.Provision:
+		return domain.User{}, ErrFederatedSignupDisabled
+	default:
+		user, err = s.provisioner.provision(ctx, domain.User{
+			Username:     identity.EmailAddress,
+			EmailAddress: identity.EmailAddress,
+			FirstName:    identity.FirstName,
+			Surname:      identity.Surname,
+		}, domain.AuthSourceFederated, "federated:"+providerCfg.Name)
+		if err != nil {
+			return domain.User{}, err
+		}
+	}
+
+	if err := s.addIdentity(ctx, user, providerCfg, identity, true); err != nil {
+		return domain.User{}, err
+	}
+
+	return user, nil
+}
+
+// linkIdentity links the account to the user who started the login. Having
+// signed in to both, they need not share an email address.
+func (s *FederationService) linkIdentity(ctx context.Context, providerCfg config.FederatedProviderConfig, identity federatedIdentity, userId uint) error {
+	if err := checkAllowedDomain(providerCfg, identity); err != nil {
+		return err
+	}
+
+	linked, err := s.userIdentityRepo.GetByProviderSubject(providerCfg.Name, identity.Subject)
+	switch {
+	case err == nil && linked.UserId == userId:
+		return nil
+	case err == nil:
+		return ErrIdentityAlreadyLinked
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	user, err := s.userRepo.GetById(repositories.AllTenants, userId)
+	if err != nil {
+		return notFoundOr(err, ErrUserNotFound)
+	}
+
+	if err := accountStatusError(user.Status); err != nil {
+		return err
+	}
+
+	identities, err := s.userIdentityRepo.GetByUserId(userId)
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range identities {
+		if existing.Provider == providerCfg.Name {
+			return ErrIdentityAlreadyLinked
+		}
+	}
+
+	return s.addIdentity(ctx, user, providerCfg, identity, false)
+}
+
+func (s *FederationService) addIdentity(ctx context.Context, user domain.User, providerCfg config.FederatedProviderConfig, identity federatedIdentity, signedIn bool) error {
+	userIdentity := domain.UserIdentity{
+		UserId:       user.ID,
+		Provider:     providerCfg.Name,
+		Subject:      identity.Subject,
+		EmailAddress: identity.EmailAddress,
+	}
+
+	if signedIn {
+		now := time.Now()
+		userIdentity.LastLoginAt = &now
+	}
+
+	if _, err := s.userIdentityRepo.Add(userIdentity); err != nil {
+		return err
+	}
+
+	// there is no token on the callback to take the actor from
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserIdentityLinked,
+		ActorUserId:  userTarget(user.ID),
+		TargetUserId: userTarget(user.ID),
+		Target:       "provider:" + providerCfg.Name,
+	}, map[string]interface{}{
+		"subject_pseudonym":       s.auditService.Pseudonym(identity.Subject),
+		"email_address_pseudonym": s.auditService.Pseudonym(identity.EmailAddress),
+	})
+
+	s.logger.Infof("%s account %s linked to user %s", providerCfg.Name, identity.Subject, user.Username)
+	return nil
+}
+
+func (s *FederationService) callbackUrl(providerName string) string {
+	return fmt.Sprintf("%s/auth/%s/callback", s.callbackBaseUrl, providerName)
+}
+
+// federatedClaimEntitlements evaluates the provider's claim rules. A claim
+// named by several rules is granted when any of them match.
+func federatedClaimEntitlements(providerCfg config.FederatedProviderConfig, identity federatedIdentity) map[string]bool {
+	entitled := map[string]bool{}
+
+	for _, rule := range providerCfg.ClaimRules {
+		entitled[rule.Claim] = entitled[rule.Claim] || attributeMatches(identity.Attributes, rule.Attribute, rule.Value)
+	}
+
+	return entitled
+}
+
+func isEmailVerified(providerCfg config.FederatedProviderConfig, identity federatedIdentity) bool {
+	return len(identity.EmailAddress) > 0 && (identity.EmailVerified || providerCfg.TrustEmail)
+}
+
+// checkAllowedDomain refuses accounts without a verified email address in one
+// of the provider's allowed domains, when it has any.
+func checkAllowedDomain(providerCfg config.FederatedProviderConfig, identity federatedIdentity) error {
+	if len(providerCfg.AllowedDomains) > 0 &&
+		!(isEmailVerified(providerCfg, identity) && isAllowedEmailDomain(providerCfg.AllowedDomains, identity.EmailAddress)) {
+		return ErrFederatedDomainNotAllowed
+	}
+
+	return nil
+}
+
+func isAllowedEmailDomain(allowedDomains []string, emailAddress string) bool {
+	at := strings.LastIndex(emailAddress, "@")
+	if at < 0 {
+		return false
+	}
+
+	domainName := emailAddress[at+1:]
+	for _, allowed := range allowedDomains {
+		if strings.EqualFold(domainName, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/repositories"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// LdapAuthenticator signs users in against an LDAP directory such as Active
+// Directory. A directory user signing in for the first time is provisioned
+// as a local user without a password, and on every login their details are
+// refreshed from the directory and the claims mapped from LDAP groups are
+// granted or revoked to match their group membership.
+type LdapAuthenticator struct {
+	cfg              *config.LdapConfig
+	userRepo         *repositories.UserRepository
+	userClaimService *UserClaimService
+	provisioner      *userProvisioner
+	auditService     *AuditService
+	logger           *zap.SugaredLogger
+}
+
+func InitLdapAuthenticator(serviceCfg *config.ServiceConfig) *LdapAuthenticator {
+	return &LdapAuthenticator{
+		cfg:              serviceCfg.Ldap,
+		userRepo:         repositories.InitUserRepositoy(serviceCfg),
+		userClaimService: InitUserClaimService(serviceCfg),
+		provisioner:      initUserProvisioner(serviceCfg),
+		auditService:     InitAuditService(serviceCfg),
+		logger:           serviceCfg.Logger,
+	}
+}
+
+func (a *LdapAuthenticator) Name() string {
+	return config.AuthenticatorLdap
+}
+
+func (a *LdapAuthenticator) Authenticate(ctx context.Context, username, password string) (domain.User, error) {
+	// a simple bind with an empty password is an unauthenticated bind, which
+	// most directories accept for any DN
+	if len(password) == 0 {
+		return domain.User{}, ErrPasswordMismatch
+	}
+
+	conn, err := a.connect()
+	if err != nil {
+		return domain.User{}, err
+	}
+	defer conn.Close()
+
+	entry, err := a.findUser(conn, username)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	directoryUser := a.newDirectoryUser(entry, username)
+
+	user, err := a.userRepo.GetByUsername(directoryUser.Username)
+	switch {
+	case err == nil && !isDirectoryUser(user):
+		a.logger.Warnf("directory user %s has the username of a %s user and is ignored", directoryUser.Username, user.AuthSource)
+		return domain.User{}, errUserNotHandled
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		return domain.User{}, err
+	}
+
+	if err := a.bindUser(conn, entry, password); err != nil {
+		return user, err
+	}
+
+	groups, err := a.getGroups(conn, entry)
+	if err != nil {
+		return user, err
+	}
+
+	if user.ID == 0 {
+		user, err = a.provisioner.provision(ctx, directoryUser, domain.AuthSourceLdap, a.Name())
+	} else {
+		user, err = a.refreshUser(ctx, user, directoryUser)
+	}
+	if err != nil {
+		return user, err
+	}
+
+	if err := a.syncGroupClaims(ctx, user, groups); err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
+
+// isDirectoryUser reports whether the existing user was provisioned from the
+// directory. Any other user, local, federated or a service account, keeps
+// their username to themselves.
+func isDirectoryUser(user domain.User) bool {
+	return user.AuthSource == domain.AuthSourceLdap
+}
+
+// CheckConnection connects and binds with the service account, for
+// check-config.
+func (a *LdapAuthenticator) CheckConnection() error {
+	conn, err := a.connect()
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// connect dials the directory and binds with the service account, or stays
+// anonymous when none is configured.
+func (a *LdapAuthenticator) connect() (ldap.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: a.cfg.InsecureSkipVerify}
+	if u, err := url.Parse(a.cfg.Url); err == nil {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	conn, err := ldap.DialURL(a.cfg.Url,
+		ldap.DialWithDialer(&net.Dialer{Timeout: a.cfg.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDirectoryUnavailable, err)
+	}
+	conn.SetTimeout(a.cfg.Timeout)
+
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: %v", ErrDirectoryUnavailable, err)
+		}
+	}
+
+	if err := a.bindServiceAccount(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (a *LdapAuthenticator) bindServiceAccount(conn ldap.Client) error {
+	if len(a.cfg.BindDn) == 0 {
+		return nil
+	}
+
+	if err := conn.Bind(a.cfg.BindDn, string(a.cfg.BindPassword)); err != nil {
+		return fmt.Errorf("%w: service account bind failed: %v", ErrDirectoryUnavailable, err)
+	}
+
+	return nil
+}
+
+// bindUser checks the password by binding as the user.
+func (a *LdapAuthenticator) bindUser(conn ldap.Client, entry *ldap.Entry, password string) error {
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return ErrPasswordMismatch
+		}
+		return fmt.Errorf("%w: %v", ErrDirectoryUnavailable, err)
+	}
+
+	return nil
+}
+
+func (a *LdapAuthenticator) findUser(conn ldap.Client, username string) (*ldap.Entry, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.BaseDn, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(a.cfg.Timeout.Seconds()), false,
+		fmt.Sprintf(a.cfg.UserFilter, ldap.EscapeFilter(username)),
+		[]string{
+			a.cfg.UsernameAttribute, a.cfg.EmailAttribute, a.cfg.FirstNameAttribute,
+			a.cfg.SurnameAttribute, a.cfg.MemberOfAttribute,
+		},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("%w: user search failed: %v", ErrDirectoryUnavailable, err)
+	}
+
+	switch len(result.Entries) {
+	case 0:
+		return nil, errUserNotHandled
+	case 1:
+		return result.Entries[0], nil
+	}
+
+	a.logger.Warnf("username %s matches %d directory entries and cannot sign in", username, len(result.Entries))
+	return nil, errUserNotHandled
+}
+
+// getGroups returns the DNs of the user's groups, searched for with the
+// service account when a group filter is configured.
+func (a *LdapAuthenticator) getGroups(conn ldap.Client, entry *ldap.Entry) ([]string, error) {
+	if len(a.cfg.GroupClaims) == 0 {
+		return nil, nil
+	}
+
+	if len(a.cfg.GroupFilter) == 0 {
+		return entry.GetEqualFoldAttributeValues(a.cfg.MemberOfAttribute), nil
+	}
+
+	// the user may not be allowed to search for groups themselves
+	if err := a.bindServiceAccount(conn); err != nil {
+		return nil, err
+	}
+
+	baseDn := a.cfg.GroupBaseDn
+	if len(baseDn) == 0 {
+		baseDn = a.cfg.BaseDn
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		baseDn, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(a.cfg.Timeout.Seconds()), false,
+		fmt.Sprintf(a.cfg.GroupFilter, ldap.EscapeFilter(entry.DN)),
+		[]string{"dn"},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("%w: group search failed: %v", ErrDirectoryUnavailable, err)
+	}
+
+	groups := []string{}
+	for _, group := range result.Entries {
+		groups = append(groups, group.DN)
+	}
+
+	return groups, nil
+}
+
+func (a *LdapAuthenticator) newDirectoryUser(entry *ldap.Entry, username string) domain.User {
+	user := domain.User{
+		Username:     entry.GetEqualFoldAttributeValue(a.cfg.UsernameAttribute),
+		EmailAddress: entry.GetEqualFoldAttributeValue(a.cfg.EmailAttribute),
+		FirstName:    entry.GetEqualFoldAttributeValue(a.cfg.FirstNameAttribute),
+		Surname:      entry.GetEqualFoldAttributeValue(a.cfg.SurnameAttribute),
+	}
+
+	if len(user.Username) == 0 {
+		user.Username = username
+	}
+
+	return user
+}
+
+// refreshUser copies the directory's current details onto the local user.
+func (a *LdapAuthenticator) refreshUser(ctx context.Context, user, directoryUser domain.User) (domain.User, error) {
+	if user.EmailAddress == directoryUser.EmailAddress &&
+		user.FirstName == directoryUser.FirstName &&
+		user.Surname == directoryUser.Surname {
+		return user, nil
+	}
+
+	if user.EmailAddress != directoryUser.EmailAddress {
+		directoryUser.ID = user.ID
+		if err := a.provisioner.checkAvailable(directoryUser); err != nil {
+			return user, err
+		}
+	}
+
+	user.EmailAddress = directoryUser.EmailAddress
+	user.FirstName = directoryUser.FirstName
+	user.Surname = directoryUser.Surname
+
+	if err := a.userRepo.UpdateUser(user); err != nil {
+		return user, err
+	}
+
+	a.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserDetailsUpdated,
+		TargetUserId: userTarget(user.ID),
+	}, map[string]interface{}{"authenticator": a.Name()})
+
+	return user, nil
+}
+
+// syncGroupClaims grants each mapped claim the user's groups entitle them to
+// and revokes the mapped claims they no longer do.
+func (a *LdapAuthenticator) syncGroupClaims(ctx context.Context, user domain.User, groups []string) error {
+	return a.userClaimService.SyncClaims(ctx, user, a.entitledClaims(groups))
+}
+
+// entitledClaims maps each claim mapped from a group to whether the user is
+// in one of the groups it is mapped from.
+func (a *LdapAuthenticator) entitledClaims(groups []string) map[string]bool {
+	entitled := map[string]bool{}
+	for _, groupClaim := range a.cfg.GroupClaims {
+		entitled[groupClaim.Claim] = entitled[groupClaim.Claim] || isLdapGroupMember(groups, groupClaim.Group)
+	}
+
+	return entitled
+}
+
+// isLdapGroupMember compares DNs case insensitively, as directories do.
+func isLdapGroupMember(groups []string, group string) bool {
+	for _, dn := range groups {
+		if strings.EqualFold(strings.TrimSpace(dn), strings.TrimSpace(group)) {
+			return true
+		}
+	}
+
+	return false
+}
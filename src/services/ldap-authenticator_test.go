@@ -0,0 +1,297 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+// fakeDirectory stands in for an LDAP server. Searches are answered by base
+// DN and filter, and binds checked against the passwords by DN. Operations
+// the authenticator does not use are left to the embedded nil client.
+type fakeDirectory struct {
+	ldap.Client
+	passwords map[string]string
+	results   map[string][]*ldap.Entry
+	bindErr   error
+	searchErr error
+
+	bound    string
+	searches []*ldap.SearchRequest
+}
+
+func (d *fakeDirectory) Bind(dn, password string) error {
+	if d.bindErr != nil {
+		return d.bindErr
+	}
+
+	if want, ok := d.passwords[dn]; !ok || want != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+
+	d.bound = dn
+	return nil
+}
+
+func (d *fakeDirectory) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	d.searches = append(d.searches, request)
+	if d.searchErr != nil {
+		return nil, d.searchErr
+	}
+
+	return &ldap.SearchResult{Entries: d.results[request.BaseDN+" "+request.Filter]}, nil
+}
+
+func (d *fakeDirectory) Close() error {
+	return nil
+}
+
+func newTestLdapAuthenticator(cfg config.LdapConfig) *LdapAuthenticator {
+	cfg.BaseDn = "dc=example,dc=com"
+	cfg.UserFilter = "(uid=%s)"
+	cfg.Timeout = 5 * time.Second
+	cfg.UsernameAttribute = "uid"
+	cfg.EmailAttribute = "mail"
+	cfg.FirstNameAttribute = "givenName"
+	cfg.SurnameAttribute = "sn"
+	cfg.MemberOfAttribute = "memberOf"
+
+	return &LdapAuthenticator{cfg: &cfg, logger: zap.NewNop().Sugar()}
+}
+
+var aliceEntry = ldap.NewEntry("uid=alice,ou=people,dc=example,dc=com", map[string][]string{
+	"uid":       {"alice"},
+	"mail":      {"alice@example.com"},
+	"givenName": {"Alice"},
+	"sn":        {"Smith"},
+	"memberOf":  {"CN=Admins,OU=Groups,DC=example,DC=com", "cn=staff,ou=groups,dc=example,dc=com"},
+})
+
+func TestIsDirectoryUser(t *testing.T) {
+	tests := []struct {
+		authSource string
+		want       bool
+	}{
+		{authSource: domain.AuthSourceLdap, want: true},
+		{authSource: domain.AuthSourceLocal},
+		{authSource: ""},
+		{authSource: domain.AuthSourceFederated},
+		{authSource: domain.AuthSourceServiceAccount},
+	}
+
+	for _, tt := range tests {
+		if got := isDirectoryUser(domain.User{AuthSource: tt.authSource}); got != tt.want {
+			t.Errorf("isDirectoryUser(%q) = %v, want %v", tt.authSource, got, tt.want)
+		}
+	}
+}
+
+func TestLdapFindUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		username  string
+		results   map[string][]*ldap.Entry
+		searchErr error
+		wantDn    string
+		wantErr   error
+	}{
+		{
+			name:     "one match",
+			username: "alice",
+			results:  map[string][]*ldap.Entry{"dc=example,dc=com (uid=alice)": {aliceEntry}},
+			wantDn:   aliceEntry.DN,
+		},
+		{
+			name:     "no match",
+			username: "bob",
+			results:  map[string][]*ldap.Entry{"dc=example,dc=com (uid=alice)": {aliceEntry}},
+			wantErr:  errUserNotHandled,
+		},
+		{
+			name:     "ambiguous",
+			username: "alice",
+			results:  map[string][]*ldap.Entry{"dc=example,dc=com (uid=alice)": {aliceEntry, aliceEntry}},
+			wantErr:  errUserNotHandled,
+		},
+		{
+			name:     "filter characters escaped",
+			username: "*)(uid=*",
+			results:  map[string][]*ldap.Entry{"dc=example,dc=com (uid=*)(uid=*)": {aliceEntry}},
+			wantErr:  errUserNotHandled,
+		},
+		{
+			name:      "directory unavailable",
+			username:  "alice",
+			searchErr: ldap.NewError(ldap.ErrorNetwork, errors.New("connection reset")),
+			wantErr:   ErrDirectoryUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestLdapAuthenticator(config.LdapConfig{})
+			directory := &fakeDirectory{results: tt.results, searchErr: tt.searchErr}
+
+			entry, err := a.findUser(directory, tt.username)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("findUser() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && entry.DN != tt.wantDn {
+				t.Errorf("findUser() DN = %s, want %s", entry.DN, tt.wantDn)
+			}
+		})
+	}
+}
+
+func TestLdapBindUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		bindErr  error
+		wantErr  error
+	}{
+		{name: "correct password", password: "secret"},
+		{name: "wrong password", password: "guess", wantErr: ErrPasswordMismatch},
+		{
+			name:     "directory unavailable",
+			password: "secret",
+			bindErr:  ldap.NewError(ldap.ErrorNetwork, errors.New("connection reset")),
+			wantErr:  ErrDirectoryUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestLdapAuthenticator(config.LdapConfig{})
+			directory := &fakeDirectory{
+				passwords: map[string]string{aliceEntry.DN: "secret"},
+				bindErr:   tt.bindErr,
+			}
+
+			err := a.bindUser(directory, aliceEntry, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("bindUser() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && directory.bound != aliceEntry.DN {
+				t.Errorf("bound as %q, want %q", directory.bound, aliceEntry.DN)
+			}
+		})
+	}
+}
+
+func TestLdapGetGroups(t *testing.T) {
+	groupClaims := []config.LdapGroupClaim{{Group: "cn=admins,ou=groups,dc=example,dc=com", Claim: domain.AdministratorClaim}}
+	staff := ldap.NewEntry("cn=staff,ou=groups,dc=example,dc=com", nil)
+
+	tests := []struct {
+		name      string
+		cfg       config.LdapConfig
+		want      []string
+		wantBound string
+	}{
+		{
+			name: "no group claims",
+			cfg:  config.LdapConfig{},
+		},
+		{
+			name: "memberOf attribute",
+			cfg:  config.LdapConfig{GroupClaims: groupClaims},
+			want: aliceEntry.GetAttributeValues("memberOf"),
+		},
+		{
+			name: "group search as the service account",
+			cfg: config.LdapConfig{
+				GroupClaims:  groupClaims,
+				GroupBaseDn:  "ou=groups,dc=example,dc=com",
+				GroupFilter:  "(member=%s)",
+				BindDn:       "cn=service,dc=example,dc=com",
+				BindPassword: []byte("service-secret"),
+			},
+			want:      []string{staff.DN},
+			wantBound: "cn=service,dc=example,dc=com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestLdapAuthenticator(tt.cfg)
+			directory := &fakeDirectory{
+				passwords: map[string]string{"cn=service,dc=example,dc=com": "service-secret"},
+				results: map[string][]*ldap.Entry{
+					"ou=groups,dc=example,dc=com (member=uid=alice,ou=people,dc=example,dc=com)": {staff},
+				},
+			}
+
+			got, err := a.getGroups(directory, aliceEntry)
+			if err != nil {
+				t.Fatalf("getGroups() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getGroups() = %v, want %v", got, tt.want)
+			}
+			if directory.bound != tt.wantBound {
+				t.Errorf("bound as %q, want %q", directory.bound, tt.wantBound)
+			}
+		})
+	}
+}
+
+func TestLdapEntitledClaims(t *testing.T) {
+	a := newTestLdapAuthenticator(config.LdapConfig{
+		GroupClaims: []config.LdapGroupClaim{
+			{Group: "cn=admins,ou=groups,dc=example,dc=com", Claim: domain.AdministratorClaim},
+			{Group: "cn=auditors,ou=groups,dc=example,dc=com", Claim: "Auditor"},
+			{Group: "cn=staff,ou=groups,dc=example,dc=com", Claim: "Auditor"},
+		},
+	})
+
+	tests := []struct {
+		name   string
+		groups []string
+		want   map[string]bool
+	}{
+		{
+			name:   "case and spacing of DNs ignored",
+			groups: []string{" CN=Admins,OU=Groups,DC=example,DC=com "},
+			want:   map[string]bool{domain.AdministratorClaim: true, "Auditor": false},
+		},
+		{
+			name:   "any of the groups a claim is mapped from",
+			groups: []string{"cn=staff,ou=groups,dc=example,dc=com"},
+			want:   map[string]bool{domain.AdministratorClaim: false, "Auditor": true},
+		},
+		{
+			name: "no groups revokes every mapped claim",
+			want: map[string]bool{domain.AdministratorClaim: false, "Auditor": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.entitledClaims(tt.groups); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entitledClaims() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLdapNewDirectoryUser(t *testing.T) {
+	a := newTestLdapAuthenticator(config.LdapConfig{})
+
+	got := a.newDirectoryUser(aliceEntry, "ALICE")
+	want := domain.User{Username: "alice", EmailAddress: "alice@example.com", FirstName: "Alice", Surname: "Smith"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newDirectoryUser() = %+v, want %+v", got, want)
+	}
+
+	got = a.newDirectoryUser(ldap.NewEntry("uid=bob,dc=example,dc=com", nil), "bob")
+	if got.Username != "bob" {
+		t.Errorf("newDirectoryUser() without a username attribute = %q, want the username signed in with", got.Username)
+	}
+}
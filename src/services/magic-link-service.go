@@ -0,0 +1,234 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/repositories"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const magicLinkAuthenticator = "magic_link"
+
+// MagicLinkService signs local users in with a single use link emailed to
+// them. The link only works in the browser that asked for it, which holds a
+// secret the link is bound to, so a link forwarded or read from a mailbox by
+// someone else is of no use to them.
+type MagicLinkService struct {
+	cfg           *config.MagicLinkConfig
+	secret        []byte
+	magicLinkRepo *repositories.MagicLinkRepository
+	userRepo      *repositories.UserRepository
+	userClaimRepo *repositories.UserClaimRepository
+	userService   *UserService
+	auditService  *AuditService
+	mailer        *Mailer
+	logger        *zap.SugaredLogger
+}
+
+func InitMagicLinkService(serviceCfg *config.ServiceConfig) *MagicLinkService {
+	return &MagicLinkService{
+		cfg:           serviceCfg.MagicLink,
+		secret:        []byte(serviceCfg.ClientSecret),
+		magicLinkRepo: repositories.InitMagicLinkRepository(serviceCfg),
+		userRepo:      repositories.InitUserRepositoy(serviceCfg),
+		userClaimRepo: repositories.InitUserClaimRepository(serviceCfg),
+		userService:   InitUserService(serviceCfg),
+		auditService:  InitAuditService(serviceCfg),
+		mailer:        InitMailer(serviceCfg),
+		logger:        serviceCfg.Logger,
+	}
+}
+
+// RequestLink emails a link to the user with the email address, returning
+// the secret the requesting browser must hold to use it. Whether a link was
+// sent is not revealed, so a secret is returned for addresses that have no
+// account, belong to users who cannot sign in with a link or have asked for
+// too many links.
+func (s *MagicLinkService) RequestLink(ctx context.Context, emailAddress string) (string, error) {
+	binding, err := helpers.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	emailAddress = strings.TrimSpace(emailAddress)
+	if len(emailAddress) == 0 {
+		return binding, nil
+	}
+
+	user, err := s.userRepo.GetByEmailAddress(emailAddress)
+	if err != nil {
+		s.logger.Warnf("magic link requested for unknown email address with pseudonym %s", s.auditService.Pseudonym(emailAddress))
+		return binding, nil
+	}
+
+	if !canUseMagicLink(user) {
+		s.logger.Warnf("magic link not sent to user %s with auth source %s, account status %s and email verified %t",
+			user.Username, user.AuthSource, user.Status, user.EmailVerified)
+		return binding, nil
+	}
+
+	sent, err := s.magicLinkRepo.CountSince(user.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		return "", err
+	}
+
+	if sent >= int64(s.cfg.MaxPerHour) {
+		s.logger.Warnf("magic link not sent to user %s who has been sent %d in the last hour", user.Username, sent)
+		return binding, nil
+	}
+
+	token, err := helpers.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.magicLinkRepo.Add(domain.MagicLink{
+		UserId:       user.ID,
+		TokenHash:    s.hash(token),
+		BindingHash:  s.hash(binding),
+		EmailAddress: user.EmailAddress,
+		IPAddress:    helpers.RequestMetadataFromContext(ctx).IPAddress,
+		ExpiresAt:    time.Now().Add(s.cfg.Ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	link, err := s.linkUrl(token)
+	if err != nil {
+		return "", err
+	}
+
+	// sent in the background so a slow mail server does not hold up the
+	// response
+	go s.send(user, link)
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserMagicLinkSent,
+		TargetUserId: userTarget(user.ID),
+	}, nil)
+
+	return binding, nil
+}
+
+// ConsumeLink signs in with the token from a link, which must be presented
+// with the secret given to the browser that requested it. A link presented
+// without it is left usable, so it still works once opened in the right
+// browser.
+func (s *MagicLinkService) ConsumeLink(ctx context.Context, token, binding string) (dtos.UserLoginResponseDto, error) {
+	if len(token) == 0 {
+		return dtos.UserLoginResponseDto{}, ErrInvalidMagicLink
+	}
+
+	link, err := s.magicLinkRepo.GetUsable(s.hash(token))
+	if err != nil {
+		s.logger.Warnf("unknown, expired or used magic link presented")
+		return dtos.UserLoginResponseDto{}, notFoundOr(err, ErrInvalidMagicLink)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(link.BindingHash), []byte(s.hash(binding))) != 1 {
+		s.logger.Warnf("magic link for user id %d presented from another browser", link.UserId)
+		s.userService.recordLoginFailure(ctx, userTarget(link.UserId), "magic link opened in another browser",
+			map[string]interface{}{"authenticator": magicLinkAuthenticator})
+		return dtos.UserLoginResponseDto{}, ErrMagicLinkOtherBrowser
+	}
+
+	consumed, err := s.magicLinkRepo.Consume(link.ID)
+	if err != nil {
+		return dtos.UserLoginResponseDto{}, err
+	}
+
+	if !consumed {
+		return dtos.UserLoginResponseDto{}, ErrInvalidMagicLink
+	}
+
+	// the account may have changed since the link was sent
+	user, err := s.userRepo.GetById(repositories.AllTenants, link.UserId)
+	if err != nil {
+		return dtos.UserLoginResponseDto{}, notFoundOr(err, ErrInvalidMagicLink)
+	}
+
+	if user.EmailAddress != link.EmailAddress || user.AuthSource != domain.AuthSourceLocal || !user.EmailVerified {
+		s.logger.Warnf("magic link for user %s no longer matches the account", user.Username)
+		s.userService.recordLoginFailure(ctx, userTarget(user.ID), "magic link no longer matches the account",
+			map[string]interface{}{"authenticator": magicLinkAuthenticator})
+		return dtos.UserLoginResponseDto{}, ErrInvalidMagicLink
+	}
+
+	if err := accountStatusError(user.Status); err != nil {
+		s.logger.Warnf("login refused for user %s with account status %s", user.Username, user.Status)
+		s.userService.recordLoginFailure(ctx, userTarget(user.ID), "account is "+user.Status, nil)
+		return dtos.UserLoginResponseDto{}, err
+	}
+
+	claims, err := s.userClaimRepo.GetClaimsByUserId(user.ID)
+	if err != nil {
+		return dtos.UserLoginResponseDto{}, err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserLoginSucceeded,
+		ActorUserId:  userTarget(user.ID),
+		TargetUserId: userTarget(user.ID),
+	}, map[string]interface{}{"authenticator": magicLinkAuthenticator})
+
+	return dtos.UserLoginResponseDto{
+		UserId:       user.ID,
+		Username:     user.Username,
+		EmailAddress: user.EmailAddress,
+		UserClaims:   claims,
+	}, nil
+}
+
+// canUseMagicLink reports whether a link may be sent to the user. Directory
+// and federated users sign in where their password is kept, and an address
+// nobody has proved they own would let whoever registered it sign in as the
+// account.
+func canUseMagicLink(user domain.User) bool {
+	return user.AuthSource == domain.AuthSourceLocal && user.Status == domain.AccountStatusActive && user.EmailVerified
+}
+
+func (s *MagicLinkService) send(user domain.User, link string) {
+	body := fmt.Sprintf("Hello %s,\n\n"+
+		"Use the link below to sign in. It can be used once, in the browser you asked for it from, within the next %d minutes.\n\n"+
+		"%s\n\n"+
+		"If you did not ask to sign in you can ignore this email.\n",
+		user.Username, int(s.cfg.Ttl.Minutes()), link)
+
+	if err := s.mailer.Send(user.EmailAddress, "Your sign in link", body); err != nil {
+		s.logger.Errorf("error sending magic link to user %s with error %v", user.Username, err)
+	}
+}
+
+func (s *MagicLinkService) linkUrl(token string) (string, error) {
+	u, err := url.Parse(s.cfg.LinkUrl)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// hash keys the value with the token signing secret, so a copy of the table
+// cannot be used to sign in or tested against guessed tokens.
+func (s *MagicLinkService) hash(value string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
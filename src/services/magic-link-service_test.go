@@ -0,0 +1,37 @@
+package services
+
+import (
+	"authservice/src/domain"
+	"testing"
+)
+
+func TestCanUseMagicLink(t *testing.T) {
+	verified := domain.User{AuthSource: domain.AuthSourceLocal, Status: domain.AccountStatusActive, EmailVerified: true}
+
+	tests := []struct {
+		name   string
+		change func(user *domain.User)
+		want   bool
+	}{
+		{name: "active local user with a verified address", change: func(user *domain.User) {}, want: true},
+		{name: "unverified address", change: func(user *domain.User) { user.EmailVerified = false }},
+		{name: "directory user", change: func(user *domain.User) { user.AuthSource = domain.AuthSourceLdap }},
+		{name: "federated user", change: func(user *domain.User) { user.AuthSource = domain.AuthSourceFederated }},
+		{name: "service account", change: func(user *domain.User) { user.AuthSource = domain.AuthSourceServiceAccount }},
+		{name: "suspended", change: func(user *domain.User) { user.Status = domain.AccountStatusSuspended }},
+		{name: "locked", change: func(user *domain.User) { user.Status = domain.AccountStatusLocked }},
+		{name: "pending verification", change: func(user *domain.User) {
+			user.Status, user.EmailVerified = domain.AccountStatusPendingVerification, false
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := verified
+			tt.change(&user)
+			if got := canUseMagicLink(user); got != tt.want {
+				t.Errorf("canUseMagicLink() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"authservice/src/config"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Mailer sends plain text email through the configured SMTP server.
+type Mailer struct {
+	cfg    *config.SmtpConfig
+	logger *zap.SugaredLogger
+}
+
+func InitMailer(serviceCfg *config.ServiceConfig) *Mailer {
+	return &Mailer{
+		cfg:    serviceCfg.Smtp,
+		logger: serviceCfg.Logger,
+	}
+}
+
+func (m *Mailer) Send(to, subject, body string) error {
+	from, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return err
+	}
+
+	// parsing also refuses line breaks, which could add headers
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %v", to, err)
+	}
+
+	message, err := newMailMessage(from, recipient, subject, body)
+	if err != nil {
+		return err
+	}
+
+	client, err := m.connect()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+
+	if err := client.Rcpt(recipient.Address); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// connect opens the connection, moves it onto TLS and signs in. Plain
+// authentication is refused by net/smtp over a connection that is not
+// encrypted, other than to localhost.
+func (m *Mailer) connect() (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	dialer := &net.Dialer{Timeout: m.cfg.Timeout}
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+
+	var conn net.Conn
+	var err error
+	if m.cfg.ImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(m.cfg.Timeout))
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if !m.cfg.ImplicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				client.Close()
+				return nil, err
+			}
+		}
+	}
+
+	if len(m.cfg.Username) > 0 {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, string(m.cfg.Password), m.cfg.Host)); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+func newMailMessage(from, to *mail.Address, subject, body string) ([]byte, error) {
+	var message bytes.Buffer
+
+	fmt.Fprintf(&message, "From: %s\r\n", from.String())
+	fmt.Fprintf(&message, "To: %s\r\n", to.String())
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	w := quotedprintable.NewWriter(&message)
+	if _, err := w.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return message.Bytes(), nil
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/repositories"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// OrganizationService manages the organizations users belong to. Only
+// platform administrators, who belong to none, manage them.
+type OrganizationService struct {
+	orgRepo       *repositories.OrganizationRepository
+	userRepo      *repositories.UserRepository
+	claimRepo     *repositories.ClaimRepository
+	userClaimRepo *repositories.UserClaimRepository
+	auditService  *AuditService
+	logger        *zap.SugaredLogger
+}
+
+func InitOrganizationService(serviceCfg *config.ServiceConfig) *OrganizationService {
+	return &OrganizationService{
+		orgRepo:       repositories.InitOrganizationRepository(serviceCfg),
+		userRepo:      repositories.InitUserRepositoy(serviceCfg),
+		claimRepo:     repositories.InitClaimRepository(serviceCfg),
+		userClaimRepo: repositories.InitUserClaimRepository(serviceCfg),
+		auditService:  InitAuditService(serviceCfg),
+		logger:        serviceCfg.Logger,
+	}
+}
+
+func (s *OrganizationService) CreateOrganization(ctx context.Context, create dtos.OrganizationCreateDto) (dtos.OrganizationDto, error) {
+	organization := domain.Organization{
+		Slug: strings.TrimSpace(create.Slug),
+		Name: strings.TrimSpace(create.Name),
+	}
+
+	if len(organization.Name) == 0 || !organizationSlugPattern.MatchString(organization.Slug) {
+		return dtos.OrganizationDto{}, ErrInvalidOrganization
+	}
+
+	_, err := s.orgRepo.GetBySlug(organization.Slug)
+	switch {
+	case err == nil:
+		return dtos.OrganizationDto{}, ErrOrganizationSlugTaken
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return dtos.OrganizationDto{}, err
+	}
+
+	organization, err = s.orgRepo.Add(organization)
+	if err != nil {
+		return dtos.OrganizationDto{}, err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType: domain.AuditOrganizationCreated,
+		Target:    organizationTarget(organization.ID),
+	}, map[string]interface{}{"slug": organization.Slug, "name": organization.Name})
+
+	return newOrganizationDto(organization), nil
+}
+
+func (s *OrganizationService) GetOrganizations() ([]dtos.OrganizationDto, error) {
+	organizations, err := s.orgRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := []dtos.OrganizationDto{}
+	for _, organization := range organizations {
+		resp = append(resp, newOrganizationDto(organization))
+	}
+
+	return resp, nil
+}
+
+// MoveUser moves the user into the organization, or out of any with nil,
+// revoking their claims and signing them out, so nothing they were granted in
+// one organization is used in another. They are left with the User claim.
+func (s *OrganizationService) MoveUser(ctx context.Context, userId uint, organizationId *uint) error {
+	user, err := s.userRepo.GetById(repositories.AllTenants, userId)
+	if err != nil {
+		return notFoundOr(err, ErrUserNotFound)
+	}
+
+	if organizationId != nil {
+		if _, err := s.orgRepo.GetById(*organizationId); err != nil {
+			return notFoundOr(err, ErrOrganizationNotFound)
+		}
+	}
+
+	if repositories.InTenant(organizationId).Allows(user.OrganizationId) {
+		return nil
+	}
+
+	if err := s.ensureNotLastAdministrator(user); err != nil {
+		return err
+	}
+
+	userClaim, err := s.claimRepo.GetByName(domain.UserClaimName)
+	if err != nil {
+		return err
+	}
+
+	if err := s.orgRepo.SetMembership(user.ID, organizationId, userClaim.ID); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserOrganizationChanged,
+		TargetUserId: userTarget(user.ID),
+	}, map[string]interface{}{"from": user.OrganizationId, "to": organizationId})
+
+	s.logger.Infof("user %s moved to organization %v", user.Username, organizationId)
+	return nil
+}
+
+// ensureNotLastAdministrator keeps an administrator in the organization the
+// user is leaving, above all the platform's own.
+func (s *OrganizationService) ensureNotLastAdministrator(user domain.User) error {
+	claims, err := s.userClaimRepo.GetClaimsByUserId(user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, claim := range claims {
+		if claim != domain.AdministratorClaim {
+			continue
+		}
+
+		adminClaim, err := s.claimRepo.GetByName(domain.AdministratorClaim)
+		if err != nil {
+			return err
+		}
+
+		count, err := s.userClaimRepo.CountUsersByClaimId(repositories.InTenant(user.OrganizationId), adminClaim.ID)
+		if err != nil {
+			return err
+		}
+
+		if count <= 1 {
+			return ErrLastAdministrator
+		}
+	}
+
+	return nil
+}
+
+func organizationTarget(organizationId uint) string {
+	return fmt.Sprintf("organization:%d", organizationId)
+}
+
+func newOrganizationDto(organization domain.Organization) dtos.OrganizationDto {
+	return dtos.OrganizationDto{
+		OrganizationId: organization.ID,
+		Slug:           organization.Slug,
+		Name:           organization.Name,
+		CreatedAt:      organization.CreatedAt,
+	}
+}
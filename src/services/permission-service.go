@@ -0,0 +1,186 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/repositories"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var permissionNamePattern = regexp.MustCompile(`^[a-z0-9_]+:[a-z0-9_]+$`)
+
+// PermissionService manages permissions and the roles, which are claims,
+// that bundle them. Roles and permissions are shared by every organization,
+// so only platform administrators change them.
+type PermissionService struct {
+	permissionRepo *repositories.PermissionRepository
+	claimRepo      *repositories.ClaimRepository
+	auditService   *AuditService
+	logger         *zap.SugaredLogger
+}
+
+func InitPermissionService(serviceCfg *config.ServiceConfig) *PermissionService {
+	return &PermissionService{
+		permissionRepo: repositories.InitPermissionRepository(serviceCfg),
+		claimRepo:      repositories.InitClaimRepository(serviceCfg),
+		auditService:   InitAuditService(serviceCfg),
+		logger:         serviceCfg.Logger,
+	}
+}
+
+func (s *PermissionService) GetPermissions() ([]dtos.PermissionDto, error) {
+	permissions, err := s.permissionRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := []dtos.PermissionDto{}
+	for _, permission := range permissions {
+		resp = append(resp, newPermissionDto(permission))
+	}
+
+	return resp, nil
+}
+
+func (s *PermissionService) CreatePermission(ctx context.Context, create dtos.PermissionCreateDto) (dtos.PermissionDto, error) {
+	permission := domain.Permission{
+		Name:        strings.TrimSpace(create.Name),
+		Description: strings.TrimSpace(create.Description),
+	}
+
+	if !permissionNamePattern.MatchString(permission.Name) {
+		return dtos.PermissionDto{}, ErrInvalidPermission
+	}
+
+	_, err := s.permissionRepo.GetByName(permission.Name)
+	switch {
+	case err == nil:
+		return dtos.PermissionDto{}, ErrPermissionNameTaken
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return dtos.PermissionDto{}, err
+	}
+
+	permission, err = s.permissionRepo.Add(permission)
+	if err != nil {
+		return dtos.PermissionDto{}, err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType: domain.AuditPermissionCreated,
+		Target:    permissionTarget(permission.Name),
+	}, nil)
+
+	return newPermissionDto(permission), nil
+}
+
+func (s *PermissionService) DeletePermission(ctx context.Context, name string) error {
+	if domain.IsBuiltInPermission(name) {
+		return ErrBuiltInPermission
+	}
+
+	permission, err := s.permissionRepo.GetByName(name)
+	if err != nil {
+		return notFoundOr(err, ErrPermissionNotFound)
+	}
+
+	if err := s.permissionRepo.Delete(permission); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType: domain.AuditPermissionDeleted,
+		Target:    permissionTarget(permission.Name),
+	}, nil)
+
+	return nil
+}
+
+func (s *PermissionService) GetRolePermissions(claimName string) ([]string, error) {
+	claim, err := s.claimRepo.GetByName(claimName)
+	if err != nil {
+		return nil, notFoundOr(err, ErrClaimNotFound)
+	}
+
+	return s.permissionRepo.GetByClaimNames([]string{claim.Claim})
+}
+
+func (s *PermissionService) GrantPermission(ctx context.Context, claimName, permissionName string) error {
+	claim, permission, err := s.getClaimAndPermission(claimName, permissionName)
+	if err != nil {
+		return err
+	}
+
+	if err := s.permissionRepo.GrantToClaim(claim.ID, permission.ID); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType: domain.AuditClaimPermissionGranted,
+		Target:    claimTarget(claim),
+	}, map[string]interface{}{"permission": permission.Name})
+
+	return nil
+}
+
+// RevokePermission refuses to take the service's own permissions from the
+// Administrator role, so there is always a role that can manage the rest.
+func (s *PermissionService) RevokePermission(ctx context.Context, claimName, permissionName string) error {
+	claim, permission, err := s.getClaimAndPermission(claimName, permissionName)
+	if err != nil {
+		return err
+	}
+
+	if claim.Claim == domain.AdministratorClaim && domain.IsBuiltInPermission(permission.Name) {
+		return ErrBuiltInPermission
+	}
+
+	revoked, err := s.permissionRepo.RevokeFromClaim(claim.ID, permission.ID)
+	if err != nil {
+		return err
+	}
+
+	if revoked == 0 {
+		return ErrPermissionNotFound
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType: domain.AuditClaimPermissionRevoked,
+		Target:    claimTarget(claim),
+	}, map[string]interface{}{"permission": permission.Name})
+
+	return nil
+}
+
+func (s *PermissionService) getClaimAndPermission(claimName, permissionName string) (domain.Claim, domain.Permission, error) {
+	claim, err := s.claimRepo.GetByName(claimName)
+	if err != nil {
+		return domain.Claim{}, domain.Permission{}, notFoundOr(err, ErrClaimNotFound)
+	}
+
+	permission, err := s.permissionRepo.GetByName(permissionName)
+	if err != nil {
+		return domain.Claim{}, domain.Permission{}, notFoundOr(err, ErrPermissionNotFound)
+	}
+
+	return claim, permission, nil
+}
+
+func permissionTarget(name string) string {
+	return "permission:" + name
+}
+
+func newPermissionDto(permission domain.Permission) dtos.PermissionDto {
+	return dtos.PermissionDto{
+		Name:        permission.Name,
+		Description: permission.Description,
+		BuiltIn:     domain.IsBuiltInPermission(permission.Name),
+		CreatedAt:   permission.CreatedAt,
+	}
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"authservice/src/config"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// samlMetadataRefresh is how long metadata read from a metadata url is used
+// before it is read again, so the identity provider can rotate its keys.
+const samlMetadataRefresh = 24 * time.Hour
+
+var samlNameIdFormats = map[string]saml.NameIDFormat{
+	"unspecified": saml.UnspecifiedNameIDFormat,
+	"persistent":  saml.PersistentNameIDFormat,
+	"email":       saml.EmailAddressNameIDFormat,
+	"transient":   saml.TransientNameIDFormat,
+}
+
+// samlProvider signs in with a SAML 2.0 identity provider. The request is
+// sent with the HTTP-Redirect binding and carries the login's nonce as its
+// id, and the signed response is posted back to the callback, which this
+// service's metadata names as its assertion consumer service.
+type samlProvider struct {
+	cfg         config.FederatedProviderConfig
+	federation  *config.FederationConfig
+	client      *http.Client
+	mu          sync.Mutex
+	idpMetadata *saml.EntityDescriptor
+	readAt      time.Time
+}
+
+func (p *samlProvider) authCodeURL(ctx context.Context, redirectUrl, state, nonce, verifier string) (string, error) {
+	sp, err := p.serviceProvider(ctx, redirectUrl)
+	if err != nil {
+		return "", err
+	}
+
+	ssoUrl := sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if len(ssoUrl) == 0 {
+		return "", fmt.Errorf("%w: the identity provider has no HTTP-Redirect sign on service", ErrFederatedLoginFailed)
+	}
+
+	req, err := sp.MakeAuthenticationRequest(ssoUrl, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", err
+	}
+	req.ID = samlRequestId(nonce)
+
+	authUrl, err := req.Redirect(state, sp)
+	if err != nil {
+		return "", err
+	}
+
+	return authUrl.String(), nil
+}
+
+// exchange validates the posted SAMLResponse, which must be signed by the
+// identity provider and answer the request started with the nonce.
+func (p *samlProvider) exchange(ctx context.Context, redirectUrl, code, nonce, verifier string) (federatedIdentity, error) {
+	sp, err := p.serviceProvider(ctx, redirectUrl)
+	if err != nil {
+		return federatedIdentity{}, err
+	}
+
+	response, err := base64.StdEncoding.DecodeString(code)
+	if err != nil {
+		return federatedIdentity{}, fmt.Errorf("%w: the SAML response is not base64 encoded", ErrFederatedLoginFailed)
+	}
+
+	assertion, err := sp.ParseXMLResponse(response, []string{samlRequestId(nonce)})
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+		return federatedIdentity{}, fmt.Errorf("%w: invalid SAML response: %v", ErrFederatedLoginFailed, err)
+	}
+
+	return p.newIdentity(assertion)
+}
+
+// metadata describes this service to the identity provider. It does not need
+// the identity provider's own metadata, which may not exist until it has this.
+func (p *samlProvider) metadata(redirectUrl string) ([]byte, error) {
+	sp, err := p.newServiceProvider(redirectUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// responses are only taken posted to the callback, not as artifacts
+	entity := sp.Metadata()
+	for i := range entity.SPSSODescriptors {
+		descriptor := &entity.SPSSODescriptors[i]
+		descriptor.AssertionConsumerServices = descriptor.AssertionConsumerServices[:1]
+	}
+
+	metadata, err := xml.MarshalIndent(entity, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), metadata...), nil
+}
+
+func (p *samlProvider) serviceProvider(ctx context.Context, redirectUrl string) (*saml.ServiceProvider, error) {
+	idpMetadata, err := p.readIdpMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.newServiceProvider(redirectUrl, idpMetadata)
+}
+
+func (p *samlProvider) newServiceProvider(redirectUrl string, idpMetadata *saml.EntityDescriptor) (*saml.ServiceProvider, error) {
+	acsUrl, err := url.Parse(redirectUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &saml.ServiceProvider{
+		EntityID:          p.cfg.EntityId,
+		Key:               p.federation.SamlKey,
+		Certificate:       p.federation.SamlCertificate,
+		HTTPClient:        p.client,
+		AcsURL:            *acsUrl,
+		IDPMetadata:       idpMetadata,
+		AuthnNameIDFormat: samlNameIdFormats[p.cfg.NameIdFormat],
+		SignatureMethod:   dsig.RSASHA256SignatureMethod,
+	}, nil
+}
+
+// readIdpMetadata parses the configured metadata, or reads it from the
+// metadata url on first use and again once it is stale. Stale metadata is
+// kept when the identity provider cannot be reached.
+func (p *samlProvider) readIdpMetadata(ctx context.Context) (*saml.EntityDescriptor, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.idpMetadata != nil && (len(p.cfg.IdpMetadata) > 0 || time.Since(p.readAt) < samlMetadataRefresh) {
+		return p.idpMetadata, nil
+	}
+
+	data := p.cfg.IdpMetadata
+	if len(data) == 0 {
+		fetched, err := p.fetchIdpMetadata(ctx)
+		if err != nil {
+			if p.idpMetadata != nil {
+				return p.idpMetadata, nil
+			}
+			return nil, err
+		}
+		data = fetched
+	}
+
+	idpMetadata, err := parseSamlMetadata(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid identity provider metadata: %v", ErrFederatedLoginFailed, err)
+	}
+
+	p.idpMetadata = idpMetadata
+	p.readAt = time.Now()
+	return idpMetadata, nil
+}
+
+func (p *samlProvider) fetchIdpMetadata(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.MetadataUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: request for %s failed: %v", ErrFederatedLoginFailed, p.cfg.MetadataUrl, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: request for %s returned %s", ErrFederatedLoginFailed, p.cfg.MetadataUrl, resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+}
+
+// newIdentity reads the user from the assertion. A transient NameID changes
+// on every login, so it cannot identify the account without a subject
+// attribute.
+func (p *samlProvider) newIdentity(assertion *saml.Assertion) (federatedIdentity, error) {
+	attributes := samlAttributes(assertion)
+
+	var nameId saml.NameID
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		nameId = *assertion.Subject.NameID
+	}
+
+	identity := federatedIdentity{
+		Subject:      nameId.Value,
+		EmailAddress: stringAttribute(attributes, p.cfg.Attributes.EmailAddress),
+		FirstName:    stringAttribute(attributes, p.cfg.Attributes.FirstName),
+		Surname:      stringAttribute(attributes, p.cfg.Attributes.Surname),
+		Attributes:   attributes,
+	}
+
+	if len(p.cfg.Attributes.Subject) > 0 {
+		identity.Subject = stringAttribute(attributes, p.cfg.Attributes.Subject)
+	} else if nameId.Format == string(saml.TransientNameIDFormat) {
+		return federatedIdentity{}, fmt.Errorf("%w: the NameID is transient and no subject attribute is configured", ErrFederatedLoginFailed)
+	}
+
+	if len(identity.Subject) == 0 {
+		return federatedIdentity{}, fmt.Errorf("%w: the assertion has no subject", ErrFederatedLoginFailed)
+	}
+
+	if len(identity.EmailAddress) == 0 && nameId.Format == string(saml.EmailAddressNameIDFormat) {
+		identity.EmailAddress = nameId.Value
+	}
+
+	return identity, nil
+}
+
+// samlAttributes flattens the assertion's attributes by name, and by
+// friendly name where that is not also a name. Attributes with several
+// values become lists.
+func samlAttributes(assertion *saml.Assertion) map[string]interface{} {
+	attributes := map[string]interface{}{}
+	friendly := map[string]interface{}{}
+
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			values := []interface{}{}
+			for _, value := range attribute.Values {
+				values = append(values, value.Value)
+			}
+
+			var value interface{} = values
+			if len(values) == 1 {
+				value = values[0]
+			}
+
+			attributes[attribute.Name] = value
+			if len(attribute.FriendlyName) > 0 {
+				friendly[attribute.FriendlyName] = value
+			}
+		}
+	}
+
+	for name, value := range friendly {
+		if _, ok := attributes[name]; !ok {
+			attributes[name] = value
+		}
+	}
+
+	return attributes
+}
+
+// parseSamlMetadata accepts an identity provider's EntityDescriptor, or an
+// EntitiesDescriptor holding one.
+func parseSamlMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	entity := &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(data, entity); err == nil {
+		if len(entity.IDPSSODescriptors) == 0 {
+			return nil, errors.New("the metadata does not describe an identity provider")
+		}
+		return entity, nil
+	}
+
+	entities := &saml.EntitiesDescriptor{}
+	if err := xml.Unmarshal(data, entities); err != nil {
+		return nil, err
+	}
+
+	for i := range entities.EntityDescriptors {
+		if len(entities.EntityDescriptors[i].IDPSSODescriptors) > 0 {
+			return &entities.EntityDescriptors[i], nil
+		}
+	}
+
+	return nil, errors.New("the metadata does not describe an identity provider")
+}
+
+// samlRequestId makes the nonce a valid XML id, which cannot start with a
+// digit.
+func samlRequestId(nonce string) string {
+	return "id-" + nonce
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"authservice/src/config"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	samlTestIdpEntityId = "https://idp.example.com/metadata"
+	samlTestEntityId    = "https://auth.example.com/auth/idp/metadata"
+	samlTestAcsUrl      = "https://auth.example.com/auth/idp/callback"
+)
+
+// samlTestIdp signs responses with the key whose certificate its metadata
+// publishes, the way an identity provider answers a request.
+type samlTestIdp struct {
+	key         *rsa.PrivateKey
+	certificate *x509.Certificate
+}
+
+// samlTestResponse changes a valid response to the request for nonce-1, which
+// is issued now for this service and signed by the identity provider.
+type samlTestResponse struct {
+	inResponseTo string
+	audience     string
+	issuedAt     time.Time
+	validFor     time.Duration
+	signWith     *rsa.PrivateKey
+	unsigned     bool
+	tamper       bool
+}
+
+func newSamlTestIdp(t *testing.T) *samlTestIdp {
+	t.Helper()
+
+	key := newTestRSAKey(t)
+	return &samlTestIdp{key: key, certificate: newTestCertificate(t, key)}
+}
+
+func (idp *samlTestIdp) metadata(t *testing.T) []byte {
+	t.Helper()
+
+	entity := saml.EntityDescriptor{
+		EntityID: samlTestIdpEntityId,
+		IDPSSODescriptors: []saml.IDPSSODescriptor{{
+			SSODescriptor: saml.SSODescriptor{
+				RoleDescriptor: saml.RoleDescriptor{
+					ProtocolSupportEnumeration: "urn:oasis:names:tc:SAML:2.0:protocol",
+					KeyDescriptors: []saml.KeyDescriptor{{
+						Use: "signing",
+						KeyInfo: saml.KeyInfo{X509Data: saml.X509Data{
+							X509Certificates: []saml.X509Certificate{{Data: base64.StdEncoding.EncodeToString(idp.certificate.Raw)}},
+						}},
+					}},
+				},
+			},
+			SingleSignOnServices: []saml.Endpoint{{Binding: saml.HTTPRedirectBinding, Location: "https://idp.example.com/sso"}},
+		}},
+	}
+
+	metadata, err := xml.Marshal(entity)
+	if err != nil {
+		t.Fatalf("marshalling metadata: %v", err)
+	}
+
+	return metadata
+}
+
+// respond returns the base64 encoded response, as the browser posts it.
+func (idp *samlTestIdp) respond(t *testing.T, r samlTestResponse) string {
+	t.Helper()
+
+	if len(r.inResponseTo) == 0 {
+		r.inResponseTo = samlRequestId("nonce-1")
+	}
+	if len(r.audience) == 0 {
+		r.audience = samlTestEntityId
+	}
+	if r.issuedAt.IsZero() {
+		r.issuedAt = time.Now()
+	}
+	if r.validFor == 0 {
+		r.validFor = 5 * time.Minute
+	}
+	if r.signWith == nil {
+		r.signWith = idp.key
+	}
+
+	issuer := saml.Issuer{Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity", Value: samlTestIdpEntityId}
+	assertion := &saml.Assertion{
+		ID:           "id-assertion-1",
+		IssueInstant: r.issuedAt,
+		Version:      "2.0",
+		Issuer:       issuer,
+		Subject: &saml.Subject{
+			NameID: &saml.NameID{Format: string(saml.PersistentNameIDFormat), Value: "subject-1"},
+			SubjectConfirmations: []saml.SubjectConfirmation{{
+				Method: "urn:oasis:names:tc:SAML:2.0:cm:bearer",
+				SubjectConfirmationData: &saml.SubjectConfirmationData{
+					InResponseTo: r.inResponseTo,
+					NotOnOrAfter: r.issuedAt.Add(r.validFor),
+					Recipient:    samlTestAcsUrl,
+				},
+			}},
+		},
+		Conditions: &saml.Conditions{
+			NotBefore:            r.issuedAt.Add(-time.Minute),
+			NotOnOrAfter:         r.issuedAt.Add(r.validFor),
+			AudienceRestrictions: []saml.AudienceRestriction{{Audience: saml.Audience{Value: r.audience}}},
+		},
+		AttributeStatements: []saml.AttributeStatement{{
+			Attributes: []saml.Attribute{{
+				Name:   "email",
+				Values: []saml.AttributeValue{{Type: "xs:string", Value: "alice@example.com"}},
+			}},
+		}},
+	}
+
+	assertionEl := assertion.Element()
+	if !r.unsigned {
+		signingContext := dsig.NewDefaultSigningContext(dsig.TLSCertKeyStore(tls.Certificate{
+			Certificate: [][]byte{idp.certificate.Raw},
+			PrivateKey:  r.signWith,
+			Leaf:        idp.certificate,
+		}))
+		if err := signingContext.SetSignatureMethod(dsig.RSASHA256SignatureMethod); err != nil {
+			t.Fatalf("setting the signature method: %v", err)
+		}
+		// the assertion is signed on its own and verified inside the response
+		signingContext.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+
+		signed, err := signingContext.SignEnveloped(assertionEl)
+		if err != nil {
+			t.Fatalf("signing the assertion: %v", err)
+		}
+		assertion.Signature = signed.Child[len(signed.Child)-1].(*etree.Element)
+		assertionEl = assertion.Element()
+	}
+
+	if r.tamper {
+		nameId := assertionEl.FindElement(".//NameID")
+		if nameId == nil {
+			t.Fatal("the assertion has no NameID")
+		}
+		nameId.SetText("subject-2")
+	}
+
+	response := &saml.Response{
+		ID:           "id-response-1",
+		InResponseTo: r.inResponseTo,
+		IssueInstant: r.issuedAt,
+		Version:      "2.0",
+		Destination:  samlTestAcsUrl,
+		Issuer:       &issuer,
+		Status:       saml.Status{StatusCode: saml.StatusCode{Value: saml.StatusSuccess}},
+	}
+	responseEl := response.Element()
+	responseEl.AddChild(assertionEl)
+
+	doc := etree.NewDocument()
+	doc.SetRoot(responseEl)
+	out, err := doc.WriteToBytes()
+	if err != nil {
+		t.Fatalf("writing the response: %v", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(out)
+}
+
+func newTestSamlProvider(t *testing.T, idp *samlTestIdp) federatedProvider {
+	t.Helper()
+
+	key := newTestRSAKey(t)
+	return newFederatedProvider(config.FederatedProviderConfig{
+		Type:        config.FederatedProviderSaml,
+		IdpMetadata: idp.metadata(t),
+		EntityId:    samlTestEntityId,
+		Attributes:  config.FederatedAttributes{EmailAddress: "email"},
+	}, &config.FederationConfig{SamlKey: key, SamlCertificate: newTestCertificate(t, key)})
+}
+
+func TestSamlAuthCodeURL(t *testing.T) {
+	provider := newTestSamlProvider(t, newSamlTestIdp(t))
+
+	authUrl, err := provider.authCodeURL(context.Background(), samlTestAcsUrl, "state-1", "nonce-1", "")
+	if err != nil {
+		t.Fatalf("authCodeURL() error = %v", err)
+	}
+
+	u, err := url.Parse(authUrl)
+	if err != nil {
+		t.Fatalf("invalid authorization url %q: %v", authUrl, err)
+	}
+
+	// the state comes back as the RelayState and the nonce as InResponseTo
+	if got := u.Query().Get("RelayState"); got != "state-1" {
+		t.Errorf("RelayState = %q, want %q", got, "state-1")
+	}
+
+	deflated, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatalf("SAMLRequest is not base64 encoded: %v", err)
+	}
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatalf("SAMLRequest is not deflated: %v", err)
+	}
+
+	var request saml.AuthnRequest
+	if err := xml.Unmarshal(data, &request); err != nil {
+		t.Fatalf("invalid SAMLRequest: %v", err)
+	}
+	if request.ID != samlRequestId("nonce-1") {
+		t.Errorf("request ID = %q, want %q", request.ID, samlRequestId("nonce-1"))
+	}
+}
+
+func TestSamlExchange(t *testing.T) {
+	otherKey := newTestRSAKey(t)
+
+	tests := []struct {
+		name     string
+		response samlTestResponse
+		nonce    string
+		wantErr  bool
+	}{
+		{name: "valid response"},
+		{name: "unsigned assertion", response: samlTestResponse{unsigned: true}, wantErr: true},
+		{name: "assertion signed with another key", response: samlTestResponse{signWith: otherKey}, wantErr: true},
+		{name: "assertion changed after signing", response: samlTestResponse{tamper: true}, wantErr: true},
+		{name: "assertion for another service", response: samlTestResponse{audience: "https://other.example.com"}, wantErr: true},
+		{name: "response to another request", response: samlTestResponse{inResponseTo: samlRequestId("nonce-2")}, wantErr: true},
+		{name: "nonce of another login", nonce: "nonce-2", wantErr: true},
+		{name: "response issued an hour ago", response: samlTestResponse{issuedAt: time.Now().Add(-time.Hour)}, wantErr: true},
+		{name: "expired assertion", response: samlTestResponse{validFor: -10 * time.Minute}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newSamlTestIdp(t)
+			provider := newTestSamlProvider(t, idp)
+
+			nonce := "nonce-1"
+			if len(tt.nonce) > 0 {
+				nonce = tt.nonce
+			}
+
+			identity, err := provider.exchange(context.Background(), samlTestAcsUrl, idp.respond(t, tt.response), nonce, "")
+			if tt.wantErr {
+				if !errors.Is(err, ErrFederatedLoginFailed) {
+					t.Fatalf("exchange() error = %v, want %v", err, ErrFederatedLoginFailed)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("exchange() error = %v", err)
+			}
+			if identity.Subject != "subject-1" || identity.EmailAddress != "alice@example.com" {
+				t.Errorf("exchange() = %+v, want subject-1 with alice@example.com", identity)
+			}
+		})
+	}
+}
+
+func newTestCertificate(t *testing.T, key *rsa.PrivateKey) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "auth-service-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing certificate: %v", err)
+	}
+
+	return certificate
+}
@@ -0,0 +1,420 @@
+package services
+
+import (
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SCIM groups are claims, and group members the users holding the claim.
+// Claims are roles shared by every organization, and the SCIM token is bound
+// to one, so groups cannot be created, renamed or deleted through SCIM, only
+// their members changed. Membership changes go through the user claim service
+// so they are audited and the last administrator cannot be removed.
+
+var errScimGroupShared = newScimError(http.StatusForbidden, "", "groups are roles shared by every organization, so only their members can be changed")
+
+func (s *ScimService) GetGroup(ctx context.Context, id string) (dtos.ScimGroupDto, error) {
+	claim, err := s.getClaim(id)
+	if err != nil {
+		return dtos.ScimGroupDto{}, err
+	}
+
+	members, err := s.scimRepo.GetMembers(tenantScope(ctx), []uint{claim.ID})
+	if err != nil {
+		return dtos.ScimGroupDto{}, err
+	}
+
+	return s.newScimGroup(claim, members[claim.ID]), nil
+}
+
+func (s *ScimService) ListGroups(ctx context.Context, query dtos.ScimListQueryDto) (dtos.ScimListResponseDto, error) {
+	listQuery, err := newScimListQuery(query)
+	if err != nil {
+		return dtos.ScimListResponseDto{}, err
+	}
+
+	claims, total, err := s.scimRepo.ListGroups(listQuery)
+	if err != nil {
+		return dtos.ScimListResponseDto{}, scimQueryError(err)
+	}
+
+	members := map[uint][]domain.User{}
+	excludeMembers := isScimAttributeExcluded(query, "members")
+	if !excludeMembers {
+		claimIds := make([]uint, 0, len(claims))
+		for _, claim := range claims {
+			claimIds = append(claimIds, claim.ID)
+		}
+
+		if members, err = s.scimRepo.GetMembers(tenantScope(ctx), claimIds); err != nil {
+			return dtos.ScimListResponseDto{}, err
+		}
+	}
+
+	resources := make([]dtos.ScimGroupDto, 0, len(claims))
+	for _, claim := range claims {
+		group := s.newScimGroup(claim, members[claim.ID])
+		if excludeMembers {
+			// the version covers the members, so it cannot be given without them
+			group.Meta.Version = ""
+		}
+		resources = append(resources, group)
+	}
+
+	return newScimListResponse(listQuery, total, len(resources), resources), nil
+}
+
+func (s *ScimService) CreateGroup(ctx context.Context, group dtos.ScimGroupDto) (dtos.ScimGroupDto, error) {
+	return dtos.ScimGroupDto{}, errScimGroupShared
+}
+
+// ReplaceGroup makes the group's members exactly those given.
+func (s *ScimService) ReplaceGroup(ctx context.Context, id string, group dtos.ScimGroupDto, ifMatch string) (dtos.ScimGroupDto, error) {
+	current, err := s.GetGroup(ctx, id)
+	if err != nil {
+		return dtos.ScimGroupDto{}, err
+	}
+
+	if err := checkScimVersion(current.Meta, ifMatch); err != nil {
+		return dtos.ScimGroupDto{}, err
+	}
+
+	if group.Members == nil {
+		group.Members = []dtos.ScimReferenceDto{}
+	}
+
+	return s.saveGroup(ctx, current, group)
+}
+
+func (s *ScimService) PatchGroup(ctx context.Context, id string, patch dtos.ScimPatchDto, ifMatch string) (dtos.ScimGroupDto, error) {
+	current, err := s.GetGroup(ctx, id)
+	if err != nil {
+		return dtos.ScimGroupDto{}, err
+	}
+
+	if err := checkScimVersion(current.Meta, ifMatch); err != nil {
+		return dtos.ScimGroupDto{}, err
+	}
+
+	updated := current
+	updated.Members = append([]dtos.ScimReferenceDto{}, current.Members...)
+
+	for _, operation := range patch.Operations {
+		if err := applyScimGroupOperation(&updated, operation); err != nil {
+			return dtos.ScimGroupDto{}, err
+		}
+	}
+
+	return s.saveGroup(ctx, current, updated)
+}
+
+func (s *ScimService) DeleteGroup(ctx context.Context, id string, ifMatch string) error {
+	return errScimGroupShared
+}
+
+func (s *ScimService) saveGroup(ctx context.Context, current, updated dtos.ScimGroupDto) (dtos.ScimGroupDto, error) {
+	claim, err := s.getClaim(current.Id)
+	if err != nil {
+		return dtos.ScimGroupDto{}, err
+	}
+
+	if err := checkScimGroupUnchanged(current, updated); err != nil {
+		return dtos.ScimGroupDto{}, err
+	}
+
+	memberIds, err := parseScimMemberIds(updated.Members)
+	if err != nil {
+		return dtos.ScimGroupDto{}, err
+	}
+
+	currentIds, err := parseScimMemberIds(current.Members)
+	if err != nil {
+		return dtos.ScimGroupDto{}, err
+	}
+
+	added, removed := idsNotIn(memberIds, currentIds), idsNotIn(currentIds, memberIds)
+	if err := s.checkMembersExist(ctx, added); err != nil {
+		return dtos.ScimGroupDto{}, err
+	}
+
+	if err := s.updateMembers(ctx, claim, added, removed); err != nil {
+		return dtos.ScimGroupDto{}, err
+	}
+
+	return s.GetGroup(ctx, current.Id)
+}
+
+// checkScimGroupUnchanged refuses changes to anything but the members, which
+// would change the role for every organization.
+func checkScimGroupUnchanged(current, updated dtos.ScimGroupDto) error {
+	if strings.TrimSpace(updated.DisplayName) != current.DisplayName || updated.ExternalId != current.ExternalId {
+		return errScimGroupShared
+	}
+
+	return nil
+}
+
+func (s *ScimService) updateMembers(ctx context.Context, claim domain.Claim, add, remove []uint) error {
+	for _, userId := range remove {
+		if err := s.userClaimService.RevokeClaim(ctx, userId, claim.Claim); err != nil {
+			if errors.Is(err, ErrLastAdministrator) {
+				return newScimError(http.StatusConflict, "", "%v", err)
+			}
+			return err
+		}
+	}
+
+	for _, userId := range add {
+		if err := s.userClaimService.GrantClaim(ctx, userId, claim.Claim); err != nil {
+			if errors.Is(err, ErrUserNotFound) {
+				return newScimError(http.StatusBadRequest, "invalidValue", "member %d does not exist", userId)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseScimMemberIds returns the distinct user ids of the members.
+func parseScimMemberIds(members []dtos.ScimReferenceDto) ([]uint, error) {
+	ids := make([]uint, 0, len(members))
+	seen := map[uint]bool{}
+
+	for _, member := range members {
+		id, err := strconv.ParseUint(member.Value, 10, 0)
+		if err != nil {
+			return nil, newScimError(http.StatusBadRequest, "invalidValue", "member %q does not exist", member.Value)
+		}
+
+		if !seen[uint(id)] {
+			seen[uint(id)] = true
+			ids = append(ids, uint(id))
+		}
+	}
+
+	return ids, nil
+}
+
+// checkMembersExist is called before anything is changed, so a request naming
+// an unknown user is rejected as a whole.
+func (s *ScimService) checkMembersExist(ctx context.Context, userIds []uint) error {
+	for _, userId := range userIds {
+		if _, err := s.getUser(ctx, strconv.FormatUint(uint64(userId), 10)); err != nil {
+			if errors.Is(err, errScimNotFound) {
+				return newScimError(http.StatusBadRequest, "invalidValue", "member %d does not exist", userId)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ScimService) getClaim(id string) (domain.Claim, error) {
+	claimId, err := strconv.ParseUint(id, 10, 0)
+	if err != nil {
+		return domain.Claim{}, errScimNotFound
+	}
+
+	claim, err := s.scimRepo.GetClaimById(uint(claimId))
+	if err != nil {
+		return domain.Claim{}, notFoundOr(err, errScimNotFound)
+	}
+
+	return claim, nil
+}
+
+func (s *ScimService) newScimGroup(claim domain.Claim, members []domain.User) dtos.ScimGroupDto {
+	id := strconv.FormatUint(uint64(claim.ID), 10)
+
+	group := dtos.ScimGroupDto{
+		Schemas:     []string{dtos.ScimGroupSchema},
+		Id:          id,
+		ExternalId:  claim.ExternalId,
+		DisplayName: claim.Claim,
+	}
+
+	for _, member := range members {
+		memberId := strconv.FormatUint(uint64(member.ID), 10)
+		group.Members = append(group.Members, dtos.ScimReferenceDto{
+			Value:   memberId,
+			Ref:     s.location("Users", memberId),
+			Display: member.Username,
+		})
+	}
+
+	created, lastModified := claim.CreatedAt, claim.UpdatedAt
+	group.Meta = &dtos.ScimMetaDto{
+		ResourceType: "Group",
+		Created:      &created,
+		LastModified: &lastModified,
+		Location:     s.location("Groups", id),
+		Version:      scimVersion(group),
+	}
+
+	return group
+}
+
+func applyScimGroupOperation(group *dtos.ScimGroupDto, operation dtos.ScimPatchOperationDto) error {
+	op := strings.ToLower(operation.Op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return newScimError(http.StatusBadRequest, "invalidSyntax", "unknown operation %q", operation.Op)
+	}
+
+	if len(operation.Path) == 0 {
+		if op == "remove" {
+			return newScimError(http.StatusBadRequest, "noTarget", "remove needs a path")
+		}
+
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(operation.Value, &values); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "the value of an operation without a path must be an object")
+		}
+
+		for attribute, value := range values {
+			if err := setScimGroupAttribute(group, op, helpers.NormalizeScimPath(attribute), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	path, err := helpers.ParseScimPath(operation.Path)
+	if err != nil {
+		return newScimError(http.StatusBadRequest, "invalidPath", "%v", err)
+	}
+
+	if op != "remove" {
+		if path.Filter != nil {
+			return newScimError(http.StatusBadRequest, "invalidPath", "a filtered path can only be removed")
+		}
+		return setScimGroupAttribute(group, op, path.Attribute, operation.Value)
+	}
+
+	switch path.Attribute {
+	case "externalid":
+		group.ExternalId = ""
+		return nil
+	case "members":
+		return removeScimGroupMembers(group, path.Filter, operation.Value)
+	case "displayname":
+		return newScimError(http.StatusBadRequest, "mutability", "displayName cannot be removed")
+	}
+
+	return newScimError(http.StatusBadRequest, "invalidPath", "%s cannot be removed", path.Attribute)
+}
+
+func setScimGroupAttribute(group *dtos.ScimGroupDto, op, attribute string, value json.RawMessage) error {
+	switch attribute {
+	case "displayname":
+		return decodeScimValue(attribute, value, &group.DisplayName)
+	case "externalid":
+		return decodeScimValue(attribute, value, &group.ExternalId)
+	case "members":
+		var members []dtos.ScimReferenceDto
+		if err := json.Unmarshal(value, &members); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "members must be a list of members")
+		}
+
+		if op == "replace" {
+			group.Members = members
+		} else {
+			group.Members = append(group.Members, members...)
+		}
+		return nil
+	case "id", "meta", "schemas":
+		return newScimError(http.StatusBadRequest, "mutability", "%s cannot be changed", attribute)
+	}
+
+	return newScimError(http.StatusBadRequest, "invalidPath", "unknown attribute %s", attribute)
+}
+
+// removeScimGroupMembers removes the members matching a members[value eq "x"]
+// filter, those listed in the value, or every member when there is neither.
+func removeScimGroupMembers(group *dtos.ScimGroupDto, filter helpers.ScimFilter, value json.RawMessage) error {
+	remove := map[string]bool{}
+
+	switch {
+	case filter != nil:
+		values, ok := scimMemberFilterValues(filter)
+		if !ok {
+			return newScimError(http.StatusBadRequest, "invalidFilter", `members can only be removed with value eq "id" filters`)
+		}
+		for _, v := range values {
+			remove[v] = true
+		}
+	case len(value) > 0 && string(value) != "null":
+		var members []dtos.ScimReferenceDto
+		if err := json.Unmarshal(value, &members); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "members must be a list of members")
+		}
+		for _, member := range members {
+			remove[member.Value] = true
+		}
+	default:
+		group.Members = []dtos.ScimReferenceDto{}
+		return nil
+	}
+
+	kept := []dtos.ScimReferenceDto{}
+	for _, member := range group.Members {
+		if !remove[member.Value] {
+			kept = append(kept, member)
+		}
+	}
+	group.Members = kept
+
+	return nil
+}
+
+// scimMemberFilterValues returns the ids of a filter made only of
+// value eq "id" comparisons joined with or.
+func scimMemberFilterValues(filter helpers.ScimFilter) ([]string, bool) {
+	switch f := filter.(type) {
+	case helpers.ScimCompareFilter:
+		value, ok := f.Value.(string)
+		if f.Attribute != "members.value" || f.Operator != "eq" || !ok {
+			return nil, false
+		}
+		return []string{value}, true
+	case helpers.ScimLogicalFilter:
+		if f.Operator != "or" {
+			return nil, false
+		}
+
+		left, ok := scimMemberFilterValues(f.Left)
+		if !ok {
+			return nil, false
+		}
+
+		right, ok := scimMemberFilterValues(f.Right)
+		return append(left, right...), ok
+	}
+
+	return nil, false
+}
+
+// idsNotIn returns the ids in from that are not in to.
+func idsNotIn(from, to []uint) []uint {
+	keep := map[uint]bool{}
+	for _, id := range to {
+		keep[id] = true
+	}
+
+	removed := []uint{}
+	for _, id := range from {
+		if !keep[id] {
+			removed = append(removed, id)
+		}
+	}
+
+	return removed
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"authservice/src/dtos"
+	"authservice/src/repositories"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func newScimOrganizationContext() context.Context {
+	organizationId := uint(5)
+	return withTenantScope(context.Background(), repositories.InTenant(&organizationId))
+}
+
+func TestScimGroupsCannotBeCreatedOrDeleted(t *testing.T) {
+	s := &ScimService{}
+	ctx := newScimOrganizationContext()
+
+	_, err := s.CreateGroup(ctx, dtos.ScimGroupDto{DisplayName: "Auditor"})
+	checkScimStatus(t, "CreateGroup()", err, http.StatusForbidden)
+
+	err = s.DeleteGroup(ctx, "1", "")
+	checkScimStatus(t, "DeleteGroup()", err, http.StatusForbidden)
+}
+
+func TestScimGroupChanges(t *testing.T) {
+	current := dtos.ScimGroupDto{
+		Id:          "3",
+		DisplayName: "Auditor",
+		ExternalId:  "okta-auditors",
+		Members:     []dtos.ScimReferenceDto{{Value: "1"}},
+	}
+
+	tests := []struct {
+		name       string
+		operation  dtos.ScimPatchOperationDto
+		wantStatus int
+	}{
+		{
+			name:      "add a member",
+			operation: dtos.ScimPatchOperationDto{Op: "add", Path: "members", Value: json.RawMessage(`[{"value":"2"}]`)},
+		},
+		{
+			name:      "remove a member",
+			operation: dtos.ScimPatchOperationDto{Op: "remove", Path: `members[value eq "1"]`},
+		},
+		{
+			name:      "same name",
+			operation: dtos.ScimPatchOperationDto{Op: "replace", Path: "displayName", Value: json.RawMessage(`" Auditor "`)},
+		},
+		{
+			name:       "rename",
+			operation:  dtos.ScimPatchOperationDto{Op: "replace", Path: "displayName", Value: json.RawMessage(`"Administrator"`)},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "rename without a path",
+			operation:  dtos.ScimPatchOperationDto{Op: "replace", Value: json.RawMessage(`{"displayName":"Auditors"}`)},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "change the external id",
+			operation:  dtos.ScimPatchOperationDto{Op: "replace", Path: "externalId", Value: json.RawMessage(`"other"`)},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := current
+			updated.Members = append([]dtos.ScimReferenceDto{}, current.Members...)
+
+			if err := applyScimGroupOperation(&updated, tt.operation); err != nil {
+				t.Fatalf("applyScimGroupOperation() error = %v", err)
+			}
+
+			err := checkScimGroupUnchanged(current, updated)
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Errorf("checkScimGroupUnchanged() error = %v, want nil", err)
+				}
+				return
+			}
+			checkScimStatus(t, "checkScimGroupUnchanged()", err, tt.wantStatus)
+		})
+	}
+}
+
+func checkScimStatus(t *testing.T, call string, err error, want int) {
+	t.Helper()
+
+	var scimErr *ScimError
+	if !errors.As(err, &scimErr) || scimErr.Status != want {
+		t.Errorf("%s error = %v, want a SCIM error with status %d", call, err, want)
+	}
+}
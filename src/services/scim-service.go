@@ -0,0 +1,710 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/repositories"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultScimCount = 100
+	maxScimCount     = 1000
+
+	// recorded as the actor of status changes made by provisioning clients
+	scimActor        = "scim:provisioning"
+	scimDeactivation = "deactivated by SCIM provisioning"
+	scimReactivation = "reactivated by SCIM provisioning"
+)
+
+// ScimError carries the HTTP status and, where RFC 7644 defines one, the
+// scimType a SCIM client expects.
+type ScimError struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *ScimError) Error() string {
+	return e.Detail
+}
+
+func newScimError(status int, scimType, format string, a ...interface{}) *ScimError {
+	return &ScimError{Status: status, ScimType: scimType, Detail: fmt.Sprintf(format, a...)}
+}
+
+var errScimNotFound = newScimError(http.StatusNotFound, "", "resource not found")
+
+type ScimService struct {
+	scimRepo         *repositories.ScimRepository
+	organizationRepo *repositories.OrganizationRepository
+	userRepo         *repositories.UserRepository
+	userClaimRepo    *repositories.UserClaimRepository
+	userService      *UserService
+	userClaimService *UserClaimService
+	emailService     *EmailService
+	auditService     *AuditService
+	organization     string
+	baseUrl          string
+	logger           *zap.SugaredLogger
+}
+
+func InitScimService(serviceCfg *config.ServiceConfig) *ScimService {
+	return &ScimService{
+		scimRepo:         repositories.InitScimRepository(serviceCfg),
+		organizationRepo: repositories.InitOrganizationRepository(serviceCfg),
+		userRepo:         repositories.InitUserRepositoy(serviceCfg),
+		userClaimRepo:    repositories.InitUserClaimRepository(serviceCfg),
+		userService:      InitUserService(serviceCfg),
+		userClaimService: InitUserClaimService(serviceCfg),
+		emailService:     InitEmailService(),
+		auditService:     InitAuditService(serviceCfg),
+		organization:     serviceCfg.ScimOrganization,
+		baseUrl:          serviceCfg.ScimBaseUrl,
+		logger:           serviceCfg.Logger,
+	}
+}
+
+// WithOrganization confines the request to the users of the organization the
+// SCIM token is bound to. Users the client creates join it.
+func (s *ScimService) WithOrganization(ctx context.Context) (context.Context, error) {
+	organization, err := s.organizationRepo.GetBySlug(s.organization)
+	if err != nil {
+		s.logger.Errorf("error locating SCIM organization %s with error %v", s.organization, err)
+		return ctx, err
+	}
+
+	return withTenantScope(ctx, repositories.InTenant(&organization.ID)), nil
+}
+
+func (s *ScimService) GetUser(ctx context.Context, id string) (dtos.ScimUserDto, error) {
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return dtos.ScimUserDto{}, err
+	}
+
+	claims, err := s.userClaimRepo.GetClaimsByUserIds([]uint{user.ID})
+	if err != nil {
+		return dtos.ScimUserDto{}, err
+	}
+
+	return s.newScimUser(user, claims[user.ID]), nil
+}
+
+func (s *ScimService) ListUsers(ctx context.Context, query dtos.ScimListQueryDto) (dtos.ScimListResponseDto, error) {
+	listQuery, err := newScimListQuery(query)
+	if err != nil {
+		return dtos.ScimListResponseDto{}, err
+	}
+
+	users, total, err := s.scimRepo.ListUsers(tenantScope(ctx), listQuery)
+	if err != nil {
+		return dtos.ScimListResponseDto{}, scimQueryError(err)
+	}
+
+	claims := map[uint][]domain.Claim{}
+	excludeGroups := isScimAttributeExcluded(query, "groups")
+	if !excludeGroups {
+		userIds := make([]uint, 0, len(users))
+		for _, user := range users {
+			userIds = append(userIds, user.ID)
+		}
+
+		if claims, err = s.userClaimRepo.GetClaimsByUserIds(userIds); err != nil {
+			return dtos.ScimListResponseDto{}, err
+		}
+	}
+
+	resources := make([]dtos.ScimUserDto, 0, len(users))
+	for _, user := range users {
+		scimUser := s.newScimUser(user, claims[user.ID])
+		if excludeGroups {
+			// the version covers the groups, so it cannot be given without them
+			scimUser.Meta.Version = ""
+		}
+		resources = append(resources, scimUser)
+	}
+
+	return newScimListResponse(listQuery, total, len(resources), resources), nil
+}
+
+// CreateUser provisions a new user with the default claim. Users created
+// without a password are given a random one nobody knows, so they cannot sign
+// in with a password until it is reset.
+func (s *ScimService) CreateUser(ctx context.Context, scimUser dtos.ScimUserDto) (dtos.ScimUserDto, error) {
+	user := domain.User{
+		Username:     strings.TrimSpace(scimUser.UserName),
+		EmailAddress: primaryScimEmail(scimUser.Emails),
+		ExternalId:   scimUser.ExternalId,
+		Password:     scimUser.Password,
+	}
+
+	if scimUser.Name != nil {
+		user.FirstName = scimUser.Name.GivenName
+		user.Surname = scimUser.Name.FamilyName
+	}
+
+	if err := s.validateScimUser(user, user.Password); err != nil {
+		return dtos.ScimUserDto{}, err
+	}
+
+	if len(user.Password) == 0 {
+		random, err := helpers.GenerateRandomToken(24)
+		if err != nil {
+			return dtos.ScimUserDto{}, err
+		}
+		user.Password = "Scim-" + random
+	}
+
+	user, err := s.userService.AddUser(ctx, user, false)
+	if err != nil {
+		return dtos.ScimUserDto{}, err
+	}
+
+	if scimUser.Active != nil && !*scimUser.Active {
+		if err := s.userService.SuspendUser(ctx, user.ID, scimDeactivation, scimActor); err != nil {
+			return dtos.ScimUserDto{}, err
+		}
+	}
+
+	s.logger.Infof("user %s provisioned through SCIM", user.Username)
+	return s.GetUser(ctx, strconv.FormatUint(uint64(user.ID), 10))
+}
+
+// ReplaceUser applies a full representation of the user. Attributes missing
+// from it are cleared, except active and password which are left alone.
+func (s *ScimService) ReplaceUser(ctx context.Context, id string, scimUser dtos.ScimUserDto, ifMatch string) (dtos.ScimUserDto, error) {
+	current, err := s.GetUser(ctx, id)
+	if err != nil {
+		return dtos.ScimUserDto{}, err
+	}
+
+	if err := checkScimVersion(current.Meta, ifMatch); err != nil {
+		return dtos.ScimUserDto{}, err
+	}
+
+	if scimUser.Active == nil {
+		scimUser.Active = current.Active
+	}
+
+	return s.saveUser(ctx, current, scimUser)
+}
+
+func (s *ScimService) PatchUser(ctx context.Context, id string, patch dtos.ScimPatchDto, ifMatch string) (dtos.ScimUserDto, error) {
+	current, err := s.GetUser(ctx, id)
+	if err != nil {
+		return dtos.ScimUserDto{}, err
+	}
+
+	if err := checkScimVersion(current.Meta, ifMatch); err != nil {
+		return dtos.ScimUserDto{}, err
+	}
+
+	updated := current
+	if current.Name != nil {
+		name := *current.Name
+		updated.Name = &name
+	}
+
+	for _, operation := range patch.Operations {
+		if err := applyScimUserOperation(&updated, operation); err != nil {
+			return dtos.ScimUserDto{}, err
+		}
+	}
+
+	return s.saveUser(ctx, current, updated)
+}
+
+// DeleteUser soft-deletes the user, so it can still be restored by an
+// administrator within the retention period.
+func (s *ScimService) DeleteUser(ctx context.Context, id string, ifMatch string) error {
+	current, err := s.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := checkScimVersion(current.Meta, ifMatch); err != nil {
+		return err
+	}
+
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userService.DeleteUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	s.logger.Infof("user %s deprovisioned through SCIM", user.Username)
+	return nil
+}
+
+// saveUser writes whatever differs between the current and updated
+// representations in one transaction, so a failure part way leaves the user
+// as it was. The usual audit events and domain events are recorded.
+func (s *ScimService) saveUser(ctx context.Context, current, updated dtos.ScimUserDto) (dtos.ScimUserDto, error) {
+	user, err := s.getUser(ctx, current.Id)
+	if err != nil {
+		return dtos.ScimUserDto{}, err
+	}
+
+	changed := user
+	changed.Username = strings.TrimSpace(updated.UserName)
+	changed.EmailAddress = primaryScimEmail(updated.Emails)
+	changed.ExternalId = updated.ExternalId
+	changed.FirstName, changed.Surname = "", ""
+	if updated.Name != nil {
+		changed.FirstName = updated.Name.GivenName
+		changed.Surname = updated.Name.FamilyName
+	}
+
+	if err := s.validateScimUser(changed, updated.Password); err != nil {
+		return dtos.ScimUserDto{}, err
+	}
+
+	changes := repositories.UserChanges{}
+	if changed.Username != user.Username || changed.EmailAddress != user.EmailAddress ||
+		changed.FirstName != user.FirstName || changed.Surname != user.Surname || changed.ExternalId != user.ExternalId {
+		changes.Details = &changed
+	}
+
+	if len(updated.Password) > 0 {
+		if changes.Password, err = s.userService.newPasswordChange(user, updated.Password); err != nil {
+			return dtos.ScimUserDto{}, err
+		}
+	}
+
+	if updated.Active != nil && current.Active != nil && *updated.Active != *current.Active {
+		if *updated.Active {
+			if user.Status != domain.AccountStatusActive {
+				changes.Status = &repositories.StatusChange{Status: domain.AccountStatusActive, Reason: scimReactivation, Actor: scimActor}
+			}
+		} else {
+			changes.Status = &repositories.StatusChange{Status: domain.AccountStatusSuspended, Reason: scimDeactivation, Actor: scimActor, RevokeTokens: true}
+		}
+	}
+
+	if changes.Details == nil && changes.Password == nil && changes.Status == nil {
+		return current, nil
+	}
+
+	if err := s.userRepo.ApplyChanges(user.ID, changes); err != nil {
+		return dtos.ScimUserDto{}, err
+	}
+
+	s.recordChanges(ctx, user, changes)
+	return s.GetUser(ctx, current.Id)
+}
+
+// recordChanges audits what saveUser changed once it is committed.
+func (s *ScimService) recordChanges(ctx context.Context, user domain.User, changes repositories.UserChanges) {
+	target := userTarget(user.ID)
+
+	if changes.Details != nil {
+		s.auditService.Record(ctx, domain.AuditEvent{
+			EventType:    domain.AuditUserDetailsUpdated,
+			TargetUserId: target,
+		}, map[string]interface{}{"by": scimActor})
+	}
+
+	if changes.Password != nil {
+		s.auditService.Record(ctx, domain.AuditEvent{
+			EventType:    domain.AuditUserPasswordChanged,
+			TargetUserId: target,
+		}, map[string]interface{}{"reset_by": scimActor})
+		s.logger.Infof("password for user %s reset by %s", user.Username, scimActor)
+	}
+
+	switch {
+	case changes.Status == nil:
+	case changes.Status.Status == domain.AccountStatusActive:
+		s.auditService.Record(ctx, domain.AuditEvent{
+			EventType:    domain.AuditUserReactivated,
+			TargetUserId: target,
+		}, map[string]interface{}{"reason": scimReactivation, "previous_status": user.Status})
+		s.logger.Infof("user %s reactivated by %s: %s", user.Username, scimActor, scimReactivation)
+	default:
+		s.auditService.Record(ctx, domain.AuditEvent{
+			EventType:    domain.AuditUserSuspended,
+			TargetUserId: target,
+		}, map[string]interface{}{"reason": scimDeactivation})
+		s.logger.Infof("user %s suspended by %s: %s", user.Username, scimActor, scimDeactivation)
+	}
+}
+
+// validateScimUser checks the user, and any new password, before anything is
+// written so a rejected request changes nothing.
+func (s *ScimService) validateScimUser(user domain.User, password string) error {
+	if len(user.Username) == 0 {
+		return newScimError(http.StatusBadRequest, "invalidValue", "userName must be supplied")
+	}
+
+	if !s.emailService.ValidateEmail(user.EmailAddress) {
+		return newScimError(http.StatusBadRequest, "invalidValue", "a valid email address must be supplied")
+	}
+
+	if len(password) > 0 {
+		if err := helpers.InitPasswordHelper(password).ValidateComplexity(); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "%v", err)
+		}
+	}
+
+	conflict, err := s.userRepo.HasActiveConflict(user)
+	if err != nil {
+		return err
+	}
+
+	if conflict {
+		return newScimError(http.StatusConflict, "uniqueness", "the userName or email address is already in use")
+	}
+
+	return nil
+}
+
+func (s *ScimService) getUser(ctx context.Context, id string) (domain.User, error) {
+	userId, err := strconv.ParseUint(id, 10, 0)
+	if err != nil {
+		return domain.User{}, errScimNotFound
+	}
+
+	user, err := s.userRepo.GetById(tenantScope(ctx), uint(userId))
+	if err != nil {
+		return domain.User{}, notFoundOr(err, errScimNotFound)
+	}
+
+	if user.Status == domain.AccountStatusErased {
+		return domain.User{}, errScimNotFound
+	}
+
+	return user, nil
+}
+
+func (s *ScimService) newScimUser(user domain.User, claims []domain.Claim) dtos.ScimUserDto {
+	id := strconv.FormatUint(uint64(user.ID), 10)
+	active := user.Status == domain.AccountStatusActive
+
+	scimUser := dtos.ScimUserDto{
+		Schemas:    []string{dtos.ScimUserSchema},
+		Id:         id,
+		ExternalId: user.ExternalId,
+		UserName:   user.Username,
+		Emails:     []dtos.ScimEmailDto{{Value: user.EmailAddress, Type: "work", Primary: true}},
+		Active:     &active,
+	}
+
+	if len(user.FirstName) > 0 || len(user.Surname) > 0 {
+		scimUser.Name = &dtos.ScimNameDto{
+			Formatted:  strings.TrimSpace(user.FirstName + " " + user.Surname),
+			GivenName:  user.FirstName,
+			FamilyName: user.Surname,
+		}
+		scimUser.DisplayName = scimUser.Name.Formatted
+	}
+
+	for _, claim := range claims {
+		groupId := strconv.FormatUint(uint64(claim.ID), 10)
+		scimUser.Groups = append(scimUser.Groups, dtos.ScimReferenceDto{
+			Value:   groupId,
+			Ref:     s.location("Groups", groupId),
+			Display: claim.Claim,
+		})
+	}
+
+	created, lastModified := user.CreatedAt, user.UpdatedAt
+	scimUser.Meta = &dtos.ScimMetaDto{
+		ResourceType: "User",
+		Created:      &created,
+		LastModified: &lastModified,
+		Location:     s.location("Users", id),
+		Version:      scimVersion(scimUser),
+	}
+
+	return scimUser
+}
+
+func (s *ScimService) location(resourceType, id string) string {
+	return fmt.Sprintf("%s/%s/%s", s.baseUrl, resourceType, id)
+}
+
+// applyScimUserOperation applies one PATCH operation. Attributes the service
+// does not store, such as enterprise extension attributes, are ignored rather
+// than rejected, as clients commonly send them to every target.
+func applyScimUserOperation(user *dtos.ScimUserDto, operation dtos.ScimPatchOperationDto) error {
+	op := strings.ToLower(operation.Op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return newScimError(http.StatusBadRequest, "invalidSyntax", "unknown operation %q", operation.Op)
+	}
+
+	if len(operation.Path) == 0 {
+		if op == "remove" {
+			return newScimError(http.StatusBadRequest, "noTarget", "remove needs a path")
+		}
+
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(operation.Value, &values); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "the value of an operation without a path must be an object")
+		}
+
+		for attribute, value := range values {
+			if err := setScimUserAttribute(user, helpers.NormalizeScimPath(attribute), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	path, err := helpers.ParseScimPath(operation.Path)
+	if err != nil {
+		return newScimError(http.StatusBadRequest, "invalidPath", "%v", err)
+	}
+
+	attribute := path.Attribute
+	if len(path.SubAttribute) > 0 {
+		attribute += "." + path.SubAttribute
+	}
+
+	if op == "remove" {
+		return removeScimUserAttribute(user, attribute)
+	}
+
+	return setScimUserAttribute(user, attribute, operation.Value)
+}
+
+func setScimUserAttribute(user *dtos.ScimUserDto, attribute string, value json.RawMessage) error {
+	switch attribute {
+	case "username":
+		return decodeScimValue(attribute, value, &user.UserName)
+	case "externalid":
+		return decodeScimValue(attribute, value, &user.ExternalId)
+	case "password":
+		return decodeScimValue(attribute, value, &user.Password)
+	case "active":
+		active, err := decodeScimBool(value)
+		if err != nil {
+			return err
+		}
+		user.Active = &active
+		return nil
+	case "name":
+		var name map[string]json.RawMessage
+		if err := json.Unmarshal(value, &name); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "name must be an object")
+		}
+		for subAttribute, subValue := range name {
+			if err := setScimUserAttribute(user, "name."+strings.ToLower(subAttribute), subValue); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "name.givenname", "name.familyname":
+		if user.Name == nil {
+			user.Name = &dtos.ScimNameDto{}
+		}
+		if attribute == "name.givenname" {
+			return decodeScimValue(attribute, value, &user.Name.GivenName)
+		}
+		return decodeScimValue(attribute, value, &user.Name.FamilyName)
+	case "emails", "emails.value":
+		email, err := decodeScimEmail(value)
+		if err != nil {
+			return err
+		}
+		user.Emails = []dtos.ScimEmailDto{{Value: email, Type: "work", Primary: true}}
+		return nil
+	case "id", "meta", "groups", "schemas":
+		return newScimError(http.StatusBadRequest, "mutability", "%s cannot be changed", attribute)
+	}
+
+	return nil
+}
+
+func removeScimUserAttribute(user *dtos.ScimUserDto, attribute string) error {
+	switch attribute {
+	case "externalid":
+		user.ExternalId = ""
+	case "name":
+		user.Name = nil
+	case "name.givenname", "name.familyname":
+		if user.Name != nil {
+			if attribute == "name.givenname" {
+				user.Name.GivenName = ""
+			} else {
+				user.Name.FamilyName = ""
+			}
+		}
+	case "username", "emails", "emails.value", "active", "password":
+		return newScimError(http.StatusBadRequest, "mutability", "%s cannot be removed", attribute)
+	case "id", "meta", "groups", "schemas":
+		return newScimError(http.StatusBadRequest, "mutability", "%s cannot be changed", attribute)
+	}
+
+	return nil
+}
+
+func decodeScimValue(attribute string, value json.RawMessage, dest *string) error {
+	if err := json.Unmarshal(value, dest); err != nil {
+		return newScimError(http.StatusBadRequest, "invalidValue", "%s must be a string", attribute)
+	}
+
+	return nil
+}
+
+// decodeScimBool also accepts "true" and "false" as strings, in any case, as
+// some clients send booleans that way.
+func decodeScimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+
+	var str string
+	if err := json.Unmarshal(value, &str); err == nil {
+		if b, err := strconv.ParseBool(strings.ToLower(str)); err == nil {
+			return b, nil
+		}
+	}
+
+	return false, newScimError(http.StatusBadRequest, "invalidValue", "active must be true or false")
+}
+
+// decodeScimEmail accepts an address, an email object or a list of email
+// objects, taking the primary address from a list.
+func decodeScimEmail(value json.RawMessage) (string, error) {
+	var email string
+	if err := json.Unmarshal(value, &email); err == nil {
+		return email, nil
+	}
+
+	var single dtos.ScimEmailDto
+	if err := json.Unmarshal(value, &single); err == nil {
+		return single.Value, nil
+	}
+
+	var emails []dtos.ScimEmailDto
+	if err := json.Unmarshal(value, &emails); err == nil && len(emails) > 0 {
+		return primaryScimEmail(emails), nil
+	}
+
+	return "", newScimError(http.StatusBadRequest, "invalidValue", "emails must hold an email address")
+}
+
+// primaryScimEmail returns the primary address, or the first when none is
+// marked primary. Users hold a single address.
+func primaryScimEmail(emails []dtos.ScimEmailDto) string {
+	for _, email := range emails {
+		if email.Primary {
+			return strings.TrimSpace(email.Value)
+		}
+	}
+
+	if len(emails) > 0 {
+		return strings.TrimSpace(emails[0].Value)
+	}
+
+	return ""
+}
+
+// scimVersion is a weak ETag over the representation, so any change to what
+// a client would see, including group membership, changes the version.
+func scimVersion(resource interface{}) string {
+	data, _ := json.Marshal(resource)
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf(`W/"%s"`, hex.EncodeToString(sum[:12]))
+}
+
+// checkScimVersion compares the version against an If-Match header, which may
+// list several versions or be *.
+func checkScimVersion(meta *dtos.ScimMetaDto, ifMatch string) error {
+	if len(ifMatch) == 0 || meta == nil {
+		return nil
+	}
+
+	if ScimVersionMatches(meta.Version, ifMatch) {
+		return nil
+	}
+
+	return newScimError(http.StatusPreconditionFailed, "", "the resource has changed since version %s", ifMatch)
+}
+
+// ScimVersionMatches reports whether the version is one of the comma separated
+// entity tags in an If-Match or If-None-Match header. Weak comparison is used,
+// so W/"x" and "x" match.
+func ScimVersionMatches(version, header string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(version, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newScimListQuery applies the paging defaults and limits and parses the
+// filter.
+func newScimListQuery(query dtos.ScimListQueryDto) (repositories.ScimListQuery, error) {
+	listQuery := repositories.ScimListQuery{
+		SortBy:   helpers.NormalizeScimPath(query.SortBy),
+		SortDesc: query.SortDescending,
+		Limit:    defaultScimCount,
+	}
+
+	if query.StartIndex > 1 {
+		listQuery.Offset = query.StartIndex - 1
+	}
+
+	if query.Count != nil {
+		listQuery.Limit = max(0, min(*query.Count, maxScimCount))
+	}
+
+	if len(query.Filter) > 0 {
+		filter, err := helpers.ParseScimFilter(query.Filter)
+		if err != nil {
+			return listQuery, newScimError(http.StatusBadRequest, "invalidFilter", "%v", err)
+		}
+		listQuery.Filter = filter
+	}
+
+	return listQuery, nil
+}
+
+func scimQueryError(err error) error {
+	if errors.Is(err, helpers.ErrInvalidScimFilter) {
+		return newScimError(http.StatusBadRequest, "invalidFilter", "%v", err)
+	}
+
+	return err
+}
+
+func isScimAttributeExcluded(query dtos.ScimListQueryDto, attribute string) bool {
+	for _, excluded := range query.ExcludedAttributes {
+		if helpers.NormalizeScimPath(excluded) == attribute {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newScimListResponse(query repositories.ScimListQuery, total int64, count int, resources interface{}) dtos.ScimListResponseDto {
+	return dtos.ScimListResponseDto{
+		Schemas:      []string{dtos.ScimListResponseSchema},
+		TotalResults: total,
+		StartIndex:   query.Offset + 1,
+		ItemsPerPage: count,
+		Resources:    resources,
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/repositories"
+	"context"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// ServiceAccountService creates the users scripts and jobs act as. They have
+// no password and cannot sign in, only use the API keys administrators issue
+// them, and are given claims like any other user.
+type ServiceAccountService struct {
+	userRepo      *repositories.UserRepository
+	claimRepo     *repositories.ClaimRepository
+	userClaimRepo *repositories.UserClaimRepository
+	emailService  *EmailService
+	auditService  *AuditService
+	logger        *zap.SugaredLogger
+}
+
+func InitServiceAccountService(serviceCfg *config.ServiceConfig) *ServiceAccountService {
+	return &ServiceAccountService{
+		userRepo:      repositories.InitUserRepositoy(serviceCfg),
+		claimRepo:     repositories.InitClaimRepository(serviceCfg),
+		userClaimRepo: repositories.InitUserClaimRepository(serviceCfg),
+		emailService:  InitEmailService(),
+		auditService:  InitAuditService(serviceCfg),
+		logger:        serviceCfg.Logger,
+	}
+}
+
+// CreateServiceAccount needs an email address, as every user does, which
+// should reach whoever looks after the account.
+func (s *ServiceAccountService) CreateServiceAccount(ctx context.Context, create dtos.ServiceAccountCreateDto) (dtos.UserDto, error) {
+	user := domain.User{
+		Username:       strings.TrimSpace(create.Username),
+		EmailAddress:   strings.TrimSpace(create.EmailAddress),
+		AuthSource:     domain.AuthSourceServiceAccount,
+		OrganizationId: tenantScope(ctx).OrganizationId(),
+	}
+
+	if len(user.Username) == 0 || !s.emailService.ValidateEmail(user.EmailAddress) {
+		return dtos.UserDto{}, ErrInvalidServiceAccount
+	}
+
+	conflict, err := s.userRepo.HasActiveConflict(user)
+	if err != nil {
+		return dtos.UserDto{}, err
+	}
+
+	if conflict {
+		return dtos.UserDto{}, ErrExternalUserConflict
+	}
+
+	user, err = s.userRepo.Add(user)
+	if err != nil {
+		return dtos.UserDto{}, err
+	}
+
+	claim, err := s.claimRepo.GetByName(domain.UserClaimName)
+	if err != nil {
+		s.logger.Errorf("error locating claim %s for user %s with error %v", domain.UserClaimName, user.Username, err)
+		return dtos.UserDto{}, err
+	}
+
+	if err := s.userClaimRepo.Add(domain.UserClaim{UserId: user.ID, ClaimId: claim.ID}); err != nil {
+		s.logger.Errorf("error adding user claim for user %s with error %v", user.Username, err)
+		return dtos.UserDto{}, err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserRegistered,
+		TargetUserId: userTarget(user.ID),
+	}, map[string]interface{}{"claim": domain.UserClaimName, "auth_source": domain.AuthSourceServiceAccount})
+
+	return newUserDto(user), nil
+}
+
+// GetServiceAccount returns ErrNotServiceAccount for users who are not one,
+// so their keys cannot be managed as a service account's.
+func (s *ServiceAccountService) GetServiceAccount(ctx context.Context, userId uint) (dtos.UserDto, error) {
+	user, err := s.userRepo.GetById(tenantScope(ctx), userId)
+	if err != nil {
+		return dtos.UserDto{}, notFoundOr(err, ErrUserNotFound)
+	}
+
+	if user.AuthSource != domain.AuthSourceServiceAccount {
+		return dtos.UserDto{}, ErrNotServiceAccount
+	}
+
+	return newUserDto(user), nil
+}
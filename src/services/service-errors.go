@@ -0,0 +1,70 @@
+package services
+
+import "errors"
+
+var (
+	ErrInvalidListQuery  = errors.New("invalid list query")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrClaimNotFound     = errors.New("claim not found")
+	ErrLastAdministrator = errors.New("the last administrator cannot have the administrator claim revoked")
+
+	ErrAccountSuspended           = errors.New("this account has been suspended")
+	ErrAccountLocked              = errors.New("this account has been locked")
+	ErrAccountPendingVerification = errors.New("this account has not been verified yet")
+	ErrCannotChangeOwnStatus      = errors.New("you cannot change the status of your own account")
+
+	ErrRestoreWindowExpired = errors.New("the user was deleted too long ago to be restored")
+	ErrRestoreConflict      = errors.New("the username or email address has since been taken by another user")
+	ErrAlreadyErased        = errors.New("the user has already been erased")
+	ErrPasswordMismatch     = errors.New("details do not match")
+
+	ErrDirectoryUnavailable      = errors.New("the user directory could not be reached")
+	ErrPasswordManagedExternally = errors.New("the password of this user is managed by their directory")
+	ErrExternalUserConflict      = errors.New("the username or email address is already taken by another user")
+
+	ErrUnknownProvider           = errors.New("unknown identity provider")
+	ErrInvalidFederatedState     = errors.New("the login has expired or was not started here, please try again")
+	ErrFederatedLoginFailed      = errors.New("the identity provider did not confirm the login")
+	ErrFederatedEmailUnverified  = errors.New("the identity provider has not verified the email address")
+	ErrFederatedDomainNotAllowed = errors.New("the email address is not in a domain allowed to sign in")
+	ErrFederatedSignupDisabled   = errors.New("there is no account for this email address")
+	ErrFederatedLinkUnverified   = errors.New("an account with this email address exists but has not verified it, sign in and verify it first")
+
+	ErrIdentityAlreadyLinked = errors.New("the identity provider account, or another account at the provider, is already linked")
+	ErrIdentityNotFound      = errors.New("linked identity not found")
+	ErrLastLoginMethod       = errors.New("the user's only remaining way to sign in cannot be removed")
+
+	ErrInvalidMagicLink      = errors.New("the sign in link is invalid, has expired or has already been used")
+	ErrMagicLinkOtherBrowser = errors.New("the sign in link must be opened in the browser it was requested from")
+
+	ErrSessionNotFound = errors.New("session not found")
+
+	ErrApiKeyNotFound        = errors.New("API key not found")
+	ErrInvalidApiKeyScope    = errors.New("API key scopes must be claims the user holds")
+	ErrInvalidApiKeyExpiry   = errors.New("API key expiry must be in the future and within the maximum key lifetime")
+	ErrApiKeyNameRequired    = errors.New("a name must be supplied for the API key")
+	ErrNotServiceAccount     = errors.New("the user is not a service account")
+	ErrInvalidServiceAccount = errors.New("a service account needs a username and a valid email address")
+
+	ErrOrganizationNotFound  = errors.New("organization not found")
+	ErrInvalidOrganization   = errors.New("an organization needs a name and a slug of lowercase letters, digits and hyphens")
+	ErrOrganizationSlugTaken = errors.New("the organization slug is already taken")
+
+	ErrGroupNotFound             = errors.New("group not found")
+	ErrInvalidGroup              = errors.New("a name must be supplied for the group")
+	ErrGroupNameTaken            = errors.New("the group name is already taken")
+	ErrGroupCycle                = errors.New("a group cannot be made a subgroup of itself or of one of its subgroups")
+	ErrGroupOrganizationMismatch = errors.New("groups can only contain users and groups of their own organization")
+
+	ErrPermissionNotFound  = errors.New("permission not found")
+	ErrInvalidPermission   = errors.New("a permission must be named resource:action in lowercase letters, digits and underscores")
+	ErrPermissionNameTaken = errors.New("the permission already exists")
+	ErrBuiltInPermission   = errors.New("the service's own permissions cannot be deleted or taken from the Administrator role")
+
+	ErrWebhookNotFound     = errors.New("webhook subscription not found")
+	ErrInvalidWebhookUrl   = errors.New("webhook url must be an absolute http or https url")
+	ErrInvalidWebhookEvent = errors.New("unknown webhook event type")
+
+	ErrUnsupportedFormat = errors.New("format must be csv or jsonl")
+	ErrInvalidImportFile = errors.New("the import file could not be read")
+)
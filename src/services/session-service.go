@@ -0,0 +1,169 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/repositories"
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	sessionTokenLifetime = 1 * time.Hour
+
+	// last_seen_at is only written once this much time has passed so that
+	// every authenticated request does not turn into a database write
+	sessionTouchInterval = 1 * time.Minute
+
+	loginHistoryLimit = 50
+)
+
+type SessionService struct {
+	sessionRepo  *repositories.UserSessionRepository
+	auditService *AuditService
+	logger       *zap.SugaredLogger
+}
+
+func InitSessionService(serviceCfg *config.ServiceConfig) *SessionService {
+	return &SessionService{
+		sessionRepo:  repositories.InitUserSessionRepository(serviceCfg),
+		auditService: InitAuditService(serviceCfg),
+		logger:       serviceCfg.Logger,
+	}
+}
+
+// StartSession records a successful login using the request metadata held in
+// ctx. The returned session id is carried in the token as its sid claim.
+func (s *SessionService) StartSession(ctx context.Context, userId uint, authMethod string) (domain.UserSession, error) {
+	sessionId, err := helpers.GenerateRandomToken(16)
+	if err != nil {
+		return domain.UserSession{}, err
+	}
+
+	now := time.Now()
+	metadata := helpers.RequestMetadataFromContext(ctx)
+
+	return s.sessionRepo.Add(domain.UserSession{
+		SessionId:  sessionId,
+		UserId:     userId,
+		AuthMethod: authMethod,
+		IPAddress:  metadata.IPAddress,
+		UserAgent:  metadata.UserAgent,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(sessionTokenLifetime),
+	})
+}
+
+// IsSessionActive reports whether the session exists for the user and has not
+// been revoked or expired, noting the activity against it as it goes.
+func (s *SessionService) IsSessionActive(userId uint, sessionId string) bool {
+	session, err := s.sessionRepo.GetBySessionId(sessionId)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Errorf("error getting session for user id %d with error %v", userId, err)
+		}
+		return false
+	}
+
+	now := time.Now()
+	if session.UserId != userId || !session.IsActive(now) {
+		return false
+	}
+
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		if err := s.sessionRepo.TouchLastSeen(sessionId, now); err != nil {
+			s.logger.Warnf("unable to update last seen for session of user id %d with error %v", userId, err)
+		}
+	}
+
+	return true
+}
+
+func (s *SessionService) GetActiveSessions(userId uint, currentSessionId string) ([]dtos.UserSessionDto, error) {
+	sessions, err := s.sessionRepo.GetActiveByUserId(userId)
+	if err != nil {
+		return []dtos.UserSessionDto{}, err
+	}
+
+	return newUserSessionDtos(sessions, currentSessionId), nil
+}
+
+// GetLoginHistory returns the user's most recent logins, including those
+// whose sessions have since ended.
+func (s *SessionService) GetLoginHistory(userId uint, currentSessionId string) ([]dtos.UserSessionDto, error) {
+	sessions, err := s.sessionRepo.GetHistoryByUserId(userId, loginHistoryLimit)
+	if err != nil {
+		return []dtos.UserSessionDto{}, err
+	}
+
+	return newUserSessionDtos(sessions, currentSessionId), nil
+}
+
+func (s *SessionService) GetAllSessions(userId uint) ([]dtos.UserSessionDto, error) {
+	sessions, err := s.sessionRepo.GetHistoryByUserId(userId, 0)
+	if err != nil {
+		return []dtos.UserSessionDto{}, err
+	}
+
+	return newUserSessionDtos(sessions, ""), nil
+}
+
+func (s *SessionService) RevokeSession(ctx context.Context, userId uint, sessionId string) error {
+	revoked, err := s.sessionRepo.Revoke(userId, sessionId)
+	if err != nil {
+		return err
+	}
+
+	if revoked == 0 {
+		return ErrSessionNotFound
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserSessionRevoked,
+		TargetUserId: userTarget(userId),
+	}, map[string]interface{}{"session_id": sessionId})
+
+	return nil
+}
+
+// RevokeOtherSessions signs the user out everywhere except the session making
+// the request.
+func (s *SessionService) RevokeOtherSessions(ctx context.Context, userId uint, currentSessionId string) (int64, error) {
+	revoked, err := s.sessionRepo.RevokeAllExcept(userId, currentSessionId)
+	if err != nil {
+		return 0, err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserSessionRevoked,
+		TargetUserId: userTarget(userId),
+	}, map[string]interface{}{"kept_session_id": currentSessionId, "revoked": revoked})
+
+	return revoked, nil
+}
+
+func newUserSessionDtos(sessions []domain.UserSession, currentSessionId string) []dtos.UserSessionDto {
+	sessionDtos := []dtos.UserSessionDto{}
+
+	for _, session := range sessions {
+		sessionDtos = append(sessionDtos, dtos.UserSessionDto{
+			SessionId:  session.SessionId,
+			AuthMethod: session.AuthMethod,
+			IPAddress:  session.IPAddress,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			RevokedAt:  session.RevokedAt,
+			Current:    len(currentSessionId) > 0 && session.SessionId == currentSessionId,
+		})
+	}
+
+	return sessionDtos
+}
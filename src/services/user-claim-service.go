@@ -0,0 +1,181 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/repositories"
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type UserClaimService struct {
+	userRepo      *repositories.UserRepository
+	claimRepo     *repositories.ClaimRepository
+	userClaimRepo *repositories.UserClaimRepository
+	auditService  *AuditService
+	logger        *zap.SugaredLogger
+}
+
+func InitUserClaimService(serviceCfg *config.ServiceConfig) *UserClaimService {
+	return &UserClaimService{
+		userRepo:      repositories.InitUserRepositoy(serviceCfg),
+		claimRepo:     repositories.InitClaimRepository(serviceCfg),
+		userClaimRepo: repositories.InitUserClaimRepository(serviceCfg),
+		auditService:  InitAuditService(serviceCfg),
+		logger:        serviceCfg.Logger,
+	}
+}
+
+func (s *UserClaimService) GrantClaim(ctx context.Context, userId uint, claimName string) error {
+	user, claim, err := s.getUserAndClaim(ctx, userId, claimName)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userClaimRepo.Add(domain.UserClaim{UserId: user.ID, ClaimId: claim.ID}); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditClaimGranted,
+		TargetUserId: userTarget(user.ID),
+		Target:       claimTarget(claim),
+	}, nil)
+
+	s.logger.Infof("claim %s granted to user %s", claim.Claim, user.Username)
+	return nil
+}
+
+func (s *UserClaimService) RevokeClaim(ctx context.Context, userId uint, claimName string) error {
+	user, claim, err := s.getUserAndClaim(ctx, userId, claimName)
+	if err != nil {
+		return err
+	}
+
+	guard, err := administratorGuard(s.claimRepo, user.OrganizationId)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userClaimRepo.Delete(domain.UserClaim{UserId: user.ID, ClaimId: claim.ID}, guard); err != nil {
+		return lastAdministratorOr(err)
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditClaimRevoked,
+		TargetUserId: userTarget(user.ID),
+		Target:       claimTarget(claim),
+	}, nil)
+
+	s.logger.Infof("claim %s revoked from user %s", claim.Claim, user.Username)
+	return nil
+}
+
+// SyncClaims grants the user each claim entitled maps to true and revokes
+// each it maps to false, leaving claims it does not mention alone. It keeps
+// the claims mapped from directory groups or identity provider attributes in
+// step with them. A claim that cannot be granted only costs the user access,
+// so it is logged rather than failing the sync.
+func (s *UserClaimService) SyncClaims(ctx context.Context, user domain.User, entitled map[string]bool) error {
+	if len(entitled) == 0 {
+		return nil
+	}
+
+	// inherited claims are left to the groups they come from
+	current, err := s.userClaimRepo.GetDirectClaimsByUserId(user.ID)
+	if err != nil {
+		return err
+	}
+
+	held := map[string]bool{}
+	for _, claim := range current {
+		held[claim] = true
+	}
+
+	for claim, isEntitled := range entitled {
+		switch {
+		case isEntitled && !held[claim]:
+			if err := s.GrantClaim(ctx, user.ID, claim); err != nil {
+				s.logger.Warnf("unable to grant mapped claim %s to user %s with error %v", claim, user.Username, err)
+			}
+		case !isEntitled && held[claim]:
+			err := s.RevokeClaim(ctx, user.ID, claim)
+			if errors.Is(err, ErrLastAdministrator) {
+				s.logger.Warnf("user %s keeps mapped claim %s as the last administrator", user.Username, claim)
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *UserClaimService) GetUserClaims(ctx context.Context, userId uint) ([]string, error) {
+	if _, err := s.userRepo.GetById(tenantScope(ctx), userId); err != nil {
+		return []string{}, notFoundOr(err, ErrUserNotFound)
+	}
+
+	return s.userClaimRepo.GetClaimsByUserId(userId)
+}
+
+func (s *UserClaimService) GetUsersWithClaim(ctx context.Context, claimName string) ([]dtos.UserDto, error) {
+	claim, err := s.claimRepo.GetByName(claimName)
+	if err != nil {
+		return []dtos.UserDto{}, notFoundOr(err, ErrClaimNotFound)
+	}
+
+	users, err := s.userClaimRepo.GetUsersByClaimId(tenantScope(ctx), claim.ID)
+	if err != nil {
+		return []dtos.UserDto{}, err
+	}
+
+	userDtos := []dtos.UserDto{}
+	for _, user := range users {
+		userDtos = append(userDtos, newUserDto(user))
+	}
+
+	return userDtos, nil
+}
+
+func (s *UserClaimService) getUserAndClaim(ctx context.Context, userId uint, claimName string) (domain.User, domain.Claim, error) {
+	user, err := s.userRepo.GetById(tenantScope(ctx), userId)
+	if err != nil {
+		return domain.User{}, domain.Claim{}, notFoundOr(err, ErrUserNotFound)
+	}
+
+	claim, err := s.claimRepo.GetByName(claimName)
+	if err != nil {
+		return domain.User{}, domain.Claim{}, notFoundOr(err, ErrClaimNotFound)
+	}
+
+	return user, claim, nil
+}
+
+// notFoundOr swaps gorm's record not found error for the given service error.
+func notFoundOr(err, notFoundErr error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return notFoundErr
+	}
+	return err
+}
+
+// administratorGuard keeps a change from leaving the organization, or the
+// users in none, without an administrator. The check and the change are made
+// together under one lock, so changes made side by side cannot each leave
+// the other the last administrator.
+func administratorGuard(claimRepo *repositories.ClaimRepository, organizationId *uint) (repositories.ClaimGuard, error) {
+	adminClaim, err := claimRepo.GetByName(domain.AdministratorClaim)
+	if err != nil {
+		return repositories.ClaimGuard{}, err
+	}
+
+	return repositories.ClaimGuard{
+		Scope:   repositories.InTenant(organizationId),
+		ClaimId: adminClaim.ID,
+	}, nil
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/repositories"
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	selfErasureActor = "self"
+)
+
+type UserDataService struct {
+	userRepo       *repositories.UserRepository
+	claimRepo      *repositories.ClaimRepository
+	userClaimRepo  *repositories.UserClaimRepository
+	sessionService *SessionService
+	cryptoHelper   *helpers.CryptoHelper
+	auditService   *AuditService
+	logger         *zap.SugaredLogger
+}
+
+func InitUserDataService(serviceCfg *config.ServiceConfig) *UserDataService {
+	return &UserDataService{
+		userRepo:       repositories.InitUserRepositoy(serviceCfg),
+		claimRepo:      repositories.InitClaimRepository(serviceCfg),
+		userClaimRepo:  repositories.InitUserClaimRepository(serviceCfg),
+		sessionService: InitSessionService(serviceCfg),
+		cryptoHelper:   helpers.InitCryptoHelper(serviceCfg.HashExecutor, serviceCfg.Peppers),
+		auditService:   InitAuditService(serviceCfg),
+		logger:         serviceCfg.Logger,
+	}
+}
+
+func (s *UserDataService) ExportUser(ctx context.Context, userId uint) (dtos.UserExportDto, error) {
+	user, err := s.userRepo.GetByIdIncludingDeleted(tenantScope(ctx), userId)
+	if err != nil {
+		return dtos.UserExportDto{}, notFoundOr(err, ErrUserNotFound)
+	}
+
+	claims, err := s.userClaimRepo.GetClaimsByUserId(user.ID)
+	if err != nil {
+		return dtos.UserExportDto{}, err
+	}
+
+	loginHistory, err := s.sessionService.GetAllSessions(user.ID)
+	if err != nil {
+		return dtos.UserExportDto{}, err
+	}
+
+	auditEvents, err := s.auditService.GetByUserId(user.ID)
+	if err != nil {
+		return dtos.UserExportDto{}, err
+	}
+
+	export := dtos.UserExportDto{
+		ExportedAt: time.Now(),
+		Profile: dtos.UserExportProfileDto{
+			UserId:          user.ID,
+			Username:        user.Username,
+			EmailAddress:    user.EmailAddress,
+			FirstName:       user.FirstName,
+			Surname:         user.Surname,
+			EmailVerified:   user.EmailVerified,
+			Status:          user.Status,
+			StatusReason:    user.StatusReason,
+			StatusChangedBy: user.StatusChangedBy,
+			StatusChangedAt: user.StatusChangedAt,
+			CreatedAt:       user.CreatedAt,
+			UpdatedAt:       user.UpdatedAt,
+			ErasedAt:        user.ErasedAt,
+		},
+		Claims:       claims,
+		LoginHistory: loginHistory,
+		AuditEvents:  auditEvents,
+	}
+
+	if user.DeletedAt.Valid {
+		deletedAt := user.DeletedAt.Time
+		export.Profile.DeletedAt = &deletedAt
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserExported,
+		TargetUserId: userTarget(user.ID),
+	}, nil)
+
+	s.logger.Infof("exported data for user id %d", user.ID)
+	return export, nil
+}
+
+// EraseOwnAccount requires the current password so a stolen token alone
+// cannot be used to destroy an account.
+func (s *UserDataService) EraseOwnAccount(ctx context.Context, userId uint, password string) error {
+	user, err := s.userRepo.GetById(tenantScope(ctx), userId)
+	if err != nil {
+		return notFoundOr(err, ErrUserNotFound)
+	}
+
+	matched, err := s.cryptoHelper.IsPasswordMatched(user.Password, user.PepperId, password)
+	if err != nil {
+		return err
+	}
+
+	if !matched {
+		return ErrPasswordMismatch
+	}
+
+	return s.erase(ctx, user, "erasure requested by user", selfErasureActor)
+}
+
+func (s *UserDataService) EraseUser(ctx context.Context, userId uint, reason, actor string) error {
+	user, err := s.userRepo.GetByIdIncludingDeleted(tenantScope(ctx), userId)
+	if err != nil {
+		return notFoundOr(err, ErrUserNotFound)
+	}
+
+	return s.erase(ctx, user, reason, actor)
+}
+
+func (s *UserDataService) erase(ctx context.Context, user domain.User, reason, actor string) error {
+	if user.ErasedAt != nil {
+		return ErrAlreadyErased
+	}
+
+	guard, err := administratorGuard(s.claimRepo, user.OrganizationId)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.Erase(user, reason, actor, guard); err != nil {
+		return lastAdministratorOr(err)
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserErased,
+		TargetUserId: userTarget(user.ID),
+	}, nil)
+
+	s.logger.Infof("personal data for user id %d erased by %s", user.ID, actor)
+	return nil
+}
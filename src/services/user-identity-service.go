@@ -0,0 +1,110 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/repositories"
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// UserIdentityService lists and unlinks the identity provider accounts
+// linked to a user. Accounts are linked through the FederationService, as
+// the user has to sign in to them.
+type UserIdentityService struct {
+	displayNames     map[string]string
+	userIdentityRepo *repositories.UserIdentityRepository
+	userRepo         *repositories.UserRepository
+	auditService     *AuditService
+	logger           *zap.SugaredLogger
+}
+
+func InitUserIdentityService(serviceCfg *config.ServiceConfig) *UserIdentityService {
+	s := &UserIdentityService{
+		displayNames:     map[string]string{},
+		userIdentityRepo: repositories.InitUserIdentityRepository(serviceCfg),
+		userRepo:         repositories.InitUserRepositoy(serviceCfg),
+		auditService:     InitAuditService(serviceCfg),
+		logger:           serviceCfg.Logger,
+	}
+
+	if serviceCfg.Federation != nil {
+		for _, providerCfg := range serviceCfg.Federation.Providers {
+			s.displayNames[providerCfg.Name] = providerCfg.DisplayName
+		}
+	}
+
+	return s
+}
+
+func (s *UserIdentityService) GetIdentities(userId uint) ([]dtos.UserIdentityDto, error) {
+	identities, err := s.userIdentityRepo.GetByUserId(userId)
+	if err != nil {
+		return []dtos.UserIdentityDto{}, err
+	}
+
+	identityDtos := []dtos.UserIdentityDto{}
+	for _, identity := range identities {
+		displayName, ok := s.displayNames[identity.Provider]
+		if !ok {
+			displayName = identity.Provider
+		}
+
+		identityDtos = append(identityDtos, dtos.UserIdentityDto{
+			Id:           identity.ID,
+			Provider:     identity.Provider,
+			DisplayName:  displayName,
+			EmailAddress: identity.EmailAddress,
+			CreatedAt:    identity.CreatedAt,
+			LastLoginAt:  identity.LastLoginAt,
+		})
+	}
+
+	return identityDtos, nil
+}
+
+// Unlink removes a linked account, unless it is the only way the user has
+// left to sign in.
+func (s *UserIdentityService) Unlink(ctx context.Context, userId, identityId uint) error {
+	user, err := s.userRepo.GetById(tenantScope(ctx), userId)
+	if err != nil {
+		return notFoundOr(err, ErrUserNotFound)
+	}
+
+	unlinked, err := s.userIdentityRepo.Unlink(userId, identityId, func(user domain.User, identities []domain.UserIdentity) error {
+		if countLoginMethods(user, len(identities)) <= 1 {
+			return ErrLastLoginMethod
+		}
+		return nil
+	})
+	if err != nil {
+		return notFoundOr(err, ErrIdentityNotFound)
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserIdentityUnlinked,
+		TargetUserId: userTarget(userId),
+		Target:       "provider:" + unlinked.Provider,
+	}, map[string]interface{}{"subject_pseudonym": s.auditService.Pseudonym(unlinked.Subject)})
+
+	s.logger.Infof("%s account %s unlinked from user %s", unlinked.Provider, unlinked.Subject, user.Username)
+	return nil
+}
+
+// countLoginMethods counts the ways the user can sign in: a local password,
+// their directory and each linked account.
+func countLoginMethods(user domain.User, identities int) int {
+	methods := identities
+
+	if isLocalUser(user) && len(user.Password) > 0 {
+		methods++
+	}
+
+	if user.AuthSource == domain.AuthSourceLdap {
+		methods++
+	}
+
+	return methods
+}
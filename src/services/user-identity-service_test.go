@@ -0,0 +1,31 @@
+package services
+
+import (
+	"authservice/src/domain"
+	"testing"
+)
+
+func TestCountLoginMethods(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       domain.User
+		identities int
+		want       int
+	}{
+		{name: "local password only", user: domain.User{AuthSource: domain.AuthSourceLocal, Password: "hash"}, want: 1},
+		{name: "local password and an account", user: domain.User{AuthSource: domain.AuthSourceLocal, Password: "hash"}, identities: 1, want: 2},
+		{name: "password predating auth sources", user: domain.User{Password: "hash"}, want: 1},
+		{name: "local user without a password", user: domain.User{AuthSource: domain.AuthSourceLocal}, identities: 1, want: 1},
+		{name: "federated user", user: domain.User{AuthSource: domain.AuthSourceFederated, Password: "unusable"}, identities: 2, want: 2},
+		{name: "directory user", user: domain.User{AuthSource: domain.AuthSourceLdap}, identities: 1, want: 2},
+		{name: "service account", user: domain.User{AuthSource: domain.AuthSourceServiceAccount}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countLoginMethods(tt.user, tt.identities); got != tt.want {
+				t.Errorf("countLoginMethods() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"authservice/src/dtos"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	UserFileFormatCSV   = "csv"
+	UserFileFormatJSONL = "jsonl"
+
+	// the longest line accepted in a JSON Lines file
+	maxImportLineBytes = 1048576
+
+	// cells starting with one of these are taken for formulas by spreadsheets
+	csvFormulaPrefixes = "=+-@\t\r"
+)
+
+var userFileColumns = []string{
+	"username", "email_address", "first_name", "surname",
+	"password", "password_hash", "claims", "email_verified", "status",
+}
+
+// userRowReader returns the rows of an import file one at a time, along with
+// the line each starts on. A row that cannot be parsed is returned as a
+// rowParseError so the rest of the file can still be read; any other error
+// ends the import.
+type userRowReader interface {
+	Next() (int, dtos.UserImportRowDto, error)
+}
+
+type userRowWriter interface {
+	Write(row dtos.UserImportRowDto) error
+	Flush() error
+}
+
+type rowParseError struct {
+	err error
+}
+
+func (e rowParseError) Error() string {
+	return e.err.Error()
+}
+
+func newUserRowReader(r io.Reader, format string) (userRowReader, error) {
+	switch format {
+	case UserFileFormatCSV:
+		return newCSVUserRowReader(r)
+	case UserFileFormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+		return &jsonlUserRowReader{scanner: scanner}, nil
+	}
+
+	return nil, ErrUnsupportedFormat
+}
+
+func newUserRowWriter(w io.Writer, format string) (userRowWriter, error) {
+	switch format {
+	case UserFileFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(userFileColumns); err != nil {
+			return nil, err
+		}
+		return &csvUserRowWriter{writer: writer}, nil
+	case UserFileFormatJSONL:
+		writer := bufio.NewWriter(w)
+		return &jsonlUserRowWriter{writer: writer, encoder: json.NewEncoder(writer)}, nil
+	}
+
+	return nil, ErrUnsupportedFormat
+}
+
+// csvUserRowReader maps columns by the header row, so columns can be in any
+// order and optional ones left out. Claims are separated by semicolons.
+type csvUserRowReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+	row     int
+}
+
+func newCSVUserRowReader(r io.Reader) (*csvUserRowReader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing header row", ErrInvalidImportFile)
+	}
+
+	known := map[string]bool{}
+	for _, column := range userFileColumns {
+		known[column] = true
+	}
+
+	columns := map[string]int{}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if !known[column] {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidImportFile, column)
+		}
+		columns[column] = i
+	}
+
+	for _, required := range []string{"username", "email_address"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: the %s column is required", ErrInvalidImportFile, required)
+		}
+	}
+
+	return &csvUserRowReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvUserRowReader) Next() (int, dtos.UserImportRowDto, error) {
+	record, err := c.reader.Read()
+	if err == io.EOF {
+		return 0, dtos.UserImportRowDto{}, err
+	}
+
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			c.row = parseErr.StartLine
+		}
+
+		if errors.Is(err, csv.ErrFieldCount) {
+			return c.row, dtos.UserImportRowDto{}, rowParseError{errors.New("wrong number of fields")}
+		}
+		return c.row, dtos.UserImportRowDto{}, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+	c.row, _ = c.reader.FieldPos(0)
+
+	field := func(name string) string {
+		if i, ok := c.columns[name]; ok {
+			return restoreCSVCell(strings.TrimSpace(record[i]))
+		}
+		return ""
+	}
+
+	row := dtos.UserImportRowDto{
+		Username:     field("username"),
+		EmailAddress: field("email_address"),
+		FirstName:    field("first_name"),
+		Surname:      field("surname"),
+		Password:     field("password"),
+		PasswordHash: field("password_hash"),
+		Status:       field("status"),
+	}
+
+	for _, claim := range strings.Split(field("claims"), ";") {
+		if claim = strings.TrimSpace(claim); len(claim) > 0 {
+			row.Claims = append(row.Claims, claim)
+		}
+	}
+
+	if verified := field("email_verified"); len(verified) > 0 {
+		value, err := strconv.ParseBool(verified)
+		if err != nil {
+			return c.row, row, rowParseError{errors.New("email_verified must be true or false")}
+		}
+		row.EmailVerified = &value
+	}
+
+	return c.row, row, nil
+}
+
+// jsonlUserRowReader reads one JSON object per line, skipping blank lines.
+type jsonlUserRowReader struct {
+	scanner *bufio.Scanner
+	row     int
+}
+
+func (j *jsonlUserRowReader) Next() (int, dtos.UserImportRowDto, error) {
+	for j.scanner.Scan() {
+		j.row++
+
+		line := strings.TrimSpace(j.scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+
+		var row dtos.UserImportRowDto
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&row); err != nil {
+			return j.row, row, rowParseError{fmt.Errorf("invalid JSON: %v", err)}
+		}
+
+		return j.row, row, nil
+	}
+
+	if err := j.scanner.Err(); err != nil {
+		return j.row + 1, dtos.UserImportRowDto{}, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+
+	return 0, dtos.UserImportRowDto{}, io.EOF
+}
+
+type csvUserRowWriter struct {
+	writer *csv.Writer
+}
+
+func (c *csvUserRowWriter) Write(row dtos.UserImportRowDto) error {
+	verified := ""
+	if row.EmailVerified != nil {
+		verified = strconv.FormatBool(*row.EmailVerified)
+	}
+
+	record := []string{
+		row.Username, row.EmailAddress, row.FirstName, row.Surname,
+		row.Password, row.PasswordHash, strings.Join(row.Claims, ";"), verified, row.Status,
+	}
+	for i, cell := range record {
+		record[i] = neutraliseCSVCell(cell)
+	}
+
+	return c.writer.Write(record)
+}
+
+func (c *csvUserRowWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// neutraliseCSVCell prefixes a cell a spreadsheet would take for a formula
+// with a quote, so opening an export cannot run anything a user put in their
+// details.
+func neutraliseCSVCell(cell string) string {
+	if len(cell) > 0 && strings.ContainsRune(csvFormulaPrefixes, rune(cell[0])) {
+		return "'" + cell
+	}
+
+	return cell
+}
+
+// restoreCSVCell undoes neutraliseCSVCell, so an export imports unchanged.
+func restoreCSVCell(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(cell[1])) {
+		return cell[1:]
+	}
+
+	return cell
+}
+
+type jsonlUserRowWriter struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (j *jsonlUserRowWriter) Write(row dtos.UserImportRowDto) error {
+	return j.encoder.Encode(row)
+}
+
+func (j *jsonlUserRowWriter) Flush() error {
+	return j.writer.Flush()
+}
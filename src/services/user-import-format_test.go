@@ -0,0 +1,105 @@
+package services
+
+import (
+	"authservice/src/dtos"
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+)
+
+func TestNeutraliseCSVCell(t *testing.T) {
+	tests := []struct {
+		name string
+		cell string
+		want string
+	}{
+		{name: "plain", cell: "alice", want: "alice"},
+		{name: "empty", cell: "", want: ""},
+		{name: "formula", cell: "=HYPERLINK(\"http://evil\")", want: "'=HYPERLINK(\"http://evil\")"},
+		{name: "plus", cell: "+1", want: "'+1"},
+		{name: "minus", cell: "-2+3", want: "'-2+3"},
+		{name: "at", cell: "@SUM(A1)", want: "'@SUM(A1)"},
+		{name: "tab", cell: "\t=1", want: "'\t=1"},
+		{name: "carriage return", cell: "\r=1", want: "'\r=1"},
+		{name: "formula character later", cell: "a=b", want: "a=b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := neutraliseCSVCell(tt.cell)
+			if got != tt.want {
+				t.Errorf("neutraliseCSVCell(%q) = %q, want %q", tt.cell, got, tt.want)
+			}
+			if back := restoreCSVCell(got); back != tt.cell {
+				t.Errorf("restoreCSVCell(%q) = %q, want %q", got, back, tt.cell)
+			}
+		})
+	}
+}
+
+func TestRestoreCSVCellKeepsOtherQuotes(t *testing.T) {
+	tests := []string{"'", "'alice", "O'Brien"}
+
+	for _, cell := range tests {
+		if got := restoreCSVCell(cell); got != cell {
+			t.Errorf("restoreCSVCell(%q) = %q, want it unchanged", cell, got)
+		}
+	}
+}
+
+func TestCSVExportNeutralisesFormulaCells(t *testing.T) {
+	verified := true
+	rows := []dtos.UserImportRowDto{
+		{
+			Username:      "=cmd|' /C calc'!A0",
+			EmailAddress:  "alice@example.com",
+			FirstName:     "+Alice",
+			Surname:       "-Smith",
+			Claims:        []string{"User"},
+			EmailVerified: &verified,
+			Status:        "@active",
+		},
+		{Username: "bob", EmailAddress: "bob@example.com", Claims: []string{"User", "Administrator"}},
+	}
+
+	var buf bytes.Buffer
+	writer, err := newUserRowWriter(&buf, UserFileFormatCSV)
+	if err != nil {
+		t.Fatalf("newUserRowWriter() error = %v", err)
+	}
+	for _, row := range rows {
+		if err := writer.Write(row); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(buf.Bytes())).ReadAll()
+	if err != nil {
+		t.Fatalf("reading export: %v", err)
+	}
+	for _, record := range records[1:] {
+		for _, cell := range record {
+			if neutraliseCSVCell(cell) != cell {
+				t.Errorf("exported cell %q would be read as a formula", cell)
+			}
+		}
+	}
+
+	reader, err := newUserRowReader(bytes.NewReader(buf.Bytes()), UserFileFormatCSV)
+	if err != nil {
+		t.Fatalf("newUserRowReader() error = %v", err)
+	}
+	for _, want := range rows {
+		_, got, err := reader.Next()
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("round trip = %+v, want %+v", got, want)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/repositories"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	userImportBatchSize = 500
+	userExportPageSize  = 500
+)
+
+var importableStatuses = map[string]bool{
+	domain.AccountStatusActive:              true,
+	domain.AccountStatusSuspended:           true,
+	domain.AccountStatusLocked:              true,
+	domain.AccountStatusPendingVerification: true,
+}
+
+type UserImportService struct {
+	userImportRepo *repositories.UserImportRepository
+	claimRepo      *repositories.ClaimRepository
+	userClaimRepo  *repositories.UserClaimRepository
+	emailService   *EmailService
+	cryptoHelper   *helpers.CryptoHelper
+	auditService   *AuditService
+	logger         *zap.SugaredLogger
+}
+
+func InitUserImportService(serviceCfg *config.ServiceConfig) *UserImportService {
+	return &UserImportService{
+		userImportRepo: repositories.InitUserImportRepository(serviceCfg),
+		claimRepo:      repositories.InitClaimRepository(serviceCfg),
+		userClaimRepo:  repositories.InitUserClaimRepository(serviceCfg),
+		emailService:   InitEmailService(),
+		cryptoHelper:   helpers.InitCryptoHelper(serviceCfg.HashExecutor, serviceCfg.Peppers),
+		auditService:   InitAuditService(serviceCfg),
+		logger:         serviceCfg.Logger,
+	}
+}
+
+// pendingImport is a row that passed validation and is waiting for its batch.
+type pendingImport struct {
+	row        dtos.UserImportRowDto
+	userImport repositories.UserImport
+}
+
+// ImportUsers creates or updates a user for every row of the file, keyed on
+// username, in batches of userImportBatchSize. Rows that fail are reported
+// and skipped, so re-running a corrected file is safe: rows that were already
+// imported come back unchanged. A dry run validates and applies every row
+// inside a transaction that is then rolled back.
+func (s *UserImportService) ImportUsers(ctx context.Context, file io.Reader, format string, dryRun bool, actor string) (dtos.UserImportResultDto, error) {
+	result := dtos.UserImportResultDto{DryRun: dryRun, Errors: []dtos.UserImportErrorDto{}}
+
+	reader, err := newUserRowReader(file, format)
+	if err != nil {
+		return result, err
+	}
+
+	claims, err := s.claimRepo.GetAll()
+	if err != nil {
+		return result, err
+	}
+
+	claimIds := make(map[string]uint, len(claims))
+	for _, claim := range claims {
+		claimIds[claim.Claim] = claim.ID
+	}
+
+	seen := map[string]int{}
+	batch := make([]pendingImport, 0, userImportBatchSize)
+
+	for {
+		rowNumber, row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		var parseErr rowParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return result, err
+		}
+
+		result.Rows++
+
+		if err == nil {
+			err = s.validateRow(row, claimIds, seen)
+		}
+
+		if err != nil {
+			result.AddError(rowNumber, row.Username, err)
+			continue
+		}
+		seen[row.Username] = rowNumber
+
+		batch = append(batch, pendingImport{
+			row:        row,
+			userImport: newUserImport(rowNumber, row, claimIds),
+		})
+
+		if len(batch) == userImportBatchSize {
+			if err := s.importBatch(tenantScope(ctx), batch, dryRun, claimIds[domain.UserClaimName], &result); err != nil {
+				return result, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := s.importBatch(tenantScope(ctx), batch, dryRun, claimIds[domain.UserClaimName], &result); err != nil {
+			return result, err
+		}
+	}
+
+	if !dryRun {
+		s.auditService.Record(ctx, domain.AuditEvent{EventType: domain.AuditUsersImported}, map[string]interface{}{
+			"format":    format,
+			"rows":      result.Rows,
+			"created":   result.Created,
+			"updated":   result.Updated,
+			"unchanged": result.Unchanged,
+			"failed":    result.Failed,
+			"by":        actor,
+		})
+	}
+
+	s.logger.Infof("user import by %s (dry run %t) of %d rows: %d created, %d updated, %d unchanged, %d failed",
+		actor, dryRun, result.Rows, result.Created, result.Updated, result.Unchanged, result.Failed)
+
+	return result, nil
+}
+
+func (s *UserImportService) validateRow(row dtos.UserImportRowDto, claimIds map[string]uint, seen map[string]int) error {
+	if len(row.Username) == 0 {
+		return errors.New("username must be supplied")
+	}
+
+	if first, ok := seen[row.Username]; ok {
+		return fmt.Errorf("username %s already appears on row %d", row.Username, first)
+	}
+
+	if !s.emailService.ValidateEmail(row.EmailAddress) {
+		return fmt.Errorf("the email address %s is not in a valid format", row.EmailAddress)
+	}
+
+	if len(row.Password) > 0 && len(row.PasswordHash) > 0 {
+		return errors.New("only one of password and password_hash may be supplied")
+	}
+
+	if len(row.Password) > 0 {
+		if err := helpers.InitPasswordHelper(row.Password).ValidateComplexity(); err != nil {
+			return err
+		}
+	}
+
+	if len(row.PasswordHash) > 0 && !helpers.IsBcryptHash(row.PasswordHash) {
+		return errors.New("password_hash must be a bcrypt hash")
+	}
+
+	if len(row.Status) > 0 && !importableStatuses[row.Status] {
+		return fmt.Errorf("unknown status %s", row.Status)
+	}
+
+	for _, claim := range row.Claims {
+		if _, ok := claimIds[claim]; !ok {
+			return fmt.Errorf("unknown claim %s", claim)
+		}
+	}
+
+	return nil
+}
+
+func newUserImport(rowNumber int, row dtos.UserImportRowDto, claimIds map[string]uint) repositories.UserImport {
+	userImport := repositories.UserImport{
+		Row: rowNumber,
+		User: domain.User{
+			Username:     row.Username,
+			EmailAddress: row.EmailAddress,
+			FirstName:    row.FirstName,
+			Surname:      row.Surname,
+			Status:       row.Status,
+		},
+		SetStatus:        len(row.Status) > 0,
+		SetEmailVerified: row.EmailVerified != nil,
+	}
+
+	if row.EmailVerified != nil {
+		userImport.User.EmailVerified = *row.EmailVerified
+	}
+
+	for _, claim := range row.Claims {
+		if id, ok := claimIds[claim]; ok {
+			userImport.ClaimIds = append(userImport.ClaimIds, id)
+		}
+	}
+
+	return userImport
+}
+
+// importBatch sets passwords on the rows that will create users and hands the
+// batch to the repository. Existing users keep their password, so plain text
+// passwords are only hashed when they will be used, and never on a dry run.
+// Pre-hashed passwords are stored without a pepper and moved to the current
+// pepper the first time the user logs in.
+func (s *UserImportService) importBatch(scope repositories.TenantScope, batch []pendingImport, dryRun bool, defaultClaimId uint, result *dtos.UserImportResultDto) error {
+	usernames := make([]string, 0, len(batch))
+	for _, pending := range batch {
+		usernames = append(usernames, pending.row.Username)
+	}
+
+	existing, err := s.userImportRepo.GetExistingUsernames(usernames)
+	if err != nil {
+		return err
+	}
+
+	imports := make([]repositories.UserImport, 0, len(batch))
+	for _, pending := range batch {
+		userImport := pending.userImport
+
+		if !existing[pending.row.Username] {
+			// new users listing no claims get the default one, as they would
+			// when registering
+			if len(userImport.ClaimIds) == 0 {
+				userImport.ClaimIds = []uint{defaultClaimId}
+			}
+
+			switch {
+			case len(pending.row.PasswordHash) > 0:
+				userImport.User.Password = pending.row.PasswordHash
+			case len(pending.row.Password) > 0 && dryRun:
+				userImport.User.Password = "dry-run"
+			case len(pending.row.Password) > 0:
+				hash, pepperId, err := s.cryptoHelper.HashPassword(pending.row.Password)
+				if err != nil {
+					s.logger.Errorf("error hashing imported password for user %s with error %v", pending.row.Username, err)
+					return err
+				}
+				userImport.User.Password = hash
+				userImport.User.PepperId = pepperId
+			}
+		}
+
+		imports = append(imports, userImport)
+	}
+
+	outcomes, err := s.userImportRepo.ImportBatch(scope, imports, dryRun)
+	if err != nil {
+		return err
+	}
+
+	for i, outcome := range outcomes {
+		if outcome.Err != nil {
+			result.AddError(outcome.Row, batch[i].row.Username, outcome.Err)
+			continue
+		}
+
+		switch outcome.Result {
+		case repositories.UserImportCreated:
+			result.Created++
+		case repositories.UserImportUpdated:
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+	}
+
+	return nil
+}
+
+// ExportUsers writes every live user, with their claims, in the import file
+// format. Passwords are not exported.
+func (s *UserImportService) ExportUsers(ctx context.Context, file io.Writer, format string, actor string) (int, error) {
+	writer, err := newUserRowWriter(file, format)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var afterId uint
+
+	for {
+		users, err := s.userImportRepo.GetExportPage(tenantScope(ctx), afterId, userExportPageSize)
+		if err != nil {
+			return count, err
+		}
+
+		userIds := make([]uint, 0, len(users))
+		for _, user := range users {
+			userIds = append(userIds, user.ID)
+		}
+
+		claims, err := s.userClaimRepo.GetClaimsByUserIds(userIds)
+		if err != nil {
+			return count, err
+		}
+
+		for _, user := range users {
+			emailVerified := user.EmailVerified
+			row := dtos.UserImportRowDto{
+				Username:      user.Username,
+				EmailAddress:  user.EmailAddress,
+				FirstName:     user.FirstName,
+				Surname:       user.Surname,
+				Claims:        claimNames(claims[user.ID]),
+				EmailVerified: &emailVerified,
+				Status:        user.Status,
+			}
+
+			if err := writer.Write(row); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if len(users) < userExportPageSize {
+			break
+		}
+		afterId = users[len(users)-1].ID
+	}
+
+	if err := writer.Flush(); err != nil {
+		return count, err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{EventType: domain.AuditUsersExported}, map[string]interface{}{
+		"format": format,
+		"users":  count,
+		"by":     actor,
+	})
+
+	s.logger.Infof("%d users exported by %s", count, actor)
+	return count, nil
+}
+
+// ParseUserFileFormat accepts a format name or file extension.
+func ParseUserFileFormat(format string) (string, error) {
+	switch strings.TrimPrefix(strings.ToLower(format), ".") {
+	case UserFileFormatCSV:
+		return UserFileFormatCSV, nil
+	case UserFileFormatJSONL, "ndjson":
+		return UserFileFormatJSONL, nil
+	}
+
+	return "", ErrUnsupportedFormat
+}
+
+func claimNames(claims []domain.Claim) []string {
+	names := make([]string, 0, len(claims))
+	for _, claim := range claims {
+		names = append(names, claim.Claim)
+	}
+
+	return names
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/repositories"
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type UserPurgeJob struct {
+	userRepo  *repositories.UserRepository
+	retention time.Duration
+	interval  time.Duration
+	logger    *zap.SugaredLogger
+}
+
+func InitUserPurgeJob(serviceCfg *config.ServiceConfig) *UserPurgeJob {
+	return &UserPurgeJob{
+		userRepo:  repositories.InitUserRepositoy(serviceCfg),
+		retention: serviceCfg.UserRetention,
+		interval:  serviceCfg.UserPurgeInterval,
+		logger:    serviceCfg.Logger,
+	}
+}
+
+// Start runs the purge once immediately and then on every interval until
+// the context is cancelled.
+func (j *UserPurgeJob) Start(ctx context.Context) {
+	if j.interval <= 0 {
+		j.logger.Warn("user purge job disabled as no purge interval is configured")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			j.RunOnce()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (j *UserPurgeJob) RunOnce() (int64, error) {
+	cutoff := time.Now().Add(-j.retention)
+
+	purged, err := j.userRepo.PurgeDeletedBefore(cutoff)
+	if err != nil {
+		j.logger.Errorf("error purging users deleted before %s with error %v", cutoff.Format(time.RFC3339), err)
+		return 0, err
+	}
+
+	if purged > 0 {
+		j.logger.Infof("purged %d users deleted before %s", purged, cutoff.Format(time.RFC3339))
+	}
+
+	return purged, nil
+}
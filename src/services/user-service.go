@@ -6,9 +6,13 @@ import (
 	"authservice/src/dtos"
 	"authservice/src/helpers"
 	"authservice/src/repositories"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -16,23 +20,63 @@ import (
 	"go.uber.org/zap"
 )
 
+type contextKey string
+
+const (
+	tokenClaimsCtxKey       contextKey = "tokenClaims"
+	permissionGrantedCtxKey contextKey = "permissionGranted"
+	tenantScopeCtxKey       contextKey = "tenantScope"
+
+	defaultUserListLimit = 50
+	maxUserListLimit     = 200
+
+	// tokens whose roles grant more permissions leave them out
+	maxTokenPermissions = 50
+)
+
+var userListSortColumns = map[string]bool{
+	"created_at":    true,
+	"username":      true,
+	"email_address": true,
+	"first_name":    true,
+	"surname":       true,
+}
+
 type UserService struct {
-	userRepo      *repositories.UserRepository
-	userClaimRepo *repositories.UserClaimRepository
-	emailService  *EmailService
-	tokenAuth     *jwtauth.JWTAuth
-	logger        *zap.SugaredLogger
-	clientSecret  string
+	userRepo       *repositories.UserRepository
+	userClaimRepo  *repositories.UserClaimRepository
+	claimRepo      *repositories.ClaimRepository
+	permissionRepo *repositories.PermissionRepository
+	apiKeyRepo     *repositories.ApiKeyRepository
+	orgRepo        *repositories.OrganizationRepository
+	auditService   *AuditService
+	sessionService *SessionService
+	emailService   *EmailService
+	authenticators []Authenticator
+	cryptoHelper   *helpers.CryptoHelper
+	tokenAuth      *jwtauth.JWTAuth
+	logger         *zap.SugaredLogger
+	clientSecret   string
+	userRetention  time.Duration
 }
 
 func InitUserService(serviceCfg *config.ServiceConfig) *UserService {
 	return &UserService{
-		userRepo:      repositories.InitUserRepositoy(serviceCfg),
-		userClaimRepo: repositories.InitUserClaimRepository(serviceCfg),
-		emailService:  InitEmailService(),
-		tokenAuth:     jwtauth.New("HS256", []byte(serviceCfg.ClientSecret), nil),
-		logger:        serviceCfg.Logger,
-		clientSecret:  serviceCfg.ClientSecret,
+		userRepo:       repositories.InitUserRepositoy(serviceCfg),
+		userClaimRepo:  repositories.InitUserClaimRepository(serviceCfg),
+		claimRepo:      repositories.InitClaimRepository(serviceCfg),
+		permissionRepo: repositories.InitPermissionRepository(serviceCfg),
+		apiKeyRepo:     repositories.InitApiKeyRepository(serviceCfg),
+		orgRepo:        repositories.InitOrganizationRepository(serviceCfg),
+		auditService:   InitAuditService(serviceCfg),
+		sessionService: InitSessionService(serviceCfg),
+		emailService:   InitEmailService(),
+		authenticators: initAuthenticators(serviceCfg),
+		cryptoHelper:   helpers.InitCryptoHelper(serviceCfg.HashExecutor, serviceCfg.Peppers),
+		tokenAuth:      jwtauth.New("HS256", []byte(serviceCfg.ClientSecret), nil),
+		logger:         serviceCfg.Logger,
+		clientSecret:   serviceCfg.ClientSecret,
+		userRetention:  serviceCfg.UserRetention,
 	}
 }
 
@@ -53,17 +97,19 @@ func (s *UserService) validateUser(user domain.User) error {
 	return nil
 }
 
-func (s *UserService) AddUser(user domain.User, isAdminUser bool) (domain.User, error) {
+func (s *UserService) AddUser(ctx context.Context, user domain.User, isAdminUser bool) (domain.User, error) {
 	if err := s.validateUser(user); err != nil {
 		return user, err
 	}
 
-	pwd, err := helpers.InitCryptoHelper().Encrypt(user.Password)
+	pwd, pepperId, err := s.cryptoHelper.HashPassword(user.Password)
 	if err != nil {
-		s.logger.Errorf("error encrypting password with error %v", user.Username, err)
+		s.logger.Errorf("error encrypting password for user %s with error %v", user.Username, err)
 		return user, err
 	}
 	user.Password = pwd
+	user.PepperId = pepperId
+	user.OrganizationId = tenantScope(ctx).OrganizationId()
 
 	user, err = s.userRepo.Add(user)
 	if err != nil {
@@ -71,14 +117,20 @@ func (s *UserService) AddUser(user domain.User, isAdminUser bool) (domain.User,
 		return user, err
 	}
 
-	userClaim := domain.UserClaim{
-		UserId: user.ID,
+	claimName := domain.UserClaimName
+	if isAdminUser {
+		claimName = domain.AdministratorClaim
 	}
 
-	if isAdminUser {
-		userClaim.ClaimId = 1
-	} else {
-		userClaim.ClaimId = 2
+	claim, err := s.claimRepo.GetByName(claimName)
+	if err != nil {
+		s.logger.Errorf("error locating claim %s for user %s with error %v", claimName, user.Username, err)
+		return user, err
+	}
+
+	userClaim := domain.UserClaim{
+		UserId:  user.ID,
+		ClaimId: claim.ID,
 	}
 
 	if err := s.userClaimRepo.Add(userClaim); err != nil {
@@ -86,15 +138,25 @@ func (s *UserService) AddUser(user domain.User, isAdminUser bool) (domain.User,
 		return user, err
 	}
 
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserRegistered,
+		TargetUserId: userTarget(user.ID),
+	}, map[string]interface{}{"claim": claimName})
+
 	return user, nil
 }
 
-func (s *UserService) UpdateUserDetails(user dtos.UserDto) error {
-	usr, err := s.userRepo.GetById(user.UserId)
+func (s *UserService) UpdateUserDetails(ctx context.Context, user dtos.UserDto) error {
+	usr, err := s.userRepo.GetById(tenantScope(ctx), user.UserId)
 	if err != nil {
 		return errors.New("details do not match")
 	}
 
+	// nobody has proved they own the new address yet
+	if usr.EmailAddress != user.EmailAddress {
+		usr.EmailVerified = false
+	}
+
 	usr.FirstName = user.FirstName
 	usr.Surname = user.Surname
 	usr.EmailAddress = user.EmailAddress
@@ -104,71 +166,337 @@ func (s *UserService) UpdateUserDetails(user dtos.UserDto) error {
 		return err
 	}
 
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserDetailsUpdated,
+		TargetUserId: userTarget(usr.ID),
+	}, nil)
+
 	return nil
 }
 
-func (s *UserService) UpdateUserPassword(updateUserPassword dtos.UserUpdatePasswordDto) error {
-	user, err := s.userRepo.GetById(updateUserPassword.UserId)
+func (s *UserService) UpdateUserPassword(ctx context.Context, updateUserPassword dtos.UserUpdatePasswordDto) error {
+	user, err := s.userRepo.GetById(tenantScope(ctx), updateUserPassword.UserId)
 	if err != nil {
 		return errors.New("details do not match")
 	}
 
-	if !helpers.InitCryptoHelper().IsHashMatched(user.Password, updateUserPassword.OldPassword) {
+	if !isLocalUser(user) {
+		return ErrPasswordManagedExternally
+	}
+
+	matched, err := s.cryptoHelper.IsPasswordMatched(user.Password, user.PepperId, updateUserPassword.OldPassword)
+	if err != nil {
+		return err
+	}
+
+	if !matched {
+		s.auditService.Record(ctx, domain.AuditEvent{
+			EventType:    domain.AuditUserPasswordChanged,
+			Outcome:      domain.AuditOutcomeFailure,
+			TargetUserId: userTarget(user.ID),
+		}, map[string]interface{}{"reason": "old password did not match"})
 		return errors.New("details do not match")
 	}
 
-	err = s.userRepo.UpdateUserPassword(updateUserPassword)
+	pwdService := helpers.InitPasswordHelper(updateUserPassword.NewPassword)
+	if err := pwdService.ValidateComplexity(); err != nil {
+		return err
+	}
+
+	pwd, pepperId, err := s.cryptoHelper.HashPassword(updateUserPassword.NewPassword)
+	if err != nil {
+		s.logger.Errorf("error encrypting password for user %s with error %v", user.Username, err)
+		return err
+	}
+
+	err = s.userRepo.UpdateUserPassword(user.ID, pwd, pepperId)
+	if err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserPasswordChanged,
+		TargetUserId: userTarget(user.ID),
+	}, nil)
+
+	return nil
+}
+
+// ResetPassword sets a new password without knowing the old one and signs
+// the user out everywhere. It is meant for operators, not end users.
+func (s *UserService) ResetPassword(ctx context.Context, username, newPassword, actor string) error {
+	user, err := s.userRepo.GetByUsername(username)
+	if err != nil {
+		return notFoundOr(err, ErrUserNotFound)
+	}
+
+	change, err := s.newPasswordChange(user, newPassword)
 	if err != nil {
 		return err
 	}
 
+	if err := s.userRepo.ApplyChanges(user.ID, repositories.UserChanges{Password: change}); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserPasswordChanged,
+		TargetUserId: userTarget(user.ID),
+	}, map[string]interface{}{"reset_by": actor})
+
+	s.logger.Infof("password for user %s reset by %s", user.Username, actor)
 	return nil
 }
 
-func (s *UserService) DeleteUser(user domain.User) error {
+// newPasswordChange checks and hashes a password an administrator or
+// provisioning client sets for the user.
+func (s *UserService) newPasswordChange(user domain.User, password string) (*repositories.PasswordChange, error) {
+	if !isLocalUser(user) {
+		return nil, ErrPasswordManagedExternally
+	}
+
+	if err := helpers.InitPasswordHelper(password).ValidateComplexity(); err != nil {
+		return nil, err
+	}
+
+	hash, pepperId, err := s.cryptoHelper.HashPassword(password)
+	if err != nil {
+		s.logger.Errorf("error encrypting password for user %s with error %v", user.Username, err)
+		return nil, err
+	}
+
+	return &repositories.PasswordChange{Hash: hash, PepperId: pepperId}, nil
+}
+
+func (s *UserService) CountUsersByPepper() (map[string]int64, error) {
+	return s.userRepo.CountByPepperId()
+}
+
+func (s *UserService) DeleteUser(ctx context.Context, userId uint) error {
+	user, err := s.userRepo.GetById(tenantScope(ctx), userId)
+	if err != nil {
+		return notFoundOr(err, ErrUserNotFound)
+	}
+
 	if err := s.userRepo.Delete(user); err != nil {
 		s.logger.Errorf("error deleting user %s with error %v", user.Username, err)
 		return err
 	}
 
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserDeleted,
+		TargetUserId: userTarget(user.ID),
+	}, nil)
+
 	return nil
 }
 
-func (s *UserService) GetByUsername(username string) (dtos.UserDto, error) {
-	user, err := s.userRepo.GetByUsername(username)
+func (s *UserService) SuspendUser(ctx context.Context, userId uint, reason, actor string) error {
+	user, err := s.userRepo.GetById(tenantScope(ctx), userId)
+	if err != nil {
+		return notFoundOr(err, ErrUserNotFound)
+	}
+
+	if user.Username == actor {
+		return ErrCannotChangeOwnStatus
+	}
+
+	if err := s.userRepo.UpdateStatus(user.ID, domain.AccountStatusSuspended, reason, actor, true); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserSuspended,
+		TargetUserId: userTarget(user.ID),
+	}, map[string]interface{}{"reason": reason})
+
+	s.logger.Infof("user %s suspended by %s: %s", user.Username, actor, reason)
+	return nil
+}
+
+func (s *UserService) ReactivateUser(ctx context.Context, userId uint, reason, actor string) error {
+	user, err := s.userRepo.GetById(tenantScope(ctx), userId)
+	if err != nil {
+		return notFoundOr(err, ErrUserNotFound)
+	}
+
+	if user.Username == actor {
+		return ErrCannotChangeOwnStatus
+	}
+
+	if user.Status == domain.AccountStatusActive {
+		return nil
+	}
+
+	if err := s.userRepo.UpdateStatus(user.ID, domain.AccountStatusActive, reason, actor, false); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserReactivated,
+		TargetUserId: userTarget(user.ID),
+	}, map[string]interface{}{"reason": reason, "previous_status": user.Status})
+
+	s.logger.Infof("user %s reactivated by %s: %s", user.Username, actor, reason)
+	return nil
+}
+
+func (s *UserService) VerifyEmail(ctx context.Context, userId uint, actor string) error {
+	user, err := s.userRepo.GetById(tenantScope(ctx), userId)
+	if err != nil {
+		return notFoundOr(err, ErrUserNotFound)
+	}
+
+	if user.EmailVerified {
+		return nil
+	}
+
+	if err := s.userRepo.MarkEmailVerified(user.ID); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserEmailVerified,
+		TargetUserId: userTarget(user.ID),
+	}, nil)
+
+	s.logger.Infof("email address of user %s verified by %s", user.Username, actor)
+	return nil
+}
+
+// RestoreUser brings back a soft-deleted user provided it is still inside the
+// retention window and nobody has since taken its username or email address.
+func (s *UserService) RestoreUser(ctx context.Context, userId uint, actor string) error {
+	user, err := s.userRepo.GetDeletedById(tenantScope(ctx), userId)
+	if err != nil {
+		return notFoundOr(err, ErrUserNotFound)
+	}
+
+	if user.DeletedAt.Time.Before(time.Now().Add(-s.userRetention)) {
+		return ErrRestoreWindowExpired
+	}
+
+	conflict, err := s.userRepo.HasActiveConflict(user)
 	if err != nil {
+		return err
+	}
+
+	if conflict {
+		return ErrRestoreConflict
+	}
+
+	if err := s.userRepo.Restore(user.ID); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserRestored,
+		TargetUserId: userTarget(user.ID),
+	}, nil)
+
+	s.logger.Infof("user %s restored by %s", user.Username, actor)
+	return nil
+}
+
+func (s *UserService) GetByUsername(ctx context.Context, username string) (dtos.UserDto, error) {
+	user, err := s.userRepo.GetByUsername(username)
+	if err != nil || !tenantScope(ctx).Allows(user.OrganizationId) {
 		s.logger.Warnf("invalid user %s", username)
 		return dtos.UserDto{}, errors.New("user not found")
 	}
 
-	return dtos.UserDto{
-		UserId:       user.ID,
-		Username:     user.Username,
-		EmailAddress: user.EmailAddress,
-		FirstName:    user.FirstName,
-		Surname:      user.Surname,
-	}, nil
+	return newUserDto(user), nil
+}
+
+func (s *UserService) ListUsers(ctx context.Context, query dtos.UserListQueryDto) (dtos.UserListResponseDto, error) {
+	if len(query.SortBy) == 0 {
+		query.SortBy = "created_at"
+	}
+
+	if !userListSortColumns[query.SortBy] {
+		return dtos.UserListResponseDto{}, fmt.Errorf("%w: cannot sort by %s", ErrInvalidListQuery, query.SortBy)
+	}
+
+	if query.Limit <= 0 {
+		query.Limit = defaultUserListLimit
+	}
+
+	if query.Limit > maxUserListLimit {
+		query.Limit = maxUserListLimit
+	}
+
+	var after *dtos.UserListCursorDto
+	if len(query.Cursor) > 0 {
+		cursor, err := decodeUserListCursor(query.Cursor)
+		if err != nil || cursor.SortBy != query.SortBy {
+			return dtos.UserListResponseDto{}, fmt.Errorf("%w: invalid cursor", ErrInvalidListQuery)
+		}
+		after = &cursor
+	}
+
+	limit := query.Limit
+	query.Limit = limit + 1
+
+	users, err := s.userRepo.List(tenantScope(ctx), query, after)
+	if err != nil {
+		return dtos.UserListResponseDto{}, err
+	}
+
+	resp := dtos.UserListResponseDto{
+		Users: []dtos.UserDto{},
+	}
+
+	if len(users) > limit {
+		users = users[:limit]
+		resp.NextCursor = encodeUserListCursor(users[len(users)-1], query.SortBy)
+	}
+
+	for _, user := range users {
+		resp.Users = append(resp.Users, newUserDto(user))
+	}
+
+	return resp, nil
 }
 
-func (s *UserService) GetByUsernameAndPassword(username, password string) (dtos.UserLoginResponseDto, error) {
+func (s *UserService) GetByUsernameAndPassword(ctx context.Context, username, password string) (dtos.UserLoginResponseDto, error) {
 	loginErrMsg := "username or password does not match"
 	if len(username) <= 0 || len(password) <= 0 {
 		s.logger.Warnf("invalid login attempt for user %s", username)
 		return dtos.UserLoginResponseDto{}, errors.New(loginErrMsg)
 	}
 
-	user, err := s.userRepo.GetByUsername(username)
-	if err != nil {
+	user, authenticator, err := s.authenticate(ctx, username, password)
+	switch {
+	case errors.Is(err, errUserNotHandled):
 		s.logger.Warnf("invalid login attempt for user %s", username)
+		s.recordLoginFailure(ctx, nil, "unknown user", map[string]interface{}{
+			"username_pseudonym": s.auditService.Pseudonym(username),
+		})
 		return dtos.UserLoginResponseDto{}, errors.New(loginErrMsg)
-	}
-
-	if !helpers.InitCryptoHelper().IsHashMatched(user.Password, password) {
+	case errors.Is(err, ErrPasswordMismatch):
 		s.logger.Warnf("invalid login attempt for user %s", username)
+		var userId *uint
+		if user.ID > 0 {
+			userId = userTarget(user.ID)
+		}
+		s.recordLoginFailure(ctx, userId, "password did not match", map[string]interface{}{
+			"username_pseudonym": s.auditService.Pseudonym(username),
+			"authenticator":      authenticator,
+		})
 		return dtos.UserLoginResponseDto{}, errors.New(loginErrMsg)
+	case err != nil:
+		s.logger.Warnf("unable to verify password for user %s with error %v", username, err)
+		return dtos.UserLoginResponseDto{}, err
+	}
+
+	if err := accountStatusError(user.Status); err != nil {
+		s.logger.Warnf("login refused for user %s with account status %s", username, user.Status)
+		s.recordLoginFailure(ctx, userTarget(user.ID), "account is "+user.Status, nil)
+		return dtos.UserLoginResponseDto{}, err
 	}
 
 	resp := dtos.UserLoginResponseDto{
+		UserId:       user.ID,
 		Username:     user.Username,
 		EmailAddress: user.EmailAddress,
 	}
@@ -179,20 +507,177 @@ func (s *UserService) GetByUsernameAndPassword(username, password string) (dtos.
 	}
 	resp.UserClaims = claims
 
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserLoginSucceeded,
+		ActorUserId:  userTarget(user.ID),
+		TargetUserId: userTarget(user.ID),
+	}, map[string]interface{}{"authenticator": authenticator})
+
 	return resp, nil
 }
 
-func (s *UserService) GenerateUserToken(loginResponse dtos.UserLoginResponseDto) (string, error) {
-	permissions := []string{}
-	permissions = append(permissions, loginResponse.UserClaims...)
+func (s *UserService) recordLoginFailure(ctx context.Context, userId *uint, reason string, details map[string]interface{}) {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	details["reason"] = reason
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType:    domain.AuditUserLoginFailed,
+		Outcome:      domain.AuditOutcomeFailure,
+		ActorUserId:  userId,
+		TargetUserId: userId,
+	}, details)
+}
+
+// authenticate tries each authenticator in turn until one owns the username.
+// An authenticator that fails, such as an unreachable directory, is passed
+// over so the users of the others can still sign in, and its error returned
+// only when no other authenticator owns the username.
+func (s *UserService) authenticate(ctx context.Context, username, password string) (domain.User, string, error) {
+	var failure error
+
+	for _, authenticator := range s.authenticators {
+		user, err := authenticator.Authenticate(ctx, username, password)
+		switch {
+		case err == nil, errors.Is(err, ErrPasswordMismatch):
+			return user, authenticator.Name(), err
+		case errors.Is(err, errUserNotHandled):
+			continue
+		}
+
+		s.logger.Warnf("%s authenticator failed for user %s with error %v", authenticator.Name(), username, err)
+		if failure == nil {
+			failure = err
+		}
+	}
+
+	if failure != nil {
+		return domain.User{}, "", failure
+	}
+
+	return domain.User{}, "", errUserNotHandled
+}
+
+func accountStatusError(status string) error {
+	switch status {
+	case domain.AccountStatusSuspended:
+		return ErrAccountSuspended
+	case domain.AccountStatusLocked:
+		return ErrAccountLocked
+	case domain.AccountStatusPendingVerification:
+		return ErrAccountPendingVerification
+	}
+
+	return nil
+}
+
+func newUserDto(user domain.User) dtos.UserDto {
+	userDto := dtos.UserDto{
+		UserId:         user.ID,
+		Username:       user.Username,
+		EmailAddress:   user.EmailAddress,
+		FirstName:      user.FirstName,
+		Surname:        user.Surname,
+		EmailVerified:  user.EmailVerified,
+		Status:         user.Status,
+		StatusReason:   user.StatusReason,
+		AuthSource:     user.AuthSource,
+		OrganizationId: user.OrganizationId,
+		CreatedAt:      user.CreatedAt,
+	}
+
+	if user.DeletedAt.Valid {
+		deletedAt := user.DeletedAt.Time
+		userDto.DeletedAt = &deletedAt
+	}
+
+	return userDto
+}
+
+func encodeUserListCursor(user domain.User, sortBy string) string {
+	cursor := dtos.UserListCursorDto{
+		SortBy: sortBy,
+		UserId: user.ID,
+	}
+
+	switch sortBy {
+	case "username":
+		cursor.SortValue = user.Username
+	case "email_address":
+		cursor.SortValue = user.EmailAddress
+	case "first_name":
+		cursor.SortValue = user.FirstName
+	case "surname":
+		cursor.SortValue = user.Surname
+	default:
+		cursor.SortValue = user.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	out, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(out)
+}
+
+func decodeUserListCursor(s string) (dtos.UserListCursorDto, error) {
+	var cursor dtos.UserListCursorDto
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
+// GenerateUserToken starts a new session for the login and issues a token
+// bound to it, so the token stops working once the session is revoked. The
+// token of a user in an organization names it, and is confined to it. The
+// token carries the user's roles and the permissions they grant.
+func (s *UserService) GenerateUserToken(ctx context.Context, loginResponse dtos.UserLoginResponseDto, authMethod string) (string, error) {
+	roles := []string{}
+	roles = append(roles, loginResponse.UserClaims...)
+
+	access, err := s.accessClaims(roles)
+	if err != nil {
+		s.logger.Errorf("error expanding permissions for user %s with error %v", loginResponse.Username, err)
+		return "", err
+	}
+
+	user, err := s.userRepo.GetById(repositories.AllTenants, loginResponse.UserId)
+	if err != nil {
+		return "", err
+	}
 
-	_, tokenString, err := s.tokenAuth.Encode(map[string]interface{}{
+	tenant, err := s.tenantClaims(user.OrganizationId)
+	if err != nil {
+		s.logger.Errorf("error locating organization for user %s with error %v", loginResponse.Username, err)
+		return "", err
+	}
+
+	session, err := s.sessionService.StartSession(ctx, loginResponse.UserId, authMethod)
+	if err != nil {
+		s.logger.Errorf("error starting session for user %s with error %v", loginResponse.Username, err)
+		return "", err
+	}
+
+	claims := map[string]interface{}{
+		"user_id":       loginResponse.UserId,
 		"username":      loginResponse.Username,
 		"email_address": loginResponse.EmailAddress,
-		"exp":           time.Now().Add(1 * time.Hour),
-		"issueed_at":    time.Now(),
-		"permissions":   permissions,
-	})
+		"sid":           session.SessionId,
+		"exp":           session.ExpiresAt,
+		"iat":           session.CreatedAt,
+		"issueed_at":    session.CreatedAt,
+	}
+	for key, value := range access {
+		claims[key] = value
+	}
+	for key, value := range tenant {
+		claims[key] = value
+	}
+
+	_, tokenString, err := s.tokenAuth.Encode(claims)
 
 	if err != nil {
 		return "", err
@@ -201,10 +686,24 @@ func (s *UserService) GenerateUserToken(loginResponse dtos.UserLoginResponseDto)
 	return tokenString, nil
 }
 
+// CustomJWTAuthVerifier accepts either an access token or an API key in the
+// access_token header.
 func (s *UserService) CustomJWTAuthVerifier(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tokenString := r.Header.Get("access_token")
 
+		if strings.HasPrefix(tokenString, domain.ApiKeyPrefix) {
+			claims, ok := s.apiKeyClaims(r.Context(), tokenString)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), tokenClaimsCtxKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 			return []byte(s.clientSecret), nil
 		})
@@ -236,8 +735,15 @@ func (s *UserService) CustomJWTAuthVerifier(next http.Handler) http.Handler {
 			return
 		}
 
+		claims := token.Claims.(jwt.MapClaims)
+		if !s.isTokenActive(claims) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		if token.Valid {
-			next.ServeHTTP(w, r)
+			ctx := context.WithValue(r.Context(), tokenClaimsCtxKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		} else {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -245,3 +751,345 @@ func (s *UserService) CustomJWTAuthVerifier(next http.Handler) http.Handler {
 		}
 	})
 }
+
+// isTokenActive rejects tokens whose user is no longer active or has moved
+// organization, whose tokens were revoked after this one was issued or whose
+// session has ended.
+func (s *UserService) isTokenActive(claims jwt.MapClaims) bool {
+	userId, ok := claims["user_id"].(float64)
+	if !ok {
+		return false
+	}
+
+	user, err := s.userRepo.GetById(repositories.AllTenants, uint(userId))
+	if err != nil {
+		return false
+	}
+
+	if user.Status != domain.AccountStatusActive {
+		return false
+	}
+
+	if !tenantMatches(claims, user.OrganizationId) {
+		return false
+	}
+
+	if user.TokensRevokedAt != nil {
+		issuedAt, ok := claims["iat"].(float64)
+		if !ok || int64(issuedAt) <= user.TokensRevokedAt.Unix() {
+			return false
+		}
+	}
+
+	sessionId, ok := claims["sid"].(string)
+	if !ok || !s.sessionService.IsSessionActive(user.ID, sessionId) {
+		return false
+	}
+
+	return true
+}
+
+// apiKeyClaims stands the key in for an access token, with the permissions
+// of the key's scopes the user still holds. Keys stop working with their
+// user's account, but are not ended by the user's tokens being revoked.
+func (s *UserService) apiKeyClaims(ctx context.Context, key string) (jwt.MapClaims, bool) {
+	apiKey, err := s.apiKeyRepo.GetByHash(hashApiKey(key))
+	if err != nil || !apiKey.IsActive(time.Now()) {
+		return nil, false
+	}
+
+	user, err := s.userRepo.GetById(repositories.AllTenants, apiKey.UserId)
+	if err != nil || user.Status != domain.AccountStatusActive {
+		return nil, false
+	}
+
+	tenant, err := s.tenantClaims(user.OrganizationId)
+	if err != nil {
+		return nil, false
+	}
+
+	claims, err := s.userClaimRepo.GetClaimsByUserId(user.ID)
+	if err != nil {
+		return nil, false
+	}
+
+	access, err := s.accessClaims(heldScopes(apiKey.Scopes, claims))
+	if err != nil {
+		return nil, false
+	}
+
+	// the repository logs a failure, and a key is not refused for want of
+	// its last use being recorded
+	_ = s.apiKeyRepo.RecordUse(apiKey.ID, helpers.RequestMetadataFromContext(ctx).IPAddress)
+
+	// numbers as float64, as they are in decoded tokens
+	keyClaims := jwt.MapClaims{
+		"user_id":       float64(user.ID),
+		"username":      user.Username,
+		"email_address": user.EmailAddress,
+		"api_key_id":    float64(apiKey.ID),
+	}
+	for key, value := range access {
+		keyClaims[key] = value
+	}
+	for key, value := range tenant {
+		keyClaims[key] = value
+	}
+
+	return keyClaims, true
+}
+
+// accessClaims are the claims listing the roles and the permissions they
+// grant, for other applications to check. Past maxTokenPermissions the
+// permissions are left out and marked omitted, to keep tokens small. The
+// service itself checks the roles the user holds when a request is made.
+func (s *UserService) accessClaims(roles []string) (map[string]interface{}, error) {
+	permissions, err := s.permissionRepo.GetByClaimNames(roles)
+	if err != nil {
+		return nil, err
+	}
+
+	access := map[string]interface{}{
+		"roles": stringsToInterfaces(roles),
+	}
+
+	if len(permissions) > maxTokenPermissions {
+		access["permissions_omitted"] = true
+	} else {
+		access["permissions"] = stringsToInterfaces(permissions)
+	}
+
+	return access, nil
+}
+
+// tenantClaims are the claims naming the organization a user belongs to,
+// none for users in no organization.
+func (s *UserService) tenantClaims(organizationId *uint) (map[string]interface{}, error) {
+	if organizationId == nil {
+		return nil, nil
+	}
+
+	organization, err := s.orgRepo.GetById(*organizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"tenant_id": float64(organization.ID),
+		"tenant":    organization.Slug,
+	}, nil
+}
+
+// tenantMatches reports whether the token was issued in the organization the
+// user belongs to now.
+func tenantMatches(claims jwt.MapClaims, organizationId *uint) bool {
+	tenantId, ok := claims["tenant_id"].(float64)
+	if !ok || organizationId == nil {
+		return !ok && organizationId == nil
+	}
+
+	return uint(tenantId) == *organizationId
+}
+
+// RequireSession refuses requests made with an API key, for changes to the
+// account and its credentials that need the user to have signed in.
+func (s *UserService) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ApiKeyIdFromContext(r.Context()); ok {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePlatform refuses requests from users in an organization, for what
+// spans every organization or configures the service itself.
+func (s *UserService) RequirePlatform(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := TenantIdFromContext(r.Context()); ok {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission refuses requests whose caller does not hold the
+// permission through one of their current roles. Only requests it lets through reach
+// users outside the caller's own organization.
+func (s *UserService) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := TokenClaimsFromContext(r.Context())
+			if !ok || !s.hasPermission(claims, permission) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), permissionGrantedCtxKey, true)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func TokenClaimsFromContext(ctx context.Context) (jwt.MapClaims, bool) {
+	claims, ok := ctx.Value(tokenClaimsCtxKey).(jwt.MapClaims)
+	return claims, ok
+}
+
+func UserIdFromContext(ctx context.Context) (uint, bool) {
+	claims, ok := TokenClaimsFromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+
+	userId, ok := claims["user_id"].(float64)
+	return uint(userId), ok
+}
+
+func UsernameFromContext(ctx context.Context) string {
+	claims, ok := TokenClaimsFromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	username, _ := claims["username"].(string)
+	return username
+}
+
+func SessionIdFromContext(ctx context.Context) string {
+	claims, ok := TokenClaimsFromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	sessionId, _ := claims["sid"].(string)
+	return sessionId
+}
+
+// ApiKeyIdFromContext reports the API key the request was made with, if any.
+func ApiKeyIdFromContext(ctx context.Context) (uint, bool) {
+	claims, ok := TokenClaimsFromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+
+	keyId, ok := claims["api_key_id"].(float64)
+	return uint(keyId), ok
+}
+
+// TenantIdFromContext reports the organization the request's user belongs
+// to, if any.
+func TenantIdFromContext(ctx context.Context) (uint, bool) {
+	claims, ok := TokenClaimsFromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+
+	tenantId, ok := claims["tenant_id"].(float64)
+	return uint(tenantId), ok
+}
+
+// tenantScope confines a request from a user in an organization to its
+// users, and one from a user in no organization to the users in none. Only
+// platform users granted the permission the route requires, and work the
+// service does without a token such as operator commands and sign in, are
+// not confined. Callers bound to an organization by other means, such as
+// SCIM clients, set the scope with withTenantScope.
+func tenantScope(ctx context.Context) repositories.TenantScope {
+	if scope, ok := ctx.Value(tenantScopeCtxKey).(repositories.TenantScope); ok {
+		return scope
+	}
+
+	if tenantId, ok := TenantIdFromContext(ctx); ok {
+		return repositories.InTenant(&tenantId)
+	}
+
+	if _, ok := TokenClaimsFromContext(ctx); ok {
+		if granted, _ := ctx.Value(permissionGrantedCtxKey).(bool); !granted {
+			return repositories.InTenant(nil)
+		}
+	}
+
+	return repositories.AllTenants
+}
+
+func withTenantScope(ctx context.Context, scope repositories.TenantScope) context.Context {
+	return context.WithValue(ctx, tenantScopeCtxKey, scope)
+}
+
+// hasPermission checks the permission against the roles the caller holds
+// now rather than the ones the token was issued with, so revoking a claim, a
+// group membership or a role's permission takes effect on the next request.
+func (s *UserService) hasPermission(claims jwt.MapClaims, permission string) bool {
+	roles, err := s.currentRoles(claims)
+	if err != nil {
+		return false
+	}
+
+	permissions, err := s.permissionRepo.GetByClaimNames(roles)
+	if err != nil {
+		s.logger.Errorf("error expanding permissions of roles %v with error %v", roles, err)
+		return false
+	}
+
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// currentRoles are the user's effective claims. An API key's roles were
+// resolved from them when the key was checked, so they are used as they are.
+func (s *UserService) currentRoles(claims jwt.MapClaims) ([]string, error) {
+	if _, ok := claims["api_key_id"].(float64); ok {
+		roles := []string{}
+		if values, ok := claims["roles"].([]interface{}); ok {
+			for _, value := range values {
+				if role, ok := value.(string); ok {
+					roles = append(roles, role)
+				}
+			}
+		}
+
+		return roles, nil
+	}
+
+	userId, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, errors.New("token names no user")
+	}
+
+	return s.userClaimRepo.GetClaimsByUserId(uint(userId))
+}
+
+func containsClaim(value interface{}, want string) bool {
+	values, ok := value.([]interface{})
+	if !ok {
+		return false
+	}
+
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stringsToInterfaces builds claim values shaped as decoded tokens have them.
+func stringsToInterfaces(values []string) []interface{} {
+	resp := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		resp = append(resp, value)
+	}
+
+	return resp
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/repositories"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+// newPermissionCheckService answers the queries permission checks make from
+// the claims the user holds and the permissions of each role, without a
+// database. It records the queries run.
+func newPermissionCheckService(t *testing.T, userClaims []string, rolePermissions map[string][]string) (*UserService, *[]string) {
+	t.Helper()
+
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatalf("opening dry run database: %v", err)
+	}
+
+	queries := []string{}
+	db.Callback().Query().After("gorm:query").Register("test:answer", func(tx *gorm.DB) {
+		sql := tx.Statement.SQL.String()
+		queries = append(queries, sql)
+
+		dest, ok := tx.Statement.Dest.(*[]string)
+		if !ok {
+			return
+		}
+
+		if !strings.Contains(sql, "role_permissions") {
+			*dest = userClaims
+			return
+		}
+
+		// the roles are bound one by one in the IN list
+		for _, v := range tx.Statement.Vars {
+			if role, ok := v.(string); ok {
+				*dest = append(*dest, rolePermissions[role]...)
+			}
+		}
+	})
+
+	serviceCfg := &config.ServiceConfig{Db: db, Logger: zap.NewNop().Sugar()}
+	s := &UserService{
+		userClaimRepo:  repositories.InitUserClaimRepository(serviceCfg),
+		permissionRepo: repositories.InitPermissionRepository(serviceCfg),
+		logger:         serviceCfg.Logger,
+	}
+
+	return s, &queries
+}
+
+func TestHasPermission(t *testing.T) {
+	rolePermissions := map[string][]string{
+		domain.AdministratorClaim: {domain.PermissionUsersRead, domain.PermissionUsersWrite},
+		"Auditor":                 {domain.PermissionAuditRead},
+	}
+
+	tests := []struct {
+		name            string
+		userClaims      []string
+		claims          jwt.MapClaims
+		want            bool
+		wantClaimsQuery bool
+	}{
+		{
+			name:       "role the user holds",
+			userClaims: []string{domain.UserClaimName, domain.AdministratorClaim},
+			claims: jwt.MapClaims{
+				"user_id":     float64(1),
+				"roles":       []interface{}{domain.UserClaimName, domain.AdministratorClaim},
+				"permissions": []interface{}{domain.PermissionUsersRead, domain.PermissionUsersWrite},
+			},
+			want:            true,
+			wantClaimsQuery: true,
+		},
+		{
+			name:       "role revoked since the token was issued",
+			userClaims: []string{domain.UserClaimName},
+			claims: jwt.MapClaims{
+				"user_id":     float64(1),
+				"roles":       []interface{}{domain.UserClaimName, domain.AdministratorClaim},
+				"permissions": []interface{}{domain.PermissionUsersRead, domain.PermissionUsersWrite},
+			},
+			wantClaimsQuery: true,
+		},
+		{
+			name:       "role granted since the token was issued",
+			userClaims: []string{domain.UserClaimName, domain.AdministratorClaim},
+			claims: jwt.MapClaims{
+				"user_id":     float64(1),
+				"roles":       []interface{}{domain.UserClaimName},
+				"permissions": []interface{}{},
+			},
+			want:            true,
+			wantClaimsQuery: true,
+		},
+		{
+			name:       "permissions left out of the token",
+			userClaims: []string{domain.AdministratorClaim},
+			claims: jwt.MapClaims{
+				"user_id":             float64(1),
+				"roles":               []interface{}{domain.AdministratorClaim},
+				"permissions_omitted": true,
+			},
+			want:            true,
+			wantClaimsQuery: true,
+		},
+		{
+			name:       "token naming no user",
+			userClaims: []string{domain.AdministratorClaim},
+			claims: jwt.MapClaims{
+				"roles":       []interface{}{domain.AdministratorClaim},
+				"permissions": []interface{}{domain.PermissionUsersRead},
+			},
+		},
+		{
+			name:       "API key scoped to the role",
+			userClaims: []string{domain.AdministratorClaim},
+			claims: jwt.MapClaims{
+				"user_id":    float64(1),
+				"api_key_id": float64(3),
+				"roles":      []interface{}{domain.AdministratorClaim},
+			},
+			want: true,
+		},
+		{
+			name:       "API key not scoped to the role",
+			userClaims: []string{domain.AdministratorClaim, "Auditor"},
+			claims: jwt.MapClaims{
+				"user_id":    float64(1),
+				"api_key_id": float64(3),
+				"roles":      []interface{}{"Auditor"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, queries := newPermissionCheckService(t, tt.userClaims, rolePermissions)
+
+			if got := s.hasPermission(tt.claims, domain.PermissionUsersRead); got != tt.want {
+				t.Errorf("hasPermission() = %v, want %v", got, tt.want)
+			}
+
+			claimsQueried := false
+			for _, query := range *queries {
+				if !strings.Contains(query, "role_permissions") {
+					claimsQueried = true
+				}
+			}
+			if claimsQueried != tt.wantClaimsQuery {
+				t.Errorf("user's claims looked up = %v, want %v", claimsQueried, tt.wantClaimsQuery)
+			}
+		})
+	}
+}
+
+func TestTenantScope(t *testing.T) {
+	organizationId := uint(5)
+	scimOrganizationId := uint(8)
+
+	tests := []struct {
+		name       string
+		userClaims []string
+		claims     jwt.MapClaims
+		scope      *repositories.TenantScope
+		want       repositories.TenantScope
+	}{
+		{
+			name:       "platform user granted the permission",
+			userClaims: []string{domain.AdministratorClaim},
+			claims:     jwt.MapClaims{"user_id": float64(1)},
+			want:       repositories.AllTenants,
+		},
+		{
+			name:   "platform user without the permission",
+			claims: jwt.MapClaims{"user_id": float64(1)},
+			want:   repositories.InTenant(nil),
+		},
+		{
+			name:       "organization user granted the permission",
+			userClaims: []string{domain.AdministratorClaim},
+			claims:     jwt.MapClaims{"user_id": float64(1), "tenant_id": float64(organizationId)},
+			want:       repositories.InTenant(&organizationId),
+		},
+		{
+			name:   "organization user without the permission",
+			claims: jwt.MapClaims{"user_id": float64(1), "tenant_id": float64(organizationId)},
+			want:   repositories.InTenant(&organizationId),
+		},
+		{
+			name: "no token",
+			want: repositories.AllTenants,
+		},
+		{
+			name:  "scope set by the caller",
+			scope: func() *repositories.TenantScope { s := repositories.InTenant(&scimOrganizationId); return &s }(),
+			want:  repositories.InTenant(&scimOrganizationId),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newPermissionCheckService(t, tt.userClaims, map[string][]string{
+				domain.AdministratorClaim: {domain.PermissionUsersRead},
+			})
+
+			ctx := context.Background()
+			if tt.claims != nil {
+				ctx = context.WithValue(ctx, tokenClaimsCtxKey, tt.claims)
+			}
+			if tt.scope != nil {
+				ctx = withTenantScope(ctx, *tt.scope)
+			}
+
+			// the scope of a route requiring the permission, or of one that
+			// does not when the permission is refused
+			got := tenantScope(ctx)
+			handler := s.RequirePermission(domain.PermissionUsersRead)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = tenantScope(r.Context())
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil).WithContext(ctx))
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tenantScope() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/repositories"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	webhookBatchSize    = 100
+	webhookInitialDelay = 30 * time.Second
+	webhookMaxDelay     = 6 * time.Hour
+
+	webhookUpdateAttempts = 3
+	webhookUpdateDelay    = time.Second
+
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// WebhookDispatcherJob fans new outbox events out into deliveries and sends
+// any that are due, retrying failures with exponential backoff.
+type WebhookDispatcherJob struct {
+	outboxRepo  *repositories.OutboxRepository
+	webhookRepo *repositories.WebhookRepository
+	client      *http.Client
+	interval    time.Duration
+	maxAttempts int
+	logger      *zap.SugaredLogger
+}
+
+func InitWebhookDispatcherJob(serviceCfg *config.ServiceConfig) *WebhookDispatcherJob {
+	return &WebhookDispatcherJob{
+		outboxRepo:  repositories.InitOutboxRepository(serviceCfg),
+		webhookRepo: repositories.InitWebhookRepository(serviceCfg),
+		client:      &http.Client{Timeout: serviceCfg.WebhookTimeout},
+		interval:    serviceCfg.WebhookDispatchInterval,
+		maxAttempts: serviceCfg.WebhookMaxAttempts,
+		logger:      serviceCfg.Logger,
+	}
+}
+
+func (j *WebhookDispatcherJob) Start(ctx context.Context) {
+	if j.interval <= 0 {
+		j.logger.Warn("webhook dispatcher disabled as no dispatch interval is configured")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			j.RunOnce(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce returns the number of deliveries attempted.
+func (j *WebhookDispatcherJob) RunOnce(ctx context.Context) int {
+	for {
+		dispatched, err := j.outboxRepo.DispatchPending(webhookBatchSize, func(tx *gorm.DB, events []domain.OutboxEvent) error {
+			return j.webhookRepo.AddDeliveries(tx, events)
+		})
+		if err != nil || dispatched < webhookBatchSize {
+			break
+		}
+	}
+
+	// a delivery is leased for longer than a full round of sends can take
+	lease := j.client.Timeout*webhookBatchSize + time.Minute
+
+	deliveries, err := j.webhookRepo.ClaimDueDeliveries(webhookBatchSize, lease)
+	if err != nil {
+		return 0
+	}
+
+	attempted := 0
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			break
+		}
+
+		attempted++
+		if err := j.deliver(ctx, delivery); err != nil {
+			// the rest are sent once their lease runs out, rather than sent
+			// now with nowhere to record the outcome
+			break
+		}
+	}
+
+	return attempted
+}
+
+// deliver sends the delivery and records the outcome. An outcome that cannot
+// be recorded leaves the delivery leased, so it is sent again once the lease
+// runs out; receivers can tell a repeat by its X-Webhook-Delivery header.
+func (j *WebhookDispatcherJob) deliver(ctx context.Context, delivery domain.WebhookDelivery) error {
+	now := time.Now()
+	statusCode, err := j.send(ctx, delivery)
+	delivery = j.recordAttempt(delivery, now, statusCode, err)
+
+	for attempt := 1; ; attempt++ {
+		err := j.webhookRepo.UpdateDelivery(delivery)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= webhookUpdateAttempts {
+			j.logger.Errorf("unable to record the outcome of webhook delivery id %d, status %s after %d attempts, with error %v",
+				delivery.ID, delivery.Status, delivery.Attempts, err)
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(webhookUpdateDelay):
+		}
+	}
+}
+
+// recordAttempt applies the outcome of an attempt made at now, scheduling a
+// retry with backoff after a failure until maxAttempts is reached.
+func (j *WebhookDispatcherJob) recordAttempt(delivery domain.WebhookDelivery, now time.Time, statusCode int, err error) domain.WebhookDelivery {
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = statusCode
+
+	switch {
+	case err == nil:
+		delivery.Status = domain.WebhookDeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	case delivery.Attempts >= j.maxAttempts:
+		delivery.Status = domain.WebhookDeliveryFailed
+		delivery.LastError = err.Error()
+		j.logger.Warnf("giving up on webhook delivery id %d after %d attempts with error %v", delivery.ID, delivery.Attempts, err)
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(webhookBackoff(delivery.Attempts))
+	}
+
+	return delivery
+}
+
+func (j *WebhookDispatcherJob) send(ctx context.Context, delivery domain.WebhookDelivery) (int, error) {
+	subscription, err := j.webhookRepo.GetSubscriptionById(delivery.SubscriptionId)
+	if err != nil {
+		return 0, fmt.Errorf("loading subscription: %v", err)
+	}
+
+	event, err := j.outboxRepo.GetById(delivery.OutboxEventId)
+	if err != nil {
+		return 0, fmt.Errorf("loading event: %v", err)
+	}
+
+	body, err := json.Marshal(newEventDto(event))
+	if err != nil {
+		return 0, err
+	}
+
+	return j.post(ctx, subscription, event.EventType, delivery.ID, body)
+}
+
+// post sends the signed body to the subscription, reporting a response
+// outside 2xx as an error.
+func (j *WebhookDispatcherJob) post(ctx context.Context, subscription domain.WebhookSubscription, eventType string, deliveryId uint, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", eventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(deliveryId), 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(subscription.Secret, timestamp, body))
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload returns the signature header value, an HMAC-SHA256 of
+// the timestamp and body joined by a full stop. Receivers should recompute it
+// and reject old timestamps to guard against replays.
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookInitialDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= webhookMaxDelay {
+			return webhookMaxDelay
+		}
+	}
+
+	return delay
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"authservice/src/domain"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestWebhookDispatcherJob(maxAttempts int) *WebhookDispatcherJob {
+	return &WebhookDispatcherJob{
+		client:      &http.Client{Timeout: 5 * time.Second},
+		maxAttempts: maxAttempts,
+		logger:      zap.NewNop().Sugar(),
+	}
+}
+
+func TestWebhookPostSignsPayload(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantStatus int
+		wantErr    bool
+	}{
+		{name: "accepted", status: http.StatusOK, wantStatus: http.StatusOK},
+		{name: "no content", status: http.StatusNoContent, wantStatus: http.StatusNoContent},
+		{name: "server error", status: http.StatusInternalServerError, wantStatus: http.StatusInternalServerError, wantErr: true},
+		{name: "redirect", status: http.StatusMovedPermanently, wantStatus: http.StatusMovedPermanently, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte(`{"EventType":"user.registered"}`)
+			secret := "subscription-secret"
+
+			var got *http.Request
+			var gotBody []byte
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				gotBody, _ = io.ReadAll(r.Body)
+				w.WriteHeader(tt.status)
+			}))
+			defer receiver.Close()
+
+			job := newTestWebhookDispatcherJob(3)
+			subscription := domain.WebhookSubscription{Url: receiver.URL, Secret: secret}
+			subscription.ID = 7
+
+			status, err := job.post(context.Background(), subscription, domain.EventUserRegistered, 42, body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("post() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if status != tt.wantStatus {
+				t.Fatalf("post() status = %d, want %d", status, tt.wantStatus)
+			}
+
+			if got.Method != http.MethodPost {
+				t.Errorf("method = %s, want POST", got.Method)
+			}
+			if string(gotBody) != string(body) {
+				t.Errorf("body = %s, want %s", gotBody, body)
+			}
+			if got.Header.Get("X-Webhook-Event") != domain.EventUserRegistered {
+				t.Errorf("X-Webhook-Event = %q", got.Header.Get("X-Webhook-Event"))
+			}
+			if got.Header.Get("X-Webhook-Delivery") != "42" {
+				t.Errorf("X-Webhook-Delivery = %q, want 42", got.Header.Get("X-Webhook-Delivery"))
+			}
+
+			signature := got.Header.Get(WebhookSignatureHeader)
+			timestamp := strings.TrimPrefix(strings.Split(signature, ",")[0], "t=")
+			if want := SignWebhookPayload(secret, timestamp, gotBody); signature != want {
+				t.Errorf("signature = %q, want %q", signature, want)
+			}
+		})
+	}
+}
+
+func TestWebhookPostUnreachableReceiver(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := receiver.URL
+	receiver.Close()
+
+	job := newTestWebhookDispatcherJob(3)
+	status, err := job.post(context.Background(), domain.WebhookSubscription{Url: url}, domain.EventUserRegistered, 1, []byte("{}"))
+	if err == nil {
+		t.Fatal("post() to a closed receiver returned no error")
+	}
+	if status != 0 {
+		t.Errorf("status = %d, want 0", status)
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		{
+			name:      "known vector",
+			secret:    "secret",
+			timestamp: "1700000000",
+			body:      `{"a":1}`,
+			want:      "t=1700000000,v1=" + hmacHex("secret", `1700000000.{"a":1}`),
+		},
+		{
+			name:      "empty body",
+			secret:    "other",
+			timestamp: "1",
+			body:      "",
+			want:      "t=1,v1=" + hmacHex("other", "1."),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignWebhookPayload(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("SignWebhookPayload() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 3, want: 2 * time.Minute},
+		{attempts: 10, want: 512 * 30 * time.Second},
+		{attempts: 11, want: webhookMaxDelay},
+		{attempts: 50, want: webhookMaxDelay},
+	}
+
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempts); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookRecordAttempt(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	failure := errors.New("receiver responded with status 500")
+
+	tests := []struct {
+		name            string
+		attempts        int
+		statusCode      int
+		err             error
+		wantStatus      string
+		wantNextAttempt time.Time
+		wantLastError   string
+	}{
+		{
+			name:       "delivered",
+			statusCode: http.StatusOK,
+			wantStatus: domain.WebhookDeliveryDelivered,
+		},
+		{
+			name:            "first failure is retried",
+			statusCode:      http.StatusInternalServerError,
+			err:             failure,
+			wantStatus:      domain.WebhookDeliveryPending,
+			wantNextAttempt: now.Add(30 * time.Second),
+			wantLastError:   failure.Error(),
+		},
+		{
+			name:            "later failure backs off",
+			attempts:        3,
+			err:             failure,
+			wantStatus:      domain.WebhookDeliveryPending,
+			wantNextAttempt: now.Add(4 * time.Minute),
+			wantLastError:   failure.Error(),
+		},
+		{
+			name:          "last attempt gives up",
+			attempts:      4,
+			err:           failure,
+			wantStatus:    domain.WebhookDeliveryFailed,
+			wantLastError: failure.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newTestWebhookDispatcherJob(5)
+			delivery := domain.WebhookDelivery{
+				Status:    domain.WebhookDeliveryPending,
+				Attempts:  tt.attempts,
+				LastError: "previous error",
+			}
+
+			got := job.recordAttempt(delivery, now, tt.statusCode, tt.err)
+
+			if got.Status != tt.wantStatus {
+				t.Errorf("Status = %s, want %s", got.Status, tt.wantStatus)
+			}
+			if got.Attempts != tt.attempts+1 {
+				t.Errorf("Attempts = %d, want %d", got.Attempts, tt.attempts+1)
+			}
+			if got.LastAttemptAt == nil || !got.LastAttemptAt.Equal(now) {
+				t.Errorf("LastAttemptAt = %v, want %v", got.LastAttemptAt, now)
+			}
+			if got.ResponseStatus != tt.statusCode {
+				t.Errorf("ResponseStatus = %d, want %d", got.ResponseStatus, tt.statusCode)
+			}
+			if got.LastError != tt.wantLastError {
+				t.Errorf("LastError = %q, want %q", got.LastError, tt.wantLastError)
+			}
+			if !tt.wantNextAttempt.IsZero() && !got.NextAttemptAt.Equal(tt.wantNextAttempt) {
+				t.Errorf("NextAttemptAt = %v, want %v", got.NextAttemptAt, tt.wantNextAttempt)
+			}
+			if (tt.wantStatus == domain.WebhookDeliveryDelivered) != (got.DeliveredAt != nil) {
+				t.Errorf("DeliveredAt = %v for status %s", got.DeliveredAt, got.Status)
+			}
+		})
+	}
+}
+
+func hmacHex(secret, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
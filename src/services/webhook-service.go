@@ -0,0 +1,165 @@
+package services
+
+import (
+	"authservice/src/config"
+	"authservice/src/domain"
+	"authservice/src/dtos"
+	"authservice/src/helpers"
+	"authservice/src/repositories"
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWebhookDeliveryLimit = 50
+	maxWebhookDeliveryLimit     = 200
+)
+
+type WebhookService struct {
+	webhookRepo  *repositories.WebhookRepository
+	auditService *AuditService
+	logger       *zap.SugaredLogger
+}
+
+func InitWebhookService(serviceCfg *config.ServiceConfig) *WebhookService {
+	return &WebhookService{
+		webhookRepo:  repositories.InitWebhookRepository(serviceCfg),
+		auditService: InitAuditService(serviceCfg),
+		logger:       serviceCfg.Logger,
+	}
+}
+
+// CreateSubscription generates a signing secret when none is supplied. The
+// secret is returned here and never again.
+func (s *WebhookService) CreateSubscription(ctx context.Context, create dtos.WebhookSubscriptionCreateDto) (dtos.WebhookSubscriptionDto, error) {
+	target, err := url.Parse(create.Url)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || len(target.Host) == 0 {
+		return dtos.WebhookSubscriptionDto{}, ErrInvalidWebhookUrl
+	}
+
+	if len(create.EventTypes) == 0 {
+		return dtos.WebhookSubscriptionDto{}, fmt.Errorf("%w: at least one event type must be supplied", ErrInvalidWebhookEvent)
+	}
+
+	for _, eventType := range create.EventTypes {
+		if !isWebhookEventType(eventType) {
+			return dtos.WebhookSubscriptionDto{}, fmt.Errorf("%w: %s", ErrInvalidWebhookEvent, eventType)
+		}
+	}
+
+	secret := create.Secret
+	if len(secret) == 0 {
+		if secret, err = helpers.GenerateRandomToken(32); err != nil {
+			return dtos.WebhookSubscriptionDto{}, err
+		}
+	}
+
+	subscription, err := s.webhookRepo.AddSubscription(domain.WebhookSubscription{
+		Url:        target.String(),
+		Secret:     secret,
+		EventTypes: create.EventTypes,
+	})
+	if err != nil {
+		return dtos.WebhookSubscriptionDto{}, err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType: domain.AuditWebhookCreated,
+		Target:    webhookTarget(subscription.ID),
+	}, map[string]interface{}{"url": subscription.Url, "event_types": subscription.EventTypes})
+
+	resp := newWebhookSubscriptionDto(subscription)
+	resp.Secret = secret
+	return resp, nil
+}
+
+func (s *WebhookService) GetSubscriptions() ([]dtos.WebhookSubscriptionDto, error) {
+	subscriptions, err := s.webhookRepo.GetSubscriptions()
+	if err != nil {
+		return []dtos.WebhookSubscriptionDto{}, err
+	}
+
+	resp := []dtos.WebhookSubscriptionDto{}
+	for _, subscription := range subscriptions {
+		resp = append(resp, newWebhookSubscriptionDto(subscription))
+	}
+
+	return resp, nil
+}
+
+func (s *WebhookService) DeleteSubscription(ctx context.Context, subscriptionId uint) error {
+	subscription, err := s.webhookRepo.GetSubscriptionById(subscriptionId)
+	if err != nil {
+		return notFoundOr(err, ErrWebhookNotFound)
+	}
+
+	if err := s.webhookRepo.DeleteSubscription(subscription.ID); err != nil {
+		return err
+	}
+
+	s.auditService.Record(ctx, domain.AuditEvent{
+		EventType: domain.AuditWebhookDeleted,
+		Target:    webhookTarget(subscription.ID),
+	}, map[string]interface{}{"url": subscription.Url})
+
+	return nil
+}
+
+// GetDeliveries pages through the delivery log newest first, the cursor being
+// the id of the last delivery on the previous page.
+func (s *WebhookService) GetDeliveries(subscriptionId uint, status string, beforeId uint, limit int) (dtos.WebhookDeliveryListResponseDto, error) {
+	if _, err := s.webhookRepo.GetSubscriptionById(subscriptionId); err != nil {
+		return dtos.WebhookDeliveryListResponseDto{}, notFoundOr(err, ErrWebhookNotFound)
+	}
+
+	if limit <= 0 {
+		limit = defaultWebhookDeliveryLimit
+	}
+
+	if limit > maxWebhookDeliveryLimit {
+		limit = maxWebhookDeliveryLimit
+	}
+
+	deliveries, err := s.webhookRepo.GetDeliveries(subscriptionId, status, beforeId, limit+1)
+	if err != nil {
+		return dtos.WebhookDeliveryListResponseDto{}, err
+	}
+
+	resp := dtos.WebhookDeliveryListResponseDto{
+		Deliveries: deliveries,
+	}
+
+	if len(deliveries) > limit {
+		resp.Deliveries = deliveries[:limit]
+		resp.NextCursor = strconv.FormatUint(uint64(resp.Deliveries[limit-1].ID), 10)
+	}
+
+	return resp, nil
+}
+
+func isWebhookEventType(eventType string) bool {
+	for _, t := range domain.WebhookEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newWebhookSubscriptionDto(subscription domain.WebhookSubscription) dtos.WebhookSubscriptionDto {
+	return dtos.WebhookSubscriptionDto{
+		WebhookId:  subscription.ID,
+		Url:        subscription.Url,
+		EventTypes: subscription.EventTypes,
+		CreatedAt:  subscription.CreatedAt,
+	}
+}
+
+func webhookTarget(subscriptionId uint) string {
+	return fmt.Sprintf("webhook:%d", subscriptionId)
+}